@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"ecomm/ecomm-api/jobs"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/storer"
+	"log"
+	"time"
+)
+
+type pruneJobsArgs struct {
+	KeepDays int `json:"keep_days"`
+}
+
+var (
+	// Рейтинг пересчитывается при модерации отзыва, ночной пересчет исправляет расхождения
+	recomputeRatingsJob = jobs.Type[struct{}]{Name: "ratings.recompute", MaxAttempts: 3}
+	pruneJobsJob        = jobs.Type[pruneJobsArgs]{Name: "jobs.prune", MaxAttempts: 3}
+	// Возвраты, которые не удалось провести через шлюз сразу после коммита
+	settleRefundsJob = jobs.Type[struct{}]{Name: "refunds.settle", MaxAttempts: 1}
+)
+
+// registerJobs подключает обработчики фоновых задач и расписание.
+func registerJobs(pool *jobs.Pool, postgres *storer.PostgresStorer, srv *service.Service) error {
+	jobs.Handle(pool, recomputeRatingsJob, func(ctx context.Context, _ struct{}) error {
+		n, err := postgres.RecomputeProductRatings(ctx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("jobs: fixed ratings of %d products", n)
+		}
+		return nil
+	})
+	jobs.Handle(pool, pruneJobsJob, func(ctx context.Context, args pruneJobsArgs) error {
+		_, err := postgres.DeleteFinishedJobs(ctx, time.Now().AddDate(0, 0, -args.KeepDays))
+		return err
+	})
+
+	jobs.Handle(pool, settleRefundsJob, func(ctx context.Context, _ struct{}) error {
+		n, err := srv.SettlePendingRefunds(ctx)
+		if n > 0 {
+			log.Printf("jobs: settled %d pending refunds", n)
+		}
+		return err
+	})
+
+	if err := jobs.Cron(pool, "* * * * *", settleRefundsJob, struct{}{}); err != nil {
+		return err
+	}
+	if err := jobs.Cron(pool, "30 3 * * *", recomputeRatingsJob, struct{}{}); err != nil {
+		return err
+	}
+	return jobs.Cron(pool, "0 4 * * *", pruneJobsJob, pruneJobsArgs{KeepDays: 7})
+}
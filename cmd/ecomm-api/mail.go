@@ -0,0 +1,42 @@
+package main
+
+import (
+	"ecomm/ecomm-api/notifications"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+// newMailer выбирает SMTP, если задан SMTP_HOST, иначе письма складываются в MAIL_DIR.
+func newMailer() (notifications.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "ecomm <no-reply@localhost>"
+	}
+
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		mailDir := os.Getenv("MAIL_DIR")
+		if mailDir == "" {
+			mailDir = "data/mail"
+		}
+		log.Printf("SMTP_HOST is not set, writing emails to %s", mailDir)
+		return notifications.NewFileMailer(mailDir, from)
+	}
+
+	port := 587
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		var err error
+		if port, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
+		}
+	}
+	return notifications.NewSMTPMailer(notifications.SMTPConfig{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}), nil
+}
@@ -1,24 +1,176 @@
 package main
 
 import (
+	"context"
 	"ecomm/db"
+	"ecomm/domain"
+	"ecomm/ecomm-api/blobstore"
+	"ecomm/ecomm-api/grpcapi"
 	"ecomm/ecomm-api/handler"
+	"ecomm/ecomm-api/jobs"
+	"ecomm/ecomm-api/notifications"
+	"ecomm/ecomm-api/outbox"
+	"ecomm/ecomm-api/payments"
 	"ecomm/ecomm-api/service"
 	"ecomm/ecomm-api/storer"
+	"ecomm/ecomm-api/token"
+	"ecomm/ecomm-api/webhooks"
+	"errors"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout - сколько ждать выполняющиеся фоновые задачи при остановке.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	db, err := db.NewDatabase()
 	if err != nil {
-		log.Fatal("error opening database: %v", err)
+		log.Fatalf("error opening database: %v", err)
 	}
 	defer db.Close()
 	log.Println("successfully connected to database")
 
+	blobDir := os.Getenv("BLOB_DIR")
+	if blobDir == "" {
+		blobDir = "data/blobs"
+	}
+	blobs, err := blobstore.NewLocalStore(blobDir)
+	if err != nil {
+		log.Fatalf("error opening blob store: %v", err)
+	}
+
 	postgres := storer.NewPostgresStorer(db.GetDB())
-	srv := service.NewService(postgres)
-	hdl := handler.NewHandler(srv)
-	handler.RegisterRoutes(hdl)
-	handler.Start(":8080")
+	// Настоящий шлюз пока не подключён - деньги "списывает" детерминированный фейк
+	srv := service.NewService(postgres, payments.NewFakeProvider(), blobs)
+	webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		// Без секрета любой может подделать вебхук и отметить заказ оплаченным
+		log.Fatal("PAYMENT_WEBHOOK_SECRET is not set")
+	}
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		// Известным секретом любой подпишет токен администратора
+		log.Fatal("JWT_SECRET is not set")
+	}
+	tokenMaker := token.NewJWTMaker(jwtSecret)
+
+	// Пока внешнего брокера нет, события из outbox пишутся в файл
+	outboxFile := os.Getenv("OUTBOX_FILE")
+	if outboxFile == "" {
+		outboxFile = "data/outbox/events.jsonl"
+	}
+	eventsFile, err := outbox.NewFilePublisher(outboxFile)
+	if err != nil {
+		log.Fatalf("error opening outbox publisher: %v", err)
+	}
+	defer eventsFile.Close()
+	// Вебхуки партнеров получают те же события: relay только ставит доставки в очередь,
+	// а запросы отправляет dispatcher со своими повторами
+	dispatcher := webhooks.NewDispatcher(postgres, nil, webhooks.DefaultPolicy)
+
+	// Письма покупателям ставятся в очередь задач по событиям заказа, то есть уже после коммита:
+	// ошибка почты откладывает письмо, но не откатывает заказ
+	mailer, err := newMailer()
+	if err != nil {
+		log.Fatalf("error creating mailer: %v", err)
+	}
+	shopName := os.Getenv("SHOP_NAME")
+	if shopName == "" {
+		shopName = "ecomm"
+	}
+	shopURL := os.Getenv("SHOP_URL")
+	if shopURL == "" {
+		shopURL = "http://localhost:8080"
+	}
+	notifier, err := notifications.NewNotifier(postgres, mailer, notifications.Config{ShopName: shopName, ShopURL: shopURL})
+	if err != nil {
+		log.Fatalf("error creating notifier: %v", err)
+	}
+
+	events := outbox.NewInProcessPublisher()
+	events.Subscribe(eventsFile.Publish)
+	events.Subscribe(dispatcher.Enqueue)
+	events.Subscribe(notifier.Enqueue, domain.EventOrderCreated, domain.EventOrderShipped, domain.EventOrderCancelled)
+	// Relay и dispatcher пишут в eventsFile и db, поэтому их ждут до срабатывания defer
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		outbox.NewRelay(postgres, events, outbox.DefaultBatchSize, outbox.DefaultPollInterval).Run(ctx)
+	}()
+	go func() {
+		defer background.Done()
+		dispatcher.Run(ctx)
+	}()
+
+	workers := jobs.DefaultWorkers
+	if value := os.Getenv("JOB_WORKERS"); value != "" {
+		if workers, err = strconv.Atoi(value); err != nil {
+			log.Fatalf("invalid JOB_WORKERS: %v", err)
+		}
+	}
+	pool := jobs.NewPool(postgres, workers, jobs.DefaultPollInterval)
+	if err := registerJobs(pool, postgres, srv); err != nil {
+		log.Fatalf("error registering jobs: %v", err)
+	}
+	notifier.Register(pool)
+	pool.Start()
+
+	// gRPC для внутренних сервисов работает рядом с REST и использует тот же Service
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":9090"
+	}
+	listener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		log.Fatalf("error listening for gRPC: %v", err)
+	}
+	var grpcReflection bool
+	if value := os.Getenv("GRPC_REFLECTION"); value != "" {
+		if grpcReflection, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("invalid GRPC_REFLECTION: %v", err)
+		}
+	}
+	grpcServer := grpcapi.NewServer(srv, tokenMaker, grpcReflection)
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatalf("error serving gRPC: %v", err)
+		}
+	}()
+	log.Printf("gRPC server listening on %s", grpcAddr)
+
+	hdl := handler.NewHandler(srv,
+		payments.NewWebhookVerifier([]byte(webhookSecret), 5*time.Minute),
+		tokenMaker)
+	httpServer := &http.Server{Addr: ":8080", Handler: handler.RegisterRoutes(hdl)}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("error serving HTTP: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// Сначала дожидаемся начатых запросов, новые уже не принимаются
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP requests interrupted: %v", err)
+	}
+	grpcServer.GracefulStop()
+	if err := pool.Stop(shutdownCtx); err != nil {
+		log.Printf("background jobs interrupted: %v", err)
+	}
+	background.Wait()
 }
@@ -0,0 +1,189 @@
+// ecomm - административная утилита магазина. Работает через service, как и API,
+// поэтому проверки и побочные эффекты (возврат денег при отмене заказа и т.п.) те же.
+//
+//	ecomm [-output table|json] <command> <subcommand> [flags]
+package main
+
+import (
+	"context"
+	"ecomm/db"
+	"ecomm/ecomm-api/blobstore"
+	"ecomm/ecomm-api/payments"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/storer"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// app - зависимости команд. service и database создаются в main, тесты подставляют свои.
+// storer нужен только seed: генератор пишет в базу в обход проверок сервиса.
+type app struct {
+	service  *service.Service
+	storer   *storer.PostgresStorer
+	database *db.Database
+	out      io.Writer
+	errOut   io.Writer
+	output   string
+}
+
+type subcommand struct {
+	usage string
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = map[string]map[string]subcommand{
+	"products": productCommands,
+	"stock":    stockCommands,
+	"orders":   orderCommands,
+	"users":    userCommands,
+	"migrate":  migrateCommands,
+	"seed":     seedCommands,
+	"outbox":   outboxCommands,
+}
+
+// errUsage - неверные аргументы: справка уже выведена, код выхода 2.
+var errUsage = errors.New("usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	database, err := db.NewDatabase()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	// Картинками CLI не занимается, но сервису нужно хранилище
+	blobDir := os.Getenv("BLOB_DIR")
+	if blobDir == "" {
+		blobDir = "data/blobs"
+	}
+	blobs, err := blobstore.NewLocalStore(blobDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	st := storer.NewPostgresStorer(database.GetDB())
+	a := &app{
+		service:  service.NewService(st, payments.NewFakeProvider(), blobs),
+		storer:   st,
+		database: database,
+		out:      os.Stdout,
+		errOut:   os.Stderr,
+	}
+	os.Exit(a.run(ctx, os.Args[1:]))
+}
+
+// run выполняет команду и возвращает код выхода.
+func (a *app) run(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("ecomm", flag.ContinueOnError)
+	fs.SetOutput(a.errOut)
+	fs.StringVar(&a.output, "output", outputTable, "output format: table or json")
+	fs.Usage = a.usage
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if a.output != outputTable && a.output != outputJSON {
+		fmt.Fprintf(a.errOut, "unknown output format %q\n", a.output)
+		return 2
+	}
+
+	args = fs.Args()
+	if len(args) < 2 {
+		a.usage()
+		return 2
+	}
+	group, ok := commands[args[0]]
+	if !ok {
+		a.usage()
+		return 2
+	}
+	cmd, ok := group[args[1]]
+	if !ok {
+		a.usage()
+		return 2
+	}
+
+	err := cmd.run(ctx, a, args[2:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, errImportFailed):
+		return 1
+	}
+	fmt.Fprintln(a.errOut, "error:", err)
+	return 1
+}
+
+func (a *app) usage() {
+	fmt.Fprintln(a.errOut, "usage: ecomm [-output table|json] <command> <subcommand> [flags]")
+	fmt.Fprintln(a.errOut)
+	groups := make([]string, 0, len(commands))
+	for name := range commands {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		names := make([]string, 0, len(commands[group]))
+		for name := range commands[group] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(a.errOut, "  %-28s %s\n", group+" "+name, commands[group][name].usage)
+		}
+	}
+}
+
+// newFlagSet создает набор флагов подкоманды, ошибки разбора печатаются в errOut.
+func (a *app) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("ecomm "+name, flag.ContinueOnError)
+	fs.SetOutput(a.errOut)
+	return fs
+}
+
+// parseFlags разбирает флаги и проверяет, что обязательные заданы.
+func parseFlags(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		fs.Usage()
+		return errUsage
+	}
+	set := setFlags(fs)
+	for _, name := range required {
+		if !set[name] {
+			fmt.Fprintf(fs.Output(), "flag -%s is required\n", name)
+			fs.Usage()
+			return errUsage
+		}
+	}
+	return nil
+}
+
+// setFlags возвращает флаги, явно переданные в командной строке.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"ecomm/ecomm-api/blobstore"
+	"ecomm/ecomm-api/payments"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/storer"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	productColumns := []string{"id", "sku", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at", "deleted_at"}
+	createdAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, func(...string) (int, string, string), sqlmock.Sqlmock)
+	}{
+		{
+			name: "products list as table",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE deleted_at IS NULL")).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "LAMP-1", "Desk lamp", "lamp.jpg", 3, "", 4.5, 2, 19.5, 5, 2, createdAt, nil, nil).
+						AddRow(2, nil, "Chair", "chair.jpg", 4, "", 0, 0, 120, 0, 1, createdAt, nil, nil))
+
+				code, stdout, _ := run("products", "list")
+				require.Equal(t, 0, code)
+				require.Equal(t, "ID  SKU     NAME       CATEGORY  PRICE   STOCK  RATING  VERSION\n"+
+					"1   LAMP-1  Desk lamp  3         19.50   5      4.50    2\n"+
+					"2   -       Chair      4         120.00  0      0.00    1\n", stdout)
+			},
+		},
+		{
+			name: "update only given fields as json",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				// Текущую версию берет CLI, затем товар целиком проверяет сервис
+				for i := 0; i < 2; i++ {
+					mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL")).
+						WithArgs(1).
+						WillReturnRows(sqlmock.NewRows(productColumns).
+							AddRow(1, "LAMP-1", "Desk lamp", "lamp.jpg", 3, "", 0, 0, 19.5, 5, 2, createdAt, nil, nil))
+				}
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET name=$1, price=$2, version=version+1, updated_at=NOW() WHERE id=$3 AND version=$4")).
+					WithArgs("Table lamp", 21.0, 1, 2).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "LAMP-1", "Table lamp", "lamp.jpg", 3, "", 0, 0, 21, 5, 3, createdAt, createdAt, nil))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events")).
+					WithArgs("product", 1, "product.updated", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				code, stdout, stderr := run("-output", "json", "products", "update", "-id", "1", "-name", "Table lamp", "-price", "21")
+				require.Equal(t, 0, code, stderr)
+				product := map[string]interface{}{}
+				require.NoError(t, json.Unmarshal([]byte(stdout), &product))
+				require.Equal(t, "Table lamp", product["name"])
+				require.Equal(t, 3.0, product["version"])
+			},
+		},
+		{
+			name: "stock write off beyond stock",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET count_in_stock=count_in_stock+$1")).
+					WithArgs(-10, 1).
+					WillReturnRows(sqlmock.NewRows(productColumns))
+				mock.ExpectRollback()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "LAMP-1", "Desk lamp", "lamp.jpg", 3, "", 0, 0, 19.5, 5, 2, createdAt, nil, nil))
+
+				code, _, stderr := run("stock", "adjust", "-id", "1", "-delta", "-10")
+				require.Equal(t, 1, code)
+				require.Equal(t, "error: not enough stock for product with id 1. Requested: 10, Available: 5\n", stderr)
+			},
+		},
+		{
+			name: "variant stock adjust",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				variantColumns := []string{"id", "product_id", "sku", "options", "price", "count_in_stock", "image", "version", "created_at", "updated_at"}
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE id=$1 AND deleted_at IS NULL FOR UPDATE")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE product_variants SET count_in_stock=count_in_stock+$1")).
+					WithArgs(3, 7, 1).
+					WillReturnRows(sqlmock.NewRows(variantColumns).
+						AddRow(7, 1, "TS-M-RED", []byte(`{"size":"M"}`), 15.0, 8, "", 2, createdAt, createdAt))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events")).
+					WithArgs("product", 1, "product.stock_changed", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				code, stdout, stderr := run("-output", "json", "stock", "adjust", "-id", "1", "-variant-id", "7", "-delta", "3")
+				require.Equal(t, 0, code, stderr)
+				variant := map[string]interface{}{}
+				require.NoError(t, json.Unmarshal([]byte(stdout), &variant))
+				require.Equal(t, "TS-M-RED", variant["sku"])
+				require.Equal(t, 8.0, variant["count_in_stock"])
+			},
+		},
+		{
+			name: "variant stock write off beyond stock",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE id=$1 AND deleted_at IS NULL FOR UPDATE")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE product_variants SET count_in_stock=count_in_stock+$1")).
+					WithArgs(-10, 7, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count_in_stock FROM product_variants WHERE id=$1 AND product_id=$2")).
+					WithArgs(7, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}).AddRow(4))
+
+				code, _, stderr := run("stock", "adjust", "-id", "1", "-variant-id", "7", "-delta", "-10")
+				require.Equal(t, 1, code)
+				require.Equal(t, "error: not enough stock for product variant with id 7. Requested: 10, Available: 4\n", stderr)
+			},
+		},
+		{
+			name: "orders list with date-only to includes the whole day",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+				to := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM orders WHERE created_at >= $1 AND created_at < $2")).
+					WithArgs(from, to).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE created_at >= $1 AND created_at < $2 ORDER BY created_at DESC, id DESC LIMIT $3 OFFSET $4")).
+					WithArgs(from, to, 20, 0).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}))
+
+				code, _, stderr := run("orders", "list", "-from", "2024-03-01", "-to", "2024-03-01")
+				require.Equal(t, 0, code, stderr)
+			},
+		},
+		{
+			name: "outbox retry puts a dead event back",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE outbox_events SET dead_at=NULL, attempts=0 WHERE id=$1")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "aggregate_type", "aggregate_id", "type", "payload", "attempts", "last_error", "created_at", "published_at", "dead_at"}).
+						AddRow(5, "order", 10, "order.created", `{"order_id":10}`, 0, "broken payload", createdAt, nil, nil))
+
+				code, stdout, stderr := run("-output", "json", "outbox", "retry", "-id", "5")
+				require.Equal(t, 0, code, stderr)
+				event := map[string]interface{}{}
+				require.NoError(t, json.Unmarshal([]byte(stdout), &event))
+				require.Equal(t, 0.0, event["attempts"])
+				require.Nil(t, event["dead_at"])
+			},
+		},
+		{
+			name: "missing required flag",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				code, _, stderr := run("users", "promote")
+				require.Equal(t, 2, code)
+				require.Contains(t, stderr, "flag -email is required")
+			},
+		},
+		{
+			name: "seed profiles",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				code, stdout, _ := run("seed", "profiles")
+				require.Equal(t, 0, code)
+				require.Equal(t, "NAME       CATEGORIES  PRODUCTS  USERS  ORDERS\n"+
+					"small      12          40        11     60\n"+
+					"medium     40          1000      201    3000\n"+
+					"load-test  140         20000     5001   100000\n", stdout)
+			},
+		},
+		{
+			name: "seed unknown profile",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				code, _, stderr := run("seed", "run", "-profile", "huge", "-reset")
+				require.Equal(t, 1, code)
+				require.Contains(t, stderr, `unknown profile "huge"`)
+			},
+		},
+		{
+			name: "unknown command",
+			test: func(t *testing.T, run func(...string) (int, string, string), mock sqlmock.Sqlmock) {
+				code, _, stderr := run("products", "delete")
+				require.Equal(t, 2, code)
+				require.Contains(t, stderr, "usage: ecomm")
+				require.Contains(t, stderr, "stock adjust")
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer mockDB.Close()
+			blobs, err := blobstore.NewLocalStore(t.TempDir())
+			require.NoError(t, err)
+			st := storer.NewPostgresStorer(sqlx.NewDb(mockDB, "postgres"))
+			srv := service.NewService(st, payments.NewFakeProvider(), blobs)
+
+			run := func(args ...string) (int, string, string) {
+				var stdout, stderr bytes.Buffer
+				a := &app{service: srv, storer: st, out: &stdout, errOut: &stderr}
+				code := a.run(context.Background(), args)
+				return code, stdout.String(), stderr.String()
+			}
+			tc.test(t, run, mock)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
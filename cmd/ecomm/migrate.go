@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+var migrateCommands = map[string]subcommand{
+	"up":      {usage: "apply all pending migrations", run: migrateUp},
+	"down":    {usage: "roll back -steps migrations (1 by default)", run: migrateDown},
+	"version": {usage: "show the current schema version", run: migrateVersion},
+	"force":   {usage: "mark -version as applied after fixing a failed migration by hand", run: migrateForce},
+}
+
+func migrateUp(ctx context.Context, a *app, args []string) error {
+	if err := parseFlags(a.newFlagSet("migrate up"), args); err != nil {
+		return err
+	}
+	return a.migrate(func(m *migrate.Migrate) error {
+		return m.Up()
+	})
+}
+
+func migrateDown(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("migrate down")
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *steps <= 0 {
+		return fmt.Errorf("-steps must be positive")
+	}
+	return a.migrate(func(m *migrate.Migrate) error {
+		return m.Steps(-*steps)
+	})
+}
+
+func migrateVersion(ctx context.Context, a *app, args []string) error {
+	if err := parseFlags(a.newFlagSet("migrate version"), args); err != nil {
+		return err
+	}
+	return a.migrate(func(m *migrate.Migrate) error {
+		return nil
+	})
+}
+
+func migrateForce(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("migrate force")
+	version := fs.Int("version", 0, "schema version")
+	if err := parseFlags(fs, args, "version"); err != nil {
+		return err
+	}
+	return a.migrate(func(m *migrate.Migrate) error {
+		return m.Force(*version)
+	})
+}
+
+// migrate выполняет fn и печатает версию схемы после нее.
+func (a *app) migrate(fn func(*migrate.Migrate) error) error {
+	m, err := a.database.NewMigrate()
+	if err != nil {
+		return err
+	}
+	if err := fn(m); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("error migrating: %w", err)
+	}
+
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		version, err = 0, nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting schema version: %w", err)
+	}
+	status := struct {
+		Version uint `json:"version"`
+		Dirty   bool `json:"dirty"`
+	}{version, dirty}
+	return a.print(status, func(w *tabwriter.Writer) {
+		row(w, "VERSION", "DIRTY")
+		row(w, status.Version, status.Dirty)
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/token"
+	"fmt"
+	"text/tabwriter"
+)
+
+var orderCommands = map[string]subcommand{
+	"list":   {usage: "list orders, newest first", run: listOrders},
+	"get":    {usage: "show an order with items, payment and refunds", run: getOrder},
+	"cancel": {usage: "cancel an order, refunding it if paid", run: cancelOrder},
+}
+
+// Оператор CLI действует как администратор: доступ уже ограничен доступом к базе
+var cliAdmin = &token.UserClaims{Email: "ecomm-cli", IsAdmin: true}
+
+func listOrders(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("orders list")
+	req := &orderDto.GetOrdersReq{}
+	fs.StringVar(&req.Status, "status", "", "order status")
+	fs.Int64Var(&req.UserID, "user-id", 0, "orders of this user only")
+	fs.Int64Var(&req.Page, "page", 1, "page number")
+	fs.Int64Var(&req.PageSize, "page-size", 0, "orders per page")
+	from := fs.String("from", "", "created at or after, RFC 3339 or YYYY-MM-DD")
+	to := fs.String("to", "", "created before, RFC 3339 or YYYY-MM-DD")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{"from": *from, "to": *to} {
+		if value == "" {
+			continue
+		}
+		parsed, dateOnly, err := service.ParseDate(value)
+		if err != nil {
+			return fmt.Errorf("invalid -%s: %w", name, err)
+		}
+		// Как и в GET /orders: to - исключающая граница, дата без времени включает весь день
+		if dateOnly && name == "to" {
+			parsed = parsed.AddDate(0, 0, 1)
+		}
+		if name == "from" {
+			req.From = &parsed
+		} else {
+			req.To = &parsed
+		}
+	}
+
+	page, err := a.service.GetOrders(ctx, req)
+	if err != nil {
+		return err
+	}
+	return a.print(page, func(w *tabwriter.Writer) {
+		row(w, "ID", "USER", "STATUS", "ITEMS", "TOTAL", "REFUNDED", "CREATED")
+		for _, order := range page.Orders {
+			row(w, order.ID, order.UserID, order.Status, len(order.Items), order.TotalPrice, order.RefundedPrice, order.CreatedAt)
+		}
+		row(w)
+		row(w, fmt.Sprintf("page %d, %d of %d orders", page.Page, len(page.Orders), page.Total))
+	})
+}
+
+func getOrder(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("orders get")
+	id := fs.Int64("id", 0, "order id")
+	if err := parseFlags(fs, args, "id"); err != nil {
+		return err
+	}
+	order, err := a.service.GetOrder(ctx, *id, cliAdmin)
+	if err != nil {
+		return err
+	}
+	return a.printOrder(order)
+}
+
+func cancelOrder(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("orders cancel")
+	id := fs.Int64("id", 0, "order id")
+	reason := fs.String("reason", "", "cancellation reason")
+	if err := parseFlags(fs, args, "id", "reason"); err != nil {
+		return err
+	}
+	order, err := a.service.CancelOrder(ctx, *id, cliAdmin, &orderDto.CancelOrderReq{Reason: *reason})
+	if err != nil {
+		return err
+	}
+	return a.printOrder(order)
+}
+
+func (a *app) printOrder(order orderDto.OrderRes) error {
+	return a.print(order, func(w *tabwriter.Writer) {
+		row(w, "ID", order.ID)
+		row(w, "USER", order.UserID)
+		row(w, "STATUS", order.Status)
+		row(w, "PAYMENT METHOD", order.PaymentMethod)
+		row(w, "TAX", order.TaxPrice)
+		row(w, "SHIPPING", order.ShippingPrice)
+		row(w, "TOTAL", order.TotalPrice)
+		row(w, "REFUNDED", order.RefundedPrice)
+		row(w, "CREATED", order.CreatedAt)
+		if order.CancelledAt != nil {
+			row(w, "CANCELLED", fmt.Sprintf("%s: %s", cell(order.CancelledAt), order.CancellationReason))
+		}
+
+		row(w)
+		row(w, "ITEM", "PRODUCT", "VARIANT", "NAME", "QUANTITY", "PRICE")
+		for _, item := range order.Items {
+			row(w, item.ID, item.ProductID, item.VariantID, item.Name, item.Quantity, item.Price)
+		}
+		if order.Payment != nil {
+			row(w)
+			row(w, "PAYMENT", "PROVIDER", "STATUS", "AMOUNT", "CAPTURED", "REFUNDED")
+			p := order.Payment
+			row(w, p.ID, p.Provider, p.Status, p.Amount, p.CapturedAmount, p.RefundedAmount)
+		}
+		if len(order.Refunds) > 0 {
+			row(w)
+			row(w, "REFUND", "AMOUNT", "REASON", "CREATED")
+			for _, refund := range order.Refunds {
+				row(w, refund.ID, refund.Amount, refund.Reason, refund.CreatedAt)
+			}
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	outboxDto "ecomm/ecomm-api/handler/dto/outbox"
+	"fmt"
+	"text/tabwriter"
+)
+
+var outboxCommands = map[string]subcommand{
+	"dead":  {usage: "list events the relay gave up on, oldest first", run: listDeadOutboxEvents},
+	"retry": {usage: "put a dead event back into the relay queue", run: retryOutboxEvent},
+}
+
+func listDeadOutboxEvents(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("outbox dead")
+	limit := fs.Int64("limit", 0, "events to show")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	events, err := a.service.GetDeadOutboxEvents(ctx, *limit)
+	if err != nil {
+		return err
+	}
+	return a.print(events, func(w *tabwriter.Writer) {
+		printOutboxEventHeader(w)
+		for _, event := range events {
+			printOutboxEventRow(w, event)
+		}
+	})
+}
+
+func retryOutboxEvent(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("outbox retry")
+	id := fs.Int64("id", 0, "event id")
+	if err := parseFlags(fs, args, "id"); err != nil {
+		return err
+	}
+	event, err := a.service.RetryOutboxEvent(ctx, *id)
+	if err != nil {
+		return err
+	}
+	return a.print(event, func(w *tabwriter.Writer) {
+		printOutboxEventHeader(w)
+		printOutboxEventRow(w, event)
+	})
+}
+
+func printOutboxEventHeader(w *tabwriter.Writer) {
+	row(w, "ID", "TYPE", "AGGREGATE", "ATTEMPTS", "CREATED", "LAST ERROR")
+}
+
+func printOutboxEventRow(w *tabwriter.Writer, event outboxDto.OutboxEventRes) {
+	row(w, event.ID, event.Type, fmt.Sprintf("%s %d", event.AggregateType, event.AggregateID), event.Attempts, event.CreatedAt, event.LastError)
+}
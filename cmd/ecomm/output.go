@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// print выводит value как JSON или таблицей, которую рисует table.
+func (a *app) print(value interface{}, table func(*tabwriter.Writer)) error {
+	if a.output == outputJSON {
+		encoder := json.NewEncoder(a.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+func row(w *tabwriter.Writer, values ...interface{}) {
+	cells := make([]string, len(values))
+	for i, value := range values {
+		cells[i] = cell(value)
+	}
+	fmt.Fprintln(w, strings.Join(cells, "\t"))
+}
+
+func cell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case *string:
+		if v == nil {
+			return "-"
+		}
+		return *v
+	case *int64:
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprint(*v)
+	case float64:
+		return fmt.Sprintf("%.2f", v)
+	case time.Time:
+		return v.Local().Format("2006-01-02 15:04")
+	case *time.Time:
+		if v == nil {
+			return "-"
+		}
+		return v.Local().Format("2006-01-02 15:04")
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/service"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+var productCommands = map[string]subcommand{
+	"list":   {usage: "list products, -category to filter by category slug", run: listProducts},
+	"get":    {usage: "show a product", run: getProduct},
+	"create": {usage: "create a product", run: createProduct},
+	"update": {usage: "change the given fields of a product", run: updateProduct},
+	"import": {usage: "import products from a CSV or JSON Lines file", run: importProducts},
+}
+
+var stockCommands = map[string]subcommand{
+	"adjust": {usage: "add (-delta 5) or write off (-delta -5) stock of a product or its variant (-variant-id)", run: adjustStock},
+}
+
+// errImportFailed - импорт завершился, но с ошибками в строках: отчет уже выведен.
+var errImportFailed = errors.New("import failed")
+
+func listProducts(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("products list")
+	category := fs.String("category", "", "category slug, includes subcategories")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var products []productDto.ProductRes
+	var err error
+	if *category != "" {
+		products, err = a.service.GetCategoryProducts(ctx, *category)
+	} else {
+		products, err = a.service.GetProducts(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	return a.print(products, func(w *tabwriter.Writer) {
+		row(w, "ID", "SKU", "NAME", "CATEGORY", "PRICE", "STOCK", "RATING", "VERSION")
+		for _, p := range products {
+			row(w, p.ID, p.SKU, p.Name, p.CategoryID, p.Price, p.CountInStock, p.Rating, p.Version)
+		}
+	})
+}
+
+func getProduct(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("products get")
+	id := fs.Int64("id", 0, "product id")
+	if err := parseFlags(fs, args, "id"); err != nil {
+		return err
+	}
+	p, err := a.service.GetProduct(ctx, *id)
+	if err != nil {
+		return err
+	}
+	return a.printProduct(p)
+}
+
+func createProduct(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("products create")
+	req := productDto.CreateProductReq{}
+	fs.StringVar(&req.SKU, "sku", "", "stock keeping unit, optional")
+	fs.StringVar(&req.Name, "name", "", "product name")
+	fs.StringVar(&req.Image, "image", "", "image url")
+	fs.Int64Var(&req.CategoryID, "category-id", 0, "category id")
+	fs.StringVar(&req.Description, "description", "", "description")
+	fs.Float64Var(&req.Price, "price", 0, "price")
+	fs.Int64Var(&req.CountInStock, "stock", 0, "count in stock")
+	if err := parseFlags(fs, args, "name", "image", "category-id", "price"); err != nil {
+		return err
+	}
+	p, err := a.service.CreateProduct(ctx, &req)
+	if err != nil {
+		return err
+	}
+	return a.printProduct(p)
+}
+
+// updateProduct меняет только переданные флаги. Без -version берется текущая версия товара,
+// с -version изменение не применится, если товар успели поменять.
+func updateProduct(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("products update")
+	id := fs.Int64("id", 0, "product id")
+	version := fs.Int64("version", 0, "expected product version, current by default")
+	sku := fs.String("sku", "", "stock keeping unit, empty to remove")
+	name := fs.String("name", "", "product name")
+	image := fs.String("image", "", "image url")
+	categoryID := fs.Int64("category-id", 0, "category id")
+	description := fs.String("description", "", "description")
+	price := fs.Float64("price", 0, "price")
+	stock := fs.Int64("stock", 0, "count in stock, see also stock adjust")
+	if err := parseFlags(fs, args, "id"); err != nil {
+		return err
+	}
+
+	set := setFlags(fs)
+	patch := &productDto.PatchProductReq{}
+	for name, apply := range map[string]func(){
+		"sku":         func() { patch.SKU = sku },
+		"name":        func() { patch.Name = name },
+		"image":       func() { patch.Image = image },
+		"category-id": func() { patch.CategoryID = categoryID },
+		"description": func() { patch.Description = description },
+		"price":       func() { patch.Price = price },
+		"stock":       func() { patch.CountInStock = stock },
+	} {
+		if set[name] {
+			apply()
+		}
+	}
+
+	if !set["version"] {
+		current, err := a.service.GetProduct(ctx, *id)
+		if err != nil {
+			return err
+		}
+		*version = current.Version
+	}
+	p, err := a.service.PatchProduct(ctx, *id, *version, patch)
+	if err != nil {
+		return err
+	}
+	return a.printProduct(p)
+}
+
+func adjustStock(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("stock adjust")
+	id := fs.Int64("id", 0, "product id")
+	delta := fs.Int64("delta", 0, "stock change, negative to write off")
+	variantID := fs.Int64("variant-id", 0, "variant id, required for products with variants")
+	if err := parseFlags(fs, args, "id", "delta"); err != nil {
+		return err
+	}
+	if setFlags(fs)["variant-id"] {
+		variant, err := a.service.AdjustVariantStock(ctx, *id, *variantID, *delta)
+		if err != nil {
+			return err
+		}
+		return a.printVariant(variant)
+	}
+	p, err := a.service.AdjustProductStock(ctx, *id, *delta)
+	if err != nil {
+		return err
+	}
+	return a.printProduct(p)
+}
+
+func importProducts(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("products import")
+	file := fs.String("file", "", "path to the import file, - for stdin")
+	format := fs.String("format", "", "csv or jsonl, by default inferred from the file extension")
+	dryRun := fs.Bool("dry-run", false, "validate the file and report errors without saving")
+	chunkSize := fs.Int("chunk-size", service.DefaultImportChunkSize, "rows per transaction")
+	if err := parseFlags(fs, args, "file"); err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = importFormat(*file)
+	}
+
+	in := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("error opening import file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	report, err := a.service.ImportProducts(ctx, in, service.ImportOptions{
+		Format:    *format,
+		DryRun:    *dryRun,
+		ChunkSize: *chunkSize,
+	})
+	if err != nil {
+		return err
+	}
+	err = a.print(report, func(w *tabwriter.Writer) {
+		row(w, "TOTAL", "CREATED", "UPDATED", "FAILED", "DRY RUN")
+		row(w, report.Total, report.Created, report.Updated, report.Failed, report.DryRun)
+		if len(report.Errors) > 0 {
+			row(w)
+			row(w, "LINE", "ERROR")
+			for _, rowErr := range report.Errors {
+				row(w, rowErr.Line, rowErr.Message)
+			}
+		}
+		if report.ErrorsTruncated {
+			row(w, "...", fmt.Sprintf("%d more errors", report.Failed-len(report.Errors)))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return errImportFailed
+	}
+	return nil
+}
+
+func importFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".jsonl", ".ndjson":
+		return service.ImportFormatJSONL
+	}
+	return service.ImportFormatCSV
+}
+
+func (a *app) printProduct(p productDto.ProductRes) error {
+	return a.print(p, func(w *tabwriter.Writer) {
+		row(w, "ID", p.ID)
+		row(w, "SKU", p.SKU)
+		row(w, "NAME", p.Name)
+		row(w, "IMAGE", p.Image)
+		row(w, "CATEGORY", p.CategoryID)
+		row(w, "DESCRIPTION", p.Description)
+		row(w, "PRICE", p.Price)
+		row(w, "STOCK", p.CountInStock)
+		row(w, "RATING", fmt.Sprintf("%.2f (%d reviews)", p.Rating, p.NumReviews))
+		row(w, "VERSION", p.Version)
+		row(w, "CREATED", p.CreatedAt)
+		row(w, "UPDATED", p.UpdatedAt)
+	})
+}
+
+func (a *app) printVariant(v productDto.ProductVariantRes) error {
+	return a.print(v, func(w *tabwriter.Writer) {
+		row(w, "ID", v.ID)
+		row(w, "PRODUCT", v.ProductID)
+		row(w, "SKU", v.SKU)
+		row(w, "PRICE", v.Price)
+		row(w, "STOCK", v.CountInStock)
+		row(w, "CREATED", v.CreatedAt)
+		row(w, "UPDATED", v.UpdatedAt)
+	})
+}
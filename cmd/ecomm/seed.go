@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"ecomm/ecomm-api/seed"
+	"ecomm/ecomm-api/storer"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+var seedCommands = map[string]subcommand{
+	"run":      {usage: "fill the database with generated data, -reset to wipe it first", run: runSeed},
+	"profiles": {usage: "list seed profiles", run: listSeedProfiles},
+}
+
+type seedSummary struct {
+	Profile    string `json:"profile"`
+	Seed       uint64 `json:"seed"`
+	Categories int    `json:"categories"`
+	Products   int    `json:"products"`
+	Users      int    `json:"users"`
+	Orders     int    `json:"orders"`
+	Reviews    int    `json:"reviews"`
+	Password   string `json:"password"`
+}
+
+func runSeed(ctx context.Context, a *app, args []string) error {
+	fs := a.newFlagSet("seed run")
+	profileName := fs.String("profile", "small", "data size: "+strings.Join(seed.ProfileNames(), ", "))
+	seedValue := fs.Uint64("seed", 1, "random seed, the same seed gives the same data")
+	reset := fs.Bool("reset", false, "delete all shop data before seeding")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	profile, ok := seed.Profiles[*profileName]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, expected one of: %s", *profileName, strings.Join(seed.ProfileNames(), ", "))
+	}
+
+	if *reset {
+		if err := a.storer.TruncateAll(ctx); err != nil {
+			return err
+		}
+	}
+
+	ds := seed.Generate(profile, *seedValue)
+	// Прогресс идет в errOut, чтобы не мешать JSON в out
+	err := seed.Apply(ctx, a.storer, ds, func(stage string, done, total int) {
+		if done == total || done%1000 == 0 {
+			fmt.Fprintf(a.errOut, "%s: %d/%d\n", stage, done, total)
+		}
+	})
+	if err != nil {
+		var exists *storer.AlreadyExistsError
+		if errors.As(err, &exists) {
+			return fmt.Errorf("%w (the database is not empty, use -reset)", err)
+		}
+		return err
+	}
+
+	summary := seedSummary{
+		Profile:    profile.Name,
+		Seed:       ds.Seed,
+		Categories: len(ds.Categories),
+		Products:   len(ds.Products),
+		Users:      len(ds.Users),
+		Orders:     len(ds.Orders),
+		Reviews:    len(ds.Reviews),
+		Password:   seed.Password,
+	}
+	return a.print(summary, func(w *tabwriter.Writer) {
+		row(w, "PROFILE", summary.Profile)
+		row(w, "SEED", summary.Seed)
+		row(w, "CATEGORIES", summary.Categories)
+		row(w, "PRODUCTS", summary.Products)
+		row(w, "USERS", summary.Users)
+		row(w, "ORDERS", summary.Orders)
+		row(w, "REVIEWS", summary.Reviews)
+		row(w, "ADMIN", seed.AdminEmail)
+		row(w, "PASSWORD", summary.Password)
+	})
+}
+
+func listSeedProfiles(ctx context.Context, a *app, args []string) error {
+	if err := parseFlags(a.newFlagSet("seed profiles"), args); err != nil {
+		return err
+	}
+	profiles := make([]seed.Profile, 0, len(seed.Profiles))
+	for _, name := range seed.ProfileNames() {
+		profiles = append(profiles, seed.Profiles[name])
+	}
+	return a.print(profiles, func(w *tabwriter.Writer) {
+		row(w, "NAME", "CATEGORIES", "PRODUCTS", "USERS", "ORDERS")
+		for _, p := range profiles {
+			row(w, p.Name, p.Categories*(1+p.Subcategories), p.Products, p.Users+1, p.Orders)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	userDto "ecomm/ecomm-api/handler/dto/user"
+	"text/tabwriter"
+)
+
+var userCommands = map[string]subcommand{
+	"promote": {usage: "grant admin rights to a user", run: setUserAdmin(true)},
+	"demote":  {usage: "revoke admin rights from a user", run: setUserAdmin(false)},
+}
+
+// setUserAdmin - права меняются в базе, но уже выданные токены действуют до истечения срока.
+func setUserAdmin(isAdmin bool) func(context.Context, *app, []string) error {
+	return func(ctx context.Context, a *app, args []string) error {
+		fs := a.newFlagSet("users")
+		email := fs.String("email", "", "user email")
+		if err := parseFlags(fs, args, "email"); err != nil {
+			return err
+		}
+		u, err := a.service.SetUserAdmin(ctx, *email, isAdmin)
+		if err != nil {
+			return err
+		}
+		return a.print(u, func(w *tabwriter.Writer) {
+			printUserRow(w, u)
+		})
+	}
+}
+
+func printUserRow(w *tabwriter.Writer, u userDto.UserRes) {
+	row(w, "ID", "NAME", "EMAIL", "ADMIN")
+	row(w, u.ID, u.Name, u.Email, u.IsAdmin)
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Миграции вшиты в бинарник, чтобы их можно было применить без исходников
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// NewMigrate возвращает golang-migrate, настроенный на вшитые миграции и эту базу.
+func (d *Database) NewMigrate() (*migrate.Migrate, error) {
+	source, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error opening migrations: %w", err)
+	}
+	driver, err := postgres.WithInstance(d.db.DB, &postgres.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("error opening migration driver: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		return nil, fmt.Errorf("error creating migrator: %w", err)
+	}
+	return m, nil
+}
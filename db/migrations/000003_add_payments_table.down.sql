@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "payments";
+
+ALTER TABLE "orders"
+    DROP COLUMN IF EXISTS "status";
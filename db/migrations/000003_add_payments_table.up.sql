@@ -0,0 +1,24 @@
+-- Заказы, созданные до появления оплаты, уже оформлены: ждать им нечего
+ALTER TABLE "orders"
+    ADD COLUMN "status" VARCHAR(32) NOT NULL DEFAULT 'paid';
+
+ALTER TABLE "orders"
+    ALTER COLUMN "status" SET DEFAULT 'pending';
+
+CREATE TABLE "payments"
+(
+    "id"               SERIAL PRIMARY KEY,
+    "order_id"         INT            NOT NULL,
+    "provider"         VARCHAR(64)    NOT NULL,
+    "method"           VARCHAR(255)   NOT NULL,
+    "status"           VARCHAR(32)    NOT NULL,
+    "amount"           NUMERIC(10, 2) NOT NULL,
+    "captured_amount"  NUMERIC(10, 2) NOT NULL DEFAULT 0,
+    "authorization_id" VARCHAR(255)   NOT NULL,
+    "created_at"       TIMESTAMP DEFAULT now(),
+    "updated_at"       TIMESTAMP,
+    CONSTRAINT "payments_order_id_fk" FOREIGN KEY ("order_id") REFERENCES "orders" ("id") ON DELETE CASCADE,
+    CONSTRAINT "payments_provider_authorization_key" UNIQUE ("provider", "authorization_id")
+);
+
+CREATE INDEX "payments_order_id_idx" ON "payments" ("order_id");
@@ -0,0 +1,10 @@
+CREATE TABLE "payment_events"
+(
+    "id"               VARCHAR(255) NOT NULL,
+    "provider"         VARCHAR(64)  NOT NULL,
+    "type"             VARCHAR(64)  NOT NULL,
+    "authorization_id" VARCHAR(255) NOT NULL,
+    "payload"          JSONB        NOT NULL,
+    "received_at"      TIMESTAMP    NOT NULL DEFAULT now(),
+    PRIMARY KEY ("provider", "id")
+);
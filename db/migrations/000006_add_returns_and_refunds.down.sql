@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS "refunds";
+DROP TABLE IF EXISTS "returns";
+
+ALTER TABLE "payments"
+    DROP COLUMN IF EXISTS "refunded_amount";
+
+ALTER TABLE "orders"
+    DROP COLUMN IF EXISTS "refunded_price";
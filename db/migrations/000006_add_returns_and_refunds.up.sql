@@ -0,0 +1,40 @@
+ALTER TABLE "orders"
+    ADD COLUMN "refunded_price" NUMERIC(10, 2) NOT NULL DEFAULT 0;
+
+ALTER TABLE "payments"
+    ADD COLUMN "refunded_amount" NUMERIC(10, 2) NOT NULL DEFAULT 0;
+
+CREATE TABLE "returns"
+(
+    "id"            SERIAL PRIMARY KEY,
+    "order_id"      INT         NOT NULL,
+    "order_item_id" INT         NOT NULL,
+    "quantity"      INT         NOT NULL CHECK ("quantity" > 0),
+    "reason"        TEXT        NOT NULL,
+    "status"        VARCHAR(32) NOT NULL DEFAULT 'requested',
+    "admin_note"    TEXT        NOT NULL DEFAULT '',
+    "created_at"    TIMESTAMP DEFAULT now(),
+    "updated_at"    TIMESTAMP,
+    CONSTRAINT "returns_order_id_fk" FOREIGN KEY ("order_id") REFERENCES "orders" ("id") ON DELETE CASCADE,
+    CONSTRAINT "returns_order_item_id_fk" FOREIGN KEY ("order_item_id") REFERENCES "order_items" ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX "returns_order_id_idx" ON "returns" ("order_id");
+CREATE INDEX "returns_status_idx" ON "returns" ("status");
+
+CREATE TABLE "refunds"
+(
+    "id"                 SERIAL PRIMARY KEY,
+    "order_id"           INT            NOT NULL,
+    "payment_id"         INT            NOT NULL,
+    "return_id"          INT,
+    "amount"             NUMERIC(10, 2) NOT NULL CHECK ("amount" > 0),
+    "reason"             TEXT           NOT NULL DEFAULT '',
+    "provider_refund_id" VARCHAR(255)   NOT NULL,
+    "created_at"         TIMESTAMP DEFAULT now(),
+    CONSTRAINT "refunds_order_id_fk" FOREIGN KEY ("order_id") REFERENCES "orders" ("id") ON DELETE CASCADE,
+    CONSTRAINT "refunds_payment_id_fk" FOREIGN KEY ("payment_id") REFERENCES "payments" ("id") ON DELETE CASCADE,
+    CONSTRAINT "refunds_return_id_fk" FOREIGN KEY ("return_id") REFERENCES "returns" ("id") ON DELETE SET NULL
+);
+
+CREATE INDEX "refunds_order_id_idx" ON "refunds" ("order_id");
@@ -0,0 +1,3 @@
+ALTER TABLE "orders"
+    DROP COLUMN IF EXISTS "cancelled_at",
+    DROP COLUMN IF EXISTS "cancellation_reason";
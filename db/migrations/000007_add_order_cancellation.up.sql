@@ -0,0 +1,3 @@
+ALTER TABLE "orders"
+    ADD COLUMN "cancellation_reason" TEXT NOT NULL DEFAULT '',
+    ADD COLUMN "cancelled_at"        TIMESTAMP;
@@ -0,0 +1,8 @@
+ALTER TABLE "order_items"
+    DROP CONSTRAINT "fk_product",
+    ADD CONSTRAINT "fk_product"
+        FOREIGN KEY ("product_id") REFERENCES "products" ("id")
+            ON DELETE CASCADE;
+
+ALTER TABLE "products"
+    DROP COLUMN IF EXISTS "deleted_at";
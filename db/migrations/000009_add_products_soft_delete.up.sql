@@ -0,0 +1,9 @@
+ALTER TABLE "products"
+    ADD COLUMN "deleted_at" TIMESTAMP;
+
+-- Товары больше не удаляются физически, а если удалят вручную - позиции старых заказов должны остаться
+ALTER TABLE "order_items"
+    DROP CONSTRAINT "fk_product",
+    ADD CONSTRAINT "fk_product"
+        FOREIGN KEY ("product_id") REFERENCES "products" ("id")
+            ON DELETE RESTRICT;
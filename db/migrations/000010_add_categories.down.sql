@@ -0,0 +1,13 @@
+ALTER TABLE "products"
+    ADD COLUMN "category" VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE "products" AS "p"
+SET "category" = "c"."name"
+FROM "categories" AS "c"
+WHERE "c"."id" = "p"."category_id";
+
+ALTER TABLE "products"
+    ALTER COLUMN "category" DROP DEFAULT,
+    DROP COLUMN IF EXISTS "category_id";
+
+DROP TABLE IF EXISTS "categories";
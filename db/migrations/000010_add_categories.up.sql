@@ -0,0 +1,46 @@
+CREATE TABLE "categories" (
+    "id"         SERIAL PRIMARY KEY,
+    "parent_id"  INTEGER REFERENCES "categories" ("id") ON DELETE RESTRICT,
+    "name"       VARCHAR(255) NOT NULL,
+    "slug"       VARCHAR(255) NOT NULL UNIQUE,
+    "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+    "updated_at" TIMESTAMP
+);
+
+CREATE INDEX "categories_parent_id_idx" ON "categories" ("parent_id");
+
+-- Переносим строки из products.category: "Phones" и " phones" получают один slug и одну категорию
+INSERT INTO "categories" ("name", "slug")
+SELECT MIN(TRIM("category")), "slug"
+FROM (
+    SELECT "category",
+           TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(TRIM("category")), '[^[:alnum:]]+', '-', 'g')) AS "slug"
+    FROM "products"
+) AS "p"
+WHERE "slug" <> ''
+GROUP BY "slug";
+
+INSERT INTO "categories" ("name", "slug")
+SELECT 'Uncategorized', 'uncategorized'
+WHERE EXISTS (
+    SELECT 1 FROM "products"
+    WHERE TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(TRIM("category")), '[^[:alnum:]]+', '-', 'g')) = ''
+)
+ON CONFLICT ("slug") DO NOTHING;
+
+ALTER TABLE "products"
+    ADD COLUMN "category_id" INTEGER REFERENCES "categories" ("id") ON DELETE RESTRICT;
+
+UPDATE "products" AS "p"
+SET "category_id" = "c"."id"
+FROM "categories" AS "c"
+WHERE "c"."slug" = COALESCE(
+    NULLIF(TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(TRIM("p"."category")), '[^[:alnum:]]+', '-', 'g')), ''),
+    'uncategorized'
+);
+
+ALTER TABLE "products"
+    ALTER COLUMN "category_id" SET NOT NULL,
+    DROP COLUMN "category";
+
+CREATE INDEX "products_category_id_idx" ON "products" ("category_id");
@@ -0,0 +1,27 @@
+-- Опции товара (размер, цвет) и допустимые значения, например ["S", "M", "L"]
+CREATE TABLE "product_options" (
+    "id"         SERIAL PRIMARY KEY,
+    "product_id" INTEGER NOT NULL REFERENCES "products" ("id") ON DELETE RESTRICT,
+    "name"       VARCHAR(64) NOT NULL,
+    "values"     JSONB NOT NULL DEFAULT '[]',
+    "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE ("product_id", "name")
+);
+
+-- Вариант - конкретная комбинация опций со своим SKU, ценой, остатком и картинкой
+CREATE TABLE "product_variants" (
+    "id"             SERIAL PRIMARY KEY,
+    "product_id"     INTEGER NOT NULL REFERENCES "products" ("id") ON DELETE RESTRICT,
+    "sku"            VARCHAR(64) NOT NULL UNIQUE,
+    "options"        JSONB NOT NULL DEFAULT '{}',
+    "price"          NUMERIC(10,2) NOT NULL,
+    "count_in_stock" INTEGER NOT NULL,
+    "image"          VARCHAR(255) NOT NULL DEFAULT '',
+    "version"        INTEGER NOT NULL DEFAULT 1,
+    "created_at"     TIMESTAMP NOT NULL DEFAULT now(),
+    "updated_at"     TIMESTAMP,
+    UNIQUE ("product_id", "options")
+);
+
+ALTER TABLE "order_items"
+    ADD COLUMN "variant_id" INTEGER REFERENCES "product_variants" ("id") ON DELETE RESTRICT;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "reviews";
+
+ALTER TABLE "products"
+    ALTER COLUMN "rating" DROP DEFAULT,
+    ALTER COLUMN "rating" TYPE INTEGER USING ROUND("rating");
@@ -0,0 +1,25 @@
+-- Рейтинг теперь среднее по одобренным отзывам, а не целое число от клиента
+ALTER TABLE "products"
+    ALTER COLUMN "rating" TYPE NUMERIC(3, 2) USING "rating",
+    ALTER COLUMN "rating" SET DEFAULT 0;
+
+-- Значения, выставленные клиентами, ни на чем не основаны: отзывов еще нет
+UPDATE "products" SET "rating" = 0, "num_reviews" = 0;
+
+CREATE TABLE "reviews"
+(
+    "id"         SERIAL PRIMARY KEY,
+    "product_id" INT         NOT NULL,
+    "user_id"    INT         NOT NULL,
+    "rating"     SMALLINT    NOT NULL CHECK ("rating" BETWEEN 1 AND 5),
+    "comment"    TEXT        NOT NULL DEFAULT '',
+    "status"     VARCHAR(32) NOT NULL DEFAULT 'pending',
+    "created_at" TIMESTAMP DEFAULT now(),
+    "updated_at" TIMESTAMP,
+    CONSTRAINT "reviews_product_id_fk" FOREIGN KEY ("product_id") REFERENCES "products" ("id") ON DELETE CASCADE,
+    CONSTRAINT "reviews_user_id_fk" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE,
+    UNIQUE ("product_id", "user_id")
+);
+
+CREATE INDEX "reviews_product_id_status_idx" ON "reviews" ("product_id", "status");
+CREATE INDEX "reviews_status_idx" ON "reviews" ("status");
@@ -0,0 +1,17 @@
+-- Загруженные картинки товара, position задает порядок показа (0 - главная)
+CREATE TABLE "product_images"
+(
+    "id"            SERIAL PRIMARY KEY,
+    "product_id"    INT          NOT NULL,
+    "position"      INT          NOT NULL,
+    "blob_key"      VARCHAR(255) NOT NULL UNIQUE,
+    "thumbnail_key" VARCHAR(255) NOT NULL,
+    "content_type"  VARCHAR(64)  NOT NULL,
+    "size"          BIGINT       NOT NULL,
+    "width"         INT          NOT NULL,
+    "height"        INT          NOT NULL,
+    "created_at"    TIMESTAMP DEFAULT now(),
+    CONSTRAINT "product_images_product_id_fk" FOREIGN KEY ("product_id") REFERENCES "products" ("id") ON DELETE CASCADE
+);
+
+CREATE INDEX "product_images_product_id_position_idx" ON "product_images" ("product_id", "position");
@@ -0,0 +1,3 @@
+-- Необязательный артикул товара: по нему массовый импорт находит уже существующие товары
+ALTER TABLE "products"
+    ADD COLUMN "sku" VARCHAR(64) UNIQUE;
@@ -0,0 +1,16 @@
+-- Доменные события пишутся в одной транзакции с изменением, а relay публикует их по порядку id
+CREATE TABLE "outbox_events"
+(
+    "id"             BIGSERIAL PRIMARY KEY,
+    "aggregate_type" VARCHAR(64) NOT NULL,
+    "aggregate_id"   BIGINT      NOT NULL,
+    "type"           VARCHAR(64) NOT NULL,
+    "payload"        JSONB       NOT NULL,
+    "attempts"       INT         NOT NULL DEFAULT 0,
+    "last_error"     TEXT,
+    "created_at"     TIMESTAMP   NOT NULL DEFAULT now(),
+    "published_at"   TIMESTAMP
+);
+
+-- Relay читает только неопубликованные события, их немного
+CREATE INDEX "outbox_events_unpublished_idx" ON "outbox_events" ("id") WHERE "published_at" IS NULL;
@@ -0,0 +1,38 @@
+-- Исходящие вебхуки: партнеры подписываются на доменные события из outbox
+CREATE TABLE "webhook_subscriptions"
+(
+    "id"                   SERIAL PRIMARY KEY,
+    "url"                  TEXT         NOT NULL,
+    "event_types"          JSONB        NOT NULL DEFAULT '[]',
+    "secret"               VARCHAR(128) NOT NULL,
+    "enabled"              BOOLEAN      NOT NULL DEFAULT TRUE,
+    -- Неудачные попытки подряд: после порога подписка отключается
+    "consecutive_failures" INT          NOT NULL DEFAULT 0,
+    "disabled_at"          TIMESTAMP,
+    "created_at"           TIMESTAMP    NOT NULL DEFAULT now(),
+    "updated_at"           TIMESTAMP
+);
+
+-- Одна строка на пару (подписка, событие) - это и очередь отправки, и журнал доставок
+CREATE TABLE "webhook_deliveries"
+(
+    "id"              BIGSERIAL PRIMARY KEY,
+    "subscription_id" INT         NOT NULL,
+    "event_id"        BIGINT      NOT NULL,
+    "event_type"      VARCHAR(64) NOT NULL,
+    "body"            TEXT        NOT NULL,
+    "status"          VARCHAR(32) NOT NULL DEFAULT 'pending',
+    "attempts"        INT         NOT NULL DEFAULT 0,
+    "next_attempt_at" TIMESTAMP   NOT NULL DEFAULT now(),
+    "response_code"   INT,
+    "response_body"   TEXT,
+    "last_error"      TEXT,
+    "created_at"      TIMESTAMP   NOT NULL DEFAULT now(),
+    "updated_at"      TIMESTAMP,
+    "delivered_at"    TIMESTAMP,
+    CONSTRAINT "webhook_deliveries_subscription_id_fk" FOREIGN KEY ("subscription_id") REFERENCES "webhook_subscriptions" ("id") ON DELETE CASCADE,
+    -- Relay доставляет события at-least-once, повтор не должен создать вторую доставку
+    UNIQUE ("subscription_id", "event_id")
+);
+
+CREATE INDEX "webhook_deliveries_due_idx" ON "webhook_deliveries" ("next_attempt_at") WHERE "status" = 'pending';
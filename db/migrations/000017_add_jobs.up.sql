@@ -0,0 +1,22 @@
+-- Очередь фоновых задач: воркеры забирают строки через FOR UPDATE SKIP LOCKED
+CREATE TABLE "jobs"
+(
+    "id"           BIGSERIAL PRIMARY KEY,
+    "type"         VARCHAR(64)  NOT NULL,
+    "payload"      JSONB        NOT NULL DEFAULT '{}',
+    "status"       VARCHAR(32)  NOT NULL DEFAULT 'pending',
+    "attempts"     INT          NOT NULL DEFAULT 0,
+    "max_attempts" INT          NOT NULL DEFAULT 5,
+    "run_at"       TIMESTAMP    NOT NULL DEFAULT now(),
+    "locked_at"    TIMESTAMP,
+    "last_error"   TEXT,
+    -- Задача с тем же ключом ставится только один раз, например одно срабатывание расписания
+    "unique_key"   VARCHAR(255) UNIQUE,
+    "created_at"   TIMESTAMP    NOT NULL DEFAULT now(),
+    "updated_at"   TIMESTAMP,
+    "finished_at"  TIMESTAMP
+);
+
+CREATE INDEX "jobs_due_idx" ON "jobs" ("run_at") WHERE "status" = 'pending';
+-- Зависшие задачи упавших воркеров ищутся по времени захвата
+CREATE INDEX "jobs_running_idx" ON "jobs" ("locked_at") WHERE "status" = 'running';
@@ -0,0 +1,3 @@
+ALTER TABLE "orders"
+    DROP COLUMN IF EXISTS "shipped_at",
+    DROP COLUMN IF EXISTS "tracking_number";
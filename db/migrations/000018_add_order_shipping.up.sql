@@ -0,0 +1,3 @@
+ALTER TABLE "orders"
+    ADD COLUMN "tracking_number" VARCHAR(128),
+    ADD COLUMN "shipped_at"      TIMESTAMP;
@@ -0,0 +1,11 @@
+-- Хранится только SHA-256 токена: сам токен есть лишь в письме пользователю
+CREATE TABLE "password_reset_tokens"
+(
+    "id"         BIGSERIAL PRIMARY KEY,
+    "user_id"    INT         NOT NULL,
+    "token_hash" VARCHAR(64) NOT NULL UNIQUE,
+    "expires_at" TIMESTAMP   NOT NULL,
+    "used_at"    TIMESTAMP,
+    "created_at" TIMESTAMP   NOT NULL DEFAULT now(),
+    CONSTRAINT "password_reset_tokens_user_id_fk" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS "refunds_pending_idx";
+
+ALTER TABLE "refunds"
+    ALTER COLUMN "provider_refund_id" DROP DEFAULT,
+    DROP COLUMN IF EXISTS "updated_at",
+    DROP COLUMN IF EXISTS "last_error",
+    DROP COLUMN IF EXISTS "status";
@@ -0,0 +1,11 @@
+-- Уже записанные возвраты прошли через шлюз
+ALTER TABLE "refunds"
+    ADD COLUMN "status"     VARCHAR(32) NOT NULL DEFAULT 'succeeded',
+    ADD COLUMN "last_error" TEXT,
+    ADD COLUMN "updated_at" TIMESTAMP;
+
+ALTER TABLE "refunds"
+    ALTER COLUMN "status" SET DEFAULT 'pending',
+    ALTER COLUMN "provider_refund_id" SET DEFAULT '';
+
+CREATE INDEX "refunds_pending_idx" ON "refunds" ("id") WHERE "status" = 'pending';
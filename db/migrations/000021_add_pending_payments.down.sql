@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "payments_provider_authorization_key";
+
+ALTER TABLE "payments"
+    ADD CONSTRAINT "payments_provider_authorization_key" UNIQUE ("provider", "authorization_id");
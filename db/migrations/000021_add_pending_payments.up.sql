@@ -0,0 +1,6 @@
+-- Платеж записывается в статусе pending до обращения к шлюзу, когда авторизации у него еще нет
+ALTER TABLE "payments"
+    DROP CONSTRAINT "payments_provider_authorization_key";
+
+CREATE UNIQUE INDEX "payments_provider_authorization_key" ON "payments" ("provider", "authorization_id")
+    WHERE "authorization_id" <> '';
@@ -0,0 +1,7 @@
+-- Событие, которое не удалось опубликовать за все попытки, откладывается, чтобы не держать очередь relay.
+-- Вернуть его в очередь можно командой ecomm outbox retry.
+ALTER TABLE "outbox_events"
+    ADD COLUMN "dead_at" TIMESTAMP;
+
+DROP INDEX "outbox_events_unpublished_idx";
+CREATE INDEX "outbox_events_unpublished_idx" ON "outbox_events" ("id") WHERE "published_at" IS NULL AND "dead_at" IS NULL;
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// Category - узел дерева категорий, корневые категории без ParentID.
+type Category struct {
+	ID        int64      `db:"id"`
+	ParentID  *int64     `db:"parent_id"`
+	Name      string     `db:"name"`
+	Slug      string     `db:"slug"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt *time.Time `db:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead" // Попытки исчерпаны или ошибка неисправима, перезапустить можно только вручную
+)
+
+// JobStatuses - все статусы задач.
+var JobStatuses = []string{JobPending, JobRunning, JobSucceeded, JobDead}
+
+// Job - фоновая задача из очереди. Payload - аргументы обработчика в JSON.
+type Job struct {
+	ID          int64      `db:"id"`
+	Type        string     `db:"type"`
+	Payload     string     `db:"payload"`
+	Status      string     `db:"status"`
+	Attempts    int64      `db:"attempts"`
+	MaxAttempts int64      `db:"max_attempts"`
+	RunAt       time.Time  `db:"run_at"`
+	LockedAt    *time.Time `db:"locked_at"`
+	LastError   *string    `db:"last_error"`
+	UniqueKey   *string    `db:"unique_key"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   *time.Time `db:"updated_at"`
+	FinishedAt  *time.Time `db:"finished_at"`
+}
@@ -2,13 +2,31 @@ package domain
 
 import "time"
 
+const (
+	OrderStatusPending       = "pending"
+	OrderStatusPaid          = "paid"
+	OrderStatusPaymentFailed = "payment_failed"
+	OrderStatusRefunded      = "refunded"
+	OrderStatusShipped       = "shipped"
+	OrderStatusCancelled     = "cancelled"
+)
+
 type Order struct {
-	ID            int64      `db:"id"`
-	PaymentMethod string     `db:"payment_method"`
-	TaxPrice      float64    `db:"tax_price"`
-	ShippingPrice float64    `db:"shipping_price"`
-	TotalPrice    float64    `db:"total_price"`
-	CreatedAt     time.Time  `db:"created_at"`
-	UpdatedAt     *time.Time `db:"updated_at"`
-	Items         []OrderItem
+	ID                 int64      `db:"id"`
+	UserID             int64      `db:"user_id"`
+	PaymentMethod      string     `db:"payment_method"`
+	Status             string     `db:"status"`
+	TaxPrice           float64    `db:"tax_price"`
+	ShippingPrice      float64    `db:"shipping_price"`
+	TotalPrice         float64    `db:"total_price"`
+	RefundedPrice      float64    `db:"refunded_price"`
+	CancellationReason string     `db:"cancellation_reason"`
+	CancelledAt        *time.Time `db:"cancelled_at"`
+	TrackingNumber     *string    `db:"tracking_number"`
+	ShippedAt          *time.Time `db:"shipped_at"`
+	CreatedAt          time.Time  `db:"created_at"`
+	UpdatedAt          *time.Time `db:"updated_at"`
+	Items              []OrderItem
+	Payment            *Payment
+	Refunds            []Refund
 }
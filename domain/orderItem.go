@@ -7,5 +7,6 @@ type OrderItem struct {
 	Image     string  `db:"image"`
 	Price     float64 `db:"price"`
 	ProductID int64   `db:"product_id"`
+	VariantID *int64  `db:"variant_id"` // nil - товар без вариантов
 	OrderID   int64   `db:"order_id"`
 }
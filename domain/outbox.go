@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+// Типы доменных событий
+const (
+	EventOrderCreated        = "order.created"
+	EventOrderShipped        = "order.shipped"
+	EventOrderCancelled      = "order.cancelled"
+	EventProductCreated      = "product.created"
+	EventProductUpdated      = "product.updated"
+	EventProductDeleted      = "product.deleted"
+	EventProductRestored     = "product.restored"
+	EventProductStockChanged = "product.stock_changed"
+)
+
+// EventTypes - все типы событий, на которые можно подписаться.
+var EventTypes = []string{
+	EventOrderCreated,
+	EventOrderShipped,
+	EventOrderCancelled,
+	EventProductCreated,
+	EventProductUpdated,
+	EventProductDeleted,
+	EventProductRestored,
+	EventProductStockChanged,
+}
+
+// OutboxEvent - доменное событие, записанное в одной транзакции с изменением, которое его породило.
+// PublishedAt nil - событие еще не доставлено. DeadAt - когда relay отложил событие, исчерпав попытки.
+type OutboxEvent struct {
+	ID            int64      `db:"id"`
+	AggregateType string     `db:"aggregate_type"` // order, product
+	AggregateID   int64      `db:"aggregate_id"`
+	Type          string     `db:"type"`
+	Payload       string     `db:"payload"` // JSON
+	Attempts      int64      `db:"attempts"`
+	LastError     *string    `db:"last_error"`
+	CreatedAt     time.Time  `db:"created_at"`
+	PublishedAt   *time.Time `db:"published_at"`
+	DeadAt        *time.Time `db:"dead_at"`
+}
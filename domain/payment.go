@@ -0,0 +1,41 @@
+package domain
+
+import "time"
+
+const (
+	PaymentStatusPending    = "pending" // Записан до обращения к шлюзу, авторизации еще нет
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusVoided     = "voided"
+	PaymentStatusFailed     = "failed"
+	PaymentStatusRefunded   = "refunded"
+
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+)
+
+// PaymentProviderSeed - провайдер платежей, записанных генератором тестовых данных без обращения к шлюзу.
+const PaymentProviderSeed = "seed"
+
+type Payment struct {
+	ID              int64      `db:"id"`
+	OrderID         int64      `db:"order_id"`
+	Provider        string     `db:"provider"`
+	Method          string     `db:"method"`
+	Status          string     `db:"status"`
+	Amount          float64    `db:"amount"`
+	CapturedAmount  float64    `db:"captured_amount"`
+	RefundedAmount  float64    `db:"refunded_amount"`
+	AuthorizationID string     `db:"authorization_id"`
+	CreatedAt       time.Time  `db:"created_at"`
+	UpdatedAt       *time.Time `db:"updated_at"`
+}
+
+// PaymentEvent - принятое уведомление шлюза. Уникальный ID защищает от повторной обработки.
+type PaymentEvent struct {
+	ID              string    `db:"id"`
+	Provider        string    `db:"provider"`
+	Type            string    `db:"type"`
+	AuthorizationID string    `db:"authorization_id"`
+	Payload         string    `db:"payload"`
+	ReceivedAt      time.Time `db:"received_at"`
+}
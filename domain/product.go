@@ -4,14 +4,17 @@ import "time"
 
 type Product struct {
 	ID           int64      `db:"id"`
+	SKU          *string    `db:"sku"` // nil - артикул не задан
 	Name         string     `db:"name"`
 	Image        string     `db:"image"`
-	Category     string     `db:"category"`
+	CategoryID   int64      `db:"category_id"`
 	Description  string     `db:"description"`
-	Rating       int64      `db:"rating"`
+	Rating       float64    `db:"rating"` // Среднее по одобренным отзывам
 	NumReviews   int64      `db:"num_reviews"`
 	Price        float64    `db:"price"`
 	CountInStock int64      `db:"count_in_stock"`
+	Version      int64      `db:"version"`
 	CreatedAt    time.Time  `db:"created_at"`
 	UpdatedAt    *time.Time `db:"updated_at"`
+	DeletedAt    *time.Time `db:"deleted_at"` // nil - товар не удален
 }
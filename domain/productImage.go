@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+// ProductImage - загруженная картинка товара и ее уменьшенная копия в BlobStore.
+type ProductImage struct {
+	ID           int64     `db:"id"`
+	ProductID    int64     `db:"product_id"`
+	Position     int64     `db:"position"`
+	BlobKey      string    `db:"blob_key"`
+	ThumbnailKey string    `db:"thumbnail_key"`
+	ContentType  string    `db:"content_type"`
+	Size         int64     `db:"size"`
+	Width        int64     `db:"width"`
+	Height       int64     `db:"height"`
+	CreatedAt    time.Time `db:"created_at"`
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+const (
+	RefundStatusPending   = "pending"   // Записан, шлюз еще не вернул деньги
+	RefundStatusSucceeded = "succeeded" // Шлюз вернул деньги
+	RefundStatusFailed    = "failed"    // Шлюз отказал, сумма снова доступна для возврата
+)
+
+// Refund - строка возврата денег по заказу, уменьшает оплаченную сумму заказа.
+type Refund struct {
+	ID               int64      `db:"id"`
+	OrderID          int64      `db:"order_id"`
+	PaymentID        int64      `db:"payment_id"`
+	ReturnID         *int64     `db:"return_id"`
+	Amount           float64    `db:"amount"`
+	Reason           string     `db:"reason"`
+	ProviderRefundID string     `db:"provider_refund_id"`
+	Status           string     `db:"status"`
+	LastError        *string    `db:"last_error"`
+	CreatedAt        time.Time  `db:"created_at"`
+	UpdatedAt        *time.Time `db:"updated_at"`
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+	ReturnStatusRefunded  = "refunded"
+)
+
+// Return - заявка покупателя на возврат части позиции заказа (RMA).
+type Return struct {
+	ID          int64      `db:"id"`
+	OrderID     int64      `db:"order_id"`
+	OrderItemID int64      `db:"order_item_id"`
+	Quantity    int64      `db:"quantity"`
+	Reason      string     `db:"reason"`
+	Status      string     `db:"status"`
+	AdminNote   string     `db:"admin_note"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   *time.Time `db:"updated_at"`
+}
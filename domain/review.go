@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// Review - отзыв покупателя о товаре. В рейтинг товара попадают только одобренные отзывы.
+type Review struct {
+	ID        int64      `db:"id"`
+	ProductID int64      `db:"product_id"`
+	UserID    int64      `db:"user_id"`
+	Rating    int64      `db:"rating"`
+	Comment   string     `db:"comment"`
+	Status    string     `db:"status"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt *time.Time `db:"updated_at"`
+}
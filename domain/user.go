@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+type User struct {
+	ID       int64  `db:"id"`
+	Name     string `db:"name"`
+	Email    string `db:"email"`
+	Password string `db:"password"`
+	IsAdmin  bool   `db:"is_admin"`
+}
+
+// PasswordResetToken - одноразовый токен сброса пароля. Хранится только его хеш.
+type PasswordResetToken struct {
+	ID        int64      `db:"id"`
+	UserID    int64      `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+// HashPasswordResetToken возвращает hex SHA-256 токена. Токен случайный и длинный,
+// поэтому соль не нужна, а поиск по хешу остается точным.
+func HashPasswordResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ProductOption - опция товара (например, "size") и её допустимые значения.
+type ProductOption struct {
+	ID        int64        `db:"id"`
+	ProductID int64        `db:"product_id"`
+	Name      string       `db:"name"`
+	Values    OptionValues `db:"values"`
+	CreatedAt time.Time    `db:"created_at"`
+}
+
+// ProductVariant - продаваемая комбинация опций товара со своим SKU, ценой и остатком.
+type ProductVariant struct {
+	ID           int64          `db:"id"`
+	ProductID    int64          `db:"product_id"`
+	SKU          string         `db:"sku"`
+	Options      VariantOptions `db:"options"`
+	Price        float64        `db:"price"`
+	CountInStock int64          `db:"count_in_stock"`
+	Image        string         `db:"image"`
+	Version      int64          `db:"version"`
+	CreatedAt    time.Time      `db:"created_at"`
+	UpdatedAt    *time.Time     `db:"updated_at"`
+}
+
+// OptionValues хранится в JSONB-массиве.
+type OptionValues []string
+
+func (v OptionValues) Value() (driver.Value, error) {
+	if v == nil {
+		v = OptionValues{}
+	}
+	return jsonValue(v)
+}
+
+func (v *OptionValues) Scan(src interface{}) error {
+	return jsonScan(src, v)
+}
+
+// VariantOptions - значения опций варианта, например {"size": "M", "color": "red"}. Хранится в JSONB.
+type VariantOptions map[string]string
+
+func (o VariantOptions) Value() (driver.Value, error) {
+	if o == nil {
+		o = VariantOptions{}
+	}
+	return jsonValue(o)
+}
+
+func (o *VariantOptions) Scan(src interface{}) error {
+	return jsonScan(src, o)
+}
+
+func jsonValue(v interface{}) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func jsonScan(src interface{}, dst interface{}) error {
+	switch src := src.(type) {
+	case []byte:
+		return json.Unmarshal(src, dst)
+	case string:
+		return json.Unmarshal([]byte(src), dst)
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into %T", src, dst)
+}
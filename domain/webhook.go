@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed" // Попытки исчерпаны, доставить можно только вручную
+)
+
+// WebhookSubscription - адрес партнера, куда отправляются события выбранных типов.
+// Тело каждого запроса подписывается Secret.
+type WebhookSubscription struct {
+	ID                  int64             `db:"id"`
+	URL                 string            `db:"url"`
+	EventTypes          WebhookEventTypes `db:"event_types"`
+	Secret              string            `db:"secret"`
+	Enabled             bool              `db:"enabled"`
+	ConsecutiveFailures int64             `db:"consecutive_failures"`
+	DisabledAt          *time.Time        `db:"disabled_at"`
+	CreatedAt           time.Time         `db:"created_at"`
+	UpdatedAt           *time.Time        `db:"updated_at"`
+}
+
+// WebhookEventTypes хранится в JSONB-массиве.
+type WebhookEventTypes []string
+
+func (t WebhookEventTypes) Value() (driver.Value, error) {
+	if t == nil {
+		t = WebhookEventTypes{}
+	}
+	return jsonValue(t)
+}
+
+func (t *WebhookEventTypes) Scan(src interface{}) error {
+	return jsonScan(src, t)
+}
+
+// WebhookDelivery - отправка одного события одной подписке вместе с результатом последней попытки.
+type WebhookDelivery struct {
+	ID             int64      `db:"id"`
+	SubscriptionID int64      `db:"subscription_id"`
+	EventID        int64      `db:"event_id"`
+	EventType      string     `db:"event_type"`
+	Body           string     `db:"body"`
+	Status         string     `db:"status"`
+	Attempts       int64      `db:"attempts"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	ResponseCode   *int64     `db:"response_code"`
+	ResponseBody   *string    `db:"response_body"`
+	LastError      *string    `db:"last_error"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      *time.Time `db:"updated_at"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+}
+
+// WebhookAttempt - результат одной попытки доставки. NextAttemptAt nil - попыток больше не будет.
+type WebhookAttempt struct {
+	DeliveryID    int64
+	Succeeded     bool
+	ResponseCode  *int64
+	ResponseBody  *string
+	Error         *string
+	NextAttemptAt *time.Time
+}
@@ -0,0 +1,24 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey - ключ, по которому объект не может лежать в хранилище
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore - хранилище двоичных объектов (картинок) по ключу.
+// Ключ выдает вызывающий код, хранилище его не интерпретирует.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get возвращает ErrNotFound, если объекта с таким ключом нет,
+	// и ErrInvalidKey, если ключ недопустим
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete не считает ошибкой отсутствие объекта
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,59 @@
+package blobstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStore(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *LocalStore)
+	}{
+		{
+			name: "put, get and delete",
+			test: func(t *testing.T, store *LocalStore) {
+				ctx := context.Background()
+				require.NoError(t, store.Put(ctx, "products/1/a.png", strings.NewReader("image")))
+
+				r, err := store.Get(ctx, "products/1/a.png")
+				require.NoError(t, err)
+				data, err := io.ReadAll(r)
+				require.NoError(t, r.Close())
+				require.NoError(t, err)
+				require.Equal(t, "image", string(data))
+
+				require.NoError(t, store.Delete(ctx, "products/1/a.png"))
+				_, err = store.Get(ctx, "products/1/a.png")
+				require.ErrorIs(t, err, ErrNotFound)
+			},
+		},
+		{
+			name: "delete missing blob",
+			test: func(t *testing.T, store *LocalStore) {
+				require.NoError(t, store.Delete(context.Background(), "missing.png"))
+			},
+		},
+		{
+			name: "key outside of root",
+			test: func(t *testing.T, store *LocalStore) {
+				err := store.Put(context.Background(), "../escape.png", strings.NewReader("image"))
+				require.ErrorIs(t, err, ErrInvalidKey)
+				_, err = store.Get(context.Background(), "/etc/passwd")
+				require.ErrorIs(t, err, ErrInvalidKey)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := NewLocalStore(t.TempDir())
+			require.NoError(t, err)
+			tc.test(t, store)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package gql
+
+import (
+	"context"
+	"ecomm/ecomm-api/service"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// Коды ошибок в extensions.code
+const (
+	codeNotFound        = "NOT_FOUND"
+	codeBadUserInput    = "BAD_USER_INPUT"
+	codeUnauthenticated = "UNAUTHENTICATED"
+	codeForbidden       = "FORBIDDEN"
+	codeConflict        = "CONFLICT"
+	codeQueryTooComplex = "QUERY_TOO_COMPLEX"
+	codeInternal        = "INTERNAL"
+)
+
+// queryError - ошибка, которую видит клиент. graphql-go кладет Extensions в ответ рядом с сообщением.
+type queryError struct {
+	message string
+	code    string
+}
+
+func (e *queryError) Error() string {
+	return e.message
+}
+
+func (e *queryError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+var _ gqlerrors.ExtendedError = (*queryError)(nil)
+
+// toQueryError переводит ошибку сервиса в ошибку поля. Сообщения те же, что отдает REST (responseWithError),
+// внутренние ошибки только логируются.
+func toQueryError(err error) error {
+	var (
+		errNotFound                *service.ErrNotFound
+		errNotFoundProductForOrder *service.ErrNotFoundProductForOrder
+		errValidation              *service.ErrValidation
+		errConflict                *service.ErrConflict
+		errUnauthorized            *service.ErrUnauthorized
+		errForbidden               *service.ErrForbidden
+		errQuery                   *queryError
+	)
+
+	switch {
+	case errors.As(err, &errQuery):
+		return errQuery
+	case errors.As(err, &errNotFound):
+		return &queryError{fmt.Sprintf("%s with id %v not found", errNotFound.Resource, errNotFound.ID), codeNotFound}
+	case errors.As(err, &errNotFoundProductForOrder):
+		return &queryError{"Some product for order not found", codeNotFound}
+	case errors.As(err, &errValidation):
+		return &queryError{errValidation.Message, codeBadUserInput}
+	case errors.As(err, &errConflict):
+		return &queryError{errConflict.Message, codeConflict}
+	case errors.As(err, &errUnauthorized):
+		return &queryError{errUnauthorized.Message, codeUnauthenticated}
+	case errors.As(err, &errForbidden):
+		return &queryError{errForbidden.Message, codeForbidden}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return &queryError{err.Error(), codeInternal}
+	}
+
+	log.Printf("GraphQL error: %v", err)
+	return &queryError{"Internal Server Error", codeInternal}
+}
+
+func badInput(format string, args ...interface{}) error {
+	return &queryError{fmt.Sprintf(format, args...), codeBadUserInput}
+}
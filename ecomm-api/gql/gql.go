@@ -0,0 +1,135 @@
+package gql
+
+import (
+	"context"
+	categoryDto "ecomm/ecomm-api/handler/dto/category"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	reviewDto "ecomm/ecomm-api/handler/dto/review"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/token"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request - тело POST /graphql.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Server выполняет запросы витрины поверх service: товары, категории, текущий пользователь и его заказы.
+type Server struct {
+	service *service.Service
+	limits  Limits
+}
+
+func NewServer(srv *service.Service, limits Limits) *Server {
+	return &Server{service: srv, limits: limits}
+}
+
+// Execute разбирает и проверяет запрос, отклоняет слишком глубокие и дорогие запросы и только потом выполняет его.
+// claims - пользователь из Bearer-токена, nil для анонимного запроса.
+func (s *Server) Execute(ctx context.Context, claims *token.UserClaims, req Request) *graphql.Result {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &graphql.Result{Errors: withCode(gqlerrors.FormatErrors(err), "GRAPHQL_PARSE_FAILED")}
+	}
+	if validation := graphql.ValidateDocument(&schema, doc, nil); !validation.IsValid {
+		return &graphql.Result{Errors: withCode(validation.Errors, "GRAPHQL_VALIDATION_FAILED")}
+	}
+	if err := s.limits.check(doc, req.OperationName, req.Variables); err != nil {
+		return &graphql.Result{Errors: withCode(gqlerrors.FormatErrors(err), codeQueryTooComplex)}
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(ctx, requestKey{}, newRequest(s.service, claims)),
+	})
+	for i := range result.Errors {
+		if result.Errors[i].Extensions == nil {
+			result.Errors[i].Extensions = extensionsOf(result.Errors[i])
+		}
+	}
+	return result
+}
+
+func withCode(errs []gqlerrors.FormattedError, code string) []gqlerrors.FormattedError {
+	for i := range errs {
+		errs[i].Extensions = map[string]interface{}{"code": code}
+	}
+	return errs
+}
+
+// extensionsOf ищет queryError в цепочке исходных ошибок. graphql-go теряет extensions у ошибок
+// отложенных значений: оборачивает их в FormattedError раньше, чем проверяет ExtendedError.
+func extensionsOf(err error) map[string]interface{} {
+	for err != nil {
+		switch e := err.(type) {
+		case *queryError:
+			return e.Extensions()
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return map[string]interface{}{"code": codeInternal}
+		}
+	}
+	return map[string]interface{}{"code": codeInternal}
+}
+
+type requestKey struct{}
+
+// request - состояние одного запроса. Загрузчики живут ровно запрос, поэтому их кэш не устаревает.
+type request struct {
+	service    *service.Service
+	claims     *token.UserClaims
+	products   *loader[int64, productDto.ProductRes]
+	reviews    *loader[int64, []reviewDto.ReviewRes]
+	categories *loader[int64, categoryDto.CategoryRes]
+}
+
+func newRequest(srv *service.Service, claims *token.UserClaims) *request {
+	return &request{
+		service: srv,
+		claims:  claims,
+		products: newLoader(func(ctx context.Context, ids []int64) (map[int64]productDto.ProductRes, error) {
+			products, err := srv.GetProductsByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int64]productDto.ProductRes, len(products))
+			for _, p := range products {
+				byID[p.ID] = p
+			}
+			return byID, nil
+		}),
+		reviews: newLoader(srv.GetReviewsByProductIDs),
+		// Категорий немного, поэтому первая же загрузка читает их все
+		categories: newLoader(func(ctx context.Context, _ []int64) (map[int64]categoryDto.CategoryRes, error) {
+			categories, err := srv.GetCategories(ctx)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[int64]categoryDto.CategoryRes, len(categories))
+			for _, c := range categories {
+				byID[c.ID] = c
+			}
+			return byID, nil
+		}),
+	}
+}
+
+func requestFrom(ctx context.Context) *request {
+	return ctx.Value(requestKey{}).(*request)
+}
@@ -0,0 +1,146 @@
+package gql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{
+			name: "keys of one level are fetched in one batch",
+			test: func(t *testing.T) {
+				var batches [][]int64
+				l := newLoader(func(ctx context.Context, keys []int64) (map[int64]string, error) {
+					batches = append(batches, keys)
+					return map[int64]string{1: "one", 2: "two"}, nil
+				})
+
+				ctx := context.Background()
+				one, two, three, again := l.load(ctx, 1), l.load(ctx, 2), l.load(ctx, 3), l.load(ctx, 1)
+
+				value, ok, err := two()
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.Equal(t, "two", value)
+				value, _, _ = one()
+				require.Equal(t, "one", value)
+				value, _, _ = again()
+				require.Equal(t, "one", value)
+				_, ok, err = three()
+				require.NoError(t, err)
+				require.False(t, ok)
+
+				// Повторная загрузка берется из кэша, в том числе отсутствующий ключ
+				_, ok, _ = l.load(ctx, 3)()
+				require.False(t, ok)
+				require.Equal(t, [][]int64{{1, 2, 3}}, batches)
+			},
+		},
+		{
+			name: "fetch error goes to every key of the batch",
+			test: func(t *testing.T) {
+				fetchErr := errors.New("db is down")
+				l := newLoader(func(ctx context.Context, keys []int64) (map[int64]string, error) {
+					return nil, fetchErr
+				})
+
+				ctx := context.Background()
+				one, two := l.load(ctx, 1), l.load(ctx, 2)
+				_, _, err := one()
+				require.ErrorIs(t, err, fetchErr)
+				_, _, err = two()
+				require.ErrorIs(t, err, fetchErr)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, tc.test)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{MaxDepth: 5, MaxComplexity: 300}
+
+	tcs := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		err       string
+	}{
+		{
+			name:  "small query",
+			query: `{ products(first: 10) { id name reviews { rating } } }`,
+		},
+		{
+			name:  "introspection is free",
+			query: `{ __schema { types { name fields { name type { name ofType { name ofType { name } } } } } } }`,
+		},
+		{
+			name:  "too deep",
+			query: `{ me { orders { orders { items { product { category { parent { name } } } } } } } }`,
+			err:   "query depth 8 exceeds the limit of 5",
+		},
+		{
+			name:  "too deep through fragments",
+			query: `{ me { ...Orders } } fragment Orders on User { orders { orders { ... on Order { items { product { category { name } } } } } } }`,
+			err:   "query depth 7 exceeds the limit of 5",
+		},
+		{
+			name:  "list size multiplies nested fields",
+			query: `{ products(first: 100) { id name price } }`,
+			err:   "query complexity 301 exceeds the limit of 300",
+		},
+		{
+			name:      "list size from a variable",
+			query:     `query Catalog($n: Int) { products(first: $n) { id name price } }`,
+			variables: map[string]interface{}{"n": float64(100)},
+			err:       "query complexity 301 exceeds the limit of 300",
+		},
+		{
+			name:  "list size from a variable default",
+			query: `query Catalog($n: Int = 100) { products(first: $n) { id name price } }`,
+			err:   "query complexity 301 exceeds the limit of 300",
+		},
+		{
+			// Сервис отдаст страницу по умолчанию, а отрицательный множитель обнулил бы стоимость
+			name:  "non-positive page size costs the default page",
+			query: `{ me { orders(pageSize: -5) { orders { id status } } } }`,
+			err:   "query complexity 422 exceeds the limit of 300",
+		},
+		{
+			name:      "zero page size from a variable",
+			query:     `query Orders($n: Int) { me { orders(pageSize: $n) { orders { id status } } } }`,
+			variables: map[string]interface{}{"n": float64(0)},
+			err:       "query complexity 422 exceeds the limit of 300",
+		},
+		{
+			name:  "argument default and unsized lists",
+			query: `{ products { reviews { id rating comment } } }`,
+			err:   "query complexity 621 exceeds the limit of 300",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(tc.query)})})
+			require.NoError(t, err)
+
+			err = limits.check(doc, "", tc.variables)
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits ограничивают запрос до выполнения. Глубина - число вложенных уровней полей.
+// Сложность - число полей, которые придется разрешить: поле-список умножает стоимость своих
+// подполей на ожидаемое число элементов (аргумент first или pageSize, иначе defaultListSize).
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+var DefaultLimits = Limits{MaxDepth: 8, MaxComplexity: 5000}
+
+// defaultListSize - оценка длины списка без аргумента размера, например отзывов товара.
+const defaultListSize = 10
+
+// Аргументы, задающие длину списка
+var listSizeArgs = []string{"first", "pageSize"}
+
+// check вызывается после валидации: фрагменты уже проверены на циклы, а поля - на существование.
+func (l Limits) check(doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	var operation *ast.OperationDefinition
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, definition := range doc.Definitions {
+		switch d := definition.(type) {
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				operation = d
+			}
+		case *ast.FragmentDefinition:
+			fragments[d.Name.Value] = d
+		}
+	}
+	if operation == nil {
+		// Выполнение вернет понятную ошибку про имя операции
+		return nil
+	}
+
+	// Значения переменных по умолчанию тоже задают размер списков
+	values := map[string]interface{}{}
+	for _, v := range operation.VariableDefinitions {
+		if n, ok := v.DefaultValue.(*ast.IntValue); ok {
+			values[v.Variable.Name.Value], _ = strconv.ParseFloat(n.Value, 64)
+		}
+	}
+	for name, value := range variables {
+		values[name] = value
+	}
+
+	c := &costCounter{fragments: fragments, variables: values}
+	complexity, depth := c.selectionSet(operation.SelectionSet, schema.QueryType(), 0)
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", depth, l.MaxDepth)
+	}
+	if l.MaxComplexity > 0 && complexity > l.MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, l.MaxComplexity)
+	}
+	return nil
+}
+
+type costCounter struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// selectionSet возвращает стоимость набора полей и глубину самой глубокой ветки.
+func (c *costCounter) selectionSet(set *ast.SelectionSet, parent *graphql.Object, depth int) (int, int) {
+	if set == nil {
+		return 0, depth
+	}
+	complexity, maxDepth := 0, depth
+	add := func(cost int, d int) {
+		complexity += cost
+		if d > maxDepth {
+			maxDepth = d
+		}
+	}
+
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			// Интроспекция не касается данных и не считается
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			add(c.field(s, parent, depth+1))
+		case *ast.InlineFragment:
+			add(c.selectionSet(s.SelectionSet, c.fragmentType(s.TypeCondition, parent), depth))
+		case *ast.FragmentSpread:
+			if fragment, ok := c.fragments[s.Name.Value]; ok {
+				add(c.selectionSet(fragment.SelectionSet, c.fragmentType(fragment.TypeCondition, parent), depth))
+			}
+		}
+	}
+	return complexity, maxDepth
+}
+
+func (c *costCounter) field(field *ast.Field, parent *graphql.Object, depth int) (int, int) {
+	definition, ok := parent.Fields()[field.Name.Value]
+	if !ok {
+		return 1, depth
+	}
+
+	fieldType, multiplier := definition.Type, 1
+	if nonNull, ok := fieldType.(*graphql.NonNull); ok {
+		fieldType = nonNull.OfType
+	}
+	if list, ok := fieldType.(*graphql.List); ok {
+		multiplier = c.listSize(field, definition)
+		fieldType = list.OfType
+		if nonNull, ok := fieldType.(*graphql.NonNull); ok {
+			fieldType = nonNull.OfType
+		}
+	}
+
+	object, ok := fieldType.(*graphql.Object)
+	if !ok {
+		return 1, depth
+	}
+	// Страница заказов сама не список, но ее размер задает pageSize поля-владельца
+	if multiplier == 1 {
+		if size, ok := c.sizeArg(field, definition); ok {
+			multiplier = size
+		}
+	}
+	children, childDepth := c.selectionSet(field.SelectionSet, object, depth)
+	return 1 + multiplier*children, childDepth
+}
+
+func (c *costCounter) listSize(field *ast.Field, definition *graphql.FieldDefinition) int {
+	if size, ok := c.sizeArg(field, definition); ok {
+		return size
+	}
+	return defaultListSize
+}
+
+// sizeArg читает размер списка из литерала, переменной или значения аргумента по умолчанию.
+// Сервис считает pageSize <= 0 отсутствующим и берет размер по умолчанию, поэтому такие значения
+// тоже заменяются значением аргумента по умолчанию. Множитель не бывает меньше 1.
+func (c *costCounter) sizeArg(field *ast.Field, definition *graphql.FieldDefinition) (int, bool) {
+	for _, name := range listSizeArgs {
+		for _, arg := range field.Arguments {
+			if arg.Name.Value != name {
+				continue
+			}
+			if n, ok := c.argValue(arg.Value); ok && n > 0 {
+				return n, true
+			}
+		}
+		for _, arg := range definition.Args {
+			if arg.Name() == name {
+				if n, ok := arg.DefaultValue.(int); ok {
+					return max(n, 1), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func (c *costCounter) argValue(value ast.Value) (int, bool) {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		if n, err := strconv.Atoi(value.Value); err == nil {
+			return n, true
+		}
+	case *ast.Variable:
+		switch n := c.variables[value.Name.Value].(type) {
+		case float64:
+			return int(n), true
+		case int:
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+func (c *costCounter) fragmentType(condition *ast.Named, parent *graphql.Object) *graphql.Object {
+	if condition == nil {
+		return parent
+	}
+	if object, ok := schema.Type(condition.Name.Value).(*graphql.Object); ok {
+		return object
+	}
+	return parent
+}
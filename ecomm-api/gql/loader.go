@@ -0,0 +1,78 @@
+package gql
+
+import (
+	"context"
+	"sync"
+)
+
+// loader копит ключи, запрошенные резолверами одного уровня запроса, и загружает их одним вызовом fetch.
+// graphql-go раскрывает отложенные значения (thunk) в ширину: сначала все резолверы уровня
+// регистрируют ключи через load, затем первый же вызванный thunk загружает всю пачку.
+// Результаты, в том числе отсутствие ключа и ошибки, кэшируются до конца запроса.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]loaded[V]
+}
+
+type loaded[V any] struct {
+	value V
+	ok    bool
+	err   error
+}
+
+func newLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, results: map[K]loaded[V]{}}
+}
+
+// load регистрирует ключ и возвращает thunk. Ключ, которого нет в результате fetch, дает ok=false.
+func (l *loader[K, V]) load(ctx context.Context, key K) func() (V, bool, error) {
+	l.mu.Lock()
+	if _, done := l.results[key]; !done && !l.isPending(key) {
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, bool, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.isPending(key) {
+			l.flush(ctx)
+		}
+		r := l.results[key]
+		return r.value, r.ok, r.err
+	}
+}
+
+func (l *loader[K, V]) isPending(key K) bool {
+	for _, k := range l.pending {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// flush загружает все ожидающие ключи. Вызывается под мьютексом.
+func (l *loader[K, V]) flush(ctx context.Context) {
+	keys := l.pending
+	l.pending = nil
+	values, err := l.fetch(ctx, keys)
+	if err != nil {
+		for _, key := range keys {
+			l.results[key] = loaded[V]{err: err}
+		}
+		return
+	}
+	// fetch может вернуть больше, чем просили: лишние значения тоже пригодятся
+	for key, value := range values {
+		l.results[key] = loaded[V]{value: value, ok: true}
+	}
+	for _, key := range keys {
+		if _, ok := values[key]; !ok {
+			l.results[key] = loaded[V]{}
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package gql
+
+import (
+	categoryDto "ecomm/ecomm-api/handler/dto/category"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	reviewDto "ecomm/ecomm-api/handler/dto/review"
+	"ecomm/ecomm-api/token"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultProductsFirst = 20
+	maxProductsFirst     = 100
+)
+
+// schema строится один раз: резолверы берут сервис и загрузчики из контекста запроса (см. request).
+var schema = mustSchema()
+
+// prop - резолвер поля, которое читается из DTO-источника без обращения к сервису.
+func prop[T any](get func(T) interface{}) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return get(p.Source.(T)), nil
+	}
+}
+
+// deferred превращает thunk загрузчика в отложенное значение graphql-go. Отсутствующий ключ дает null.
+func deferred[V any](thunk func() (V, bool, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		value, ok, err := thunk()
+		if err != nil {
+			return nil, toQueryError(err)
+		}
+		if !ok {
+			return nil, nil
+		}
+		return value, nil
+	}
+}
+
+func parseID(p graphql.ResolveParams, name string) (int64, error) {
+	raw, _ := p.Args[name].(string)
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, badInput("invalid %s", name)
+	}
+	return id, nil
+}
+
+func nonNull(t graphql.Output) graphql.Output {
+	return graphql.NewNonNull(t)
+}
+
+func listOf(t graphql.Output) graphql.Output {
+	return graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(t)))
+}
+
+func mustSchema() graphql.Schema {
+	type category = categoryDto.CategoryRes
+	categoryType := graphql.NewObject(graphql.ObjectConfig{Name: "Category", Fields: graphql.Fields{
+		"id":   &graphql.Field{Type: nonNull(graphql.ID), Resolve: prop(func(c category) interface{} { return c.ID })},
+		"name": &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(c category) interface{} { return c.Name })},
+		"slug": &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(c category) interface{} { return c.Slug })},
+	}})
+	// Поле parent ссылается на сам тип, поэтому добавляется после его создания
+	categoryType.AddFieldConfig("parent", &graphql.Field{
+		Type: categoryType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			c := p.Source.(category)
+			if c.ParentID == nil {
+				return nil, nil
+			}
+			return deferred(requestFrom(p.Context).categories.load(p.Context, *c.ParentID)), nil
+		},
+	})
+
+	type review = reviewDto.ReviewRes
+	reviewType := graphql.NewObject(graphql.ObjectConfig{Name: "Review", Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: nonNull(graphql.ID), Resolve: prop(func(r review) interface{} { return r.ID })},
+		"userId":    &graphql.Field{Type: nonNull(graphql.ID), Resolve: prop(func(r review) interface{} { return r.UserID })},
+		"rating":    &graphql.Field{Type: nonNull(graphql.Int), Resolve: prop(func(r review) interface{} { return r.Rating })},
+		"comment":   &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(r review) interface{} { return r.Comment })},
+		"createdAt": &graphql.Field{Type: nonNull(graphql.DateTime), Resolve: prop(func(r review) interface{} { return r.CreatedAt })},
+	}})
+
+	type product = productDto.ProductRes
+	productType := graphql.NewObject(graphql.ObjectConfig{Name: "Product", Fields: graphql.Fields{
+		"id":           &graphql.Field{Type: nonNull(graphql.ID), Resolve: prop(func(p product) interface{} { return p.ID })},
+		"sku":          &graphql.Field{Type: graphql.String, Resolve: prop(func(p product) interface{} { return p.SKU })},
+		"name":         &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(p product) interface{} { return p.Name })},
+		"image":        &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(p product) interface{} { return p.Image })},
+		"description":  &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(p product) interface{} { return p.Description })},
+		"price":        &graphql.Field{Type: nonNull(graphql.Float), Resolve: prop(func(p product) interface{} { return p.Price })},
+		"countInStock": &graphql.Field{Type: nonNull(graphql.Int), Resolve: prop(func(p product) interface{} { return p.CountInStock })},
+		"inStock":      &graphql.Field{Type: nonNull(graphql.Boolean), Resolve: prop(func(p product) interface{} { return p.CountInStock > 0 })},
+		"rating":       &graphql.Field{Type: nonNull(graphql.Float), Resolve: prop(func(p product) interface{} { return p.Rating })},
+		"numReviews":   &graphql.Field{Type: nonNull(graphql.Int), Resolve: prop(func(p product) interface{} { return p.NumReviews })},
+		"createdAt":    &graphql.Field{Type: nonNull(graphql.DateTime), Resolve: prop(func(p product) interface{} { return p.CreatedAt })},
+		"category": &graphql.Field{
+			Type: categoryType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return deferred(requestFrom(p.Context).categories.load(p.Context, p.Source.(product).CategoryID)), nil
+			},
+		},
+		"reviews": &graphql.Field{
+			Type:        listOf(reviewType),
+			Description: "Approved reviews",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				thunk := requestFrom(p.Context).reviews.load(p.Context, p.Source.(product).ID)
+				return func() (interface{}, error) {
+					reviews, _, err := thunk()
+					if err != nil {
+						return nil, toQueryError(err)
+					}
+					if reviews == nil {
+						reviews = []review{}
+					}
+					return reviews, nil
+				}, nil
+			},
+		},
+	}})
+
+	type orderItem = orderDto.OrderItemRes
+	orderItemType := graphql.NewObject(graphql.ObjectConfig{Name: "OrderItem", Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: nonNull(graphql.ID), Resolve: prop(func(i orderItem) interface{} { return i.ID })},
+		"name":      &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(i orderItem) interface{} { return i.Name })},
+		"quantity":  &graphql.Field{Type: nonNull(graphql.Int), Resolve: prop(func(i orderItem) interface{} { return i.Quantity })},
+		"image":     &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(i orderItem) interface{} { return i.Image })},
+		"price":     &graphql.Field{Type: nonNull(graphql.Float), Resolve: prop(func(i orderItem) interface{} { return i.Price })},
+		"productId": &graphql.Field{Type: nonNull(graphql.ID), Resolve: prop(func(i orderItem) interface{} { return i.ProductID })},
+		"variantId": &graphql.Field{Type: graphql.ID, Resolve: prop(func(i orderItem) interface{} {
+			if i.VariantID == nil {
+				return nil
+			}
+			return *i.VariantID
+		})},
+		"product": &graphql.Field{
+			Type:        productType,
+			Description: "Current product, null if it was deleted",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return deferred(requestFrom(p.Context).products.load(p.Context, p.Source.(orderItem).ProductID)), nil
+			},
+		},
+	}})
+
+	type order = orderDto.OrderRes
+	orderType := graphql.NewObject(graphql.ObjectConfig{Name: "Order", Fields: graphql.Fields{
+		"id":            &graphql.Field{Type: nonNull(graphql.ID), Resolve: prop(func(o order) interface{} { return o.ID })},
+		"status":        &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(o order) interface{} { return o.Status })},
+		"paymentMethod": &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(o order) interface{} { return o.PaymentMethod })},
+		"taxPrice":      &graphql.Field{Type: nonNull(graphql.Float), Resolve: prop(func(o order) interface{} { return o.TaxPrice })},
+		"shippingPrice": &graphql.Field{Type: nonNull(graphql.Float), Resolve: prop(func(o order) interface{} { return o.ShippingPrice })},
+		"totalPrice":    &graphql.Field{Type: nonNull(graphql.Float), Resolve: prop(func(o order) interface{} { return o.TotalPrice })},
+		"refundedPrice": &graphql.Field{Type: nonNull(graphql.Float), Resolve: prop(func(o order) interface{} { return o.RefundedPrice })},
+		"items":         &graphql.Field{Type: listOf(orderItemType), Resolve: prop(func(o order) interface{} { return o.Items })},
+		"cancellationReason": &graphql.Field{Type: graphql.String, Resolve: prop(func(o order) interface{} {
+			if o.CancellationReason == "" {
+				return nil
+			}
+			return o.CancellationReason
+		})},
+		"cancelledAt": &graphql.Field{Type: graphql.DateTime, Resolve: prop(func(o order) interface{} { return o.CancelledAt })},
+		"createdAt":   &graphql.Field{Type: nonNull(graphql.DateTime), Resolve: prop(func(o order) interface{} { return o.CreatedAt })},
+	}})
+
+	type orderPage = orderDto.OrdersPageRes
+	orderPageType := graphql.NewObject(graphql.ObjectConfig{Name: "OrderPage", Fields: graphql.Fields{
+		"orders":   &graphql.Field{Type: listOf(orderType), Resolve: prop(func(p orderPage) interface{} { return p.Orders })},
+		"page":     &graphql.Field{Type: nonNull(graphql.Int), Resolve: prop(func(p orderPage) interface{} { return p.Page })},
+		"pageSize": &graphql.Field{Type: nonNull(graphql.Int), Resolve: prop(func(p orderPage) interface{} { return p.PageSize })},
+		"total":    &graphql.Field{Type: nonNull(graphql.Int), Resolve: prop(func(p orderPage) interface{} { return p.Total })},
+	}})
+
+	type user = *token.UserClaims
+	userType := graphql.NewObject(graphql.ObjectConfig{Name: "User", Fields: graphql.Fields{
+		"id":      &graphql.Field{Type: nonNull(graphql.ID), Resolve: prop(func(u user) interface{} { return u.ID })},
+		"email":   &graphql.Field{Type: nonNull(graphql.String), Resolve: prop(func(u user) interface{} { return u.Email })},
+		"isAdmin": &graphql.Field{Type: nonNull(graphql.Boolean), Resolve: prop(func(u user) interface{} { return u.IsAdmin })},
+		"orders": &graphql.Field{
+			Type: nonNull(orderPageType),
+			Args: graphql.FieldConfigArgument{
+				"page":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+				"pageSize": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 20},
+				"status":   &graphql.ArgumentConfig{Type: graphql.String},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				req := &orderDto.GetOrdersReq{}
+				if page, ok := p.Args["page"].(int); ok {
+					req.Page = int64(page)
+				}
+				if pageSize, ok := p.Args["pageSize"].(int); ok {
+					req.PageSize = int64(pageSize)
+				}
+				req.Status, _ = p.Args["status"].(string)
+				page, err := requestFrom(p.Context).service.GetMyOrders(p.Context, p.Source.(user), req)
+				if err != nil {
+					return nil, toQueryError(err)
+				}
+				return page, nil
+			},
+		},
+	}})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"product": &graphql.Field{
+				Type: productType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p, "id")
+					if err != nil {
+						return nil, err
+					}
+					// Через загрузчик, чтобы товар не читался повторно, если он встретится в заказе
+					return deferred(requestFrom(p.Context).products.load(p.Context, id)), nil
+				},
+			},
+			"products": &graphql.Field{
+				Type:        listOf(productType),
+				Description: "Catalog page, a category includes its subcategories",
+				Args: graphql.FieldConfigArgument{
+					"category": &graphql.ArgumentConfig{Type: graphql.String, Description: "Category slug"},
+					"inStock":  &graphql.ArgumentConfig{Type: graphql.Boolean},
+					"first":    &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultProductsFirst},
+					"offset":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: resolveProducts,
+			},
+			"categories": &graphql.Field{
+				Type: listOf(categoryType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					categories, err := requestFrom(p.Context).service.GetCategories(p.Context)
+					if err != nil {
+						return nil, toQueryError(err)
+					}
+					return categories, nil
+				},
+			},
+			"category": &graphql.Field{
+				Type: categoryType,
+				Args: graphql.FieldConfigArgument{"slug": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					c, err := requestFrom(p.Context).service.GetCategory(p.Context, p.Args["slug"].(string))
+					if err != nil {
+						return nil, toQueryError(err)
+					}
+					return c, nil
+				},
+			},
+			"me": &graphql.Field{
+				Type:        userType,
+				Description: "Current user, null without a bearer token",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					claims := requestFrom(p.Context).claims
+					if claims == nil {
+						return nil, nil
+					}
+					return claims, nil
+				},
+			},
+			"order": &graphql.Field{
+				Type:        orderType,
+				Description: "Order of the current user, admins see any order",
+				Args:        graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					req := requestFrom(p.Context)
+					if req.claims == nil {
+						return nil, &queryError{"missing bearer token", codeUnauthenticated}
+					}
+					id, err := parseID(p, "id")
+					if err != nil {
+						return nil, err
+					}
+					o, err := req.service.GetOrder(p.Context, id, req.claims)
+					if err != nil {
+						return nil, toQueryError(err)
+					}
+					return o, nil
+				},
+			},
+		},
+	})
+
+	s, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		panic("gql: invalid schema: " + err.Error())
+	}
+	return s
+}
+
+// resolveProducts отдает страницу каталога, страница выбирается в базе.
+func resolveProducts(p graphql.ResolveParams) (interface{}, error) {
+	first, _ := p.Args["first"].(int)
+	offset, _ := p.Args["offset"].(int)
+	if first < 1 || first > maxProductsFirst {
+		return nil, badInput("first must be between 1 and %d", maxProductsFirst)
+	}
+	if offset < 0 {
+		return nil, badInput("offset must not be negative")
+	}
+
+	category, _ := p.Args["category"].(string)
+	var inStock *bool
+	if value, ok := p.Args["inStock"].(bool); ok {
+		inStock = &value
+	}
+	products, err := requestFrom(p.Context).service.ListProducts(p.Context, category, inStock, first, offset)
+	if err != nil {
+		return nil, toQueryError(err)
+	}
+	return products, nil
+}
@@ -0,0 +1,79 @@
+package grpcapi
+
+import (
+	"context"
+	"ecomm/ecomm-api/grpcapi/ecommpb"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/token"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type authKey struct{}
+
+// authenticator проверяет Bearer-токен из метаданных authorization, как authenticate в REST.
+// Каталог открыт, для методов OrderService токен обязателен.
+type authenticator struct {
+	tokenMaker *token.JWTMaker
+}
+
+func requiresAuth(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+ecommpb.OrderService_ServiceDesc.ServiceName+"/")
+}
+
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !requiresAuth(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return handler(ctx, req)
+}
+
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !requiresAuth(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return toStatus(err)
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	op := "grpc.authenticate"
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, service.NewErrUnauthorized(op, "missing bearer token", nil)
+	}
+	tokenStr, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || tokenStr == "" {
+		return nil, service.NewErrUnauthorized(op, "missing bearer token", nil)
+	}
+	claims, err := a.tokenMaker.VerifyToken(tokenStr)
+	if err != nil {
+		return nil, service.NewErrUnauthorized(op, "invalid token", err)
+	}
+	return context.WithValue(ctx, authKey{}, claims), nil
+}
+
+// authenticatedStream подменяет контекст потока на контекст с claims.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func claimsFromContext(ctx context.Context) *token.UserClaims {
+	claims, _ := ctx.Value(authKey{}).(*token.UserClaims)
+	return claims
+}
@@ -0,0 +1,124 @@
+package grpcapi
+
+import (
+	"ecomm/ecomm-api/grpcapi/ecommpb"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Сообщения строятся из тех же DTO, что отдает REST, чтобы оба API не расходились в полях.
+
+func toProduct(p productDto.ProductRes) *ecommpb.Product {
+	return &ecommpb.Product{
+		Id:           p.ID,
+		Sku:          p.SKU,
+		Name:         p.Name,
+		Image:        p.Image,
+		CategoryId:   p.CategoryID,
+		Description:  p.Description,
+		Rating:       p.Rating,
+		NumReviews:   p.NumReviews,
+		Price:        p.Price,
+		CountInStock: p.CountInStock,
+		Version:      p.Version,
+		CreatedAt:    timestamppb.New(p.CreatedAt),
+		UpdatedAt:    toTimestamp(p.UpdatedAt),
+	}
+}
+
+func toOrder(o orderDto.OrderRes) *ecommpb.Order {
+	order := &ecommpb.Order{
+		Id:                 o.ID,
+		UserId:             o.UserID,
+		PaymentMethod:      o.PaymentMethod,
+		Status:             o.Status,
+		TaxPrice:           o.TaxPrice,
+		ShippingPrice:      o.ShippingPrice,
+		TotalPrice:         o.TotalPrice,
+		RefundedPrice:      o.RefundedPrice,
+		CancellationReason: o.CancellationReason,
+		CancelledAt:        toTimestamp(o.CancelledAt),
+		CreatedAt:          timestamppb.New(o.CreatedAt),
+		UpdatedAt:          toTimestamp(o.UpdatedAt),
+	}
+	for _, item := range o.Items {
+		order.Items = append(order.Items, &ecommpb.OrderItem{
+			Id:        item.ID,
+			Name:      item.Name,
+			Quantity:  item.Quantity,
+			Image:     item.Image,
+			Price:     item.Price,
+			ProductId: item.ProductID,
+			VariantId: item.VariantID,
+		})
+	}
+	if p := o.Payment; p != nil {
+		order.Payment = &ecommpb.Payment{
+			Id:              p.ID,
+			Provider:        p.Provider,
+			Method:          p.Method,
+			Status:          p.Status,
+			Amount:          p.Amount,
+			CapturedAmount:  p.CapturedAmount,
+			RefundedAmount:  p.RefundedAmount,
+			AuthorizationId: p.AuthorizationID,
+			CreatedAt:       timestamppb.New(p.CreatedAt),
+			UpdatedAt:       toTimestamp(p.UpdatedAt),
+		}
+	}
+	return order
+}
+
+func toOrdersPage(page orderDto.OrdersPageRes) *ecommpb.ListOrdersResponse {
+	res := &ecommpb.ListOrdersResponse{Page: page.Page, PageSize: page.PageSize, Total: page.Total}
+	for _, o := range page.Orders {
+		res.Orders = append(res.Orders, toOrder(o))
+	}
+	return res
+}
+
+func toCreateOrderReq(req *ecommpb.CreateOrderRequest) *orderDto.CreateOrderReq {
+	createOrderReq := &orderDto.CreateOrderReq{
+		PaymentMethod: req.GetPaymentMethod(),
+		PaymentToken:  req.GetPaymentToken(),
+	}
+	for _, item := range req.GetItems() {
+		createOrderReq.Items = append(createOrderReq.Items, orderDto.CreateOrderItemReq{
+			Quantity:  item.GetQuantity(),
+			ProductID: item.GetProductId(),
+			VariantID: item.VariantId,
+		})
+	}
+	return createOrderReq
+}
+
+func toGetOrdersReq(req *ecommpb.ListOrdersRequest) *orderDto.GetOrdersReq {
+	return &orderDto.GetOrdersReq{
+		Page:     req.GetPage(),
+		PageSize: req.GetPageSize(),
+		Status:   req.GetStatus(),
+		UserID:   req.GetUserId(),
+		From:     fromTimestamp(req.GetFrom()),
+		To:       fromTimestamp(req.GetTo()),
+		MinTotal: req.MinTotal,
+		MaxTotal: req.MaxTotal,
+	}
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
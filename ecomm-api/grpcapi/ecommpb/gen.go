@@ -0,0 +1,4 @@
+// Package ecommpb - сгенерированный код gRPC API. Файлы *.pb.go не правятся руками.
+package ecommpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative products.proto orders.proto
@@ -0,0 +1,58 @@
+package grpcapi
+
+import (
+	"context"
+	"ecomm/ecomm-api/service"
+	"errors"
+	"log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus переводит ошибку сервиса в статус gRPC. Сообщения те же, что отдает REST (responseWithError),
+// внутренние ошибки только логируются.
+func toStatus(err error) error {
+	var (
+		errNotFound                *service.ErrNotFound
+		errNotEnough               *service.ErrNotEnoughStock
+		errNotFoundProductForOrder *service.ErrNotFoundProductForOrder
+		errPaymentDeclined         *service.ErrPaymentDeclined
+		errValidation              *service.ErrValidation
+		errConflict                *service.ErrConflict
+		errUnauthorized            *service.ErrUnauthorized
+		errForbidden               *service.ErrForbidden
+		errPreconditionFailed      *service.ErrPreconditionFailed
+	)
+
+	switch {
+	case errors.As(err, &errNotFound):
+		return status.Errorf(codes.NotFound, "%s with id %v not found", errNotFound.Resource, errNotFound.ID)
+	case errors.As(err, &errNotEnough):
+		return status.Errorf(codes.FailedPrecondition, "not enough stock for %s with id %v. Requested: %d, Available: %d",
+			errNotEnough.Resource, errNotEnough.ID, errNotEnough.Requested, errNotEnough.Available)
+	case errors.As(err, &errNotFoundProductForOrder):
+		return status.Error(codes.NotFound, "Some product for order not found")
+	case errors.As(err, &errPaymentDeclined):
+		return status.Errorf(codes.FailedPrecondition, "payment declined: %s", errPaymentDeclined.Reason)
+	case errors.As(err, &errValidation):
+		return status.Error(codes.InvalidArgument, errValidation.Message)
+	case errors.As(err, &errConflict):
+		return status.Error(codes.FailedPrecondition, errConflict.Message)
+	case errors.As(err, &errUnauthorized):
+		return status.Error(codes.Unauthenticated, errUnauthorized.Message)
+	case errors.As(err, &errForbidden):
+		return status.Error(codes.PermissionDenied, errForbidden.Message)
+	case errors.As(err, &errPreconditionFailed):
+		return status.Error(codes.FailedPrecondition, errPreconditionFailed.Message)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+
+	// Ошибка отправки в поток уже несет статус gRPC
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	log.Printf("gRPC error: %v", err)
+	return status.Error(codes.Internal, "Internal Server Error")
+}
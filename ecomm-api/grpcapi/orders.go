@@ -0,0 +1,57 @@
+package grpcapi
+
+import (
+	"context"
+	"ecomm/ecomm-api/grpcapi/ecommpb"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	"ecomm/ecomm-api/service"
+)
+
+type orderServer struct {
+	ecommpb.UnimplementedOrderServiceServer
+	service *service.Service
+}
+
+func (s *orderServer) CreateOrder(ctx context.Context, req *ecommpb.CreateOrderRequest) (*ecommpb.Order, error) {
+	orderRes, err := s.service.CreateOrder(ctx, claimsFromContext(ctx), toCreateOrderReq(req))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toOrder(orderRes), nil
+}
+
+func (s *orderServer) GetOrder(ctx context.Context, req *ecommpb.GetOrderRequest) (*ecommpb.Order, error) {
+	orderRes, err := s.service.GetOrder(ctx, req.GetId(), claimsFromContext(ctx))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toOrder(orderRes), nil
+}
+
+func (s *orderServer) CancelOrder(ctx context.Context, req *ecommpb.CancelOrderRequest) (*ecommpb.Order, error) {
+	orderRes, err := s.service.CancelOrder(ctx, req.GetId(), claimsFromContext(ctx), &orderDto.CancelOrderReq{Reason: req.GetReason()})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toOrder(orderRes), nil
+}
+
+func (s *orderServer) ListMyOrders(ctx context.Context, req *ecommpb.ListOrdersRequest) (*ecommpb.ListOrdersResponse, error) {
+	page, err := s.service.GetMyOrders(ctx, claimsFromContext(ctx), toGetOrdersReq(req))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toOrdersPage(page), nil
+}
+
+// ListOrders - все заказы, как GET /orders, только для администратора.
+func (s *orderServer) ListOrders(ctx context.Context, req *ecommpb.ListOrdersRequest) (*ecommpb.ListOrdersResponse, error) {
+	if claims := claimsFromContext(ctx); claims == nil || !claims.IsAdmin {
+		return nil, toStatus(service.NewErrForbidden("grpc.ListOrders", "admin only"))
+	}
+	page, err := s.service.GetOrders(ctx, toGetOrdersReq(req))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toOrdersPage(page), nil
+}
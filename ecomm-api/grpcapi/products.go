@@ -0,0 +1,40 @@
+package grpcapi
+
+import (
+	"context"
+	"ecomm/ecomm-api/grpcapi/ecommpb"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/service"
+
+	"google.golang.org/grpc"
+)
+
+type productServer struct {
+	ecommpb.UnimplementedProductServiceServer
+	service *service.Service
+}
+
+func (s *productServer) GetProduct(ctx context.Context, req *ecommpb.GetProductRequest) (*ecommpb.Product, error) {
+	productRes, err := s.service.GetProduct(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProduct(productRes), nil
+}
+
+// ListProducts читает каталог страницами и отправляет товары, не дожидаясь конца выборки.
+// Удаленные товары в поток не попадают.
+func (s *productServer) ListProducts(req *ecommpb.ListProductsRequest, stream grpc.ServerStreamingServer[ecommpb.Product]) error {
+	exportReq := &productDto.ExportProductsReq{
+		Category:     req.GetCategory(),
+		UpdatedSince: fromTimestamp(req.GetUpdatedSince()),
+		InStock:      req.GetInStock(),
+	}
+	err := s.service.StreamProducts(stream.Context(), exportReq, func(productRes productDto.ProductRes) error {
+		return stream.Send(toProduct(productRes))
+	})
+	if err != nil {
+		return toStatus(err)
+	}
+	return nil
+}
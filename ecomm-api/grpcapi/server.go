@@ -0,0 +1,28 @@
+// Package grpcapi - gRPC API каталога и заказов для внутренних сервисов. Работает поверх того же
+// service.Service, что и REST, поэтому проверки, транзакции и ошибки у них общие.
+package grpcapi
+
+import (
+	"ecomm/ecomm-api/grpcapi/ecommpb"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/token"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// NewServer создает gRPC-сервер с сервисами товаров и заказов. reflection нужен grpcurl и похожим
+// утилитам без .proto файлов, но раскрывает схему API, поэтому по умолчанию выключен.
+func NewServer(srv *service.Service, tokenMaker *token.JWTMaker, enableReflection bool) *grpc.Server {
+	auth := &authenticator{tokenMaker: tokenMaker}
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auth.unary),
+		grpc.ChainStreamInterceptor(auth.stream),
+	)
+	ecommpb.RegisterProductServiceServer(server, &productServer{service: srv})
+	ecommpb.RegisterOrderServiceServer(server, &orderServer{service: srv})
+	if enableReflection {
+		reflection.Register(server)
+	}
+	return server
+}
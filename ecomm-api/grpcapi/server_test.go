@@ -0,0 +1,204 @@
+package grpcapi
+
+import (
+	"context"
+	"ecomm/ecomm-api/blobstore"
+	"ecomm/ecomm-api/grpcapi/ecommpb"
+	"ecomm/ecomm-api/payments"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/storer"
+	"ecomm/ecomm-api/token"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var testTokenMaker = token.NewJWTMaker("test-secret")
+
+// withTestClient поднимает gRPC-сервер поверх sqlmock в памяти и подключает к нему клиента.
+func withTestClient(t *testing.T, fn func(*grpc.ClientConn, sqlmock.Sqlmock)) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	blobs, err := blobstore.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	srv := service.NewService(storer.NewPostgresStorer(sqlx.NewDb(mockDB, "postgres")), payments.NewFakeProvider(), blobs)
+
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(srv, testTokenMaker, false)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	fn(conn, mock)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func withToken(t *testing.T, userID int64, isAdmin bool) context.Context {
+	accessToken, _, err := testTokenMaker.CreateToken(userID, "user@example.com", isAdmin, time.Hour)
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+accessToken)
+}
+
+func TestServer(t *testing.T) {
+	productColumns := []string{"id", "sku", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at", "deleted_at"}
+	createdAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *grpc.ClientConn, sqlmock.Sqlmock)
+	}{
+		{
+			name: "get product",
+			test: func(t *testing.T, conn *grpc.ClientConn, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "LAMP-1", "Desk lamp", "lamp.jpg", 3, "", 4.5, 2, 19.5, 5, 2, createdAt, nil, nil))
+
+				product, err := ecommpb.NewProductServiceClient(conn).GetProduct(context.Background(), &ecommpb.GetProductRequest{Id: 1})
+				require.NoError(t, err)
+				require.Equal(t, "LAMP-1", product.GetSku())
+				require.Equal(t, int64(2), product.GetVersion())
+				require.Equal(t, createdAt, product.GetCreatedAt().AsTime())
+				require.Nil(t, product.GetUpdatedAt())
+			},
+		},
+		{
+			name: "get missing product",
+			test: func(t *testing.T, conn *grpc.ClientConn, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows(productColumns))
+
+				_, err := ecommpb.NewProductServiceClient(conn).GetProduct(context.Background(), &ecommpb.GetProductRequest{Id: 7})
+				require.Equal(t, codes.NotFound, status.Code(err))
+				require.Equal(t, "product with id 7 not found", status.Convert(err).Message())
+			},
+		},
+		{
+			name: "list products streams every product",
+			test: func(t *testing.T, conn *grpc.ClientConn, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE count_in_stock > 0 AND deleted_at IS NULL ORDER BY id LIMIT $1")).
+					WithArgs(500).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "LAMP-1", "Desk lamp", "lamp.jpg", 3, "", 0, 0, 19.5, 5, 1, createdAt, nil, nil).
+						AddRow(2, nil, "Chair", "chair.jpg", 4, "", 0, 0, 120, 1, 1, createdAt, nil, nil))
+
+				stream, err := ecommpb.NewProductServiceClient(conn).ListProducts(context.Background(), &ecommpb.ListProductsRequest{InStock: true})
+				require.NoError(t, err)
+				var names []string
+				for {
+					product, err := stream.Recv()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					require.NoError(t, err)
+					names = append(names, product.GetName())
+				}
+				require.Equal(t, []string{"Desk lamp", "Chair"}, names)
+			},
+		},
+		{
+			name: "orders require a token",
+			test: func(t *testing.T, conn *grpc.ClientConn, mock sqlmock.Sqlmock) {
+				_, err := ecommpb.NewOrderServiceClient(conn).GetOrder(context.Background(), &ecommpb.GetOrderRequest{Id: 1})
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		{
+			name: "list all orders is admin only",
+			test: func(t *testing.T, conn *grpc.ClientConn, mock sqlmock.Sqlmock) {
+				_, err := ecommpb.NewOrderServiceClient(conn).ListOrders(withToken(t, 5, false), &ecommpb.ListOrdersRequest{})
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		{
+			name: "validation error",
+			test: func(t *testing.T, conn *grpc.ClientConn, mock sqlmock.Sqlmock) {
+				_, err := ecommpb.NewOrderServiceClient(conn).CancelOrder(withToken(t, 5, false), &ecommpb.CancelOrderRequest{Id: 1})
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+				require.Equal(t, "cancellation reason is required", status.Convert(err).Message())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestClient(t, func(conn *grpc.ClientConn, mock sqlmock.Sqlmock) {
+				tc.test(t, conn, mock)
+			})
+		})
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	tcs := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		message string
+	}{
+		{
+			name:    "not found",
+			err:     &service.ErrNotFound{Resource: "order", ID: int64(3)},
+			code:    codes.NotFound,
+			message: "order with id 3 not found",
+		},
+		{
+			name:    "not enough stock",
+			err:     fmt.Errorf("creating order: %w", &service.ErrNotEnoughStock{Resource: "product", ID: int64(2), Requested: 5, Available: 1}),
+			code:    codes.FailedPrecondition,
+			message: "not enough stock for product with id 2. Requested: 5, Available: 1",
+		},
+		{
+			name:    "product for order not found",
+			err:     &service.ErrNotFoundProductForOrder{Resource: "product", ID: int64(9)},
+			code:    codes.NotFound,
+			message: "Some product for order not found",
+		},
+		{
+			name: "cancelled by client",
+			err:  fmt.Errorf("error in transaction: %w", context.Canceled),
+			code: codes.Canceled,
+		},
+		{
+			name:    "unknown error is hidden",
+			err:     errors.New("pq: connection refused"),
+			code:    codes.Internal,
+			message: "Internal Server Error",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			st := status.Convert(toStatus(tc.err))
+			require.Equal(t, tc.code, st.Code())
+			if tc.message != "" {
+				require.Equal(t, tc.message, st.Message())
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	categoryDto "ecomm/ecomm-api/handler/dto/category"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+func (h *handler) createCategory(w http.ResponseWriter, r *http.Request) {
+	var createCategoryReq categoryDto.CreateCategoryReq
+	if err := json.NewDecoder(r.Body).Decode(&createCategoryReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	categoryRes, err := h.service.CreateCategory(r.Context(), &createCategoryReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, categoryRes)
+}
+
+func (h *handler) getCategories(w http.ResponseWriter, r *http.Request) {
+	categoriesRes, err := h.service.GetCategories(r.Context())
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, categoriesRes)
+}
+
+func (h *handler) getCategory(w http.ResponseWriter, r *http.Request) {
+	categoryRes, err := h.service.GetCategory(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, categoryRes)
+}
+
+func (h *handler) updateCategory(w http.ResponseWriter, r *http.Request) {
+	var updateCategoryReq categoryDto.UpdateCategoryReq
+	if err := json.NewDecoder(r.Body).Decode(&updateCategoryReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	categoryRes, err := h.service.UpdateCategory(r.Context(), chi.URLParam(r, "slug"), &updateCategoryReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, categoryRes)
+}
+
+func (h *handler) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteCategory(r.Context(), chi.URLParam(r, "slug")); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *handler) getCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	productsRes, err := h.service.GetCategoryProducts(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, productsRes)
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategories(t *testing.T) {
+	categoryColumns := []string{"id", "parent_id", "name", "slug", "created_at", "updated_at"}
+	selectBySlug := regexp.QuoteMeta("SELECT * FROM categories WHERE slug=$1")
+
+	createCategory := func(t *testing.T, server *httptest.Server, isAdmin bool, body string) (*http.Response, map[string]interface{}) {
+		accessToken, _, err := testTokenMaker.CreateToken(1, "admin@example.com", isAdmin, time.Hour)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/categories", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&resBody))
+		return res, resBody
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "create with slug from name and parent",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectBySlug).WithArgs("electronics").
+					WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(1, nil, "Electronics", "electronics", time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO categories (parent_id, name, slug) VALUES ($1, $2, $3) RETURNING *")).
+					WithArgs(sqlmock.AnyArg(), "Mobile Phones", "mobile-phones").
+					WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(2, 1, "Mobile Phones", "mobile-phones", time.Now(), nil))
+
+				res, body := createCategory(t, server, true, `{"name": " Mobile Phones ", "parent_slug": "electronics"}`)
+				require.Equal(t, http.StatusCreated, res.StatusCode)
+				require.Equal(t, "mobile-phones", body["slug"])
+				require.Equal(t, float64(1), body["parent_id"])
+			},
+		},
+		{
+			name: "invalid slug",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := createCategory(t, server, true, `{"name": "Phones", "slug": "Phones!"}`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+			},
+		},
+		{
+			name: "create requires admin",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := createCategory(t, server, false, `{"name": "Phones"}`)
+				require.Equal(t, http.StatusForbidden, res.StatusCode)
+			},
+		},
+		{
+			name: "products include descendants",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectBySlug).WithArgs("electronics").
+					WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(1, nil, "Electronics", "electronics", time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE tree AS")).WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "category_id"}).AddRow(10, "phone", 2))
+
+				res, err := http.Get(server.URL + "/categories/electronics/products")
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode)
+
+				var products []map[string]interface{}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&products))
+				require.Len(t, products, 1)
+				require.Equal(t, float64(2), products[0]["category_id"])
+			},
+		},
+		{
+			name: "unknown category",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectBySlug).WithArgs("nope").WillReturnRows(sqlmock.NewRows(categoryColumns))
+
+				res, err := http.Get(server.URL + "/categories/nope/products")
+				require.NoError(t, err)
+				res.Body.Close()
+				require.Equal(t, http.StatusNotFound, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package categoryDto
+
+import "time"
+
+// Slug можно не указывать - он будет построен из Name.
+type CreateCategoryReq struct {
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+	ParentSlug string `json:"parent_slug"`
+}
+
+// UpdateCategoryReq заменяет категорию целиком, пустой ParentSlug делает её корневой.
+type UpdateCategoryReq struct {
+	Name       string `json:"name"`
+	Slug       string `json:"slug"`
+	ParentSlug string `json:"parent_slug"`
+}
+
+type CategoryRes struct {
+	ID        int64      `json:"id"`
+	ParentID  *int64     `json:"parent_id"`
+	Name      string     `json:"name"`
+	Slug      string     `json:"slug"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
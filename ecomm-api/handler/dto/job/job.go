@@ -0,0 +1,20 @@
+package jobDto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobRes struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int64           `json:"attempts"`
+	MaxAttempts int64           `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   *string         `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   *time.Time      `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
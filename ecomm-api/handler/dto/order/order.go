@@ -3,13 +3,15 @@ package orderDto
 import "time"
 
 type CreateOrderReq struct {
-	PaymentMethod string `json:"payment_method"`
-	Items         []CreateOrderItemReq
+	PaymentMethod string               `json:"payment_method"`
+	PaymentToken  string               `json:"payment_token"`
+	Items         []CreateOrderItemReq `json:"items"`
 }
 
 type CreateOrderItemReq struct {
-	Quantity  int64 `json:"quantity"`
-	ProductID int64 `json:"product_id"`
+	Quantity  int64  `json:"quantity"`
+	ProductID int64  `json:"product_id"`
+	VariantID *int64 `json:"variant_id"` // Обязателен, если у товара есть варианты
 }
 
 type OrderItemRes struct {
@@ -19,16 +21,85 @@ type OrderItemRes struct {
 	Image     string  `json:"image"`
 	Price     float64 `json:"price"`
 	ProductID int64   `json:"product_id"`
+	VariantID *int64  `json:"variant_id,omitempty"`
 	OrderID   int64   `json:"order_id"`
 }
 
+type PaymentRes struct {
+	ID              int64      `json:"id"`
+	Provider        string     `json:"provider"`
+	Method          string     `json:"method"`
+	Status          string     `json:"status"`
+	Amount          float64    `json:"amount"`
+	CapturedAmount  float64    `json:"captured_amount"`
+	RefundedAmount  float64    `json:"refunded_amount"`
+	AuthorizationID string     `json:"authorization_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+}
+
+type CancelOrderReq struct {
+	Reason string `json:"reason"`
+}
+
+// ShipOrderReq - трек-номер необязателен, но без него письмо об отправке будет без ссылки на посылку.
+type ShipOrderReq struct {
+	TrackingNumber string `json:"tracking_number"`
+}
+
+type CreateRefundReq struct {
+	Amount *float64 `json:"amount"` // Если не указана - весь остаток оплаченной суммы
+	Reason string   `json:"reason"`
+}
+
+type RefundRes struct {
+	ID               int64     `json:"id"`
+	OrderID          int64     `json:"order_id"`
+	PaymentID        int64     `json:"payment_id"`
+	ReturnID         *int64    `json:"return_id"`
+	Amount           float64   `json:"amount"`
+	Reason           string    `json:"reason"`
+	ProviderRefundID string    `json:"provider_refund_id"`
+	Status           string    `json:"status"` // pending, succeeded, failed
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 type OrderRes struct {
-	ID            int64          `json:"id"`
-	PaymentMethod string         `json:"payment_method"`
-	TaxPrice      float64        `json:"tax_price"`
-	ShippingPrice float64        `json:"shipping_price"`
-	TotalPrice    float64        `json:"total_price"`
-	Items         []OrderItemRes `json:"items"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     *time.Time     `json:"updated_at"`
+	ID                 int64          `json:"id"`
+	UserID             int64          `json:"user_id"`
+	PaymentMethod      string         `json:"payment_method"`
+	Status             string         `json:"status"`
+	TaxPrice           float64        `json:"tax_price"`
+	ShippingPrice      float64        `json:"shipping_price"`
+	TotalPrice         float64        `json:"total_price"`
+	RefundedPrice      float64        `json:"refunded_price"`
+	Items              []OrderItemRes `json:"items"`
+	Payment            *PaymentRes    `json:"payment,omitempty"`
+	Refunds            []RefundRes    `json:"refunds,omitempty"`
+	CancellationReason string         `json:"cancellation_reason,omitempty"`
+	CancelledAt        *time.Time     `json:"cancelled_at,omitempty"`
+	TrackingNumber     *string        `json:"tracking_number,omitempty"`
+	ShippedAt          *time.Time     `json:"shipped_at,omitempty"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          *time.Time     `json:"updated_at"`
+}
+
+// GetOrdersReq - фильтры и страница списка заказов из query-параметров.
+// UserID учитывается только в списке для администратора.
+type GetOrdersReq struct {
+	Page     int64
+	PageSize int64
+	Status   string
+	UserID   int64
+	From     *time.Time
+	To       *time.Time
+	MinTotal *float64
+	MaxTotal *float64
+}
+
+type OrdersPageRes struct {
+	Orders   []OrderRes `json:"orders"`
+	Page     int64      `json:"page"`
+	PageSize int64      `json:"page_size"`
+	Total    int64      `json:"total"`
 }
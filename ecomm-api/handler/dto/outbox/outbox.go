@@ -0,0 +1,18 @@
+package outboxDto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type OutboxEventRes struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int64           `json:"attempts"`
+	LastError     *string         `json:"last_error"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeadAt        *time.Time      `json:"dead_at"`
+}
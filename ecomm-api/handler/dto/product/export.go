@@ -0,0 +1,11 @@
+package productDto
+
+import "time"
+
+// ExportProductsReq - фильтры выгрузки товаров из query-параметров.
+type ExportProductsReq struct {
+	Category       string // slug, вместе с подкатегориями
+	UpdatedSince   *time.Time
+	InStock        bool
+	IncludeDeleted bool
+}
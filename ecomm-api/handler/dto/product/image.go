@@ -0,0 +1,20 @@
+package productDto
+
+import "time"
+
+type ReorderProductImagesReq struct {
+	ImageIDs []int64 `json:"image_ids"` // Все картинки товара в новом порядке
+}
+
+type ProductImageRes struct {
+	ID           int64     `json:"id"`
+	ProductID    int64     `json:"product_id"`
+	Position     int64     `json:"position"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int64     `json:"width"`
+	Height       int64     `json:"height"`
+	CreatedAt    time.Time `json:"created_at"`
+}
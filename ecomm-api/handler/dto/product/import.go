@@ -0,0 +1,28 @@
+package productDto
+
+// ImportProductRow - строка файла импорта. Категорию можно указать по slug или по id.
+type ImportProductRow struct {
+	SKU          string  `json:"sku"`
+	Name         string  `json:"name"`
+	Image        string  `json:"image"`
+	Category     string  `json:"category"`
+	CategoryID   int64   `json:"category_id"`
+	Description  string  `json:"description"`
+	Price        float64 `json:"price"`
+	CountInStock int64   `json:"count_in_stock"`
+}
+
+type ImportRowErrorRes struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type ImportReportRes struct {
+	DryRun          bool                `json:"dry_run"`
+	Total           int                 `json:"total"`
+	Created         int                 `json:"created"`
+	Updated         int                 `json:"updated"`
+	Failed          int                 `json:"failed"`
+	Errors          []ImportRowErrorRes `json:"errors"`
+	ErrorsTruncated bool                `json:"errors_truncated"` // В отчете только первые ошибки, Failed считает все
+}
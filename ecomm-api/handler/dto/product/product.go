@@ -3,36 +3,48 @@ package productDto
 import "time"
 
 type CreateProductReq struct {
+	SKU          string  `json:"sku"` // Необязательный, пустой - без артикула
 	Name         string  `json:"name"`
 	Image        string  `json:"image"`
-	Category     string  `json:"category"`
+	CategoryID   int64   `json:"category_id"`
 	Description  string  `json:"description"`
-	Rating       int64   `json:"rating"`
-	NumReviews   int64   `json:"num_reviews"`
 	Price        float64 `json:"price"`
 	CountInStock int64   `json:"count_in_stock"`
 }
 
 type UpdateProductReq struct {
+	SKU          string  `json:"sku"`
 	Name         string  `json:"name"`
 	Image        string  `json:"image"`
-	Category     string  `json:"category"`
+	CategoryID   int64   `json:"category_id"`
 	Description  string  `json:"description"`
-	Rating       int64   `json:"rating"`
-	NumReviews   int64   `json:"num_reviews"`
 	Price        float64 `json:"price"`
 	CountInStock int64   `json:"count_in_stock"`
 }
+
+// PatchProductReq - тело JSON Merge Patch (RFC 7396): nil - поле не прислали и оно не меняется.
+type PatchProductReq struct {
+	SKU          *string  `json:"sku"` // "" или null - убрать артикул
+	Name         *string  `json:"name"`
+	Image        *string  `json:"image"`
+	CategoryID   *int64   `json:"category_id"`
+	Description  *string  `json:"description"`
+	Price        *float64 `json:"price"`
+	CountInStock *int64   `json:"count_in_stock"`
+}
+
 type ProductRes struct {
 	ID           int64      `json:"id"`
+	SKU          *string    `json:"sku"`
 	Name         string     `json:"name"`
 	Image        string     `json:"image"`
-	Category     string     `json:"category"`
+	CategoryID   int64      `json:"category_id"`
 	Description  string     `json:"description"`
-	Rating       int64      `json:"rating"`
+	Rating       float64    `json:"rating"`
 	NumReviews   int64      `json:"num_reviews"`
 	Price        float64    `json:"price"`
 	CountInStock int64      `json:"count_in_stock"`
+	Version      int64      `json:"version"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    *time.Time `json:"updated_at"`
 }
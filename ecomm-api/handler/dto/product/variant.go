@@ -0,0 +1,37 @@
+package productDto
+
+import "time"
+
+type CreateProductOptionReq struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type ProductOptionRes struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id"`
+	Name      string    `json:"name"`
+	Values    []string  `json:"values"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Options - значение для каждой опции товара, например {"size": "M", "color": "red"}.
+type CreateProductVariantReq struct {
+	SKU          string            `json:"sku"`
+	Options      map[string]string `json:"options"`
+	Price        float64           `json:"price"`
+	CountInStock int64             `json:"count_in_stock"`
+	Image        string            `json:"image"`
+}
+
+type ProductVariantRes struct {
+	ID           int64             `json:"id"`
+	ProductID    int64             `json:"product_id"`
+	SKU          string            `json:"sku"`
+	Options      map[string]string `json:"options"`
+	Price        float64           `json:"price"`
+	CountInStock int64             `json:"count_in_stock"`
+	Image        string            `json:"image"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    *time.Time        `json:"updated_at"`
+}
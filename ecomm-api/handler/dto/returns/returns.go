@@ -0,0 +1,29 @@
+package returnDto
+
+import "time"
+
+type CreateReturnReq struct {
+	OrderItemID int64  `json:"order_item_id"`
+	Quantity    int64  `json:"quantity"`
+	Reason      string `json:"reason"`
+}
+
+type ReviewReturnReq struct {
+	Note string `json:"note"`
+}
+
+type RefundReturnReq struct {
+	Amount *float64 `json:"amount"` // Если не указана - стоимость позиций вместе с налогом
+}
+
+type ReturnRes struct {
+	ID          int64      `json:"id"`
+	OrderID     int64      `json:"order_id"`
+	OrderItemID int64      `json:"order_item_id"`
+	Quantity    int64      `json:"quantity"`
+	Reason      string     `json:"reason"`
+	Status      string     `json:"status"`
+	AdminNote   string     `json:"admin_note"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
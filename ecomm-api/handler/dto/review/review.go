@@ -0,0 +1,19 @@
+package reviewDto
+
+import "time"
+
+type CreateReviewReq struct {
+	Rating  int64  `json:"rating"`
+	Comment string `json:"comment"`
+}
+
+type ReviewRes struct {
+	ID        int64      `json:"id"`
+	ProductID int64      `json:"product_id"`
+	UserID    int64      `json:"user_id"`
+	Rating    int64      `json:"rating"`
+	Comment   string     `json:"comment"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
@@ -0,0 +1,34 @@
+package userDto
+
+type CreateUserReq struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginUserReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type RequestPasswordResetReq struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordReq - Token из ссылки в письме и новый пароль.
+type ResetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type UserRes struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	IsAdmin bool   `json:"is_admin"`
+}
+
+type LoginUserRes struct {
+	AccessToken string  `json:"access_token"`
+	User        UserRes `json:"user"`
+}
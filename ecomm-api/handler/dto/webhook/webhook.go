@@ -0,0 +1,46 @@
+package webhookDto
+
+import "time"
+
+// Secret можно не указывать - он будет сгенерирован и вернется в ответе один раз.
+type CreateWebhookSubscriptionReq struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+}
+
+// UpdateWebhookSubscriptionReq заменяет адрес и типы событий. Пустой Secret оставляет текущий,
+// Enabled nil не меняет состояние. Включение сбрасывает счетчик неудач.
+type UpdateWebhookSubscriptionReq struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+type WebhookSubscriptionRes struct {
+	ID                  int64      `json:"id"`
+	URL                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	Secret              string     `json:"secret,omitempty"` // Только в ответе на создание и смену секрета
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           *time.Time `json:"updated_at"`
+}
+
+type WebhookDeliveryRes struct {
+	ID             int64      `json:"id"`
+	SubscriptionID int64      `json:"subscription_id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int64      `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"` // Только у ожидающих доставок
+	ResponseCode   *int64     `json:"response_code"`
+	ResponseBody   *string    `json:"response_body"`
+	LastError      *string    `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"ecomm/ecomm-api/service"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ETag товара - его версия в кавычках, например "3".
+func versionETag(version int64) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(version, 10))
+}
+
+// ifMatchVersion возвращает версию товара id, которую разрешает изменить заголовок If-Match.
+// Без заголовка изменять ресурс нельзя (428). "*" разрешает текущую версию, список ETag -
+// текущую версию, если она есть в списке, иначе 412. Слабые ETag (W/"3") не принимаются:
+// If-Match требует строгого сравнения.
+func (h *handler) ifMatchVersion(r *http.Request, id int64) (int64, error) {
+	op := "ifMatchVersion"
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, service.NewErrPreconditionRequired(op, "If-Match header is required")
+	}
+
+	anyVersion := header == "*"
+	var versions []int64
+	if !anyVersion {
+		for _, etag := range strings.Split(header, ",") {
+			etag = strings.TrimSpace(etag)
+			if etag == "" {
+				continue
+			}
+			version, err := parseVersionETag(etag)
+			if err != nil {
+				return 0, service.NewErrValidation(op, "invalid If-Match header", err)
+			}
+			versions = append(versions, version)
+		}
+		if len(versions) == 0 {
+			return 0, service.NewErrValidation(op, "invalid If-Match header", nil)
+		}
+		if len(versions) == 1 {
+			return versions[0], nil
+		}
+	}
+
+	// Версию, найденную здесь, хранилище все равно сверит при записи,
+	// так что изменение между чтением и записью закончится 412
+	product, err := h.service.GetProduct(r.Context(), id)
+	if err != nil {
+		return 0, err
+	}
+	if !anyVersion && !slices.Contains(versions, product.Version) {
+		return 0, service.NewErrPreconditionFailed(op,
+			fmt.Sprintf("product with id %d has been modified, current version is %d", id, product.Version), nil)
+	}
+	return product.Version, nil
+}
+
+func parseVersionETag(etag string) (int64, error) {
+	unquoted, err := strconv.Unquote(etag)
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if version <= 0 {
+		return 0, fmt.Errorf("version must be positive, got %d", version)
+	}
+	return version, nil
+}
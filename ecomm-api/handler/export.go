@@ -0,0 +1,114 @@
+package handler
+
+import (
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/service"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportProducts отдает каталог файлом: ?format=csv|jsonl|xlsx&category=&updated_since=&in_stock=&include_deleted=
+func (h *handler) exportProducts(w http.ResponseWriter, r *http.Request) {
+	op := "exportProducts"
+	query := r.URL.Query()
+	exportReq := &productDto.ExportProductsReq{Category: query.Get("category")}
+	if value := query.Get("updated_since"); value != "" {
+		updatedSince, _, err := service.ParseDate(value)
+		if err != nil {
+			responseWithError(w, r, service.NewErrValidation(op, "invalid updated_since", err))
+			return
+		}
+		exportReq.UpdatedSince = &updatedSince
+	}
+	for name, dst := range map[string]*bool{"in_stock": &exportReq.InStock, "include_deleted": &exportReq.IncludeDeleted} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				responseWithError(w, r, service.NewErrValidation(op, fmt.Sprintf("invalid %s", name), err))
+				return
+			}
+			*dst = parsed
+		}
+	}
+
+	export, ok := newExportWriter(w, r, "products")
+	if !ok {
+		return
+	}
+	export.finish(h.service.ExportProducts(r.Context(), export, export.format, exportReq))
+}
+
+// exportOrders отдает заказы с позициями файлом, фильтры те же, что у GET /orders.
+func (h *handler) exportOrders(w http.ResponseWriter, r *http.Request) {
+	exportReq, err := parseGetOrdersReq(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	export, ok := newExportWriter(w, r, "orders")
+	if !ok {
+		return
+	}
+	export.finish(h.service.ExportOrders(r.Context(), export, export.format, exportReq))
+}
+
+// exportWriter откладывает заголовки ответа до первой записи: пока ничего не отправлено,
+// ошибку выгрузки еще можно вернуть обычным JSON-ответом.
+type exportWriter struct {
+	w           http.ResponseWriter
+	r           *http.Request
+	format      string
+	contentType string
+	filename    string
+	started     bool
+}
+
+// newExportWriter проверяет ?format= (по умолчанию csv). При ошибке ответ уже отправлен и ok равно false.
+func newExportWriter(w http.ResponseWriter, r *http.Request, name string) (*exportWriter, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = service.ExportFormatCSV
+	}
+	contentType, err := service.ExportContentType(format)
+	if err != nil {
+		responseWithError(w, r, err)
+		return nil, false
+	}
+	return &exportWriter{
+		w:           w,
+		r:           r,
+		format:      format,
+		contentType: contentType,
+		filename:    fmt.Sprintf("%s-%s.%s", name, time.Now().UTC().Format("20060102-150405"), format),
+	}, true
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.w.Header().Set("Content-Type", e.contentType)
+		e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.filename))
+		e.w.WriteHeader(http.StatusOK)
+	}
+	return e.w.Write(p)
+}
+
+// finish завершает ответ. Если часть файла уже ушла клиенту, статус не поменять -
+// соединение обрывается, чтобы обрезанный файл не выглядел успешной выгрузкой.
+func (e *exportWriter) finish(err error) {
+	if err == nil {
+		if !e.started {
+			e.Write(nil)
+		}
+		return
+	}
+	if !e.started {
+		responseWithError(e.w, e.r, err)
+		return
+	}
+	log.Printf("error exporting %s: %v", e.filename, err)
+	panic(http.ErrAbortHandler)
+}
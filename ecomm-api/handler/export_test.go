@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestExport(t *testing.T) {
+	productColumns := []string{"id", "sku", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at", "deleted_at"}
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+	itemColumns := []string{"id", "name", "quantity", "image", "price", "product_id", "variant_id", "order_id"}
+	createdAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	download := func(t *testing.T, url string) (*http.Response, []byte) {
+		accessToken, _, err := testTokenMaker.CreateToken(1, "admin@example.com", true, time.Hour)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+	expectCursor := func(mock sqlmock.Sqlmock, name string) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("DECLARE " + name + " NO SCROLL CURSOR FOR")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "products csv",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectCursor(mock, "products_export")
+				mock.ExpectQuery(regexp.QuoteMeta("FETCH 1000 FROM products_export")).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "LAMP-1", "Desk lamp", "lamp.jpg", 3, "Warm, dimmable", 4.5, 2, 19.5, 5, 1, createdAt, nil, nil))
+				mock.ExpectCommit()
+
+				res, body := download(t, server.URL+"/products/export?in_stock=true")
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, "text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+				require.Regexp(t, `^attachment; filename="products-\d{8}-\d{6}\.csv"$`, res.Header.Get("Content-Disposition"))
+
+				records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+				require.NoError(t, err)
+				require.Len(t, records, 2)
+				require.Equal(t, []string{"1", "LAMP-1", "Desk lamp", "lamp.jpg", "3", "Warm, dimmable", "19.5", "5",
+					"4.5", "2", "1", "2026-03-01T12:00:00Z", "", ""}, records[1])
+			},
+		},
+		{
+			name: "products csv escapes formulas",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectCursor(mock, "products_export")
+				mock.ExpectQuery(regexp.QuoteMeta("FETCH 1000 FROM products_export")).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "+LAMP", `=HYPERLINK("http://evil.example","lamp")`, "lamp.jpg", 3, "@SUM(A1)", 4.5, 2, 19.5, 5, 1, createdAt, nil, nil))
+				mock.ExpectCommit()
+
+				res, body := download(t, server.URL+"/products/export")
+				require.Equal(t, http.StatusOK, res.StatusCode)
+
+				records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+				require.NoError(t, err)
+				require.Len(t, records, 2)
+				require.Equal(t, "'+LAMP", records[1][1])
+				require.Equal(t, `'=HYPERLINK("http://evil.example","lamp")`, records[1][2])
+				require.Equal(t, "'@SUM(A1)", records[1][5])
+			},
+		},
+		{
+			name: "orders xlsx",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectCursor(mock, "orders_export")
+				mock.ExpectQuery(regexp.QuoteMeta("FETCH 1000 FROM orders_export")).
+					WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 7, "card", "paid", 1, 2, 33, createdAt, nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id = ANY($1)")).
+					WillReturnRows(sqlmock.NewRows(itemColumns).
+						AddRow(1, "lamp", 1, "lamp.jpg", 10, 1, nil, 1).
+						AddRow(2, "chair", 1, "chair.jpg", 20, 2, 5, 1))
+				mock.ExpectCommit()
+
+				res, body := download(t, server.URL+"/orders/export?format=xlsx&status=paid")
+				require.Equal(t, http.StatusOK, res.StatusCode)
+
+				f, err := excelize.OpenReader(bytes.NewReader(body))
+				require.NoError(t, err)
+				defer f.Close()
+				rows, err := f.GetRows(f.GetSheetName(0))
+				require.NoError(t, err)
+				// Заголовок и по строке на каждую позицию
+				require.Len(t, rows, 3)
+				require.Equal(t, "variant_id", rows[0][12])
+				require.Equal(t, "chair", rows[2][13])
+				require.Equal(t, "5", rows[2][12])
+			},
+		},
+		{
+			name: "unknown format",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, body := download(t, server.URL+"/orders/export?format=pdf")
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				require.Contains(t, string(body), "format must be csv, jsonl or xlsx")
+			},
+		},
+		{
+			name: "database error before any output",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin().WillReturnError(io.ErrUnexpectedEOF)
+
+				res, _ := download(t, server.URL+"/products/export?format=jsonl")
+				require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+				require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
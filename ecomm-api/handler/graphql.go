@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"ecomm/ecomm-api/gql"
+	"ecomm/ecomm-api/service"
+	"encoding/json"
+	"net/http"
+)
+
+// graphqlQuery выполняет GraphQL-запрос. Ошибки запроса и полей по соглашению GraphQL
+// приходят в поле errors с кодом 200, 400 - только для тела, которое не удалось разобрать.
+func (h *handler) graphqlQuery(w http.ResponseWriter, r *http.Request) {
+	var req gql.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		responseWithError(w, r, service.NewErrValidation("graphqlQuery", "invalid request body", err))
+		return
+	}
+	if req.Query == "" {
+		responseWithError(w, r, service.NewErrValidation("graphqlQuery", "query is required", nil))
+		return
+	}
+
+	result := h.graphql.Execute(r.Context(), claimsFromContext(r.Context()), req)
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphQL(t *testing.T) {
+	productColumns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at"}
+	categoryColumns := []string{"id", "parent_id", "name", "slug", "created_at", "updated_at"}
+	reviewColumns := []string{"id", "product_id", "user_id", "rating", "comment", "status", "created_at", "updated_at"}
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+	itemColumns := []string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}
+
+	query := func(t *testing.T, server *httptest.Server, accessToken string, body map[string]interface{}) (*http.Response, map[string]interface{}) {
+		payload, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/graphql", bytes.NewReader(payload))
+		require.NoError(t, err)
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		result := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&result))
+		return res, result
+	}
+	errorCode := func(t *testing.T, result map[string]interface{}) string {
+		errs, ok := result["errors"].([]interface{})
+		require.True(t, ok, "no errors in %v", result)
+		return errs[0].(map[string]interface{})["extensions"].(map[string]interface{})["code"].(string)
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "reviews and categories of a product list are loaded in one query each",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.MatchExpectationsInOrder(false)
+				// Страница и фильтр по остатку выбираются в базе
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE count_in_stock > 0 AND deleted_at IS NULL ORDER BY id LIMIT $1 OFFSET $2")).
+					WithArgs(20, 0).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "Phone", "p.jpg", 2, "", 4.5, 1, 100, 3, 1, time.Now(), nil).
+						AddRow(3, "Cable", "k.jpg", 2, "", 5, 2, 5, 7, 1, time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM reviews WHERE product_id = ANY($1) AND status = $2 ORDER BY id")).
+					WithArgs("{1,3}", "approved").
+					WillReturnRows(sqlmock.NewRows(reviewColumns).
+						AddRow(10, 1, 5, 5, "great", "approved", time.Now(), nil).
+						AddRow(11, 3, 5, 4, "ok", "approved", time.Now(), nil).
+						AddRow(12, 3, 6, 5, "fine", "approved", time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM categories ORDER BY parent_id NULLS FIRST, name")).
+					WillReturnRows(sqlmock.NewRows(categoryColumns).
+						AddRow(1, nil, "Electronics", "electronics", time.Now(), nil).
+						AddRow(2, 1, "Phones", "phones", time.Now(), nil))
+
+				res, result := query(t, server, "", map[string]interface{}{
+					"query": `{ products(inStock: true) { id name inStock category { slug parent { slug } } reviews { rating } } }`,
+				})
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Nil(t, result["errors"])
+
+				products := result["data"].(map[string]interface{})["products"].([]interface{})
+				require.Len(t, products, 2)
+				cable := products[1].(map[string]interface{})
+				require.Equal(t, "3", cable["id"])
+				require.Len(t, cable["reviews"], 2)
+				require.Equal(t, map[string]interface{}{"slug": "phones", "parent": map[string]interface{}{"slug": "electronics"}}, cable["category"])
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "order items load their products in one query",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "paid", 10, 20, 130, time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id=$1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(itemColumns).
+						AddRow(1, "Phone", 1, "p.jpg", 100, 1, 1).
+						AddRow(2, "Case", 2, "c.jpg", 10, 2, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM refunds WHERE order_id=$1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+				// Второй товар удален, поэтому его нет в выборке
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id IN ($1, $2) AND deleted_at IS NULL")).
+					WithArgs(1, 2).
+					WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "Phone", "p.jpg", 2, "", 4.5, 1, 100, 3, 1, time.Now(), nil))
+
+				accessToken, _, err := testTokenMaker.CreateToken(3, "user@example.com", false, time.Hour)
+				require.NoError(t, err)
+				_, result := query(t, server, accessToken, map[string]interface{}{
+					"query":     `query Order($id: ID!) { order(id: $id) { totalPrice items { quantity product { name } } } }`,
+					"variables": map[string]interface{}{"id": "1"},
+				})
+				require.Nil(t, result["errors"])
+				require.Equal(t, map[string]interface{}{
+					"totalPrice": float64(130),
+					"items": []interface{}{
+						map[string]interface{}{"quantity": float64(1), "product": map[string]interface{}{"name": "Phone"}},
+						map[string]interface{}{"quantity": float64(2), "product": nil},
+					},
+				}, result["data"].(map[string]interface{})["order"])
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "anonymous user",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				_, result := query(t, server, "", map[string]interface{}{"query": `{ me { id } }`})
+				require.Equal(t, map[string]interface{}{"me": nil}, result["data"])
+
+				_, result = query(t, server, "", map[string]interface{}{"query": `{ order(id: "1") { id } }`})
+				require.Equal(t, "UNAUTHENTICATED", errorCode(t, result))
+			},
+		},
+		{
+			name: "invalid token is rejected",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := query(t, server, "garbage", map[string]interface{}{"query": `{ me { id } }`})
+				require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+			},
+		},
+		{
+			name: "not found product",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id IN ($1) AND deleted_at IS NULL")).
+					WithArgs(42).
+					WillReturnRows(sqlmock.NewRows(productColumns))
+
+				_, result := query(t, server, "", map[string]interface{}{"query": `{ product(id: "42") { name } }`})
+				require.Equal(t, map[string]interface{}{"product": nil}, result["data"])
+				require.Nil(t, result["errors"])
+			},
+		},
+		{
+			name: "errors carry codes",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				_, result := query(t, server, "", map[string]interface{}{"query": `{ products(first: 1000) { id } }`})
+				require.Equal(t, "BAD_USER_INPUT", errorCode(t, result))
+
+				_, result = query(t, server, "", map[string]interface{}{"query": `{ products { price { amount } } }`})
+				require.Equal(t, "GRAPHQL_VALIDATION_FAILED", errorCode(t, result))
+
+				_, result = query(t, server, "", map[string]interface{}{
+					"query": `{ me { orders { orders { items { product { category { parent { parent { parent { name } } } } } } } } } }`,
+				})
+				require.Equal(t, "QUERY_TOO_COMPLEX", errorCode(t, result))
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "malformed body",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, err := http.Post(server.URL+"/graphql", "application/json", bytes.NewReader([]byte("{")))
+				require.NoError(t, err)
+				res.Body.Close()
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+			})
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"ecomm/ecomm-api/gql"
 	orderDto "ecomm/ecomm-api/handler/dto/order"
 	"ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/payments"
 	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/token"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -29,6 +33,15 @@ func responseWithError(w http.ResponseWriter, r *http.Request, err error) {
 		errNotFound                *service.ErrNotFound
 		errNotEnough               *service.ErrNotEnoughStock
 		errNotFoundProductForOrder *service.ErrNotFoundProductForOrder
+		errPaymentDeclined         *service.ErrPaymentDeclined
+		errValidation              *service.ErrValidation
+		errConflict                *service.ErrConflict
+		errUnauthorized            *service.ErrUnauthorized
+		errForbidden               *service.ErrForbidden
+		errPreconditionFailed      *service.ErrPreconditionFailed
+		errPreconditionRequired    *service.ErrPreconditionRequired
+		errUnsupportedMedia        *service.ErrUnsupportedMediaType
+		errPayloadTooLarge         *service.ErrPayloadTooLarge
 		apiError                   APIErrorResponse
 		status                     = http.StatusInternalServerError
 	)
@@ -36,15 +49,48 @@ func responseWithError(w http.ResponseWriter, r *http.Request, err error) {
 	switch {
 	case errors.As(err, &errNotFound):
 		status = http.StatusNotFound
-		clientMessage = fmt.Sprintf("Product with id %d not found", errNotFound.ID)
+		clientMessage = fmt.Sprintf("%s with id %v not found", errNotFound.Resource, errNotFound.ID)
 
 	case errors.As(err, &errNotEnough):
 		status = http.StatusConflict
-		clientMessage = fmt.Sprintf("not enough stock for product with id %d. Requested: %d, Available: %d",
-			errNotEnough.ID, errNotEnough.Requested, errNotEnough.Available)
+		clientMessage = fmt.Sprintf("not enough stock for %s with id %v. Requested: %d, Available: %d",
+			errNotEnough.Resource, errNotEnough.ID, errNotEnough.Requested, errNotEnough.Available)
 	case errors.As(err, &errNotFoundProductForOrder):
 		status = http.StatusNotFound
 		clientMessage = fmt.Sprintf("Some product for order not found")
+	case errors.As(err, &errPaymentDeclined):
+		status = http.StatusPaymentRequired
+		clientMessage = fmt.Sprintf("payment declined: %s", errPaymentDeclined.Reason)
+	case errors.As(err, &errValidation):
+		status = http.StatusBadRequest
+		clientMessage = errValidation.Message
+	case errors.As(err, &errConflict):
+		status = http.StatusConflict
+		clientMessage = errConflict.Message
+	case errors.As(err, &errUnauthorized):
+		status = http.StatusUnauthorized
+		clientMessage = errUnauthorized.Message
+	case errors.As(err, &errForbidden):
+		status = http.StatusForbidden
+		clientMessage = errForbidden.Message
+	case errors.As(err, &errPreconditionFailed):
+		status = http.StatusPreconditionFailed
+		clientMessage = errPreconditionFailed.Message
+	case errors.As(err, &errPreconditionRequired):
+		status = http.StatusPreconditionRequired
+		clientMessage = errPreconditionRequired.Message
+	case errors.As(err, &errUnsupportedMedia):
+		status = http.StatusUnsupportedMediaType
+		clientMessage = errUnsupportedMedia.Message
+	case errors.As(err, &errPayloadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+		clientMessage = errPayloadTooLarge.Message
+	case errors.Is(err, errUnsupportedMediaType):
+		status = http.StatusUnsupportedMediaType
+		clientMessage = err.Error()
+	case errors.Is(err, payments.ErrInvalidSignature), errors.Is(err, payments.ErrSignatureExpired):
+		status = http.StatusUnauthorized
+		clientMessage = err.Error()
 	default:
 		// оставляем Internal Server Error
 	}
@@ -79,12 +125,18 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 }
 
 type handler struct {
-	service *service.Service
+	service         *service.Service
+	webhookVerifier *payments.WebhookVerifier
+	tokenMaker      *token.JWTMaker
+	graphql         *gql.Server
 }
 
-func NewHandler(service *service.Service) *handler {
+func NewHandler(service *service.Service, webhookVerifier *payments.WebhookVerifier, tokenMaker *token.JWTMaker) *handler {
 	return &handler{
-		service: service,
+		service:         service,
+		webhookVerifier: webhookVerifier,
+		tokenMaker:      tokenMaker,
+		graphql:         gql.NewServer(service, gql.DefaultLimits),
 	}
 }
 
@@ -101,6 +153,7 @@ func (h *handler) createProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(productRes.Version))
 	respondWithJSON(w, http.StatusCreated, productRes)
 }
 
@@ -126,6 +179,7 @@ func (h *handler) getProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(productRes.Version))
 	respondWithJSON(w, http.StatusOK, productRes)
 }
 
@@ -144,17 +198,49 @@ func (h *handler) updateProduct(w http.ResponseWriter, r *http.Request) {
 		responseWithError(w, r, err)
 		return
 	}
+	version, err := h.ifMatchVersion(r, id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
 	updateProductReq := productDto.UpdateProductReq{}
 	if err := json.NewDecoder(r.Body).Decode(&updateProductReq); err != nil {
 		responseWithError(w, r, err)
 		return
 	}
 
-	productRes, err := h.service.UpdateProduct(r.Context(), id, &updateProductReq)
+	productRes, err := h.service.UpdateProduct(r.Context(), id, version, &updateProductReq)
 	if err != nil {
 		responseWithError(w, r, err)
 		return
 	}
+	w.Header().Set("ETag", versionETag(productRes.Version))
+	respondWithJSON(w, http.StatusOK, productRes)
+}
+
+func (h *handler) patchProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	version, err := h.ifMatchVersion(r, id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	patchProductReq, err := decodeProductMergePatch(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+
+	productRes, err := h.service.PatchProduct(r.Context(), id, version, patchProductReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", versionETag(productRes.Version))
 	respondWithJSON(w, http.StatusOK, productRes)
 }
 
@@ -164,7 +250,12 @@ func (h *handler) deleteProduct(w http.ResponseWriter, r *http.Request) {
 		responseWithError(w, r, err)
 		return
 	}
-	err = h.service.DeleteProduct(r.Context(), id)
+	version, err := h.ifMatchVersion(r, id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	err = h.service.DeleteProduct(r.Context(), id, version)
 	if err != nil {
 		responseWithError(w, r, err)
 		return
@@ -172,16 +263,177 @@ func (h *handler) deleteProduct(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusNoContent, nil)
 }
 
+func (h *handler) restoreProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	productRes, err := h.service.RestoreProduct(r.Context(), id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", versionETag(productRes.Version))
+	respondWithJSON(w, http.StatusOK, productRes)
+}
+
 func (h *handler) createOrder(w http.ResponseWriter, r *http.Request) {
 	var createOrderReq orderDto.CreateOrderReq
 	if err := json.NewDecoder(r.Body).Decode(&createOrderReq); err != nil {
 		responseWithError(w, r, err)
 		return
 	}
-	orderRes, err := h.service.CreateOrder(r.Context(), &createOrderReq)
+	orderRes, err := h.service.CreateOrder(r.Context(), claimsFromContext(r.Context()), &createOrderReq)
 	if err != nil {
 		responseWithError(w, r, err)
 		return
 	}
 	respondWithJSON(w, http.StatusCreated, orderRes)
 }
+
+func (h *handler) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var cancelOrderReq orderDto.CancelOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&cancelOrderReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	orderRes, err := h.service.CancelOrder(r.Context(), id, claimsFromContext(r.Context()), &cancelOrderReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, orderRes)
+}
+
+func (h *handler) shipOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var shipOrderReq orderDto.ShipOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&shipOrderReq); err != nil {
+		responseWithError(w, r, service.NewErrValidation("shipOrder", "invalid request body", err))
+		return
+	}
+	orderRes, err := h.service.ShipOrder(r.Context(), id, &shipOrderReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, orderRes)
+}
+
+// Шлюзы шлют небольшие JSON, всё что больше - явно не от них
+const maxWebhookBodySize = 1 << 20
+
+func (h *handler) paymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	if err := h.webhookVerifier.Verify(r.Header.Get(payments.SignatureHeader), payload); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+
+	applied, err := h.service.HandlePaymentWebhook(r.Context(), payload)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]bool{"received": true, "duplicate": !applied})
+}
+
+func (h *handler) getOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	orderRes, err := h.service.GetOrder(r.Context(), id, claimsFromContext(r.Context()))
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, orderRes)
+}
+
+func (h *handler) getMyOrders(w http.ResponseWriter, r *http.Request) {
+	getOrdersReq, err := parseGetOrdersReq(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	ordersRes, err := h.service.GetMyOrders(r.Context(), claimsFromContext(r.Context()), getOrdersReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, ordersRes)
+}
+
+func (h *handler) getOrders(w http.ResponseWriter, r *http.Request) {
+	getOrdersReq, err := parseGetOrdersReq(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	ordersRes, err := h.service.GetOrders(r.Context(), getOrdersReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, ordersRes)
+}
+
+// parseGetOrdersReq разбирает ?page=&page_size=&status=&user_id=&from=&to=&min_total=&max_total=,
+// даты - в RFC 3339 или YYYY-MM-DD.
+func parseGetOrdersReq(r *http.Request) (*orderDto.GetOrdersReq, error) {
+	op := "parseGetOrdersReq"
+	query := r.URL.Query()
+	req := &orderDto.GetOrdersReq{Status: query.Get("status")}
+
+	for name, dst := range map[string]*int64{"page": &req.Page, "page_size": &req.PageSize, "user_id": &req.UserID} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, service.NewErrValidation(op, fmt.Sprintf("invalid %s", name), err)
+			}
+			*dst = parsed
+		}
+	}
+
+	for name, dst := range map[string]**time.Time{"from": &req.From, "to": &req.To} {
+		if value := query.Get(name); value != "" {
+			parsed, dateOnly, err := service.ParseDate(value)
+			if err != nil {
+				return nil, service.NewErrValidation(op, fmt.Sprintf("invalid %s", name), err)
+			}
+			// to - исключающая граница: дата без времени включает весь день
+			if dateOnly && name == "to" {
+				parsed = parsed.AddDate(0, 0, 1)
+			}
+			*dst = &parsed
+		}
+	}
+
+	for name, dst := range map[string]**float64{"min_total": &req.MinTotal, "max_total": &req.MaxTotal} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, service.NewErrValidation(op, fmt.Sprintf("invalid %s", name), err)
+			}
+			*dst = &parsed
+		}
+	}
+
+	return req, nil
+}
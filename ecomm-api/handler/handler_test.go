@@ -0,0 +1,495 @@
+package handler
+
+import (
+	"ecomm/ecomm-api/blobstore"
+	"ecomm/ecomm-api/payments"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/storer"
+	"ecomm/ecomm-api/token"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	webhookSecret  = []byte("whsec_test")
+	testTokenMaker = token.NewJWTMaker("test-secret")
+)
+
+// withTestServer поднимает API поверх sqlmock, чтобы тест мог слать настоящие HTTP-запросы.
+func withTestServer(t *testing.T, fn func(*httptest.Server, sqlmock.Sqlmock)) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	blobs, err := blobstore.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	srv := service.NewService(storer.NewPostgresStorer(sqlx.NewDb(mockDB, "postgres")), payments.NewFakeProvider(), blobs)
+	hdl := NewHandler(srv, payments.NewWebhookVerifier(webhookSecret, 5*time.Minute), testTokenMaker)
+	server := httptest.NewServer(RegisterRoutes(hdl))
+	defer server.Close()
+
+	fn(server, mock)
+}
+
+// authorize подписывает запрос токеном пользователя userID.
+func authorize(t *testing.T, req *http.Request, userID int64, isAdmin bool) {
+	accessToken, _, err := testTokenMaker.CreateToken(userID, "user@example.com", isAdmin, time.Hour)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+}
+
+func doAuthorized(t *testing.T, method string, url string, userID int64, isAdmin bool) (*http.Response, map[string]interface{}) {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	authorize(t, req, userID, isAdmin)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	return res, body
+}
+
+func TestGetOrderOwnership(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+
+	expectOrderLoad := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "paid", 10, 20, 130, time.Now(), nil))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM refunds WHERE order_id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+	}
+
+	tcs := []struct {
+		name       string
+		userID     int64
+		isAdmin    bool
+		wantStatus int
+	}{
+		{name: "owner", userID: 3, wantStatus: http.StatusOK},
+		{name: "another user", userID: 4, wantStatus: http.StatusForbidden},
+		{name: "admin", userID: 1, isAdmin: true, wantStatus: http.StatusOK},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectOrderLoad(mock)
+
+				res, body := doAuthorized(t, http.MethodGet, server.URL+"/orders/1", tc.userID, tc.isAdmin)
+				require.Equal(t, tc.wantStatus, res.StatusCode)
+				if tc.wantStatus == http.StatusOK {
+					require.Equal(t, float64(3), body["user_id"])
+				}
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			res, err := http.Get(server.URL + "/orders/1")
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		})
+	})
+}
+
+func TestGetMyOrders(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+
+	t.Run("only current user's orders", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status = $2")).
+				WithArgs(3, "paid").
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE user_id = $1 AND status = $2 ORDER BY created_at DESC, id DESC LIMIT $3 OFFSET $4")).
+				WithArgs(3, "paid", 5, 10).
+				WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "paid", 10, 20, 130, time.Now(), nil))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY order_id, id")).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+
+			// user_id из запроса игнорируется - пользователь видит только свои заказы
+			res, body := doAuthorized(t, http.MethodGet, server.URL+"/me/orders?page=3&page_size=5&status=paid&user_id=4", 3, false)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			require.Equal(t, float64(11), body["total"])
+			require.Equal(t, float64(3), body["page"])
+			require.Len(t, body["orders"], 1)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("date-only to includes the whole day", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+			to := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM orders WHERE user_id = $1 AND created_at >= $2 AND created_at < $3")).
+				WithArgs(3, from, to).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE user_id = $1 AND created_at >= $2 AND created_at < $3 ORDER BY created_at DESC, id DESC LIMIT $4 OFFSET $5")).
+				WithArgs(3, from, to, 20, 0).
+				WillReturnRows(sqlmock.NewRows(orderColumns))
+
+			res, _ := doAuthorized(t, http.MethodGet, server.URL+"/me/orders?from=2024-03-01&to=2024-03-01", 3, false)
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("invalid page size", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			res, _ := doAuthorized(t, http.MethodGet, server.URL+"/me/orders?page_size=1000", 3, false)
+			require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		})
+	})
+
+	t.Run("admin listing requires admin", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			res, _ := doAuthorized(t, http.MethodGet, server.URL+"/orders?user_id=3", 3, false)
+			require.Equal(t, http.StatusForbidden, res.StatusCode)
+		})
+	})
+}
+
+func TestShipOrder(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "tracking_number", "shipped_at", "created_at", "updated_at"}
+	ship := func(t *testing.T, url string, isAdmin bool, body string) *http.Response {
+		accessToken, _, err := testTokenMaker.CreateToken(1, "admin@example.com", isAdmin, time.Hour)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("admin ships paid order", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			shippedRow := func() *sqlmock.Rows {
+				return sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "shipped", 10, 20, 130, "TRACK-1", time.Now(), time.Now(), time.Now())
+			}
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "paid", 10, 20, 130, nil, nil, time.Now(), nil))
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET status=$1, tracking_number=$2")).
+				WithArgs("shipped", "TRACK-1", 1).
+				WillReturnRows(shippedRow())
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events")).
+				WithArgs("order", 1, "order.shipped", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1")).
+				WithArgs(1).
+				WillReturnRows(shippedRow())
+			for _, table := range []string{"order_items", "payments", "refunds"} {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM " + table + " WHERE order_id=$1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+			}
+
+			res := ship(t, server.URL+"/orders/1/ship", true, `{"tracking_number": " TRACK-1 "}`)
+			defer res.Body.Close()
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			body := map[string]interface{}{}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			require.Equal(t, "shipped", body["status"])
+			require.Equal(t, "TRACK-1", body["tracking_number"])
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("unpaid order", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "pending", 10, 20, 130, nil, nil, time.Now(), nil))
+			mock.ExpectRollback()
+
+			res := ship(t, server.URL+"/orders/1/ship", true, `{}`)
+			res.Body.Close()
+			require.Equal(t, http.StatusConflict, res.StatusCode)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			res := ship(t, server.URL+"/orders/1/ship", false, `{}`)
+			res.Body.Close()
+			require.Equal(t, http.StatusForbidden, res.StatusCode)
+		})
+	})
+}
+
+func TestCancelPaidOrder(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "refunded_price", "cancellation_reason", "created_at", "updated_at"}
+	paymentColumns := []string{"id", "order_id", "provider", "method", "status", "amount", "captured_amount", "refunded_amount", "authorization_id", "created_at", "updated_at"}
+	refundColumns := []string{"id", "order_id", "payment_id", "return_id", "amount", "reason", "provider_refund_id", "status", "created_at"}
+	expectOrderLoad := func(mock sqlmock.Sqlmock, status string, refunds *sqlmock.Rows) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", status, 10, 20, 130, 0, "", time.Now(), nil))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM refunds WHERE order_id=$1")).
+			WithArgs(1).
+			WillReturnRows(refunds)
+	}
+
+	t.Run("provider failure leaves the refund pending", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			expectOrderLoad(mock, "paid", sqlmock.NewRows(refundColumns))
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "paid", 10, 20, 130, 0, "", time.Now(), nil))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM returns")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE products p SET count_in_stock")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE product_variants pv SET count_in_stock")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, updated_at=NOW() WHERE order_id=$2 AND status='pending'")).
+				WithArgs("failed", 1).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1 AND status = ANY($2) ORDER BY id DESC LIMIT 1 FOR UPDATE")).
+				WithArgs(1, sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, "fake", "card", "captured", 130, 130, 0, "fake_auth_000001", time.Now(), nil))
+			mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO refunds")).
+				ExpectQuery().
+				WithArgs(1, 7, nil, 130.0, "order cancelled: changed my mind").
+				WillReturnRows(sqlmock.NewRows(refundColumns).AddRow(9, 1, 7, nil, 130.0, "order cancelled: changed my mind", "", "pending", time.Now()))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET refunded_amount = refunded_amount + $1")).WithArgs(130.0, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price + $1")).WithArgs(130.0, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET status=$1, cancellation_reason=$2")).
+				WithArgs("cancelled", "changed my mind", 1).
+				WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "cancelled", 10, 20, 130, 130, "changed my mind", time.Now(), time.Now()))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events")).WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			// Шлюз не знает эту авторизацию - возврат остается pending, отмена уже сохранена
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE id=$1")).
+				WithArgs(7).
+				WillReturnRows(sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, "fake", "card", "refunded", 130, 130, 130, "fake_auth_000001", time.Now(), nil))
+			expectOrderLoad(mock, "cancelled", sqlmock.NewRows(refundColumns).
+				AddRow(9, 1, 7, nil, 130.0, "order cancelled: changed my mind", "", "pending", time.Now()))
+
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/orders/1/cancel", strings.NewReader(`{"reason": "changed my mind"}`))
+			require.NoError(t, err)
+			authorize(t, req, 3, false)
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var body struct {
+				Status  string `json:"status"`
+				Refunds []struct {
+					Status string `json:"status"`
+				} `json:"refunds"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			require.Equal(t, "cancelled", body.Status)
+			require.Len(t, body.Refunds, 1)
+			require.Equal(t, "pending", body.Refunds[0].Status)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("seed payment is refunded without the gateway", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			expectOrderLoad(mock, "paid", sqlmock.NewRows(refundColumns))
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "paid", 10, 20, 130, 0, "", time.Now(), nil))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM returns")).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE products p SET count_in_stock")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE product_variants pv SET count_in_stock")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, updated_at=NOW() WHERE order_id=$2 AND status='pending'")).
+				WithArgs("failed", 1).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1 AND status = ANY($2) ORDER BY id DESC LIMIT 1 FOR UPDATE")).
+				WithArgs(1, sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, "seed", "card", "captured", 130, 130, 0, "seed_auth_1", time.Now(), nil))
+			mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO refunds")).
+				ExpectQuery().
+				WithArgs(1, 7, nil, 130.0, "order cancelled: changed my mind").
+				WillReturnRows(sqlmock.NewRows(refundColumns).AddRow(9, 1, 7, nil, 130.0, "order cancelled: changed my mind", "", "pending", time.Now()))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET refunded_amount = refunded_amount + $1")).WithArgs(130.0, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price + $1")).WithArgs(130.0, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET status=$1, cancellation_reason=$2")).
+				WithArgs("cancelled", "changed my mind", 1).
+				WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "cancelled", 10, 20, 130, 130, "changed my mind", time.Now(), time.Now()))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events")).WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			// Шлюз не видел платежей тестовых данных - возврат завершается без него
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE id=$1")).
+				WithArgs(7).
+				WillReturnRows(sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, "seed", "card", "refunded", 130, 130, 130, "seed_auth_1", time.Now(), nil))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE refunds SET status='succeeded'")).
+				WithArgs("", 9).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			expectOrderLoad(mock, "cancelled", sqlmock.NewRows(refundColumns).
+				AddRow(9, 1, 7, nil, 130.0, "order cancelled: changed my mind", "", "succeeded", time.Now()))
+
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/orders/1/cancel", strings.NewReader(`{"reason": "changed my mind"}`))
+			require.NoError(t, err)
+			authorize(t, req, 3, false)
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			require.Equal(t, http.StatusOK, res.StatusCode)
+			var body struct {
+				Status  string `json:"status"`
+				Refunds []struct {
+					Status string `json:"status"`
+				} `json:"refunds"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			require.Equal(t, "cancelled", body.Status)
+			require.Len(t, body.Refunds, 1)
+			require.Equal(t, "succeeded", body.Refunds[0].Status)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+}
+
+func TestCreateOrderPayment(t *testing.T) {
+	productColumns := []string{"id", "name", "image", "category_id", "price", "count_in_stock", "version", "created_at"}
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+	paymentColumns := []string{"id", "order_id", "provider", "method", "status", "amount", "captured_amount", "authorization_id", "created_at", "updated_at"}
+
+	// expectOrderSaved ожидает первую транзакцию: заказ, позиции, остатки и pending-платеж
+	expectOrderSaved := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id IN ($1) AND deleted_at IS NULL")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, 100, 5, 1, time.Now()))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product_variants WHERE product_id = ANY($1)")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id"}))
+		mock.ExpectBegin()
+		mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO orders")).
+			ExpectQuery().
+			WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "pending", 10, 150, 260, time.Now(), nil))
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO order_items")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id", "ordinal"}).
+				AddRow(101, "lamp", 1, "lamp.jpg", 100, 1, 1, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE products p SET count_in_stock = p.count_in_stock - v.quantity")).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO payments")).
+			ExpectQuery().
+			WithArgs(1, "fake", "card", "pending", 260.0, 0.0, "").
+			WillReturnRows(sqlmock.NewRows(paymentColumns).AddRow(7, 1, "fake", "card", "pending", 260, 0, "", time.Now(), nil))
+		mock.ExpectCommit()
+	}
+	expectLockOrder := func(mock sqlmock.Sqlmock, status string) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", status, 10, 150, 260, time.Now(), nil))
+	}
+	createOrder := func(t *testing.T, server *httptest.Server, token string) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/orders",
+			strings.NewReader(`{"payment_method": "card", "payment_token": "`+token+`", "items": [{"product_id": 1, "quantity": 1}]}`))
+		require.NoError(t, err)
+		authorize(t, req, 3, false)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res, body
+	}
+
+	t.Run("captured after the order is saved", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			expectOrderSaved(mock)
+			mock.ExpectBegin()
+			expectLockOrder(mock, "pending")
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE payments SET status=$1, captured_amount=$2, authorization_id=$3")).
+				WithArgs("captured", 260.0, "fake_auth_000001", 7).
+				WillReturnRows(sqlmock.NewRows(paymentColumns).AddRow(7, 1, "fake", "card", "captured", 260, 260, "fake_auth_000001", time.Now(), time.Now()))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET status=$1, updated_at=NOW() WHERE id=$2")).
+				WithArgs("paid", 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events")).
+				WithArgs("order", 1, "order.created", sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			res, body := createOrder(t, server, "tok_ok")
+			require.Equal(t, http.StatusCreated, res.StatusCode)
+			require.Equal(t, "paid", body["status"])
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("declined card cancels the saved order", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			expectOrderSaved(mock)
+			mock.ExpectBegin()
+			expectLockOrder(mock, "pending")
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, updated_at=NOW() WHERE id=$2 AND status='pending'")).
+				WithArgs("failed", 7).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE products p SET count_in_stock = p.count_in_stock + oi.quantity")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("UPDATE product_variants pv SET count_in_stock")).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET status=$1, cancellation_reason=$2")).
+				WithArgs("cancelled", "payment failed", 1).
+				WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", "cancelled", 10, 150, 260, time.Now(), time.Now()))
+			mock.ExpectCommit()
+
+			res, _ := createOrder(t, server, "tok_declined")
+			require.Equal(t, http.StatusPaymentRequired, res.StatusCode)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("order cancelled while the charge was in flight", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			expectOrderSaved(mock)
+			// POST /orders/1/cancel успел отменить заказ и закрыть его pending-платеж:
+			// списание не записывается, деньги возвращаются покупателю
+			mock.ExpectBegin()
+			expectLockOrder(mock, "cancelled")
+			mock.ExpectRollback()
+
+			res, _ := createOrder(t, server, "tok_ok")
+			require.Equal(t, http.StatusConflict, res.StatusCode)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+}
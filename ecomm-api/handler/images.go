@@ -0,0 +1,140 @@
+package handler
+
+import (
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// Запас сверх размера картинки на заголовки multipart и прочие поля формы
+const multipartOverhead = 1 << 20
+
+// uploadProductImage принимает multipart/form-data с файлом в поле "image".
+func (h *handler) uploadProductImage(w http.ResponseWriter, r *http.Request) {
+	op := "uploadProductImage"
+	productID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, service.MaxImageSize+multipartOverhead)
+	data, err := readMultipartFile(r, "image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			err = service.NewErrPayloadTooLarge(op, fmt.Sprintf("image must not exceed %d bytes", service.MaxImageSize))
+		}
+		responseWithError(w, r, err)
+		return
+	}
+
+	imageRes, err := h.service.UploadProductImage(r.Context(), productID, data)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, imageRes)
+}
+
+// readMultipartFile читает первую часть формы с именем field, не загружая в память остальные.
+// Читаем на байт больше лимита, чтобы сервис мог отличить файл ровно лимитного размера от большего.
+func readMultipartFile(r *http.Request, field string) ([]byte, error) {
+	op := "readMultipartFile"
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, service.NewErrUnsupportedMediaType(op, "Content-Type must be multipart/form-data")
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, service.NewErrValidation(op, fmt.Sprintf("%s file is required", field), nil)
+		}
+		if err != nil {
+			return nil, service.NewErrValidation(op, "invalid multipart form", err)
+		}
+		if part.FormName() != field {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+		return io.ReadAll(io.LimitReader(part, service.MaxImageSize+1))
+	}
+}
+
+func (h *handler) getProductImages(w http.ResponseWriter, r *http.Request) {
+	productID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	imagesRes, err := h.service.GetProductImages(r.Context(), productID)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, imagesRes)
+}
+
+func (h *handler) reorderProductImages(w http.ResponseWriter, r *http.Request) {
+	productID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var reorderReq productDto.ReorderProductImagesReq
+	if err := json.NewDecoder(r.Body).Decode(&reorderReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	imagesRes, err := h.service.ReorderProductImages(r.Context(), productID, &reorderReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, imagesRes)
+}
+
+func (h *handler) deleteProductImage(w http.ResponseWriter, r *http.Request) {
+	productID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	imageID, err := strconv.ParseInt(chi.URLParam(r, "imageID"), 10, 64)
+	if err != nil {
+		responseWithError(w, r, errors.New("invalid image id"))
+		return
+	}
+	if err := h.service.DeleteProductImage(r.Context(), productID, imageID); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// serveImage отдает сохраненный файл. Ключи случайные и не переиспользуются,
+// поэтому ответ можно кэшировать навсегда.
+func (h *handler) serveImage(w http.ResponseWriter, r *http.Request) {
+	body, contentType, err := h.service.OpenImage(r.Context(), chi.URLParam(r, "*"))
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("error serving image %s: %v", r.URL.Path, err)
+	}
+}
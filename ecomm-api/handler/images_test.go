@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadProductImage(t *testing.T) {
+	productColumns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at"}
+	imageColumns := []string{"id", "product_id", "position", "blob_key", "thumbnail_key", "content_type", "size", "width", "height", "created_at"}
+
+	pngImage := func(t *testing.T, width int, height int) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			img.Set(x, x%height, color.RGBA{R: 255, A: 255})
+		}
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+		return buf.Bytes()
+	}
+	upload := func(t *testing.T, server *httptest.Server, isAdmin bool, data []byte) (*http.Response, map[string]interface{}) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("image", "photo.jpg")
+		require.NoError(t, err)
+		_, err = part.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, form.Close())
+
+		accessToken, _, err := testTokenMaker.CreateToken(1, "admin@example.com", isAdmin, time.Hour)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/products/1/images", &body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&resBody))
+		return res, resBody
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "png with thumbnail",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				data := pngImage(t, 640, 480)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, "", 0, 0, 10, 5, 1, time.Now(), nil))
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE id=$1 AND deleted_at IS NULL FOR UPDATE")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				var blobKey, thumbnailKey captureString
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO product_images (product_id, position, blob_key, thumbnail_key, content_type, size, width, height)")).
+					WithArgs(1, &blobKey, &thumbnailKey, "image/png", len(data), 640, 480).
+					WillReturnRows(sqlmock.NewRows(imageColumns).
+						AddRow(7, 1, 0, "products/1/a.png", "products/1/a_thumb.png", "image/png", len(data), 640, 480, time.Now()))
+				// Первая картинка становится главной
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product_images WHERE product_id=$1 ORDER BY position, id LIMIT 1")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(imageColumns).
+						AddRow(7, 1, 0, "products/1/a.png", "products/1/a_thumb.png", "image/png", len(data), 640, 480, time.Now()))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET image=$1, version=version+1, updated_at=NOW() WHERE id=$2 AND image <> $1 RETURNING *")).
+					WithArgs("/images/products/1/a.png", 1).
+					WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "/images/products/1/a.png", 1, "desk lamp", 0, 0, 10, 5, 4, time.Now(), time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload) VALUES ($1, $2, $3, $4)")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				res, body := upload(t, server, true, data)
+				require.Equal(t, http.StatusCreated, res.StatusCode)
+				require.Equal(t, "/images/products/1/a_thumb.png", body["thumbnail_url"])
+				require.Regexp(t, `^products/1/[0-9a-f]{32}\.png$`, string(blobKey))
+
+				// Миниатюра вписана в квадрат 320x320 с сохранением пропорций
+				thumbnailRes, err := http.Get(server.URL + "/images/" + string(thumbnailKey))
+				require.NoError(t, err)
+				defer thumbnailRes.Body.Close()
+				require.Equal(t, http.StatusOK, thumbnailRes.StatusCode)
+				require.Equal(t, "image/png", thumbnailRes.Header.Get("Content-Type"))
+				thumbnail, err := png.DecodeConfig(thumbnailRes.Body)
+				require.NoError(t, err)
+				require.Equal(t, 320, thumbnail.Width)
+				require.Equal(t, 240, thumbnail.Height)
+			},
+		},
+		{
+			name: "not an image",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, body := upload(t, server, true, []byte("plain text pretending to be a jpeg"))
+				require.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+				require.Contains(t, body["Error"], "text/plain")
+			},
+		},
+		{
+			name: "not an admin",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := upload(t, server, false, pngImage(t, 10, 10))
+				require.Equal(t, http.StatusForbidden, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+// captureString - аргумент sqlmock, который запоминает переданную строку (например, случайный ключ файла).
+type captureString string
+
+func (c *captureString) Match(v driver.Value) bool {
+	value, ok := v.(string)
+	*c = captureString(value)
+	return ok
+}
+
+func TestServeImage(t *testing.T) {
+	tcs := []struct {
+		name string
+		path string
+	}{
+		{name: "missing image", path: "/images/products/1/missing.png"},
+		{name: "key outside of the store", path: "/images//etc/passwd.png"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, err := http.Get(server.URL + tc.path)
+				require.NoError(t, err)
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+				require.Equal(t, http.StatusNotFound, res.StatusCode)
+			})
+		})
+	}
+}
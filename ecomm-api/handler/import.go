@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"ecomm/ecomm-api/service"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+const maxImportSize = 100 << 20
+
+var importContentTypes = map[string]string{
+	"text/csv":             service.ImportFormatCSV,
+	"application/jsonl":    service.ImportFormatJSONL,
+	"application/x-ndjson": service.ImportFormatJSONL,
+}
+
+// importProducts принимает файл импорта прямо в теле запроса. Формат берется из ?format=
+// или из Content-Type, ?dry_run=true проверяет файл, ничего не сохраняя.
+func (h *handler) importProducts(w http.ResponseWriter, r *http.Request) {
+	op := "importProducts"
+	opts := service.ImportOptions{Format: r.URL.Query().Get("format")}
+	if opts.Format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format, ok := importContentTypes[mediaType]
+		if !ok {
+			responseWithError(w, r, service.NewErrUnsupportedMediaType(op,
+				"Content-Type must be text/csv or application/x-ndjson, or set the format parameter"))
+			return
+		}
+		opts.Format = format
+	}
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			responseWithError(w, r, service.NewErrValidation(op, "dry_run must be a boolean", err))
+			return
+		}
+		opts.DryRun = dryRun
+	}
+	if value := r.URL.Query().Get("chunk_size"); value != "" {
+		chunkSize, err := strconv.Atoi(value)
+		if err != nil {
+			responseWithError(w, r, service.NewErrValidation(op, "chunk_size must be an integer", err))
+			return
+		}
+		opts.ChunkSize = chunkSize
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	report, err := h.service.ImportProducts(r.Context(), r.Body, opts)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			err = service.NewErrPayloadTooLarge(op, fmt.Sprintf("import file must not exceed %d bytes", maxImportSize))
+		}
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportProducts(t *testing.T) {
+	categoryColumns := []string{"id", "parent_id", "name", "slug", "created_at", "updated_at"}
+
+	importFile := func(t *testing.T, server *httptest.Server, query string, contentType string, body string) (*http.Response, map[string]interface{}) {
+		accessToken, _, err := testTokenMaker.CreateToken(1, "admin@example.com", true, time.Hour)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/products/import"+query, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&resBody))
+		return res, resBody
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "csv dry run with row errors",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM categories WHERE slug=$1")).
+					WithArgs("lighting").
+					WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(4, nil, "Lighting", "lighting", time.Now(), nil))
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT import_row")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id, deleted_at FROM products WHERE sku=$1 FOR UPDATE")).
+					WithArgs("LAMP-1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}))
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO products (sku, name, image, category_id, description, price, count_in_stock)")).
+					WithArgs("LAMP-1", "Desk lamp", "lamp.jpg", int64(4), "Warm, dimmable", 19.5, int64(3)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events")).
+					WithArgs("product", 11, "product.created", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(regexp.QuoteMeta("RELEASE SAVEPOINT import_row")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				file := "sku,name,image,category,price,count_in_stock,description\n" +
+					"LAMP-1,Desk lamp,lamp.jpg,lighting,19.5,3,\"Warm, dimmable\"\n" +
+					"LAMP-2,Floor lamp,floor.jpg,lighting,cheap,1,\n" +
+					"\n" +
+					"LAMP-3,,floor.jpg,lighting,5,1,\n"
+				res, body := importFile(t, server, "?dry_run=true", "text/csv; charset=utf-8", file)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, true, body["dry_run"])
+				require.Equal(t, 3.0, body["total"])
+				require.Equal(t, 1.0, body["created"])
+				require.Equal(t, 2.0, body["failed"])
+				require.Equal(t, []interface{}{
+					map[string]interface{}{"line": 3.0, "message": `price must be a number: strconv.ParseFloat: parsing "cheap": invalid syntax`},
+					map[string]interface{}{"line": 5.0, "message": "name is required"},
+				}, body["errors"])
+			},
+		},
+		{
+			name: "jsonl with unknown category",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM categories WHERE slug=$1")).
+					WithArgs("garden").
+					WillReturnRows(sqlmock.NewRows(categoryColumns))
+
+				file := `{"name":"Hose","image":"hose.jpg","category":"garden","price":12}` + "\n" +
+					`{"name":"Rake","colour":"green"}` + "\n"
+				res, body := importFile(t, server, "", "application/x-ndjson", file)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, 2.0, body["failed"])
+				errors := body["errors"].([]interface{})
+				require.Equal(t, "category with id garden not found", errors[0].(map[string]interface{})["message"])
+				require.Contains(t, errors[1].(map[string]interface{})["message"], "unknown field")
+			},
+		},
+		{
+			name: "unknown csv column",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, body := importFile(t, server, "?format=csv", "application/octet-stream", "name,colour\nlamp,red\n")
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				require.Equal(t, `unknown csv column "colour"`, body["Error"])
+			},
+		},
+		{
+			name: "unsupported content type",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := importFile(t, server, "", "application/json", "[]")
+				require.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"ecomm/ecomm-api/service"
+	"net/http"
+	"strconv"
+)
+
+// getJobs - задачи фоновой очереди, фильтры ?status=&type=&limit=. Разбор dead letters - ?status=dead.
+func (h *handler) getJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var limit int64
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.ParseInt(value, 10, 64); err != nil {
+			responseWithError(w, r, service.NewErrValidation("getJobs", "invalid limit", err))
+			return
+		}
+	}
+	jobsRes, err := h.service.GetJobs(r.Context(), query.Get("status"), query.Get("type"), limit)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, jobsRes)
+}
+
+func (h *handler) getJob(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	jobRes, err := h.service.GetJob(r.Context(), id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, jobRes)
+}
+
+func (h *handler) retryJob(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	jobRes, err := h.service.RetryJob(r.Context(), id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, jobRes)
+}
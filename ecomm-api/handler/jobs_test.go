@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobs(t *testing.T) {
+	jobColumns := []string{"id", "type", "payload", "status", "attempts", "max_attempts", "run_at", "locked_at", "last_error",
+		"unique_key", "created_at", "updated_at", "finished_at"}
+	expectJob := func(mock sqlmock.Sqlmock, status string) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM jobs WHERE id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(jobColumns).
+				AddRow(1, "email.send", []byte(`{"order_id":7}`), status, 5, 5, time.Now(), nil, "smtp unavailable", nil, time.Now(), time.Now(), time.Now()))
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "dead letters",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM jobs WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2) ORDER BY id DESC LIMIT $3")).
+					WithArgs("dead", "", 50).
+					WillReturnRows(sqlmock.NewRows(jobColumns).
+						AddRow(1, "email.send", []byte(`{"order_id":7}`), "dead", 5, 5, time.Now(), nil, "smtp unavailable", nil, time.Now(), time.Now(), time.Now()))
+
+				accessToken, _, err := testTokenMaker.CreateToken(1, "admin@example.com", true, time.Hour)
+				require.NoError(t, err)
+				req, err := http.NewRequest(http.MethodGet, server.URL+"/jobs?status=dead", nil)
+				require.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer "+accessToken)
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				var jobs []map[string]interface{}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&jobs))
+				require.Len(t, jobs, 1)
+				require.Equal(t, map[string]interface{}{"order_id": float64(7)}, jobs[0]["payload"])
+				require.Equal(t, "smtp unavailable", jobs[0]["last_error"])
+			},
+		},
+		{
+			name: "unknown status",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := doAuthorized(t, http.MethodGet, server.URL+"/jobs?status=failed", 1, true)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+			},
+		},
+		{
+			name: "retry dead job",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectJob(mock, "dead")
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE jobs SET status='pending', attempts=0")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(jobColumns).
+						AddRow(1, "email.send", []byte(`{"order_id":7}`), "pending", 0, 5, time.Now(), nil, "smtp unavailable", nil, time.Now(), time.Now(), nil))
+
+				res, _ := doAuthorized(t, http.MethodPost, server.URL+"/jobs/1/retry", 1, true)
+				require.Equal(t, http.StatusAccepted, res.StatusCode)
+			},
+		},
+		{
+			name: "retry job that is not dead",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectJob(mock, "running")
+
+				res, _ := doAuthorized(t, http.MethodPost, server.URL+"/jobs/1/retry", 1, true)
+				require.Equal(t, http.StatusConflict, res.StatusCode)
+			},
+		},
+		{
+			name: "admins only",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := doAuthorized(t, http.MethodGet, server.URL+"/jobs", 3, false)
+				require.Equal(t, http.StatusForbidden, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/token"
+	"net/http"
+	"strings"
+)
+
+type authKey struct{}
+
+// authenticate проверяет Bearer-токен и кладёт claims пользователя в контекст запроса.
+func (h *handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := "authenticate"
+		header := r.Header.Get("Authorization")
+		tokenStr, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || tokenStr == "" {
+			responseWithError(w, r, service.NewErrUnauthorized(op, "missing bearer token", nil))
+			return
+		}
+
+		claims, err := h.tokenMaker.VerifyToken(tokenStr)
+		if err != nil {
+			responseWithError(w, r, service.NewErrUnauthorized(op, "invalid token", err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), authKey{}, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// optionalAuthenticate пропускает запрос без токена анонимно, но неверный токен отклоняет так же, как authenticate.
+func (h *handler) optionalAuthenticate(next http.Handler) http.Handler {
+	authenticated := h.authenticate(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin должен стоять после authenticate.
+func (h *handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := claimsFromContext(r.Context())
+		if claims == nil || !claims.IsAdmin {
+			responseWithError(w, r, service.NewErrForbidden("requireAdmin", "admin only"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func claimsFromContext(ctx context.Context) *token.UserClaims {
+	claims, _ := ctx.Value(authKey{}).(*token.UserClaims)
+	return claims
+}
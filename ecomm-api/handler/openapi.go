@@ -0,0 +1,372 @@
+package handler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	pathpkg "path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Спецификация генерируется из маршрутов RegisterRoutes и DTO (см. apiOperations), а отдается
+// закоммиченный openapi.json: его видно в ревью, и TestOpenAPISpec падает, если он отстал от кода.
+// Обновить: go test ./ecomm-api/handler -run TestOpenAPISpec -update
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// serveDocs отдает страницу документации. Она самодостаточна и читает /openapi.json.
+func serveDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
+
+const jsonContentType = "application/json"
+
+// apiOperation описывает то, чего нельзя вывести из маршрута: DTO запроса и ответа, query-параметры
+// и статус успешного ответа. Путь, path-параметры и требования к авторизации берутся из роутера.
+type apiOperation struct {
+	summary      string
+	query        []apiParam
+	headers      []apiParam
+	body         interface{} // Значение DTO тела запроса, nil - без тела
+	bodyTypes    []string    // По умолчанию application/json
+	bodyOptional bool
+	status       int
+	response     interface{} // Значение DTO ответа, nil - без тела
+	responseType []string    // По умолчанию application/json
+}
+
+type apiParam struct {
+	name        string
+	schema      string // string, integer, number, boolean, date
+	description string
+	required    bool
+	enum        []string
+}
+
+// Типы path-параметров, все остальные - строки
+var pathParamSchemas = map[string]string{
+	"id":         "integer",
+	"imageID":    "integer",
+	"deliveryID": "integer",
+}
+
+// binaryBody - тело запроса или ответа, которое не описывается DTO (файл, картинка).
+type binaryBody struct{}
+
+// multipartImage - форма загрузки картинки.
+type multipartImage struct{}
+
+// buildOpenAPI обходит маршруты и собирает документ OpenAPI 3.0. Маршрут без описания в operations
+// и описание без маршрута - ошибка: так новый обработчик не попадет в API молча.
+func buildOpenAPI(h *handler, routes chi.Routes, operations map[string]apiOperation) ([]byte, error) {
+	authenticate, requireAdmin := funcName(h.authenticate), funcName(h.requireAdmin)
+	schemas := newSchemaRegistry()
+	paths := map[string]map[string]interface{}{}
+	documented := map[string]bool{}
+
+	err := chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		name := strings.TrimSuffix(funcName(handler), "-fm")
+		name = name[strings.LastIndex(name, ".")+1:]
+		op, ok := operations[name]
+		if !ok {
+			return fmt.Errorf("route %s %s: handler %s is missing in apiOperations", method, route, name)
+		}
+		documented[name] = true
+
+		var auth, admin bool
+		for _, mw := range middlewares {
+			switch funcName(mw) {
+			case authenticate:
+				auth = true
+			case requireAdmin:
+				admin = true
+			}
+		}
+
+		path, params := openAPIPath(route)
+		for _, p := range op.query {
+			params = append(params, p.toParameter("query"))
+		}
+		for _, p := range op.headers {
+			params = append(params, p.toParameter("header"))
+		}
+
+		// Тег - первый сегмент пути: /orders/{id} попадает в orders, /openapi.json - в openapi
+		tag := strings.Split(strings.Trim(path, "/"), "/")[0]
+		operation := map[string]interface{}{
+			"operationId": name,
+			"summary":     op.summary,
+			"tags":        []string{strings.TrimSuffix(tag, pathpkg.Ext(tag))},
+			"responses":   op.responses(schemas, auth, admin),
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if auth {
+			operation["security"] = []map[string][]string{{"bearerAuth": {}}}
+		}
+		if admin {
+			operation["description"] = "Admin only."
+		}
+		if op.body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": !op.bodyOptional,
+				"content":  content(schemas.schemaOf(op.body, false), op.bodyTypes),
+			}
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(method)] = operation
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name := range operations {
+		if !documented[name] {
+			return nil, fmt.Errorf("apiOperations describes %s, but no route uses it", name)
+		}
+	}
+	if schemas.err != nil {
+		return nil, schemas.err
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "ecomm API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding openapi spec: %w", err)
+	}
+	return append(spec, '\n'), nil
+}
+
+func (op apiOperation) responses(schemas *schemaRegistry, auth, admin bool) map[string]interface{} {
+	success := map[string]interface{}{"description": http.StatusText(op.status)}
+	if op.response != nil {
+		success["content"] = content(schemas.schemaOf(op.response, true), op.responseType)
+	}
+	responses := map[string]interface{}{
+		fmt.Sprint(op.status): success,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     content(schemas.schemaOf(APIErrorResponse{}, true), nil),
+		},
+	}
+	if auth {
+		responses["401"] = map[string]string{"description": "Missing or invalid bearer token"}
+	}
+	if admin {
+		responses["403"] = map[string]string{"description": "Not an admin"}
+	}
+	return responses
+}
+
+func content(schema map[string]interface{}, contentTypes []string) map[string]interface{} {
+	if len(contentTypes) == 0 {
+		contentTypes = []string{jsonContentType}
+	}
+	result := map[string]interface{}{}
+	for _, contentType := range contentTypes {
+		result[contentType] = map[string]interface{}{"schema": schema}
+	}
+	return result
+}
+
+func (p apiParam) toParameter(in string) map[string]interface{} {
+	schema := map[string]interface{}{"type": p.schema}
+	if p.schema == "date" {
+		schema = map[string]interface{}{"type": "string", "description": "RFC 3339 or YYYY-MM-DD"}
+	}
+	if len(p.enum) > 0 {
+		schema["enum"] = p.enum
+	}
+	param := map[string]interface{}{"name": p.name, "in": in, "schema": schema}
+	if p.description != "" {
+		param["description"] = p.description
+	}
+	if p.required || in == "path" {
+		param["required"] = true
+	}
+	return param
+}
+
+// openAPIPath переводит шаблон chi в путь OpenAPI: убирает завершающий слэш подроутеров
+// и дает имя wildcard-параметру.
+func openAPIPath(route string) (string, []map[string]interface{}) {
+	if len(route) > 1 {
+		route = strings.TrimSuffix(route, "/")
+	}
+	if strings.HasSuffix(route, "/*") {
+		route = strings.TrimSuffix(route, "*") + "{key}"
+	}
+	var params []map[string]interface{}
+	for _, segment := range strings.Split(route, "/") {
+		if !strings.HasPrefix(segment, "{") {
+			continue
+		}
+		name := strings.Trim(segment, "{}")
+		schema := pathParamSchemas[name]
+		if schema == "" {
+			schema = "string"
+		}
+		params = append(params, apiParam{name: name, schema: schema}.toParameter("path"))
+	}
+	return route, params
+}
+
+func funcName(fn interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+}
+
+// schemaRegistry строит JSON Schema по типам DTO, именованные структуры уходят в components.
+// Поля ответа без omitempty присутствуют всегда и помечаются required. В запросе обязательных
+// полей на уровне JSON нет: отсутствующее поле декодируется в нулевое значение, остальное проверяет сервис.
+type schemaRegistry struct {
+	components map[string]interface{}
+	types      map[string]reflect.Type
+	response   bool
+	err        error
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{components: map[string]interface{}{}, types: map[string]reflect.Type{}}
+}
+
+func (s *schemaRegistry) schemaOf(value interface{}, response bool) map[string]interface{} {
+	s.response = response
+	switch value.(type) {
+	case binaryBody:
+		return map[string]interface{}{"type": "string", "format": "binary"}
+	case multipartImage:
+		return map[string]interface{}{
+			"type":       "object",
+			"required":   []string{"image"},
+			"properties": map[string]interface{}{"image": map[string]string{"type": "string", "format": "binary"}},
+		}
+	}
+	return s.schema(reflect.TypeOf(value))
+}
+
+func (s *schemaRegistry) schema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	// Произвольный JSON, например аргументы фоновой задачи
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.schema(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		return s.structSchema(t)
+	case reflect.Interface:
+		return map[string]interface{}{}
+	}
+	s.fail(fmt.Errorf("type %s has no OpenAPI mapping", t))
+	return map[string]interface{}{}
+}
+
+// structSchema описывает поля так же, как их видит encoding/json: имя из тега или имя поля,
+// omitempty - поле может отсутствовать в ответе.
+func (s *schemaRegistry) structSchema(t reflect.Type) map[string]interface{} {
+	name := t.Name()
+	if name != "" {
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if known, ok := s.types[name]; ok {
+			if known != t {
+				s.fail(fmt.Errorf("schema name %s is used by %s and %s", name, known, t))
+			}
+			return ref
+		}
+		s.types[name] = t
+	}
+
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		fieldName, options, _ := strings.Cut(tag, ",")
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+		properties[fieldName] = s.schema(field.Type)
+		if s.response && !strings.Contains(options, "omitempty") {
+			required = append(required, fieldName)
+		}
+	}
+	sort.Strings(required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	if name == "" {
+		return schema
+	}
+	s.components[name] = schema
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func (s *schemaRegistry) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
@@ -0,0 +1,421 @@
+package handler
+
+import (
+	"ecomm/ecomm-api/gql"
+	categoryDto "ecomm/ecomm-api/handler/dto/category"
+	jobDto "ecomm/ecomm-api/handler/dto/job"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	returnDto "ecomm/ecomm-api/handler/dto/returns"
+	reviewDto "ecomm/ecomm-api/handler/dto/review"
+	userDto "ecomm/ecomm-api/handler/dto/user"
+	webhookDto "ecomm/ecomm-api/handler/dto/webhook"
+	"ecomm/ecomm-api/payments"
+	"ecomm/ecomm-api/service"
+	"net/http"
+)
+
+var (
+	ifMatchHeader = apiParam{name: "If-Match", schema: "string", required: true,
+		description: `Current product version from ETag, for example "3"`}
+
+	orderFilters = []apiParam{
+		{name: "page", schema: "integer"},
+		{name: "page_size", schema: "integer"},
+		{name: "status", schema: "string"},
+		{name: "from", schema: "date"},
+		{name: "to", schema: "date", description: "Exclusive; a date without time includes the whole day"},
+		{name: "min_total", schema: "number"},
+		{name: "max_total", schema: "number"},
+	}
+	adminOrderFilters = append([]apiParam{{name: "user_id", schema: "integer"}}, orderFilters...)
+
+	exportFormat = apiParam{name: "format", schema: "string", description: "csv by default",
+		enum: []string{service.ExportFormatCSV, service.ExportFormatJSONL, service.ExportFormatXLSX}}
+	exportContentTypes = []string{"text/csv", "application/x-ndjson",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}
+)
+
+// apiOperations - описания обработчиков по имени метода handler, оно же operationId.
+var apiOperations = map[string]apiOperation{
+	"createProduct": {
+		summary:  "Create a product",
+		body:     productDto.CreateProductReq{},
+		status:   http.StatusCreated,
+		response: productDto.ProductRes{},
+	},
+	"getProducts": {
+		summary:  "List products",
+		status:   http.StatusOK,
+		response: []productDto.ProductRes{},
+	},
+	"getProduct": {
+		summary:  "Get a product, ETag carries its version",
+		status:   http.StatusOK,
+		response: productDto.ProductRes{},
+	},
+	"updateProduct": {
+		summary:  "Replace a product",
+		headers:  []apiParam{ifMatchHeader},
+		body:     productDto.UpdateProductReq{},
+		status:   http.StatusOK,
+		response: productDto.ProductRes{},
+	},
+	"patchProduct": {
+		summary:   "Change the given product fields (JSON Merge Patch)",
+		headers:   []apiParam{ifMatchHeader},
+		body:      productDto.PatchProductReq{},
+		bodyTypes: []string{mergePatchContentType},
+		status:    http.StatusOK,
+		response:  productDto.ProductRes{},
+	},
+	"deleteProduct": {
+		summary: "Soft-delete a product",
+		headers: []apiParam{ifMatchHeader},
+		status:  http.StatusNoContent,
+	},
+	"restoreProduct": {
+		summary:  "Restore a deleted product",
+		status:   http.StatusOK,
+		response: productDto.ProductRes{},
+	},
+	"createProductOption": {
+		summary:  "Add an option such as size or color",
+		body:     productDto.CreateProductOptionReq{},
+		status:   http.StatusCreated,
+		response: productDto.ProductOptionRes{},
+	},
+	"getProductOptions": {
+		summary:  "List product options",
+		status:   http.StatusOK,
+		response: []productDto.ProductOptionRes{},
+	},
+	"createProductVariant": {
+		summary:  "Add a variant with a value for every option",
+		body:     productDto.CreateProductVariantReq{},
+		status:   http.StatusCreated,
+		response: productDto.ProductVariantRes{},
+	},
+	"getProductVariants": {
+		summary:  "List product variants",
+		status:   http.StatusOK,
+		response: []productDto.ProductVariantRes{},
+	},
+	"getProductReviews": {
+		summary:  "List approved reviews of a product",
+		status:   http.StatusOK,
+		response: []reviewDto.ReviewRes{},
+	},
+	"createReview": {
+		summary:  "Review a purchased product, the review waits for moderation",
+		body:     reviewDto.CreateReviewReq{},
+		status:   http.StatusCreated,
+		response: reviewDto.ReviewRes{},
+	},
+	"getProductImages": {
+		summary:  "List product images in display order",
+		status:   http.StatusOK,
+		response: []productDto.ProductImageRes{},
+	},
+	"importProducts": {
+		summary: "Import products from CSV or JSON Lines, rows are matched by SKU",
+		query: []apiParam{
+			{name: "format", schema: "string", description: "Overrides Content-Type",
+				enum: []string{service.ImportFormatCSV, service.ImportFormatJSONL}},
+			{name: "dry_run", schema: "boolean", description: "Validate without saving"},
+			{name: "chunk_size", schema: "integer", description: "Rows per transaction"},
+		},
+		body:      binaryBody{},
+		bodyTypes: []string{"text/csv", "application/x-ndjson"},
+		status:    http.StatusOK,
+		response:  productDto.ImportReportRes{},
+	},
+	"exportProducts": {
+		summary: "Export the catalog as a file",
+		query: []apiParam{
+			exportFormat,
+			{name: "category", schema: "string", description: "Category slug, includes subcategories"},
+			{name: "updated_since", schema: "date"},
+			{name: "in_stock", schema: "boolean"},
+			{name: "include_deleted", schema: "boolean"},
+		},
+		status:       http.StatusOK,
+		response:     binaryBody{},
+		responseType: exportContentTypes,
+	},
+	"uploadProductImage": {
+		summary:   "Upload a JPEG, PNG, GIF or WebP image, a thumbnail is generated",
+		body:      multipartImage{},
+		bodyTypes: []string{"multipart/form-data"},
+		status:    http.StatusCreated,
+		response:  productDto.ProductImageRes{},
+	},
+	"reorderProductImages": {
+		summary:  "Set the display order of product images",
+		body:     productDto.ReorderProductImagesReq{},
+		status:   http.StatusOK,
+		response: []productDto.ProductImageRes{},
+	},
+	"deleteProductImage": {
+		summary: "Delete a product image",
+		status:  http.StatusNoContent,
+	},
+	"getCategories": {
+		summary:  "List categories",
+		status:   http.StatusOK,
+		response: []categoryDto.CategoryRes{},
+	},
+	"getCategory": {
+		summary:  "Get a category",
+		status:   http.StatusOK,
+		response: categoryDto.CategoryRes{},
+	},
+	"getCategoryProducts": {
+		summary:  "List products of a category and its subcategories",
+		status:   http.StatusOK,
+		response: []productDto.ProductRes{},
+	},
+	"createCategory": {
+		summary:  "Create a category",
+		body:     categoryDto.CreateCategoryReq{},
+		status:   http.StatusCreated,
+		response: categoryDto.CategoryRes{},
+	},
+	"updateCategory": {
+		summary:  "Replace a category",
+		body:     categoryDto.UpdateCategoryReq{},
+		status:   http.StatusOK,
+		response: categoryDto.CategoryRes{},
+	},
+	"deleteCategory": {
+		summary: "Delete an empty category",
+		status:  http.StatusNoContent,
+	},
+	"createOrder": {
+		summary:  "Place an order and charge the payment method",
+		body:     orderDto.CreateOrderReq{},
+		status:   http.StatusCreated,
+		response: orderDto.OrderRes{},
+	},
+	"getOrder": {
+		summary:  "Get an order of the current user, admins see any order",
+		status:   http.StatusOK,
+		response: orderDto.OrderRes{},
+	},
+	"getOrders": {
+		summary:  "List all orders",
+		query:    adminOrderFilters,
+		status:   http.StatusOK,
+		response: orderDto.OrdersPageRes{},
+	},
+	"exportOrders": {
+		summary:      "Export orders with items as a file",
+		query:        append([]apiParam{exportFormat}, adminOrderFilters...),
+		status:       http.StatusOK,
+		response:     binaryBody{},
+		responseType: exportContentTypes,
+	},
+	"cancelOrder": {
+		summary:  "Cancel an order, a paid order is refunded",
+		body:     orderDto.CancelOrderReq{},
+		status:   http.StatusOK,
+		response: orderDto.OrderRes{},
+	},
+	"shipOrder": {
+		summary:  "Mark a paid order as shipped, the customer gets an email with the tracking number",
+		body:     orderDto.ShipOrderReq{},
+		status:   http.StatusOK,
+		response: orderDto.OrderRes{},
+	},
+	"createReturn": {
+		summary:  "Request a return of an order item",
+		body:     returnDto.CreateReturnReq{},
+		status:   http.StatusCreated,
+		response: returnDto.ReturnRes{},
+	},
+	"getOrderReturns": {
+		summary:  "List returns of an order",
+		status:   http.StatusOK,
+		response: []returnDto.ReturnRes{},
+	},
+	"refundOrder": {
+		summary:      "Refund an order, the whole remaining amount by default",
+		body:         orderDto.CreateRefundReq{},
+		bodyOptional: true,
+		status:       http.StatusCreated,
+		response:     orderDto.RefundRes{},
+	},
+	"getMyOrders": {
+		summary:  "List orders of the current user",
+		query:    orderFilters,
+		status:   http.StatusOK,
+		response: orderDto.OrdersPageRes{},
+	},
+	"getReturns": {
+		summary:  "List returns",
+		query:    []apiParam{{name: "status", schema: "string"}},
+		status:   http.StatusOK,
+		response: []returnDto.ReturnRes{},
+	},
+	"approveReturn": {
+		summary:      "Approve a return request",
+		body:         returnDto.ReviewReturnReq{},
+		bodyOptional: true,
+		status:       http.StatusOK,
+		response:     returnDto.ReturnRes{},
+	},
+	"rejectReturn": {
+		summary:      "Reject a return request",
+		body:         returnDto.ReviewReturnReq{},
+		bodyOptional: true,
+		status:       http.StatusOK,
+		response:     returnDto.ReturnRes{},
+	},
+	"receiveReturn": {
+		summary:      "Mark returned items as received, they go back to stock",
+		body:         returnDto.ReviewReturnReq{},
+		bodyOptional: true,
+		status:       http.StatusOK,
+		response:     returnDto.ReturnRes{},
+	},
+	"refundReturn": {
+		summary:      "Refund a received return",
+		body:         returnDto.RefundReturnReq{},
+		bodyOptional: true,
+		status:       http.StatusCreated,
+		response:     orderDto.RefundRes{},
+	},
+	"getReviews": {
+		summary: "List reviews for moderation",
+		query: []apiParam{
+			{name: "status", schema: "string"},
+			{name: "product_id", schema: "integer"},
+		},
+		status:   http.StatusOK,
+		response: []reviewDto.ReviewRes{},
+	},
+	"approveReview": {
+		summary:  "Approve a review, it starts counting in the product rating",
+		status:   http.StatusOK,
+		response: reviewDto.ReviewRes{},
+	},
+	"rejectReview": {
+		summary:  "Reject a review",
+		status:   http.StatusOK,
+		response: reviewDto.ReviewRes{},
+	},
+	"createUser": {
+		summary:  "Register a user",
+		body:     userDto.CreateUserReq{},
+		status:   http.StatusCreated,
+		response: userDto.UserRes{},
+	},
+	"loginUser": {
+		summary:  "Log in and get a bearer token",
+		body:     userDto.LoginUserReq{},
+		status:   http.StatusOK,
+		response: userDto.LoginUserRes{},
+	},
+	"requestPasswordReset": {
+		summary: "Email a password reset link. The response is the same whether or not the email is registered",
+		body:    userDto.RequestPasswordResetReq{},
+		status:  http.StatusAccepted,
+	},
+	"resetPassword": {
+		summary: "Set a new password with the token from the reset email",
+		body:    userDto.ResetPasswordReq{},
+		status:  http.StatusNoContent,
+	},
+	"serveImage": {
+		summary:      "Download a stored image or thumbnail",
+		status:       http.StatusOK,
+		response:     binaryBody{},
+		responseType: []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+	},
+	"paymentWebhook": {
+		summary: "Payment provider events",
+		headers: []apiParam{{name: payments.SignatureHeader, schema: "string", required: true,
+			description: "HMAC signature of the body"}},
+		body:     map[string]interface{}{},
+		status:   http.StatusOK,
+		response: map[string]bool{},
+	},
+	"createWebhookSubscription": {
+		summary:  "Subscribe a URL to events, the signing secret is returned only here",
+		body:     webhookDto.CreateWebhookSubscriptionReq{},
+		status:   http.StatusCreated,
+		response: webhookDto.WebhookSubscriptionRes{},
+	},
+	"getWebhookSubscriptions": {
+		summary:  "List webhook subscriptions",
+		status:   http.StatusOK,
+		response: []webhookDto.WebhookSubscriptionRes{},
+	},
+	"getWebhookSubscription": {
+		summary:  "Get a webhook subscription",
+		status:   http.StatusOK,
+		response: webhookDto.WebhookSubscriptionRes{},
+	},
+	"updateWebhookSubscription": {
+		summary:  "Replace a webhook subscription, enable or disable it",
+		body:     webhookDto.UpdateWebhookSubscriptionReq{},
+		status:   http.StatusOK,
+		response: webhookDto.WebhookSubscriptionRes{},
+	},
+	"deleteWebhookSubscription": {
+		summary: "Delete a webhook subscription and its delivery log",
+		status:  http.StatusNoContent,
+	},
+	"getWebhookDeliveries": {
+		summary: "Delivery log of a webhook subscription, newest first",
+		query: []apiParam{
+			{name: "status", schema: "string"},
+			{name: "limit", schema: "integer"},
+		},
+		status:   http.StatusOK,
+		response: []webhookDto.WebhookDeliveryRes{},
+	},
+	"redeliverWebhook": {
+		summary:  "Send a delivery again with a fresh set of retries",
+		status:   http.StatusAccepted,
+		response: webhookDto.WebhookDeliveryRes{},
+	},
+	"getJobs": {
+		summary: "Background jobs, newest first. Dead letters are listed with status=dead",
+		query: []apiParam{
+			{name: "status", schema: "string"},
+			{name: "type", schema: "string"},
+			{name: "limit", schema: "integer"},
+		},
+		status:   http.StatusOK,
+		response: []jobDto.JobRes{},
+	},
+	"getJob": {
+		summary:  "Get a background job",
+		status:   http.StatusOK,
+		response: jobDto.JobRes{},
+	},
+	"retryJob": {
+		summary:  "Put a dead job back into the queue with a fresh set of attempts",
+		status:   http.StatusAccepted,
+		response: jobDto.JobRes{},
+	},
+	"graphqlQuery": {
+		summary: "GraphQL queries for the storefront: products, categories, the current user and their orders. " +
+			"The bearer token is optional, errors are reported in the errors field with status 200",
+		body:     gql.Request{},
+		status:   http.StatusOK,
+		response: map[string]interface{}{},
+	},
+	"serveOpenAPI": {
+		summary:  "This document",
+		status:   http.StatusOK,
+		response: map[string]interface{}{},
+	},
+	"serveDocs": {
+		summary:      "API documentation page",
+		status:       http.StatusOK,
+		response:     binaryBody{},
+		responseType: []string{"text/html"},
+	},
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+)
+
+var updateSpec = flag.Bool("update", false, "rewrite openapi.json from routes and DTOs")
+
+// TestOpenAPISpec падает, если маршруты или DTO поменялись, а openapi.json нет.
+func TestOpenAPISpec(t *testing.T) {
+	h := &handler{}
+	spec, err := buildOpenAPI(h, RegisterRoutes(h), apiOperations)
+	require.NoError(t, err)
+
+	if *updateSpec {
+		require.NoError(t, os.WriteFile("openapi.json", spec, 0o644))
+		return
+	}
+	committed, err := os.ReadFile("openapi.json")
+	require.NoError(t, err)
+	require.Equal(t, string(committed), string(spec),
+		"openapi.json is out of date, run: go test ./ecomm-api/handler -run TestOpenAPISpec -update")
+}
+
+func TestBuildOpenAPI(t *testing.T) {
+	h := &handler{}
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{
+			name: "undocumented route",
+			test: func(t *testing.T) {
+				r := chi.NewRouter()
+				r.Get("/health", noop)
+				_, err := buildOpenAPI(h, r, map[string]apiOperation{})
+				require.ErrorContains(t, err, "is missing in apiOperations")
+			},
+		},
+		{
+			name: "operation without route",
+			test: func(t *testing.T) {
+				r := chi.NewRouter()
+				r.Get("/users/{id}", h.getProduct)
+				_, err := buildOpenAPI(h, r, map[string]apiOperation{
+					"getProduct": apiOperations["getProduct"],
+					"getOrder":   apiOperations["getOrder"],
+				})
+				require.ErrorContains(t, err, "apiOperations describes getOrder")
+			},
+		},
+		{
+			name: "auth, path params and schemas from router and dto",
+			test: func(t *testing.T) {
+				r := chi.NewRouter()
+				r.Route("/orders", func(r chi.Router) {
+					r.Use(h.authenticate)
+					r.Post("/", h.createOrder)
+					r.With(h.requireAdmin).Get("/{id}", h.getOrder)
+				})
+				spec, err := buildOpenAPI(h, r, map[string]apiOperation{
+					"createOrder": apiOperations["createOrder"],
+					"getOrder":    apiOperations["getOrder"],
+				})
+				require.NoError(t, err)
+
+				var doc struct {
+					Paths      map[string]map[string]map[string]interface{}
+					Components struct {
+						Schemas map[string]map[string]interface{}
+					}
+				}
+				require.NoError(t, json.Unmarshal(spec, &doc))
+
+				create := doc.Paths["/orders"]["post"]
+				require.NotNil(t, create["security"])
+				require.Nil(t, create["description"])
+				get := doc.Paths["/orders/{id}"]["get"]
+				require.Equal(t, "Admin only.", get["description"])
+				require.Equal(t, []interface{}{map[string]interface{}{
+					"name": "id", "in": "path", "required": true, "schema": map[string]interface{}{"type": "integer"},
+				}}, get["parameters"])
+
+				// Поля запроса не обязательны, поля ответа без omitempty - обязательны
+				request := doc.Components.Schemas["CreateOrderReq"]
+				require.Contains(t, request["properties"], "items")
+				require.Nil(t, request["required"])
+				response := doc.Components.Schemas["OrderRes"]
+				require.Contains(t, response["required"], "items")
+				require.NotContains(t, response["required"], "payment")
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, tc.test)
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+		res, err := http.Get(server.URL + "/openapi.json")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		doc := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&doc))
+		require.Equal(t, "3.0.3", doc["openapi"])
+
+		res, err = http.Get(server.URL + "/docs")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		page, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(page), `fetch("/openapi.json")`)
+	})
+}
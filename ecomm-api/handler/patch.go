@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"bytes"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+var errUnsupportedMediaType = errors.New("Content-Type must be " + mergePatchContentType)
+
+// decodeProductMergePatch разбирает тело JSON Merge Patch (RFC 7396).
+// null в merge patch означает удаление поля, а у товара удалить можно только описание и артикул -
+// для остальных полей null отклоняется, как и неизвестные поля.
+func decodeProductMergePatch(r *http.Request) (*productDto.PatchProductReq, error) {
+	op := "decodeProductMergePatch"
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != mergePatchContentType {
+		return nil, errUnsupportedMediaType
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		return nil, service.NewErrValidation(op, "merge patch must be a JSON object", err)
+	}
+
+	emptyDescription, emptySKU := false, false
+	for name, value := range fields {
+		if !bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			continue
+		}
+		switch name {
+		case "description":
+			emptyDescription = true
+		case "sku":
+			emptySKU = true
+		default:
+			return nil, service.NewErrValidation(op, fmt.Sprintf("%s cannot be null", name), nil)
+		}
+		delete(fields, name)
+	}
+
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding merge patch: %w", err)
+	}
+	patch := &productDto.PatchProductReq{}
+	decoder := json.NewDecoder(bytes.NewReader(normalized))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(patch); err != nil {
+		return nil, service.NewErrValidation(op, "invalid merge patch", err)
+	}
+	if emptyDescription {
+		patch.Description = new(string)
+	}
+	if emptySKU {
+		patch.SKU = new(string)
+	}
+	return patch, nil
+}
@@ -0,0 +1,369 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductETag(t *testing.T) {
+	productColumns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at"}
+	updateQuery := regexp.QuoteMeta("UPDATE products SET sku=$1, name=$2, image=$3, category_id=$4, description=$5, price=$6, count_in_stock=$7, version=version+1, updated_at=NOW() WHERE id=$8 AND version=$9 AND deleted_at IS NULL RETURNING *")
+	body := `{"name":"lamp","image":"lamp.jpg","category_id":1,"description":"desk lamp","price":10,"count_in_stock":5}`
+
+	expectProductSelect := func(mock sqlmock.Sqlmock, version int64) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, "", 0, 0, 10, 5, version, time.Now(), nil))
+	}
+
+	send := func(t *testing.T, method string, url string, ifMatch string) *http.Response {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		authorize(t, req, 1, true)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "get returns version as etag",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProductSelect(mock, 3)
+
+				res, err := http.Get(server.URL + "/products/1")
+				require.NoError(t, err)
+				res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, `"3"`, res.Header.Get("ETag"))
+			},
+		},
+		{
+			name: "update without if-match",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res := send(t, http.MethodPut, server.URL+"/products/1", "")
+				require.Equal(t, http.StatusPreconditionRequired, res.StatusCode)
+			},
+		},
+		{
+			name: "update with weak etag",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res := send(t, http.MethodPut, server.URL+"/products/1", `W/"3"`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+			},
+		},
+		{
+			name: "update with current version",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(updateQuery).
+					WithArgs(nil, "lamp", "lamp.jpg", 1, "desk lamp", 10.0, 5, 1, 3).
+					WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, "desk lamp", 0, 0, 10, 5, 4, time.Now(), time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload) VALUES ($1, $2, $3, $4)")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				res := send(t, http.MethodPut, server.URL+"/products/1", `"3"`)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, `"4"`, res.Header.Get("ETag"))
+			},
+		},
+		{
+			name: "update with any version",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProductSelect(mock, 3)
+				mock.ExpectBegin()
+				mock.ExpectQuery(updateQuery).
+					WithArgs(nil, "lamp", "lamp.jpg", 1, "desk lamp", 10.0, 5, 1, 3).
+					WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, "desk lamp", 0, 0, 10, 5, 4, time.Now(), time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload) VALUES ($1, $2, $3, $4)")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				res := send(t, http.MethodPut, server.URL+"/products/1", `*`)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, `"4"`, res.Header.Get("ETag"))
+			},
+		},
+		{
+			name: "update with etag list containing current version",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProductSelect(mock, 3)
+				mock.ExpectBegin()
+				mock.ExpectQuery(updateQuery).
+					WithArgs(nil, "lamp", "lamp.jpg", 1, "desk lamp", 10.0, 5, 1, 3).
+					WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, "desk lamp", 0, 0, 10, 5, 4, time.Now(), time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload) VALUES ($1, $2, $3, $4)")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				res := send(t, http.MethodPut, server.URL+"/products/1", `"2", "3"`)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, `"4"`, res.Header.Get("ETag"))
+			},
+		},
+		{
+			name: "delete with etag list of stale versions",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProductSelect(mock, 4)
+
+				res := send(t, http.MethodDelete, server.URL+"/products/1", `"2", "3"`)
+				require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+			},
+		},
+		{
+			name: "update with stale version",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(updateQuery).
+					WithArgs(nil, "lamp", "lamp.jpg", 1, "desk lamp", 10.0, 5, 1, 3).
+					WillReturnRows(sqlmock.NewRows(productColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+				mock.ExpectRollback()
+
+				res := send(t, http.MethodPut, server.URL+"/products/1", `"3"`)
+				require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+			},
+		},
+		{
+			name: "delete with stale version",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE products SET deleted_at=NOW(), version=version+1, updated_at=NOW() WHERE id=$1 AND version=$2 AND deleted_at IS NULL")).
+					WithArgs(1, 3).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+				mock.ExpectRollback()
+
+				res := send(t, http.MethodDelete, server.URL+"/products/1", `"3"`)
+				require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+			},
+		},
+		{
+			name: "delete without if-match",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res := send(t, http.MethodDelete, server.URL+"/products/1", "")
+				require.Equal(t, http.StatusPreconditionRequired, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func TestUpdateProductValidation(t *testing.T) {
+	tcs := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"empty name", `{"name":"","image":"lamp.jpg","category_id":1,"price":10,"count_in_stock":5}`, "name is required"},
+		{"negative price", `{"name":"lamp","image":"lamp.jpg","category_id":1,"price":-1,"count_in_stock":5}`, "price must not be negative"},
+		{"negative stock", `{"name":"lamp","image":"lamp.jpg","category_id":1,"price":10,"count_in_stock":-5}`, "count_in_stock must not be negative"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				req, err := http.NewRequest(http.MethodPut, server.URL+"/products/1", strings.NewReader(tc.body))
+				require.NoError(t, err)
+				authorize(t, req, 1, true)
+				req.Header.Set("If-Match", `"3"`)
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				var body map[string]any
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+				require.Contains(t, body["Error"], tc.wantErr)
+				// До базы запрос не доходит
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func TestCreateProductValidation(t *testing.T) {
+	tcs := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"empty name", `{"name":"","image":"lamp.jpg","category_id":1,"price":10,"count_in_stock":5}`, "name is required"},
+		{"negative price", `{"name":"lamp","image":"lamp.jpg","category_id":1,"price":-1,"count_in_stock":5}`, "price must not be negative"},
+		{"negative stock", `{"name":"lamp","image":"lamp.jpg","category_id":1,"price":10,"count_in_stock":-5}`, "count_in_stock must not be negative"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				req, err := http.NewRequest(http.MethodPost, server.URL+"/products", strings.NewReader(tc.body))
+				require.NoError(t, err)
+				authorize(t, req, 1, true)
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				var body map[string]any
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+				require.Contains(t, body["Error"], tc.wantErr)
+				// До базы запрос не доходит
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func TestPatchProduct(t *testing.T) {
+	productColumns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at"}
+
+	expectProduct := func(mock sqlmock.Sqlmock, version int64) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, "desk lamp", 4, 2, 10, 5, version, time.Now(), nil))
+	}
+	patch := func(t *testing.T, server *httptest.Server, contentType string, body string) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest(http.MethodPatch, server.URL+"/products/1", strings.NewReader(body))
+		require.NoError(t, err)
+		authorize(t, req, 1, true)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("If-Match", `"3"`)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&resBody))
+		return res, resBody
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "changes only present fields",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProduct(mock, 3)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET description=$1, price=$2, version=version+1, updated_at=NOW() WHERE id=$3 AND version=$4 AND deleted_at IS NULL RETURNING *")).
+					WithArgs("", 12.5, 1, 3).
+					WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, "", 4, 2, 12.5, 5, 4, time.Now(), time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload) VALUES ($1, $2, $3, $4)")).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				res, body := patch(t, server, "application/merge-patch+json; charset=utf-8", `{"price": 12.5, "description": null}`)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, `"4"`, res.Header.Get("ETag"))
+				require.Equal(t, "lamp", body["name"])
+				require.Equal(t, 12.5, body["price"])
+			},
+		},
+		{
+			name: "wrong content type",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := patch(t, server, "application/json", `{"price": 12.5}`)
+				require.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+			},
+		},
+		{
+			name: "null for required field",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, body := patch(t, server, "application/merge-patch+json", `{"name": null}`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				require.Equal(t, "name cannot be null", body["Error"])
+			},
+		},
+		{
+			name: "unknown field",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := patch(t, server, "application/merge-patch+json", `{"version": 10}`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+			},
+		},
+		{
+			name: "merged product is invalid",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProduct(mock, 3)
+
+				res, body := patch(t, server, "application/merge-patch+json", `{"count_in_stock": -1}`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				require.Equal(t, "count_in_stock must not be negative", body["Error"])
+			},
+		},
+		{
+			name: "stale version",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProduct(mock, 4)
+
+				res, _ := patch(t, server, "application/merge-patch+json", `{"price": 12.5}`)
+				require.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func TestProductWritesRequireAdmin(t *testing.T) {
+	routes := []struct{ method, path string }{
+		{http.MethodPost, "/products"},
+		{http.MethodPut, "/products/1"},
+		{http.MethodPatch, "/products/1"},
+		{http.MethodDelete, "/products/1"},
+		{http.MethodPost, "/products/1/restore"},
+		{http.MethodPost, "/products/1/options"},
+		{http.MethodPost, "/products/1/variants"},
+	}
+
+	withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+		for _, route := range routes {
+			req, err := http.NewRequest(route.method, server.URL+route.path, strings.NewReader(`{}`))
+			require.NoError(t, err)
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, http.StatusUnauthorized, res.StatusCode, "%s %s", route.method, route.path)
+
+			res, _ = doAuthorized(t, route.method, server.URL+route.path, 3, false)
+			require.Equal(t, http.StatusForbidden, res.StatusCode, "%s %s", route.method, route.path)
+		}
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
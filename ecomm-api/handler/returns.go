@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	returnDto "ecomm/ecomm-api/handler/dto/returns"
+	"encoding/json"
+	"net/http"
+)
+
+func (h *handler) createReturn(w http.ResponseWriter, r *http.Request) {
+	orderID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var createReturnReq returnDto.CreateReturnReq
+	if err := json.NewDecoder(r.Body).Decode(&createReturnReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	returnRes, err := h.service.CreateReturn(r.Context(), orderID, claimsFromContext(r.Context()), &createReturnReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, returnRes)
+}
+
+func (h *handler) getOrderReturns(w http.ResponseWriter, r *http.Request) {
+	orderID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	returnsRes, err := h.service.GetOrderReturns(r.Context(), orderID, claimsFromContext(r.Context()))
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnsRes)
+}
+
+func (h *handler) getReturns(w http.ResponseWriter, r *http.Request) {
+	returnsRes, err := h.service.GetReturns(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnsRes)
+}
+
+func (h *handler) approveReturn(w http.ResponseWriter, r *http.Request) {
+	h.reviewReturn(w, r, h.service.ApproveReturn)
+}
+
+func (h *handler) rejectReturn(w http.ResponseWriter, r *http.Request) {
+	h.reviewReturn(w, r, h.service.RejectReturn)
+}
+
+func (h *handler) receiveReturn(w http.ResponseWriter, r *http.Request) {
+	h.reviewReturn(w, r, h.service.ReceiveReturn)
+}
+
+type reviewReturnFunc func(ctx context.Context, id int64, req *returnDto.ReviewReturnReq) (returnDto.ReturnRes, error)
+
+// reviewReturn - общий обработчик для смены статуса заявки администратором, заметка необязательна.
+func (h *handler) reviewReturn(w http.ResponseWriter, r *http.Request, review reviewReturnFunc) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var reviewReturnReq returnDto.ReviewReturnReq
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&reviewReturnReq); err != nil {
+			responseWithError(w, r, err)
+			return
+		}
+	}
+	returnRes, err := review(r.Context(), id, &reviewReturnReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, returnRes)
+}
+
+func (h *handler) refundReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var refundReturnReq returnDto.RefundReturnReq
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&refundReturnReq); err != nil {
+			responseWithError(w, r, err)
+			return
+		}
+	}
+	refundRes, err := h.service.RefundReturn(r.Context(), id, &refundReturnReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, refundRes)
+}
+
+func (h *handler) refundOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var createRefundReq orderDto.CreateRefundReq
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&createRefundReq); err != nil {
+			responseWithError(w, r, err)
+			return
+		}
+	}
+	refundRes, err := h.service.RefundOrder(r.Context(), orderID, &createRefundReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, refundRes)
+}
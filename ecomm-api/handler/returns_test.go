@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+var returnColumns = []string{"id", "order_id", "order_item_id", "quantity", "reason", "status", "admin_note", "created_at", "updated_at"}
+
+// expectOrderWithItems ожидает загрузку заказа 1 покупателя 3 в статусе status с позициями itemRows.
+func expectOrderWithItems(mock sqlmock.Sqlmock, status string, itemRows *sqlmock.Rows) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(1, 3, "card", status, 10, 20, 130, time.Now(), nil))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id=$1")).
+		WithArgs(1).
+		WillReturnRows(itemRows)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM refunds WHERE order_id=$1")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "order_id"}))
+}
+
+func TestCreateReturn(t *testing.T) {
+	expectOrderLoad := func(mock sqlmock.Sqlmock, status string) {
+		expectOrderWithItems(mock, status, sqlmock.NewRows([]string{"id", "order_id"}))
+	}
+	createReturn := func(t *testing.T, server *httptest.Server) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/orders/1/returns",
+			strings.NewReader(`{"order_item_id": 101, "quantity": 1, "reason": "broken"}`))
+		require.NoError(t, err)
+		authorize(t, req, 3, false)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		return res, body
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "shipped order",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectOrderLoad(mock, "shipped")
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE id=$1 AND order_id=$2 FOR UPDATE")).
+					WithArgs(101, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}).
+						AddRow(101, "item", 2, "test.jpg", 50, 1, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(SUM(quantity), 0) FROM returns WHERE order_item_id=$1 AND status <> 'rejected'")).
+					WithArgs(101).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(0))
+				mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO returns")).
+					ExpectQuery().
+					WithArgs(1, 101, 1, "broken", "requested").
+					WillReturnRows(sqlmock.NewRows(returnColumns).AddRow(5, 1, 101, 1, "broken", "requested", "", time.Now(), nil))
+				mock.ExpectCommit()
+
+				res, body := createReturn(t, server)
+				require.Equal(t, http.StatusCreated, res.StatusCode)
+				require.Equal(t, "requested", body["status"])
+			},
+		},
+		{
+			name: "pending order",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectOrderLoad(mock, "pending")
+
+				res, _ := createReturn(t, server)
+				require.Equal(t, http.StatusConflict, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func TestRefundReturn(t *testing.T) {
+	t.Run("returned item is missing from the order", func(t *testing.T) {
+		withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM returns WHERE id=$1")).
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows(returnColumns).AddRow(5, 1, 101, 1, "broken", "received", "", time.Now(), nil))
+			expectOrderWithItems(mock, "paid", sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}).
+				AddRow(102, "item", 1, "test.jpg", 50, 1, 1))
+
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/returns/5/refund", strings.NewReader(`{}`))
+			require.NoError(t, err)
+			authorize(t, req, 1, true)
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			res.Body.Close()
+
+			// Без позиции сумма неизвестна: возвращать весь платеж нельзя
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	reviewDto "ecomm/ecomm-api/handler/dto/review"
+	"ecomm/ecomm-api/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+func (h *handler) createReview(w http.ResponseWriter, r *http.Request) {
+	productID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var createReviewReq reviewDto.CreateReviewReq
+	if err := json.NewDecoder(r.Body).Decode(&createReviewReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	reviewRes, err := h.service.CreateReview(r.Context(), productID, claimsFromContext(r.Context()), &createReviewReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, reviewRes)
+}
+
+func (h *handler) getProductReviews(w http.ResponseWriter, r *http.Request) {
+	productID, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	reviewsRes, err := h.service.GetProductReviews(r.Context(), productID)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, reviewsRes)
+}
+
+// getReviews - очередь модерации, фильтры ?status=&product_id=.
+func (h *handler) getReviews(w http.ResponseWriter, r *http.Request) {
+	var productID int64
+	if value := r.URL.Query().Get("product_id"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			responseWithError(w, r, service.NewErrValidation("getReviews", "invalid product_id", err))
+			return
+		}
+		productID = parsed
+	}
+	reviewsRes, err := h.service.GetReviews(r.Context(), productID, r.URL.Query().Get("status"))
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, reviewsRes)
+}
+
+func (h *handler) approveReview(w http.ResponseWriter, r *http.Request) {
+	h.moderateReview(w, r, h.service.ApproveReview)
+}
+
+func (h *handler) rejectReview(w http.ResponseWriter, r *http.Request) {
+	h.moderateReview(w, r, h.service.RejectReview)
+}
+
+type moderateReviewFunc func(ctx context.Context, id int64) (reviewDto.ReviewRes, error)
+
+func (h *handler) moderateReview(w http.ResponseWriter, r *http.Request, moderate moderateReviewFunc) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	reviewRes, err := moderate(r.Context(), id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, reviewRes)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateReview(t *testing.T) {
+	productColumns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at"}
+	purchaseQuery := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM order_items oi JOIN orders o ON o.id = oi.order_id WHERE o.user_id=$1 AND oi.product_id=$2 AND o.status = ANY($3))")
+
+	expectProduct := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(1, "lamp", "lamp.jpg", 1, "", 0, 0, 10, 5, 1, time.Now(), nil))
+	}
+	createReview := func(t *testing.T, server *httptest.Server, body string) (*http.Response, map[string]interface{}) {
+		accessToken, _, err := testTokenMaker.CreateToken(3, "user@example.com", false, time.Hour)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/products/1/reviews", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&resBody))
+		return res, resBody
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "buyer creates pending review",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProduct(mock)
+				mock.ExpectQuery(purchaseQuery).
+					WithArgs(3, 1, pq.Array([]string{"paid", "shipped"})).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO reviews (product_id, user_id, rating, comment, status) VALUES ($1, $2, $3, $4, $5) RETURNING *")).
+					WithArgs(1, 3, 4, "bright enough", "pending").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "user_id", "rating", "comment", "status", "created_at", "updated_at"}).
+						AddRow(7, 1, 3, 4, "bright enough", "pending", time.Now(), nil))
+
+				res, body := createReview(t, server, `{"rating": 4, "comment": " bright enough "}`)
+				require.Equal(t, http.StatusCreated, res.StatusCode)
+				require.Equal(t, "pending", body["status"])
+			},
+		},
+		{
+			name: "not a buyer",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProduct(mock)
+				mock.ExpectQuery(purchaseQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+				res, _ := createReview(t, server, `{"rating": 4}`)
+				require.Equal(t, http.StatusForbidden, res.StatusCode)
+			},
+		},
+		{
+			name: "second review",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectProduct(mock)
+				mock.ExpectQuery(purchaseQuery).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO reviews")).
+					WillReturnError(&pq.Error{Code: "23505"})
+
+				res, _ := createReview(t, server, `{"rating": 5}`)
+				require.Equal(t, http.StatusConflict, res.StatusCode)
+			},
+		},
+		{
+			name: "rating out of range",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := createReview(t, server, `{"rating": 6}`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
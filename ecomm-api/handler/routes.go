@@ -11,15 +11,99 @@ var r *chi.Mux
 func RegisterRoutes(handler *handler) *chi.Mux {
 	r = chi.NewRouter()
 	r.Route("/products", func(r chi.Router) {
-		r.Post("/", handler.createProduct)
 		r.Get("/{id}", handler.getProduct)
 		r.Get("/", handler.getProducts)
-		r.Put("/{id}", handler.updateProduct)
-		r.Delete("/{id}", handler.deleteProduct)
+		r.Get("/{id}/options", handler.getProductOptions)
+		r.Get("/{id}/variants", handler.getProductVariants)
+		r.Get("/{id}/reviews", handler.getProductReviews)
+		r.With(handler.authenticate).Post("/{id}/reviews", handler.createReview)
+		r.Get("/{id}/images", handler.getProductImages)
+		r.Group(func(r chi.Router) {
+			r.Use(handler.authenticate, handler.requireAdmin)
+			r.Post("/", handler.createProduct)
+			r.Put("/{id}", handler.updateProduct)
+			r.Patch("/{id}", handler.patchProduct)
+			r.Delete("/{id}", handler.deleteProduct)
+			r.Post("/{id}/restore", handler.restoreProduct)
+			r.Post("/{id}/options", handler.createProductOption)
+			r.Post("/{id}/variants", handler.createProductVariant)
+			r.Post("/import", handler.importProducts)
+			r.Get("/export", handler.exportProducts)
+			r.Post("/{id}/images", handler.uploadProductImage)
+			r.Put("/{id}/images/order", handler.reorderProductImages)
+			r.Delete("/{id}/images/{imageID}", handler.deleteProductImage)
+		})
+	})
+	r.Route("/categories", func(r chi.Router) {
+		r.Get("/", handler.getCategories)
+		r.Get("/{slug}", handler.getCategory)
+		r.Get("/{slug}/products", handler.getCategoryProducts)
+		r.Group(func(r chi.Router) {
+			r.Use(handler.authenticate, handler.requireAdmin)
+			r.Post("/", handler.createCategory)
+			r.Put("/{slug}", handler.updateCategory)
+			r.Delete("/{slug}", handler.deleteCategory)
+		})
 	})
 	r.Route("/orders", func(r chi.Router) {
+		r.Use(handler.authenticate)
 		r.Post("/", handler.createOrder)
+		r.Get("/{id}", handler.getOrder)
+		r.With(handler.requireAdmin).Get("/", handler.getOrders)
+		r.With(handler.requireAdmin).Get("/export", handler.exportOrders)
+		r.Post("/{id}/cancel", handler.cancelOrder)
+		r.With(handler.requireAdmin).Post("/{id}/ship", handler.shipOrder)
+		r.Post("/{id}/returns", handler.createReturn)
+		r.Get("/{id}/returns", handler.getOrderReturns)
+		r.With(handler.requireAdmin).Post("/{id}/refunds", handler.refundOrder)
+	})
+	r.Route("/me", func(r chi.Router) {
+		r.Use(handler.authenticate)
+		r.Get("/orders", handler.getMyOrders)
+	})
+	r.Route("/returns", func(r chi.Router) {
+		r.Use(handler.authenticate, handler.requireAdmin)
+		r.Get("/", handler.getReturns)
+		r.Post("/{id}/approve", handler.approveReturn)
+		r.Post("/{id}/reject", handler.rejectReturn)
+		r.Post("/{id}/receive", handler.receiveReturn)
+		r.Post("/{id}/refund", handler.refundReturn)
+	})
+	r.Route("/reviews", func(r chi.Router) {
+		r.Use(handler.authenticate, handler.requireAdmin)
+		r.Get("/", handler.getReviews)
+		r.Post("/{id}/approve", handler.approveReview)
+		r.Post("/{id}/reject", handler.rejectReview)
+	})
+	r.Route("/users", func(r chi.Router) {
+		r.Post("/", handler.createUser)
+		r.Post("/login", handler.loginUser)
+		r.Post("/password-reset", handler.requestPasswordReset)
+		r.Post("/password-reset/confirm", handler.resetPassword)
+	})
+	r.Get("/images/*", handler.serveImage)
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Post("/payments", handler.paymentWebhook)
+		r.Route("/subscriptions", func(r chi.Router) {
+			r.Use(handler.authenticate, handler.requireAdmin)
+			r.Post("/", handler.createWebhookSubscription)
+			r.Get("/", handler.getWebhookSubscriptions)
+			r.Get("/{id}", handler.getWebhookSubscription)
+			r.Put("/{id}", handler.updateWebhookSubscription)
+			r.Delete("/{id}", handler.deleteWebhookSubscription)
+			r.Get("/{id}/deliveries", handler.getWebhookDeliveries)
+			r.Post("/{id}/deliveries/{deliveryID}/redeliver", handler.redeliverWebhook)
+		})
+	})
+	r.Route("/jobs", func(r chi.Router) {
+		r.Use(handler.authenticate, handler.requireAdmin)
+		r.Get("/", handler.getJobs)
+		r.Get("/{id}", handler.getJob)
+		r.Post("/{id}/retry", handler.retryJob)
 	})
+	r.With(handler.optionalAuthenticate).Post("/graphql", handler.graphqlQuery)
+	r.Get("/openapi.json", serveOpenAPI)
+	r.Get("/docs", serveDocs)
 
 	return r
 }
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	userDto "ecomm/ecomm-api/handler/dto/user"
+	"ecomm/ecomm-api/service"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const accessTokenDuration = 24 * time.Hour
+
+func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
+	var createUserReq userDto.CreateUserReq
+	if err := json.NewDecoder(r.Body).Decode(&createUserReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	userRes, err := h.service.CreateUser(r.Context(), &createUserReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, userRes)
+}
+
+func (h *handler) loginUser(w http.ResponseWriter, r *http.Request) {
+	var loginUserReq userDto.LoginUserReq
+	if err := json.NewDecoder(r.Body).Decode(&loginUserReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	userRes, err := h.service.LoginUser(r.Context(), &loginUserReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+
+	accessToken, _, err := h.tokenMaker.CreateToken(userRes.ID, userRes.Email, userRes.IsAdmin, accessTokenDuration)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, userDto.LoginUserRes{AccessToken: accessToken, User: userRes})
+}
+
+// requestPasswordReset всегда отвечает 202, чтобы по ответу нельзя было узнать, зарегистрирован ли email.
+func (h *handler) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var resetReq userDto.RequestPasswordResetReq
+	if err := json.NewDecoder(r.Body).Decode(&resetReq); err != nil {
+		responseWithError(w, r, service.NewErrValidation("requestPasswordReset", "invalid request body", err))
+		return
+	}
+	if err := h.service.RequestPasswordReset(r.Context(), &resetReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var resetReq userDto.ResetPasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&resetReq); err != nil {
+		responseWithError(w, r, service.NewErrValidation("resetPassword", "invalid request body", err))
+		return
+	}
+	if err := h.service.ResetPassword(r.Context(), &resetReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
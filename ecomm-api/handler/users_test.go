@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"ecomm/domain"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordReset(t *testing.T) {
+	userColumns := []string{"id", "name", "email", "password", "is_admin"}
+	jobColumns := []string{"id", "type", "payload", "status", "attempts", "max_attempts", "run_at", "locked_at", "last_error",
+		"unique_key", "created_at", "updated_at", "finished_at"}
+	post := func(t *testing.T, url string, body string) *http.Response {
+		res, err := http.Post(url, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "request enqueues an email",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM users WHERE email=$1")).
+					WithArgs("anna@example.com").
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(3, "Anna", "anna@example.com", "hash", false))
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO jobs")).
+					WithArgs("email.password_reset", `{"user_id":3}`, 3, nil, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(jobColumns).
+						AddRow(1, "email.password_reset", []byte(`{"user_id":3}`), "pending", 0, 3, time.Now(), nil, nil, "password-reset:3", time.Now(), time.Now(), nil))
+
+				res := post(t, server.URL+"/users/password-reset", `{"email": " Anna@Example.com "}`)
+				require.Equal(t, http.StatusAccepted, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "unknown email is not revealed",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM users WHERE email=$1")).
+					WithArgs("nobody@example.com").
+					WillReturnRows(sqlmock.NewRows(userColumns))
+
+				res := post(t, server.URL+"/users/password-reset", `{"email": "nobody@example.com"}`)
+				require.Equal(t, http.StatusAccepted, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "confirm with valid token",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM password_reset_tokens WHERE token_hash=$1")).
+					WithArgs(domain.HashPasswordResetToken("abc")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "token_hash", "expires_at", "used_at", "created_at"}).
+						AddRow(1, 3, domain.HashPasswordResetToken("abc"), time.Now().Add(time.Hour), nil, time.Now()))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE users SET password=$1 WHERE id=$2 RETURNING *")).
+					WithArgs(sqlmock.AnyArg(), 3).
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(3, "Anna", "anna@example.com", "new-hash", false))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE password_reset_tokens SET used_at=NOW()")).
+					WithArgs(3).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				res := post(t, server.URL+"/users/password-reset/confirm", `{"token": "abc", "password": "new-password"}`)
+				require.Equal(t, http.StatusNoContent, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "confirm with expired token",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM password_reset_tokens WHERE token_hash=$1")).
+					WithArgs(domain.HashPasswordResetToken("abc")).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+
+				res, err := http.Post(server.URL+"/users/password-reset/confirm", "application/json",
+					strings.NewReader(`{"token": "abc", "password": "new-password"}`))
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				body := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+				require.Contains(t, body["Error"], "invalid or expired password reset token")
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "confirm with short password",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res := post(t, server.URL+"/users/password-reset/confirm", `{"token": "abc", "password": "123"}`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"encoding/json"
+	"net/http"
+)
+
+func (h *handler) createProductOption(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var createProductOptionReq productDto.CreateProductOptionReq
+	if err := json.NewDecoder(r.Body).Decode(&createProductOptionReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	optionRes, err := h.service.CreateProductOption(r.Context(), id, &createProductOptionReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, optionRes)
+}
+
+func (h *handler) getProductOptions(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	optionsRes, err := h.service.GetProductOptions(r.Context(), id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, optionsRes)
+}
+
+func (h *handler) createProductVariant(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var createProductVariantReq productDto.CreateProductVariantReq
+	if err := json.NewDecoder(r.Body).Decode(&createProductVariantReq); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	variantRes, err := h.service.CreateProductVariant(r.Context(), id, &createProductVariantReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, variantRes)
+}
+
+func (h *handler) getProductVariants(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	variantsRes, err := h.service.GetProductVariants(r.Context(), id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, variantsRes)
+}
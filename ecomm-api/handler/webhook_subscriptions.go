@@ -0,0 +1,121 @@
+package handler
+
+import (
+	webhookDto "ecomm/ecomm-api/handler/dto/webhook"
+	"ecomm/ecomm-api/service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+func (h *handler) createWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	var createReq webhookDto.CreateWebhookSubscriptionReq
+	if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+		responseWithError(w, r, service.NewErrValidation("createWebhookSubscription", "invalid request body", err))
+		return
+	}
+	subscriptionRes, err := h.service.CreateWebhookSubscription(r.Context(), &createReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, subscriptionRes)
+}
+
+func (h *handler) getWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptionsRes, err := h.service.GetWebhookSubscriptions(r.Context())
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, subscriptionsRes)
+}
+
+func (h *handler) getWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	subscriptionRes, err := h.service.GetWebhookSubscription(r.Context(), id)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, subscriptionRes)
+}
+
+func (h *handler) updateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var updateReq webhookDto.UpdateWebhookSubscriptionReq
+	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+		responseWithError(w, r, service.NewErrValidation("updateWebhookSubscription", "invalid request body", err))
+		return
+	}
+	subscriptionRes, err := h.service.UpdateWebhookSubscription(r.Context(), id, &updateReq)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, subscriptionRes)
+}
+
+func (h *handler) deleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	if err := h.service.DeleteWebhookSubscription(r.Context(), id); err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusNoContent, nil)
+}
+
+// getWebhookDeliveries - журнал доставок подписки, фильтры ?status=&limit=.
+func (h *handler) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	var limit int64
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.ParseInt(value, 10, 64); err != nil {
+			responseWithError(w, r, service.NewErrValidation("getWebhookDeliveries", "invalid limit", err))
+			return
+		}
+	}
+	deliveriesRes, err := h.service.GetWebhookDeliveries(r.Context(), id, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, deliveriesRes)
+}
+
+func (h *handler) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := extractAndParseId(r)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		responseWithError(w, r, service.NewErrValidation("redeliverWebhook", "invalid delivery id", err))
+		return
+	}
+	deliveryRes, err := h.service.RedeliverWebhook(r.Context(), id, deliveryID)
+	if err != nil {
+		responseWithError(w, r, err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, deliveryRes)
+}
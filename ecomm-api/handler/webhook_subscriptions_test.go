@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSubscriptions(t *testing.T) {
+	subscriptionColumns := []string{"id", "url", "event_types", "secret", "enabled", "consecutive_failures", "disabled_at", "created_at", "updated_at"}
+	deliveryColumns := []string{"id", "subscription_id", "event_id", "event_type", "body", "status", "attempts", "next_attempt_at",
+		"response_code", "response_body", "last_error", "created_at", "updated_at", "delivered_at"}
+
+	expectSubscription := func(mock sqlmock.Sqlmock, enabled bool) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM webhook_subscriptions WHERE id=$1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+				AddRow(1, "https://partner.example/hooks", []byte(`["order.created"]`), "whsec_secret_value", enabled, 0, nil, time.Now(), nil))
+	}
+	send := func(t *testing.T, method string, url string, body string) (*http.Response, map[string]interface{}) {
+		accessToken, _, err := testTokenMaker.CreateToken(1, "admin@example.com", true, time.Hour)
+		require.NoError(t, err)
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+
+		resBody := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&resBody))
+		return res, resBody
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "create generates a secret and shows it once",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhook_subscriptions (url, event_types, secret, enabled) VALUES ($1, $2, $3, $4) RETURNING *")).
+					WithArgs("https://partner.example/hooks", `["order.created","product.stock_changed"]`, sqlmock.AnyArg(), true).
+					WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+						AddRow(1, "https://partner.example/hooks", []byte(`["order.created","product.stock_changed"]`), "whsec_generated", true, 0, nil, time.Now(), nil))
+
+				res, body := send(t, http.MethodPost, server.URL+"/webhooks/subscriptions",
+					`{"url": "https://partner.example/hooks", "event_types": ["order.created", "product.stock_changed", "order.created"]}`)
+				require.Equal(t, http.StatusCreated, res.StatusCode)
+				require.Equal(t, "whsec_generated", body["secret"])
+
+				expectSubscription(mock, true)
+				_, body = send(t, http.MethodGet, server.URL+"/webhooks/subscriptions/1", "")
+				require.NotContains(t, body, "secret")
+			},
+		},
+		{
+			name: "invalid subscription",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := send(t, http.MethodPost, server.URL+"/webhooks/subscriptions",
+					`{"url": "ftp://partner.example", "event_types": ["order.created"]}`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+				res, body := send(t, http.MethodPost, server.URL+"/webhooks/subscriptions",
+					`{"url": "https://partner.example/hooks", "event_types": ["order.delivered"]}`)
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				require.Contains(t, body["Error"], `unknown event type "order.delivered"`)
+			},
+		},
+		{
+			name: "internal url",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				for _, target := range []string{"http://localhost:8080/", "http://127.0.0.1/", "http://169.254.169.254/latest/meta-data", "http://10.0.0.5/", "http://[::1]/"} {
+					res, body := send(t, http.MethodPost, server.URL+"/webhooks/subscriptions",
+						`{"url": "`+target+`", "event_types": ["order.created"]}`)
+					require.Equal(t, http.StatusBadRequest, res.StatusCode, target)
+					require.Contains(t, body["Error"], "url must point to a public host")
+				}
+			},
+		},
+		{
+			name: "delivery log",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectSubscription(mock, true)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM webhook_deliveries WHERE subscription_id = $1 AND ($2 = '' OR status = $2) ORDER BY id DESC LIMIT $3")).
+					WithArgs(1, "failed", 50).
+					WillReturnRows(sqlmock.NewRows(deliveryColumns).
+						AddRow(7, 1, 42, "order.created", `{}`, "failed", 10, time.Now(), 503, "busy", "unexpected status 503", time.Now(), time.Now(), nil))
+
+				accessToken, _, err := testTokenMaker.CreateToken(1, "admin@example.com", true, time.Hour)
+				require.NoError(t, err)
+				req, err := http.NewRequest(http.MethodGet, server.URL+"/webhooks/subscriptions/1/deliveries?status=failed", nil)
+				require.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer "+accessToken)
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				defer res.Body.Close()
+
+				var deliveries []map[string]interface{}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&deliveries))
+				require.Len(t, deliveries, 1)
+				require.Equal(t, float64(503), deliveries[0]["response_code"])
+				require.Nil(t, deliveries[0]["next_attempt_at"])
+			},
+		},
+		{
+			name: "redeliver",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectSubscription(mock, true)
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=NOW(), updated_at=NOW() WHERE id=$1 AND subscription_id=$2 RETURNING *")).
+					WithArgs(7, 1).
+					WillReturnRows(sqlmock.NewRows(deliveryColumns).
+						AddRow(7, 1, 42, "order.created", `{}`, "pending", 0, time.Now(), 503, "busy", "unexpected status 503", time.Now(), time.Now(), nil))
+
+				res, body := send(t, http.MethodPost, server.URL+"/webhooks/subscriptions/1/deliveries/7/redeliver", "")
+				require.Equal(t, http.StatusAccepted, res.StatusCode)
+				require.Equal(t, "pending", body["status"])
+				require.NotNil(t, body["next_attempt_at"])
+			},
+		},
+		{
+			name: "redeliver to disabled subscription",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				expectSubscription(mock, false)
+
+				res, _ := send(t, http.MethodPost, server.URL+"/webhooks/subscriptions/1/deliveries/7/redeliver", "")
+				require.Equal(t, http.StatusConflict, res.StatusCode)
+			},
+		},
+		{
+			name: "admins only",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := doAuthorized(t, http.MethodGet, server.URL+"/webhooks/subscriptions", 3, false)
+				require.Equal(t, http.StatusForbidden, res.StatusCode)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
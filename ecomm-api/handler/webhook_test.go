@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"bytes"
+	"ecomm/ecomm-api/payments"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func postPaymentEvent(t *testing.T, server *httptest.Server, payload []byte, signature string) (*http.Response, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/webhooks/payments", bytes.NewReader(payload))
+	require.NoError(t, err)
+	req.Header.Set(payments.SignatureHeader, signature)
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	body := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	return res, body
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment.captured","created":1700000000,"authorization_id":"fake_auth_000001","amount":130}`)
+	paymentColumns := []string{"id", "order_id", "provider", "method", "status", "amount", "captured_amount", "refunded_amount", "authorization_id", "created_at", "updated_at"}
+
+	expectEventInsert := func(mock sqlmock.Sqlmock, rowsAffected int64) {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO payment_events (id, provider, type, authorization_id, payload) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (provider, id) DO NOTHING")).
+			WithArgs("evt_1", payments.FakeProviderName, payments.EventPaymentCaptured, "fake_auth_000001", string(payload)).
+			WillReturnResult(sqlmock.NewResult(0, rowsAffected))
+	}
+	refundColumns := []string{"id", "order_id", "payment_id", "return_id", "amount", "reason", "provider_refund_id", "status", "created_at"}
+	// expectRefundEvent ожидает событие о возврате по платежу, на котором уже есть наш возврат 9 на 50
+	expectRefundEvent := func(mock sqlmock.Sqlmock, refundPayload []byte, refundedAmount float64) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO payment_events")).
+			WithArgs("evt_2", payments.FakeProviderName, payments.EventPaymentRefunded, "fake_auth_000001", string(refundPayload)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE provider=$1 AND authorization_id=$2 FOR UPDATE")).
+			WithArgs(payments.FakeProviderName, "fake_auth_000001").
+			WillReturnRows(sqlmock.NewRows(paymentColumns).
+				AddRow(7, 1, payments.FakeProviderName, "card", "partially_refunded", 130, 130, refundedAmount, "fake_auth_000001", time.Now(), nil))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM refunds WHERE payment_id=$1 ORDER BY id")).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(refundColumns).
+				AddRow(9, 1, 7, nil, 50.0, "broken", "fake_ref_000002", "succeeded", time.Now()))
+	}
+	expectPaymentSelect := func(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE provider=$1 AND authorization_id=$2 FOR UPDATE")).
+			WithArgs(payments.FakeProviderName, "fake_auth_000001").
+			WillReturnRows(rows)
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM refunds WHERE payment_id=$1 ORDER BY id")).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(refundColumns).
+				AddRow(9, 1, 7, nil, 50.0, "broken", "fake_ref_000002", "succeeded", time.Now()))
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *httptest.Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "captured event marks payment and order as paid",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectEventInsert(mock, 1)
+				expectPaymentSelect(mock, sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, payments.FakeProviderName, "card", "authorized", 130, 0, 0, "fake_auth_000001", time.Now(), nil))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, captured_amount=$2, refunded_amount=$3, updated_at=NOW() WHERE id=$4")).
+					WithArgs("captured", 130.0, 0.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET status=$1, updated_at=NOW() WHERE id=$2 AND status <> 'cancelled'")).
+					WithArgs("paid", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				res, body := postPaymentEvent(t, server, payload, payments.Sign(webhookSecret, time.Now(), payload))
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, false, body["duplicate"])
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "duplicate event is acknowledged without changes",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectEventInsert(mock, 0)
+				mock.ExpectCommit()
+
+				res, body := postPaymentEvent(t, server, payload, payments.Sign(webhookSecret, time.Now(), payload))
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, true, body["duplicate"])
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "out of order event is recorded but ignored",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectEventInsert(mock, 1)
+				expectPaymentSelect(mock, sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, payments.FakeProviderName, "card", "voided", 130, 0, 0, "fake_auth_000001", time.Now(), nil))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, captured_amount=$2, refunded_amount=$3, updated_at=NOW() WHERE id=$4")).
+					WithArgs("voided", 0.0, 0.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				res, _ := postPaymentEvent(t, server, payload, payments.Sign(webhookSecret, time.Now(), payload))
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "partial refund keeps order status",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				refundPayload := []byte(`{"id":"evt_2","type":"payment.refunded","created":1700000000,"authorization_id":"fake_auth_000001","amount":30}`)
+				expectRefundEvent(mock, refundPayload, 50)
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, captured_amount=$2, refunded_amount=$3, updated_at=NOW() WHERE id=$4")).
+					WithArgs("partially_refunded", 130.0, 80.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price + $1")).
+					WithArgs(30.0, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				res, _ := postPaymentEvent(t, server, refundPayload, payments.Sign(webhookSecret, time.Now(), refundPayload))
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "refund of the rest marks order refunded",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				refundPayload := []byte(`{"id":"evt_2","type":"payment.refunded","created":1700000000,"authorization_id":"fake_auth_000001","amount":500}`)
+				expectRefundEvent(mock, refundPayload, 50)
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, captured_amount=$2, refunded_amount=$3, updated_at=NOW() WHERE id=$4")).
+					WithArgs("refunded", 130.0, 130.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price + $1")).
+					WithArgs(80.0, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET status=$1, updated_at=NOW() WHERE id=$2 AND status <> 'cancelled'")).
+					WithArgs("refunded", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				res, _ := postPaymentEvent(t, server, refundPayload, payments.Sign(webhookSecret, time.Now(), refundPayload))
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "event about our own refund is not counted twice",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				for _, refundPayload := range [][]byte{
+					[]byte(`{"id":"evt_2","type":"payment.refunded","created":1700000000,"authorization_id":"fake_auth_000001","amount":50,"refund_id":"fake_ref_000002"}`),
+					[]byte(`{"id":"evt_2","type":"payment.refunded","created":1700000000,"authorization_id":"fake_auth_000001","amount":50,"reference":"refund-9"}`),
+				} {
+					expectRefundEvent(mock, refundPayload, 50)
+					// Платеж записывается как есть, заказ не меняется
+					mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, captured_amount=$2, refunded_amount=$3, updated_at=NOW() WHERE id=$4")).
+						WithArgs("partially_refunded", 130.0, 50.0, 7).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+
+					res, _ := postPaymentEvent(t, server, refundPayload, payments.Sign(webhookSecret, time.Now(), refundPayload))
+					require.Equal(t, http.StatusOK, res.StatusCode)
+				}
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "unknown payment rolls back the event",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectEventInsert(mock, 1)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE provider=$1 AND authorization_id=$2 FOR UPDATE")).
+					WithArgs(payments.FakeProviderName, "fake_auth_000001").
+					WillReturnRows(sqlmock.NewRows(paymentColumns))
+				mock.ExpectRollback()
+
+				res, _ := postPaymentEvent(t, server, payload, payments.Sign(webhookSecret, time.Now(), payload))
+				require.Equal(t, http.StatusNotFound, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "invalid signature",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := postPaymentEvent(t, server, payload, payments.Sign([]byte("wrong secret"), time.Now(), payload))
+				require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "replayed request outside of tolerance",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				res, _ := postPaymentEvent(t, server, payload, payments.Sign(webhookSecret, time.Now().Add(-time.Hour), payload))
+				require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "malformed event",
+			test: func(t *testing.T, server *httptest.Server, mock sqlmock.Sqlmock) {
+				malformed := []byte(`{"type":"payment.captured"}`)
+				res, _ := postPaymentEvent(t, server, malformed, payments.Sign(webhookSecret, time.Now(), malformed))
+				require.Equal(t, http.StatusBadRequest, res.StatusCode)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(server *httptest.Server, mock sqlmock.Sqlmock) {
+				tc.test(t, server, mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule - расписание в формате cron из пяти полей: минута, час, день месяца, месяц, день недели.
+// Поле - это *, число, диапазон a-b, шаг */n или a-b/n, либо их список через запятую.
+// Воскресенье - 0 или 7. Как и в cron, если ограничены и день месяца, и день недели,
+// подходит любой из них.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = [5]cronField{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// ParseSchedule разбирает расписание, например "*/15 * * * *" или "30 3 * * 1-5".
+func ParseSchedule(spec string) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("schedule %q: expected 5 fields, got %d", spec, len(parts))
+	}
+	var bits [5]uint64
+	for i, part := range parts {
+		var err error
+		if bits[i], err = parseCronField(part, cronFields[i]); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+	}
+	// Воскресенье 7 - то же, что 0
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &Schedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", item)
+			}
+		}
+
+		from, to := bounds.min, bounds.max
+		if rangePart != "*" {
+			low, high, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = strconv.Atoi(low); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", item)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(high); err != nil {
+					return 0, fmt.Errorf("invalid range in %q", item)
+				}
+			} else if hasStep {
+				to = bounds.max
+			}
+		}
+		if from < bounds.min || to > bounds.max || from > to {
+			return 0, fmt.Errorf("%q is out of range %d-%d", item, bounds.min, bounds.max)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Next возвращает первый момент расписания строго после t в часовом поясе t.
+// Если такого нет в ближайшие пять лет (например, 30 февраля), возвращает нулевое время.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"context"
+	"ecomm/domain"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Store - часть storer, которая нужна очереди задач.
+type Store interface {
+	Enqueuer
+	ClaimJob(ctx context.Context, types []string, lease time.Duration) (*domain.Job, error)
+	CompleteJob(ctx context.Context, id int64) error
+	FailJob(ctx context.Context, id int64, message string, retryAt *time.Time) error
+}
+
+// Enqueuer ставит задачи в очередь, для этого воркеры не нужны.
+type Enqueuer interface {
+	EnqueueJob(ctx context.Context, job *domain.Job) (bool, error)
+}
+
+// DefaultMaxAttempts - попытки задачи, у типа которой MaxAttempts не задан.
+const DefaultMaxAttempts = 5
+
+// Type описывает тип задачи с аргументами Args. Аргументы хранятся в JSON, поэтому
+// у Args должны быть экспортируемые поля.
+type Type[Args any] struct {
+	Name        string
+	MaxAttempts int64
+}
+
+// Option меняет задачу перед постановкой в очередь.
+type Option func(*domain.Job)
+
+// RunAt откладывает задачу до at.
+func RunAt(at time.Time) Option {
+	return func(job *domain.Job) {
+		job.RunAt = at
+	}
+}
+
+// Delay откладывает задачу на d от текущего момента.
+func Delay(d time.Duration) Option {
+	return RunAt(time.Now().Add(d))
+}
+
+// UniqueKey не дает поставить в очередь вторую задачу с тем же ключом, даже уже выполненную.
+func UniqueKey(key string) Option {
+	return func(job *domain.Job) {
+		job.UniqueKey = &key
+	}
+}
+
+// Enqueue ставит задачу в очередь. Возвращает false, если задача с тем же UniqueKey уже есть.
+func (t Type[Args]) Enqueue(ctx context.Context, store Enqueuer, args Args, opts ...Option) (bool, error) {
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return false, fmt.Errorf("error encoding arguments of job %s: %w", t.Name, err)
+	}
+	job := &domain.Job{Type: t.Name, Payload: string(payload), MaxAttempts: t.MaxAttempts}
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+	return store.EnqueueJob(ctx, job)
+}
+
+// permanentError - ошибка, после которой повторять задачу бессмысленно.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent помечает ошибку обработчика как неисправимую: задача сразу уходит в dead без повторов.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
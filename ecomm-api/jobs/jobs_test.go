@@ -0,0 +1,336 @@
+package jobs
+
+import (
+	"context"
+	"ecomm/domain"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore повторяет поведение storer: задачи забираются по одной, попытка считается при захвате.
+type memoryStore struct {
+	mu   sync.Mutex
+	now  time.Time
+	jobs []*domain.Job
+}
+
+func (s *memoryStore) EnqueueJob(ctx context.Context, job *domain.Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.jobs {
+		if job.UniqueKey != nil && existing.UniqueKey != nil && *existing.UniqueKey == *job.UniqueKey {
+			return false, nil
+		}
+	}
+	job.ID = int64(len(s.jobs) + 1)
+	job.Status = domain.JobPending
+	if job.RunAt.IsZero() {
+		job.RunAt = s.now
+	}
+	copied := *job
+	s.jobs = append(s.jobs, &copied)
+	return true, nil
+}
+
+func (s *memoryStore) ClaimJob(ctx context.Context, types []string, lease time.Duration) (*domain.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.Status == domain.JobPending && !job.RunAt.After(s.now) && slices.Contains(types, job.Type) {
+			job.Status = domain.JobRunning
+			job.Attempts++
+			copied := *job
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) CompleteJob(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[id-1].Status = domain.JobSucceeded
+	return nil
+}
+
+func (s *memoryStore) FailJob(ctx context.Context, id int64, message string, retryAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id-1]
+	job.LastError = &message
+	job.Status = domain.JobDead
+	if retryAt != nil {
+		job.Status = domain.JobPending
+		job.RunAt = *retryAt
+	}
+	return nil
+}
+
+// job возвращает копию задачи, чтобы читать ее без гонки с воркерами.
+func (s *memoryStore) job(id int64) domain.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.jobs[id-1]
+}
+
+type sendEmailArgs struct {
+	OrderID int64 `json:"order_id"`
+}
+
+var sendEmail = Type[sendEmailArgs]{Name: "email.send", MaxAttempts: 3}
+
+func TestPool(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	setup := func(t *testing.T, handle func(ctx context.Context, args sendEmailArgs) error) (*memoryStore, *Pool) {
+		store := &memoryStore{now: now}
+		p := NewPool(store, 2, time.Millisecond)
+		p.now = func() time.Time { return now }
+		Handle(p, sendEmail, handle)
+		return store, p
+	}
+	waitStatus := func(t *testing.T, store *memoryStore, id int64, status string) domain.Job {
+		require.Eventually(t, func() bool {
+			return store.job(id).Status == status
+		}, time.Second, time.Millisecond)
+		return store.job(id)
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{
+			name: "typed handler receives arguments",
+			test: func(t *testing.T) {
+				received := make(chan int64, 1)
+				store, p := setup(t, func(ctx context.Context, args sendEmailArgs) error {
+					received <- args.OrderID
+					return nil
+				})
+				created, err := sendEmail.Enqueue(context.Background(), store, sendEmailArgs{OrderID: 7})
+				require.NoError(t, err)
+				require.True(t, created)
+
+				p.Start()
+				defer p.Stop(context.Background())
+				require.Equal(t, int64(7), <-received)
+				waitStatus(t, store, 1, domain.JobSucceeded)
+			},
+		},
+		{
+			name: "delayed job waits for its time",
+			test: func(t *testing.T) {
+				store, p := setup(t, func(ctx context.Context, args sendEmailArgs) error { return nil })
+				_, err := sendEmail.Enqueue(context.Background(), store, sendEmailArgs{}, RunAt(now.Add(time.Minute)))
+				require.NoError(t, err)
+
+				p.Start()
+				time.Sleep(20 * time.Millisecond)
+				require.NoError(t, p.Stop(context.Background()))
+				require.Equal(t, domain.JobPending, store.job(1).Status)
+			},
+		},
+		{
+			name: "failed job is retried with backoff",
+			test: func(t *testing.T) {
+				store, p := setup(t, func(ctx context.Context, args sendEmailArgs) error {
+					return errors.New("smtp unavailable")
+				})
+				_, err := sendEmail.Enqueue(context.Background(), store, sendEmailArgs{})
+				require.NoError(t, err)
+
+				p.Start()
+				defer p.Stop(context.Background())
+				require.Eventually(t, func() bool {
+					return store.job(1).LastError != nil
+				}, time.Second, time.Millisecond)
+				job := store.job(1)
+				require.Equal(t, domain.JobPending, job.Status)
+				require.Equal(t, now.Add(10*time.Second), job.RunAt)
+				require.Equal(t, "smtp unavailable", *job.LastError)
+			},
+		},
+		{
+			name: "exhausted attempts go to dead letters",
+			test: func(t *testing.T) {
+				store, p := setup(t, func(ctx context.Context, args sendEmailArgs) error {
+					return errors.New("smtp unavailable")
+				})
+				_, err := sendEmail.Enqueue(context.Background(), store, sendEmailArgs{})
+				require.NoError(t, err)
+				store.jobs[0].Attempts = 2
+
+				p.Start()
+				defer p.Stop(context.Background())
+				job := waitStatus(t, store, 1, domain.JobDead)
+				require.Equal(t, int64(3), job.Attempts)
+			},
+		},
+		{
+			name: "permanent errors and panics",
+			test: func(t *testing.T) {
+				store, p := setup(t, func(ctx context.Context, args sendEmailArgs) error {
+					if args.OrderID == 1 {
+						return Permanent(errors.New("order has no email"))
+					}
+					panic("nil template")
+				})
+				for id := int64(1); id <= 2; id++ {
+					_, err := sendEmail.Enqueue(context.Background(), store, sendEmailArgs{OrderID: id})
+					require.NoError(t, err)
+				}
+				_, err := store.EnqueueJob(context.Background(), &domain.Job{Type: sendEmail.Name, Payload: `"not an object"`, MaxAttempts: 3})
+				require.NoError(t, err)
+
+				p.Start()
+				defer p.Stop(context.Background())
+				require.Equal(t, int64(1), waitStatus(t, store, 1, domain.JobDead).Attempts)
+				require.Eventually(t, func() bool {
+					return store.job(2).LastError != nil
+				}, time.Second, time.Millisecond)
+				require.Equal(t, domain.JobPending, store.job(2).Status)
+				require.Contains(t, *store.job(2).LastError, "panic: nil template")
+				require.Contains(t, *waitStatus(t, store, 3, domain.JobDead).LastError, "invalid arguments")
+			},
+		},
+		{
+			name: "unique key enqueues once",
+			test: func(t *testing.T) {
+				store := &memoryStore{now: now}
+				for i := 0; i < 2; i++ {
+					created, err := sendEmail.Enqueue(context.Background(), store, sendEmailArgs{OrderID: 7}, UniqueKey("order-confirmation:7"))
+					require.NoError(t, err)
+					require.Equal(t, i == 0, created)
+				}
+				require.Len(t, store.jobs, 1)
+			},
+		},
+		{
+			name: "stop waits for running jobs",
+			test: func(t *testing.T) {
+				started := make(chan struct{})
+				release := make(chan struct{})
+				store, p := setup(t, func(ctx context.Context, args sendEmailArgs) error {
+					close(started)
+					<-release
+					return nil
+				})
+				_, err := sendEmail.Enqueue(context.Background(), store, sendEmailArgs{})
+				require.NoError(t, err)
+
+				p.Start()
+				<-started
+				stopped := make(chan error)
+				go func() { stopped <- p.Stop(context.Background()) }()
+				select {
+				case <-stopped:
+					t.Fatal("stop returned before the job finished")
+				case <-time.After(20 * time.Millisecond):
+				}
+				close(release)
+				require.NoError(t, <-stopped)
+				require.Equal(t, domain.JobSucceeded, store.job(1).Status)
+			},
+		},
+		{
+			name: "stop deadline cancels running jobs and requeues them",
+			test: func(t *testing.T) {
+				started := make(chan struct{})
+				store, p := setup(t, func(ctx context.Context, args sendEmailArgs) error {
+					close(started)
+					<-ctx.Done()
+					return ctx.Err()
+				})
+				_, err := sendEmail.Enqueue(context.Background(), store, sendEmailArgs{})
+				require.NoError(t, err)
+
+				p.Start()
+				<-started
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+				require.ErrorIs(t, p.Stop(ctx), context.DeadlineExceeded)
+				job := store.job(1)
+				require.Equal(t, domain.JobPending, job.Status)
+				require.Equal(t, now, job.RunAt)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, tc.test)
+	}
+}
+
+func TestCron(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 30, 0, time.UTC)
+	store := &memoryStore{now: now}
+	p := NewPool(store, 1, time.Second)
+	p.now = func() time.Time { return now }
+	require.NoError(t, Cron(p, "*/15 * * * *", sendEmail, sendEmailArgs{OrderID: 1}))
+	require.Error(t, Cron(p, "61 * * * *", sendEmail, sendEmailArgs{}))
+
+	p.planCrons()
+	p.enqueueDue(context.Background())
+	require.Empty(t, store.jobs)
+
+	// Второй экземпляр сервиса с тем же расписанием не ставит срабатывание повторно
+	other := NewPool(store, 1, time.Second)
+	other.now = p.now
+	require.NoError(t, Cron(other, "*/15 * * * *", sendEmail, sendEmailArgs{OrderID: 1}))
+	other.planCrons()
+
+	now = now.Add(15 * time.Minute)
+	p.enqueueDue(context.Background())
+	other.enqueueDue(context.Background())
+	require.Len(t, store.jobs, 1)
+	require.Equal(t, time.Date(2026, 3, 1, 12, 15, 0, 0, time.UTC), store.jobs[0].RunAt)
+	require.Equal(t, `{"order_id":1}`, store.jobs[0].Payload)
+
+	// После долгого простоя ставится одно срабатывание, а не все пропущенные
+	now = now.Add(2 * time.Hour)
+	p.enqueueDue(context.Background())
+	require.Len(t, store.jobs, 2)
+	require.Equal(t, time.Date(2026, 3, 1, 14, 30, 0, 0, time.UTC), p.crons[0].next)
+}
+
+func TestSchedule(t *testing.T) {
+	from := time.Date(2026, 3, 1, 12, 7, 30, 0, time.UTC) // Воскресенье
+	tcs := []struct {
+		spec string
+		next time.Time
+	}{
+		{spec: "* * * * *", next: time.Date(2026, 3, 1, 12, 8, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", next: time.Date(2026, 3, 1, 12, 15, 0, 0, time.UTC)},
+		{spec: "30 3 * * *", next: time.Date(2026, 3, 2, 3, 30, 0, 0, time.UTC)},
+		{spec: "0 9 * * 1-5", next: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)},
+		{spec: "0 0 1 1,7 *", next: time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 12 * * 7", next: time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)},
+		// День месяца и день недели ограничены оба - подходит любой
+		{spec: "0 0 15 * 6", next: time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 30 2 *", next: time.Time{}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(tc.spec)
+			require.NoError(t, err)
+			require.Equal(t, tc.next, schedule.Next(from))
+		})
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseSchedule(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, 10*time.Second, backoff(1))
+	require.Equal(t, 20*time.Second, backoff(2))
+	require.Equal(t, 80*time.Second, backoff(4))
+	require.Equal(t, time.Hour, backoff(20))
+}
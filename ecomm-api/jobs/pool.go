@@ -0,0 +1,283 @@
+package jobs
+
+import (
+	"context"
+	"ecomm/domain"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWorkers      = 4
+	DefaultPollInterval = time.Second
+	DefaultTimeout      = 5 * time.Minute
+	// Задача, захваченная дольше timeout+leaseMargin, считается брошенной упавшим воркером
+	leaseMargin = time.Minute
+	// Сколько ждать сохранения результата, в том числе после отмены задач остановкой
+	resultTimeout = 10 * time.Second
+
+	baseDelay = 10 * time.Second
+	maxDelay  = time.Hour
+)
+
+// backoff возвращает паузу перед следующей попыткой после attempts неудачных.
+func backoff(attempts int64) time.Duration {
+	delay := baseDelay
+	for i := int64(1); i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+type handlerFunc func(ctx context.Context, payload string) error
+
+type cronEntry struct {
+	key      string
+	schedule *Schedule
+	enqueue  func(ctx context.Context, at time.Time, key string) error
+	next     time.Time
+}
+
+// Pool выполняет задачи из очереди несколькими воркерами и ставит задачи по расписанию.
+// Задача может выполниться больше одного раза (например, если воркер упал до сохранения
+// результата), поэтому обработчики должны быть идемпотентными.
+type Pool struct {
+	store        Store
+	workers      int
+	pollInterval time.Duration
+	timeout      time.Duration
+	handlers     map[string]handlerFunc
+	types        []string
+	crons        []*cronEntry
+	now          func() time.Time
+
+	quit       chan struct{}
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+func NewPool(store Store, workers int, pollInterval time.Duration) *Pool {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	return &Pool{
+		store:        store,
+		workers:      workers,
+		pollInterval: pollInterval,
+		timeout:      DefaultTimeout,
+		handlers:     map[string]handlerFunc{},
+		now:          time.Now,
+	}
+}
+
+// Handle регистрирует обработчик задач типа t. Аргументы, которые не удалось разобрать,
+// отправляют задачу в dead без повторов. Регистрировать обработчики нужно до Start.
+func Handle[Args any](p *Pool, t Type[Args], handle func(ctx context.Context, args Args) error) {
+	if _, ok := p.handlers[t.Name]; !ok {
+		p.types = append(p.types, t.Name)
+	}
+	p.handlers[t.Name] = func(ctx context.Context, payload string) error {
+		var args Args
+		if err := json.Unmarshal([]byte(payload), &args); err != nil {
+			return Permanent(fmt.Errorf("invalid arguments: %w", err))
+		}
+		return handle(ctx, args)
+	}
+}
+
+// Cron ставит задачу t с аргументами args в очередь по расписанию spec в UTC. Каждое срабатывание
+// получает UniqueKey, поэтому несколько экземпляров сервиса ставят его только один раз.
+// Срабатывания, пропущенные пока сервис был остановлен, не догоняются.
+func Cron[Args any](p *Pool, spec string, t Type[Args], args Args) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("error scheduling job %s: %w", t.Name, err)
+	}
+	p.crons = append(p.crons, &cronEntry{
+		key:      fmt.Sprintf("cron:%s:%s", t.Name, spec),
+		schedule: schedule,
+		enqueue: func(ctx context.Context, at time.Time, key string) error {
+			_, err := t.Enqueue(ctx, p.store, args, RunAt(at), UniqueKey(key))
+			return err
+		},
+	})
+	return nil
+}
+
+// Start запускает воркеры и планировщик. Остановить их можно только через Stop.
+func (p *Pool) Start() {
+	p.quit = make(chan struct{})
+	p.jobsCtx, p.cancelJobs = context.WithCancel(context.Background())
+	if len(p.types) > 0 {
+		for i := 0; i < p.workers; i++ {
+			p.wg.Add(1)
+			go p.work()
+		}
+	}
+	if len(p.crons) > 0 {
+		p.planCrons()
+		p.wg.Add(1)
+		go p.schedule()
+	}
+}
+
+// Stop перестает забирать новые задачи и ждет, пока выполнятся начатые. Если ctx истечет
+// раньше, контексты задач отменяются, а прерванные задачи возвращаются в очередь.
+func (p *Pool) Stop(ctx context.Context) error {
+	close(p.quit)
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancelJobs()
+		return nil
+	case <-ctx.Done():
+		p.cancelJobs()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) stopping() bool {
+	select {
+	case <-p.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// work забирает задачи по одной. Пока очередь не пуста, следующая забирается сразу.
+func (p *Pool) work() {
+	defer p.wg.Done()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-timer.C:
+		}
+		if p.stopping() {
+			return
+		}
+
+		wait := p.pollInterval
+		job, err := p.store.ClaimJob(p.jobsCtx, p.types, p.timeout+leaseMargin)
+		switch {
+		case err != nil:
+			log.Printf("jobs: error claiming job: %v", err)
+		case job != nil:
+			p.run(job)
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
+
+// run выполняет задачу и сохраняет результат: успех, повтор с паузой или dead.
+func (p *Pool) run(job *domain.Job) {
+	ctx, cancel := context.WithTimeout(p.jobsCtx, p.timeout)
+	jobErr := p.call(ctx, job)
+	cancel()
+
+	ctx, cancel = context.WithTimeout(context.WithoutCancel(p.jobsCtx), resultTimeout)
+	defer cancel()
+	if jobErr == nil {
+		if err := p.store.CompleteJob(ctx, job.ID); err != nil {
+			log.Printf("jobs: error completing job %d (%s): %v", job.ID, job.Type, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	switch {
+	case p.jobsCtx.Err() != nil:
+		// Задачу прервала остановка пула, а не ее ошибка: она продолжится после запуска
+		now := p.now()
+		retryAt = &now
+	case isPermanent(jobErr) || job.Attempts >= job.MaxAttempts:
+		log.Printf("jobs: job %d (%s) moved to dead letters after %d attempts: %v", job.ID, job.Type, job.Attempts, jobErr)
+	default:
+		next := p.now().Add(backoff(job.Attempts))
+		retryAt = &next
+		log.Printf("jobs: job %d (%s) failed, attempt %d of %d: %v", job.ID, job.Type, job.Attempts, job.MaxAttempts, jobErr)
+	}
+	if err := p.store.FailJob(ctx, job.ID, jobErr.Error(), retryAt); err != nil {
+		log.Printf("jobs: error failing job %d (%s): %v", job.ID, job.Type, err)
+	}
+}
+
+// call вызывает обработчик, паника в нем считается ошибкой попытки.
+func (p *Pool) call(ctx context.Context, job *domain.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return p.handlers[job.Type](ctx, job.Payload)
+}
+
+func (p *Pool) planCrons() {
+	now := p.now().UTC()
+	for _, entry := range p.crons {
+		entry.next = entry.schedule.Next(now)
+	}
+}
+
+// schedule спит до ближайшего срабатывания и ставит задачи, которым пора.
+func (p *Pool) schedule() {
+	defer p.wg.Done()
+	for {
+		var next time.Time
+		for _, entry := range p.crons {
+			if !entry.next.IsZero() && (next.IsZero() || entry.next.Before(next)) {
+				next = entry.next
+			}
+		}
+		if next.IsZero() {
+			<-p.quit
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(p.now()))
+		select {
+		case <-p.quit:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		p.enqueueDue(p.jobsCtx)
+	}
+}
+
+// enqueueDue ставит в очередь наступившие срабатывания. Если их накопилось несколько
+// (например, после сна машины), ставится одно. Ошибка постановки только логируется:
+// следующее срабатывание попробует снова.
+func (p *Pool) enqueueDue(ctx context.Context) {
+	now := p.now().UTC()
+	for _, entry := range p.crons {
+		if entry.next.IsZero() || entry.next.After(now) {
+			continue
+		}
+		at := entry.next
+		entry.next = entry.schedule.Next(now)
+		key := fmt.Sprintf("%s:%d", entry.key, at.Unix())
+		if err := entry.enqueue(ctx, at, key); err != nil {
+			log.Printf("jobs: error enqueuing scheduled job %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// FileMailer складывает письма в каталог файлами .eml вместо отправки. Нужен для
+// локальной разработки: файл открывается любым почтовым клиентом.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	now := time.Now()
+	data, err := msg.build(m.from, now)
+	if err != nil {
+		return err
+	}
+
+	// Письмо появляется под именем .eml только целиком
+	f, err := os.CreateTemp(m.dir, now.Format("20060102-150405")+"-*.eml.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating mail file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("error writing mail file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("error writing mail file: %w", err)
+	}
+	return os.Rename(f.Name(), strings.TrimSuffix(f.Name(), ".tmp"))
+}
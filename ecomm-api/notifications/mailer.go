@@ -0,0 +1,84 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message - письмо с текстовой и HTML-версией.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer отправляет письма. Ошибка отправки повторяет фоновую задачу, поэтому
+// реализация не должна повторять сама.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// build собирает письмо в формате RFC 5322: multipart/alternative из text/plain и text/html.
+func (m *Message) build(from string, date time.Time) ([]byte, error) {
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", m.To, err)
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("error generating message id: %w", err)
+	}
+	_, domain, _ := strings.Cut(sender.Address, "@")
+
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+	headers := []string{
+		"From: " + sender.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date: " + date.Format(time.RFC1123Z),
+		fmt.Sprintf("Message-ID: <%s@%s>", hex.EncodeToString(id), domain),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + body.Boundary(),
+	}
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,372 @@
+package notifications
+
+import (
+	"bufio"
+	"context"
+	"ecomm/domain"
+	"ecomm/ecomm-api/outbox"
+	"ecomm/ecomm-api/storer"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore - Store в памяти.
+type memoryStore struct {
+	mu     sync.Mutex
+	jobs   []*domain.Job
+	orders map[int64]*domain.Order
+	users  map[int64]*domain.User
+	tokens []*domain.PasswordResetToken
+}
+
+func (s *memoryStore) EnqueueJob(ctx context.Context, job *domain.Job) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.jobs {
+		if job.UniqueKey != nil && existing.UniqueKey != nil && *existing.UniqueKey == *job.UniqueKey {
+			return false, nil
+		}
+	}
+	copied := *job
+	s.jobs = append(s.jobs, &copied)
+	return true, nil
+}
+
+func (s *memoryStore) GetOrder(ctx context.Context, id int64) (*domain.Order, error) {
+	if order, ok := s.orders[id]; ok {
+		return order, nil
+	}
+	return nil, storer.NewNotFoundError("storer.GetOrder", "order", id, nil)
+}
+
+func (s *memoryStore) GetUser(ctx context.Context, id int64) (*domain.User, error) {
+	if user, ok := s.users[id]; ok {
+		return user, nil
+	}
+	return nil, storer.NewNotFoundError("storer.GetUser", "user", id, nil)
+}
+
+func (s *memoryStore) CreatePasswordResetToken(ctx context.Context, t *domain.PasswordResetToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.ID = int64(len(s.tokens) + 1)
+	s.tokens = append(s.tokens, t)
+	return nil
+}
+
+// memoryMailer запоминает отправленные письма.
+type memoryMailer struct {
+	sent []*Message
+}
+
+func (m *memoryMailer) Send(ctx context.Context, msg *Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newTestNotifier(t *testing.T) (*Notifier, *memoryStore, *memoryMailer) {
+	store := &memoryStore{
+		orders: map[int64]*domain.Order{
+			7: {
+				ID: 7, UserID: 1, Status: domain.OrderStatusPaid,
+				TaxPrice: 1.5, ShippingPrice: 5, TotalPrice: 26.5,
+				Items: []domain.OrderItem{{Name: "Mug <large>", Quantity: 2, Price: 10}},
+			},
+		},
+		users: map[int64]*domain.User{
+			1: {ID: 1, Name: "Anna", Email: "anna@example.com"},
+		},
+	}
+	mailer := &memoryMailer{}
+	notifier, err := NewNotifier(store, mailer, Config{ShopName: "Test Shop", ShopURL: "https://shop.example/"})
+	require.NoError(t, err)
+	notifier.now = func() time.Time { return time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC) }
+	return notifier, store, mailer
+}
+
+func TestTemplates(t *testing.T) {
+	templates, err := ParseTemplates()
+	require.NoError(t, err)
+
+	order := &domain.Order{
+		ID: 7, TaxPrice: 1.5, ShippingPrice: 5, TotalPrice: 26.5,
+		CancellationReason: "out of stock",
+		Items:              []domain.OrderItem{{Name: "Mug <large>", Quantity: 2, Price: 10}},
+	}
+	tracking := "TRACK-1"
+	order.TrackingNumber = &tracking
+	user := &domain.User{Name: "Anna", Email: "anna@example.com"}
+	orderData := orderEmailData{Shop: shop{Name: "Test Shop"}, User: user, Order: order, OrderURL: "https://shop.example/orders/7"}
+
+	tcs := []struct {
+		name     string
+		data     interface{}
+		subject  string
+		contains []string
+	}{
+		{TemplateOrderConfirmation, orderData, "Order #7 confirmed", []string{"2 x Mug <large>", "26.50", "https://shop.example/orders/7"}},
+		{TemplateOrderShipped, orderData, "Order #7 has shipped", []string{"TRACK-1"}},
+		{TemplateOrderCancelled, orderData, "Order #7 cancelled", []string{"out of stock"}},
+		{TemplatePasswordReset, passwordResetEmailData{
+			Shop:      shop{Name: "Test Shop"},
+			User:      user,
+			ResetURL:  "https://shop.example/reset-password?token=abc",
+			ExpiresAt: time.Date(2026, 1, 2, 11, 0, 0, 0, time.UTC),
+		}, "Reset your Test Shop password", []string{"token=abc", "2026-01-02 11:00 UTC"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := templates.Render(tc.name, tc.data)
+			require.NoError(t, err)
+			require.Equal(t, tc.subject, msg.Subject)
+			require.Contains(t, msg.Text, "Anna")
+			require.Contains(t, msg.HTML, "Anna")
+			for _, s := range tc.contains {
+				require.Contains(t, msg.Text, s)
+			}
+			require.Contains(t, msg.HTML, "<html")
+		})
+	}
+
+	t.Run("html is escaped", func(t *testing.T) {
+		msg, err := templates.Render(TemplateOrderConfirmation, orderData)
+		require.NoError(t, err)
+		require.Contains(t, msg.HTML, "Mug &lt;large&gt;")
+		require.NotContains(t, msg.HTML, "Mug <large>")
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		_, err := templates.Render("welcome", orderData)
+		require.Error(t, err)
+	})
+}
+
+// readMessage разбирает письмо и возвращает его заголовки и части по Content-Type.
+func readMessage(t *testing.T, data []byte) (mail.Header, map[string]string) {
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, "quoted-printable", part.Header.Get("Content-Transfer-Encoding"))
+		content, err := io.ReadAll(quotedprintable.NewReader(part))
+		require.NoError(t, err)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(content)
+	}
+	return msg.Header, parts
+}
+
+func TestMessageBuild(t *testing.T) {
+	msg := &Message{
+		To:      "Анна <anna@example.com>",
+		Subject: "Заказ #7 подтвержден",
+		Text:    "Привет, " + strings.Repeat("очень длинная строка ", 10),
+		HTML:    "<p>Привет</p>",
+	}
+	data, err := msg.build("Shop <no-reply@shop.example>", time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	header, parts := readMessage(t, data)
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, msg.Subject, subject)
+	to, err := header.AddressList("To")
+	require.NoError(t, err)
+	require.Equal(t, "anna@example.com", to[0].Address)
+	require.Equal(t, "Анна", to[0].Name)
+	require.True(t, strings.HasSuffix(header.Get("Message-ID"), "@shop.example>"))
+	require.Equal(t, msg.Text, parts["text/plain"])
+	require.Equal(t, msg.HTML, parts["text/html"])
+
+	_, err = (&Message{To: "not an address"}).build("Shop <no-reply@shop.example>", time.Now())
+	require.Error(t, err)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := NewFileMailer(dir, "Shop <no-reply@shop.example>")
+	require.NoError(t, err)
+
+	require.NoError(t, mailer.Send(context.Background(), &Message{To: "anna@example.com", Subject: "Hi", Text: "text", HTML: "<p>html</p>"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.True(t, strings.HasSuffix(files[0], ".eml"))
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	header, parts := readMessage(t, data)
+	require.Equal(t, "Hi", header.Get("Subject"))
+	require.Equal(t, "text", parts["text/plain"])
+}
+
+// fakeSMTPServer принимает одно письмо по SMTP без расширений.
+type fakeSMTPServer struct {
+	listener net.Listener
+	commands []string
+	data     string
+	done     chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTPServer{listener: listener, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		defer close(s.done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimRight(line, "\r\n")
+			s.commands = append(s.commands, cmd)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				s.data = data.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return s
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	host, port, err := net.SplitHostPort(server.listener.Addr().String())
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	mailer := NewSMTPMailer(SMTPConfig{Host: host, Port: portNumber, From: "Shop <no-reply@shop.example>"})
+	err = mailer.Send(context.Background(), &Message{To: "Anna <anna@example.com>", Subject: "Hi", Text: "text", HTML: "<p>html</p>"})
+	require.NoError(t, err)
+	<-server.done
+
+	require.Contains(t, server.commands, "MAIL FROM:<no-reply@shop.example>")
+	require.Contains(t, server.commands, "RCPT TO:<anna@example.com>")
+	header, parts := readMessage(t, []byte(server.data))
+	require.Equal(t, "Hi", header.Get("Subject"))
+	require.Equal(t, "<p>html</p>", parts["text/html"])
+}
+
+func TestNotifier(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("enqueue order emails", func(t *testing.T) {
+		notifier, store, _ := newTestNotifier(t)
+		events := []*domain.OutboxEvent{
+			{ID: 1, Type: domain.EventOrderCreated, Payload: `{"order_id": 7}`},
+			{ID: 2, Type: domain.EventOrderShipped, Payload: `{"order_id": 7}`},
+			{ID: 3, Type: domain.EventOrderCancelled, Payload: `{"order_id": 7}`},
+			{ID: 4, Type: domain.EventProductUpdated, Payload: `{"product_id": 3}`},
+			// Повторная доставка того же события
+			{ID: 1, Type: domain.EventOrderCreated, Payload: `{"order_id": 7}`},
+		}
+		for _, event := range events {
+			require.NoError(t, notifier.Enqueue(ctx, event))
+		}
+
+		require.Len(t, store.jobs, 3)
+		for i, jobType := range []string{OrderConfirmationEmail.Name, OrderShippedEmail.Name, OrderCancelledEmail.Name} {
+			require.Equal(t, jobType, store.jobs[i].Type)
+			var args OrderEmailArgs
+			require.NoError(t, json.Unmarshal([]byte(store.jobs[i].Payload), &args))
+			require.Equal(t, int64(7), args.OrderID)
+		}
+
+		err := notifier.Enqueue(ctx, &domain.OutboxEvent{ID: 5, Type: domain.EventOrderCreated, Payload: `{`})
+		require.ErrorIs(t, err, outbox.ErrSkipEvent)
+		require.Len(t, store.jobs, 3)
+	})
+
+	t.Run("send order email", func(t *testing.T) {
+		notifier, _, mailer := newTestNotifier(t)
+		require.NoError(t, notifier.sendOrderEmail(ctx, TemplateOrderConfirmation, 7))
+		require.Len(t, mailer.sent, 1)
+		require.Equal(t, "anna@example.com", mailer.sent[0].To)
+		require.Equal(t, "Order #7 confirmed", mailer.sent[0].Subject)
+		require.Contains(t, mailer.sent[0].Text, "https://shop.example/orders/7")
+	})
+
+	t.Run("missing order is not retried", func(t *testing.T) {
+		notifier, _, mailer := newTestNotifier(t)
+		err := notifier.sendOrderEmail(ctx, TemplateOrderConfirmation, 8)
+		var notFoundErr *storer.NotFoundError
+		require.ErrorAs(t, err, &notFoundErr)
+		require.Empty(t, mailer.sent)
+	})
+
+	t.Run("send password reset", func(t *testing.T) {
+		notifier, store, mailer := newTestNotifier(t)
+		require.NoError(t, notifier.sendPasswordReset(ctx, 1))
+		require.Len(t, mailer.sent, 1)
+		require.Len(t, store.tokens, 1)
+
+		// В базе только хеш токена из ссылки
+		start := strings.Index(mailer.sent[0].Text, "https://shop.example/reset-password?")
+		require.GreaterOrEqual(t, start, 0)
+		link, err := url.Parse(strings.Fields(mailer.sent[0].Text[start:])[0])
+		require.NoError(t, err)
+		token := link.Query().Get("token")
+		require.Len(t, token, 64)
+		require.Equal(t, domain.HashPasswordResetToken(token), store.tokens[0].TokenHash)
+		require.NotContains(t, store.tokens[0].TokenHash, token)
+		require.Equal(t, notifier.now().Add(PasswordResetTTL), store.tokens[0].ExpiresAt)
+	})
+}
@@ -0,0 +1,205 @@
+package notifications
+
+import (
+	"context"
+	"crypto/rand"
+	"ecomm/domain"
+	"ecomm/ecomm-api/jobs"
+	"ecomm/ecomm-api/outbox"
+	"ecomm/ecomm-api/storer"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Store - часть storer, которая нужна для писем.
+type Store interface {
+	jobs.Enqueuer
+	GetOrder(ctx context.Context, id int64) (*domain.Order, error)
+	GetUser(ctx context.Context, id int64) (*domain.User, error)
+	CreatePasswordResetToken(ctx context.Context, t *domain.PasswordResetToken) error
+}
+
+type OrderEmailArgs struct {
+	OrderID int64 `json:"order_id"`
+}
+
+type PasswordResetArgs struct {
+	UserID int64 `json:"user_id"`
+}
+
+// Письма отправляются фоновыми задачами: ошибка почты только откладывает письмо
+// и никак не влияет на заказ, который к этому моменту уже сохранен.
+var (
+	OrderConfirmationEmail = jobs.Type[OrderEmailArgs]{Name: "email.order_confirmation", MaxAttempts: 8}
+	OrderShippedEmail      = jobs.Type[OrderEmailArgs]{Name: "email.order_shipped", MaxAttempts: 8}
+	OrderCancelledEmail    = jobs.Type[OrderEmailArgs]{Name: "email.order_cancelled", MaxAttempts: 8}
+	// Токен создается в самой задаче, поэтому в очереди он не хранится. Ссылка из письма,
+	// отправленного с опозданием, все равно действует PasswordResetTTL.
+	PasswordResetEmail = jobs.Type[PasswordResetArgs]{Name: "email.password_reset", MaxAttempts: 3}
+)
+
+// PasswordResetTTL - срок действия ссылки сброса пароля.
+const PasswordResetTTL = time.Hour
+
+// Config - данные магазина для писем.
+type Config struct {
+	ShopName string
+	ShopURL  string // Адрес витрины, от него строятся ссылки на заказ и сброс пароля
+}
+
+// shop - данные магазина в шаблонах.
+type shop struct {
+	Name string
+	URL  string
+}
+
+type orderEmailData struct {
+	Shop     shop
+	User     *domain.User
+	Order    *domain.Order
+	OrderURL string
+}
+
+type passwordResetEmailData struct {
+	Shop      shop
+	User      *domain.User
+	ResetURL  string
+	ExpiresAt time.Time
+}
+
+// Notifier ставит письма в очередь по доменным событиям и отправляет их.
+type Notifier struct {
+	store     Store
+	mailer    Mailer
+	templates *Templates
+	shop      shop
+	now       func() time.Time
+}
+
+func NewNotifier(store Store, mailer Mailer, config Config) (*Notifier, error) {
+	templates, err := ParseTemplates()
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{
+		store:     store,
+		mailer:    mailer,
+		templates: templates,
+		shop:      shop{Name: config.ShopName, URL: strings.TrimRight(config.ShopURL, "/")},
+		now:       time.Now,
+	}, nil
+}
+
+// Enqueue ставит письмо по событию заказа. Подходит как обработчик outbox.InProcessPublisher:
+// relay вызывает его уже после коммита. Relay может передать событие повторно, поэтому
+// ключ задачи - id события.
+func (n *Notifier) Enqueue(ctx context.Context, event *domain.OutboxEvent) error {
+	var emailType jobs.Type[OrderEmailArgs]
+	switch event.Type {
+	case domain.EventOrderCreated:
+		emailType = OrderConfirmationEmail
+	case domain.EventOrderShipped:
+		emailType = OrderShippedEmail
+	case domain.EventOrderCancelled:
+		emailType = OrderCancelledEmail
+	default:
+		return nil
+	}
+
+	var args OrderEmailArgs
+	if err := json.Unmarshal([]byte(event.Payload), &args); err != nil {
+		// Повтор не поможет: такое событие не разберется и в следующий раз.
+		return outbox.SkipEvent(fmt.Errorf("error decoding %s event %d: %w", event.Type, event.ID, err))
+	}
+	_, err := emailType.Enqueue(ctx, n.store, args, jobs.UniqueKey(fmt.Sprintf("email:event:%d", event.ID)))
+	return err
+}
+
+// Register подключает обработчики писем к пулу задач.
+func (n *Notifier) Register(pool *jobs.Pool) {
+	for _, email := range []struct {
+		jobType  jobs.Type[OrderEmailArgs]
+		template string
+	}{
+		{OrderConfirmationEmail, TemplateOrderConfirmation},
+		{OrderShippedEmail, TemplateOrderShipped},
+		{OrderCancelledEmail, TemplateOrderCancelled},
+	} {
+		jobs.Handle(pool, email.jobType, func(ctx context.Context, args OrderEmailArgs) error {
+			return n.sendOrderEmail(ctx, email.template, args.OrderID)
+		})
+	}
+	jobs.Handle(pool, PasswordResetEmail, func(ctx context.Context, args PasswordResetArgs) error {
+		return n.sendPasswordReset(ctx, args.UserID)
+	})
+}
+
+func (n *Notifier) sendOrderEmail(ctx context.Context, template string, orderID int64) error {
+	order, err := n.store.GetOrder(ctx, orderID)
+	if err != nil {
+		return permanentIfNotFound(err)
+	}
+	user, err := n.store.GetUser(ctx, order.UserID)
+	if err != nil {
+		return permanentIfNotFound(err)
+	}
+
+	msg, err := n.templates.Render(template, orderEmailData{
+		Shop:     n.shop,
+		User:     user,
+		Order:    order,
+		OrderURL: fmt.Sprintf("%s/orders/%d", n.shop.URL, order.ID),
+	})
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	msg.To = user.Email
+	return n.mailer.Send(ctx, msg)
+}
+
+func (n *Notifier) sendPasswordReset(ctx context.Context, userID int64) error {
+	user, err := n.store.GetUser(ctx, userID)
+	if err != nil {
+		return permanentIfNotFound(err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("error generating password reset token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	resetToken := &domain.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: domain.HashPasswordResetToken(token),
+		ExpiresAt: n.now().Add(PasswordResetTTL),
+	}
+	if err := n.store.CreatePasswordResetToken(ctx, resetToken); err != nil {
+		return err
+	}
+
+	msg, err := n.templates.Render(TemplatePasswordReset, passwordResetEmailData{
+		Shop:      n.shop,
+		User:      user,
+		ResetURL:  n.shop.URL + "/reset-password?token=" + url.QueryEscape(token),
+		ExpiresAt: resetToken.ExpiresAt,
+	})
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	msg.To = user.Email
+	return n.mailer.Send(ctx, msg)
+}
+
+// permanentIfNotFound не повторяет письмо о заказе или пользователе, которых уже нет.
+func permanentIfNotFound(err error) error {
+	var notFoundErr *storer.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return jobs.Permanent(err)
+	}
+	return err
+}
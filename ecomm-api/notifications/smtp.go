@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+const smtpTimeout = 30 * time.Second
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // Пустой - без аутентификации
+	Password string
+	From     string // Например "Shop <no-reply@shop.example>"
+}
+
+// SMTPMailer отправляет письма через SMTP-сервер, включая STARTTLS, если сервер его поддерживает.
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{config: config}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.build(m.config.From, time.Now())
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(m.config.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", m.config.From, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	dialer := net.Dialer{Timeout: smtpTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server %s: %w", addr, err)
+	}
+	deadline := time.Now().Add(smtpTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error starting SMTP session with %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return fmt.Errorf("error starting TLS with %s: %w", addr, err)
+		}
+	}
+	if m.config.Username != "" {
+		// PlainAuth сам откажется отправлять пароль без TLS на не-localhost
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("error authenticating with %s: %w", addr, err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("error sending MAIL FROM: %w", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("error sending RCPT TO %s: %w", to.Address, err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting DATA: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error finishing message: %w", err)
+	}
+	return client.Quit()
+}
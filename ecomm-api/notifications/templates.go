@@ -0,0 +1,80 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Имена шаблонов: для каждого есть templates/<name>.txt с блоком "subject" и templates/<name>.html
+// с блоком "content", который вставляется в layout.html.
+const (
+	TemplateOrderConfirmation = "order_confirmation"
+	TemplateOrderShipped      = "order_shipped"
+	TemplateOrderCancelled    = "order_cancelled"
+	TemplatePasswordReset     = "password_reset"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var templateFuncs = map[string]interface{}{
+	"money": func(amount float64) string {
+		return fmt.Sprintf("%.2f", amount)
+	},
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates - разобранные шаблоны писем.
+type Templates struct {
+	byName map[string]*emailTemplate
+}
+
+// ParseTemplates разбирает встроенные шаблоны всех писем.
+func ParseTemplates() (*Templates, error) {
+	t := &Templates{byName: map[string]*emailTemplate{}}
+	for _, name := range []string{TemplateOrderConfirmation, TemplateOrderShipped, TemplateOrderCancelled, TemplatePasswordReset} {
+		text, err := texttemplate.New(name+".txt").Funcs(templateFuncs).ParseFS(templateFS, "templates/"+name+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("error parsing text template %s: %w", name, err)
+		}
+		html, err := htmltemplate.New("layout.html").Funcs(templateFuncs).
+			ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			return nil, fmt.Errorf("error parsing html template %s: %w", name, err)
+		}
+		t.byName[name] = &emailTemplate{text: text, html: html}
+	}
+	return t, nil
+}
+
+// Render заполняет шаблон name данными data. Получателя задает вызывающий.
+func (t *Templates) Render(name string, data interface{}) (*Message, error) {
+	tmpl, ok := t.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("error rendering subject of %s: %w", name, err)
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("error rendering text of %s: %w", name, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, fmt.Errorf("error rendering html of %s: %w", name, err)
+	}
+	return &Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"context"
+	"ecomm/domain"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileEvent - строка файла событий. Payload пишется как JSON, а не как строка с JSON внутри.
+type fileEvent struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// FilePublisher дописывает события в файл по одному JSON на строку.
+// Удобен локально: за событиями можно следить через tail -f.
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating directory for events file %s: %w", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening events file %s: %w", path, err)
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+// Publish возвращает ошибку, только если строка не записана на диск:
+// иначе relay отметил бы событие опубликованным, а после сбоя его не было бы в файле.
+func (p *FilePublisher) Publish(ctx context.Context, event *domain.OutboxEvent) error {
+	line, err := json.Marshal(fileEvent{
+		ID:            event.ID,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		Type:          event.Type,
+		Payload:       json.RawMessage(event.Payload),
+		CreatedAt:     event.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding event %d: %w", event.ID, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing event %d: %w", event.ID, err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("error syncing events file: %w", err)
+	}
+	return nil
+}
+
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
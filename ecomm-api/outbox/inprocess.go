@@ -0,0 +1,65 @@
+package outbox
+
+import (
+	"context"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Handler обрабатывает событие внутри процесса.
+type Handler func(ctx context.Context, event *domain.OutboxEvent) error
+
+type subscription struct {
+	eventTypes map[string]bool
+	handler    Handler
+}
+
+// InProcessPublisher передает события обработчикам в том же процессе - для локальной
+// разработки и для подписчиков, которым не нужен внешний брокер.
+type InProcessPublisher struct {
+	mu            sync.RWMutex
+	subscriptions []subscription
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{}
+}
+
+// Subscribe регистрирует обработчик событий перечисленных типов, без типов - всех событий.
+func (p *InProcessPublisher) Subscribe(handler Handler, eventTypes ...string) {
+	s := subscription{handler: handler}
+	if len(eventTypes) > 0 {
+		s.eventTypes = map[string]bool{}
+		for _, eventType := range eventTypes {
+			s.eventTypes[eventType] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscriptions = append(p.subscriptions, s)
+}
+
+// Publish вызывает обработчики по порядку подписки. Ошибка любого из них возвращается relay,
+// и событие будет доставлено повторно всем обработчикам, в том числе уже успевшим его получить.
+// Обработчик, вернувший ErrSkipEvent, пропускается, а остальные получают событие как обычно.
+func (p *InProcessPublisher) Publish(ctx context.Context, event *domain.OutboxEvent) error {
+	p.mu.RLock()
+	subscriptions := p.subscriptions
+	p.mu.RUnlock()
+
+	for _, s := range subscriptions {
+		if s.eventTypes != nil && !s.eventTypes[event.Type] {
+			continue
+		}
+		if err := s.handler(ctx, event); errors.Is(err, ErrSkipEvent) {
+			log.Printf("outbox: handler skipped event %d (%s): %v", event.ID, event.Type, err)
+		} else if err != nil {
+			return fmt.Errorf("error handling event %d (%s): %w", event.ID, event.Type, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package outbox
+
+import (
+	"context"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Publisher доставляет событие подписчикам. Relay может передать одно и то же событие
+// повторно (at-least-once), поэтому получатели должны различать дубликаты по event.ID.
+type Publisher interface {
+	Publish(ctx context.Context, event *domain.OutboxEvent) error
+}
+
+// ErrSkipEvent - ошибка получателя, которую бесполезно повторять (например, payload не
+// разбирается). Relay пишет ее в лог и считает событие опубликованным, чтобы оно не
+// задерживало следующие события.
+var ErrSkipEvent = errors.New("event skipped")
+
+// SkipEvent помечает err как ErrSkipEvent.
+func SkipEvent(err error) error {
+	return fmt.Errorf("%w: %w", ErrSkipEvent, err)
+}
+
+// Store - часть storer, которая нужна relay.
+type Store interface {
+	RelayOutboxEvents(ctx context.Context, limit int, maxAttempts int64, publish func(*domain.OutboxEvent) error) (int, error)
+}
+
+const (
+	DefaultBatchSize    = 100
+	DefaultPollInterval = time.Second
+	// DefaultMaxAttempts - после стольких неудачных публикаций событие уходит в dead letters
+	DefaultMaxAttempts = 10
+)
+
+// Relay переносит события из таблицы outbox_events в Publisher. Порядок сохраняется только для событий
+// одного агрегата; события разных агрегатов могут прийти не в порядке коммитов.
+type Relay struct {
+	store        Store
+	publisher    Publisher
+	batchSize    int
+	pollInterval time.Duration
+	maxAttempts  int64
+}
+
+func NewRelay(store Store, publisher Publisher, batchSize int, pollInterval time.Duration) *Relay {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+	return &Relay{
+		store:        store,
+		publisher:    publisher,
+		batchSize:    batchSize,
+		pollInterval: pollInterval,
+		maxAttempts:  DefaultMaxAttempts,
+	}
+}
+
+// RelayOnce публикует одну пачку событий и возвращает число опубликованных.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	return r.store.RelayOutboxEvents(ctx, r.batchSize, r.maxAttempts, func(event *domain.OutboxEvent) error {
+		err := r.publisher.Publish(ctx, event)
+		if errors.Is(err, ErrSkipEvent) {
+			log.Printf("outbox relay: event %d (%s) skipped: %v", event.ID, event.Type, err)
+			return nil
+		}
+		if err != nil && event.Attempts+1 >= r.maxAttempts {
+			log.Printf("outbox relay: event %d (%s) moved to dead letters after %d attempts: %v",
+				event.ID, event.Type, event.Attempts+1, err)
+		}
+		return err
+	})
+}
+
+// Run публикует события до отмены ctx. Полная пачка значит, что в outbox, скорее всего,
+// есть еще события, поэтому следующая забирается сразу, а не через pollInterval.
+func (r *Relay) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		wait := r.pollInterval
+		n, err := r.RelayOnce(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("outbox relay: published %d events, then failed: %v", n, err)
+		} else if n == r.batchSize {
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
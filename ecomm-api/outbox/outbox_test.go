@@ -0,0 +1,231 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"ecomm/domain"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore повторяет поведение storer: события по порядку, остановка на первой ошибке,
+// событие без оставшихся попыток уходит в dead letters.
+type memoryStore struct {
+	events    []*domain.OutboxEvent
+	published map[int64]bool
+	dead      map[int64]bool
+}
+
+func newMemoryStore(events ...*domain.OutboxEvent) *memoryStore {
+	return &memoryStore{events: events, published: map[int64]bool{}, dead: map[int64]bool{}}
+}
+
+func (s *memoryStore) RelayOutboxEvents(ctx context.Context, limit int, maxAttempts int64, publish func(*domain.OutboxEvent) error) (int, error) {
+	n := 0
+	for _, event := range s.events {
+		if s.published[event.ID] || s.dead[event.ID] {
+			continue
+		}
+		if n == limit {
+			break
+		}
+		err := publish(event)
+		event.Attempts++
+		if err != nil && event.Attempts >= maxAttempts {
+			s.dead[event.ID] = true
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		s.published[event.ID] = true
+		n++
+	}
+	return n, nil
+}
+
+func newEvent(id int64, eventType string) *domain.OutboxEvent {
+	return &domain.OutboxEvent{
+		ID:            id,
+		AggregateType: "product",
+		AggregateID:   7,
+		Type:          eventType,
+		Payload:       `{"product_id":7}`,
+		CreatedAt:     time.Now(),
+	}
+}
+
+func TestRelay(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{
+			name: "subscribers get events of their types in order",
+			test: func(t *testing.T) {
+				store := newMemoryStore(newEvent(1, domain.EventProductUpdated), newEvent(2, domain.EventOrderCreated), newEvent(3, domain.EventProductDeleted))
+				publisher := NewInProcessPublisher()
+				var all, products []int64
+				publisher.Subscribe(func(ctx context.Context, event *domain.OutboxEvent) error {
+					all = append(all, event.ID)
+					return nil
+				})
+				publisher.Subscribe(func(ctx context.Context, event *domain.OutboxEvent) error {
+					products = append(products, event.ID)
+					return nil
+				}, domain.EventProductUpdated, domain.EventProductDeleted)
+
+				n, err := NewRelay(store, publisher, 10, time.Second).RelayOnce(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, 3, n)
+				require.Equal(t, []int64{1, 2, 3}, all)
+				require.Equal(t, []int64{1, 3}, products)
+			},
+		},
+		{
+			name: "failed event is redelivered on the next run",
+			test: func(t *testing.T) {
+				store := newMemoryStore(newEvent(1, domain.EventProductUpdated), newEvent(2, domain.EventProductUpdated))
+				publisher := NewInProcessPublisher()
+				var delivered []int64
+				fail := true
+				publisher.Subscribe(func(ctx context.Context, event *domain.OutboxEvent) error {
+					if event.ID == 2 && fail {
+						fail = false
+						return errors.New("subscriber is down")
+					}
+					delivered = append(delivered, event.ID)
+					return nil
+				})
+				relay := NewRelay(store, publisher, 10, time.Second)
+
+				n, err := relay.RelayOnce(context.Background())
+				require.ErrorContains(t, err, "subscriber is down")
+				require.Equal(t, 1, n)
+
+				n, err = relay.RelayOnce(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, 1, n)
+				require.Equal(t, []int64{1, 2}, delivered)
+			},
+		},
+		{
+			name: "event that always fails is moved to dead letters",
+			test: func(t *testing.T) {
+				store := newMemoryStore(newEvent(1, domain.EventProductUpdated), newEvent(2, domain.EventProductUpdated))
+				publisher := NewInProcessPublisher()
+				var delivered []int64
+				publisher.Subscribe(func(ctx context.Context, event *domain.OutboxEvent) error {
+					if event.ID == 1 {
+						return errors.New("poison event")
+					}
+					delivered = append(delivered, event.ID)
+					return nil
+				})
+				relay := NewRelay(store, publisher, 10, time.Second)
+				relay.maxAttempts = 3
+
+				for i := 0; i < 2; i++ {
+					_, err := relay.RelayOnce(context.Background())
+					require.ErrorContains(t, err, "poison event")
+					require.Empty(t, delivered)
+				}
+				n, err := relay.RelayOnce(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, 1, n)
+				require.Equal(t, []int64{2}, delivered)
+				require.True(t, store.dead[1])
+			},
+		},
+		{
+			name: "skipped event does not block the relay",
+			test: func(t *testing.T) {
+				store := newMemoryStore(newEvent(1, domain.EventProductUpdated), newEvent(2, domain.EventProductUpdated))
+				publisher := NewInProcessPublisher()
+				var skipped, delivered []int64
+				publisher.Subscribe(func(ctx context.Context, event *domain.OutboxEvent) error {
+					if event.ID == 1 {
+						skipped = append(skipped, event.ID)
+						return SkipEvent(errors.New("malformed payload"))
+					}
+					return nil
+				})
+				publisher.Subscribe(func(ctx context.Context, event *domain.OutboxEvent) error {
+					delivered = append(delivered, event.ID)
+					return nil
+				})
+
+				n, err := NewRelay(store, publisher, 10, time.Second).RelayOnce(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, 2, n)
+				require.Equal(t, []int64{1}, skipped)
+				require.Equal(t, []int64{1, 2}, delivered)
+				require.False(t, store.dead[1])
+			},
+		},
+		{
+			name: "run drains full batches without waiting",
+			test: func(t *testing.T) {
+				store := newMemoryStore(newEvent(1, domain.EventProductUpdated), newEvent(2, domain.EventProductUpdated), newEvent(3, domain.EventProductUpdated))
+				publisher := NewInProcessPublisher()
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				done := make(chan struct{})
+				publisher.Subscribe(func(ctx context.Context, event *domain.OutboxEvent) error {
+					if event.ID == 3 {
+						close(done)
+					}
+					return nil
+				})
+
+				stopped := make(chan struct{})
+				go func() {
+					NewRelay(store, publisher, 1, time.Hour).Run(ctx)
+					close(stopped)
+				}()
+				select {
+				case <-done:
+				case <-time.After(time.Second):
+					t.Fatal("relay waited for the poll interval")
+				}
+				cancel()
+				<-stopped
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, tc.test)
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox", "events.jsonl")
+	publisher, err := NewFilePublisher(path)
+	require.NoError(t, err)
+
+	store := newMemoryStore(newEvent(1, domain.EventProductUpdated), newEvent(2, domain.EventProductDeleted))
+	_, err = NewRelay(store, publisher, 10, time.Second).RelayOnce(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, publisher.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	require.Len(t, lines, 2)
+	require.Equal(t, domain.EventProductDeleted, lines[1]["type"])
+	require.Equal(t, map[string]interface{}{"product_id": float64(7)}, lines[0]["payload"])
+}
@@ -0,0 +1,140 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Токены, которыми в тестах и при локальной разработке управляют поведением FakeProvider.
+// Любой другой токен (в том числе пустой) проходит успешно.
+const (
+	FakeTokenDeclined          = "tok_declined"
+	FakeTokenInsufficientFunds = "tok_insufficient_funds"
+	FakeTokenCaptureDeclined   = "tok_capture_declined"
+)
+
+const FakeProviderName = "fake"
+
+type fakeAuthorization struct {
+	token    string
+	amount   float64
+	captured float64
+	refunded float64
+	voided   bool
+}
+
+// FakeProvider - детерминированный шлюз в памяти: идентификаторы выдаются по счётчику,
+// а исход операции зависит только от токена и сумм.
+type FakeProvider struct {
+	mu             sync.Mutex
+	seq            int64
+	authorizations map[string]*fakeAuthorization
+	refunds        map[string]*Transaction // По reference
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		authorizations: make(map[string]*fakeAuthorization),
+		refunds:        make(map[string]*Transaction),
+	}
+}
+
+func (f *FakeProvider) Name() string {
+	return FakeProviderName
+}
+
+func (f *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("fake provider: invalid amount %.2f", req.Amount)
+	}
+
+	switch req.Token {
+	case FakeTokenDeclined:
+		return nil, &DeclinedError{Op: "authorize", Code: "card_declined", Reason: "card was declined"}
+	case FakeTokenInsufficientFunds:
+		return nil, &DeclinedError{Op: "authorize", Code: "insufficient_funds", Reason: "insufficient funds"}
+	}
+
+	id := f.nextID("auth")
+	f.authorizations[id] = &fakeAuthorization{token: req.Token, amount: req.Amount}
+
+	return &Transaction{ID: id, AuthorizationID: id, Amount: req.Amount}, nil
+}
+
+func (f *FakeProvider) Capture(ctx context.Context, authorizationID string, amount float64) (*Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	auth, err := f.authorization(authorizationID)
+	if err != nil {
+		return nil, err
+	}
+	if auth.voided {
+		return nil, fmt.Errorf("fake provider: authorization %s is voided", authorizationID)
+	}
+	if auth.token == FakeTokenCaptureDeclined {
+		return nil, &DeclinedError{Op: "capture", Code: "capture_declined", Reason: "issuer declined the capture"}
+	}
+	if amount <= 0 || auth.captured+amount > auth.amount {
+		return nil, fmt.Errorf("fake provider: cannot capture %.2f of %.2f authorized", amount, auth.amount)
+	}
+
+	auth.captured += amount
+	return &Transaction{ID: f.nextID("cap"), AuthorizationID: authorizationID, Amount: amount}, nil
+}
+
+func (f *FakeProvider) Void(ctx context.Context, authorizationID string) (*Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	auth, err := f.authorization(authorizationID)
+	if err != nil {
+		return nil, err
+	}
+	if auth.captured > 0 {
+		return nil, fmt.Errorf("fake provider: authorization %s is already captured", authorizationID)
+	}
+
+	auth.voided = true
+	return &Transaction{ID: f.nextID("void"), AuthorizationID: authorizationID, Amount: auth.amount}, nil
+}
+
+func (f *FakeProvider) Refund(ctx context.Context, authorizationID string, amount float64, reference string) (*Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if tx, ok := f.refunds[reference]; ok {
+		return tx, nil
+	}
+	auth, err := f.authorization(authorizationID)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 || auth.refunded+amount > auth.captured {
+		return nil, fmt.Errorf("fake provider: cannot refund %.2f of %.2f captured", amount, auth.captured-auth.refunded)
+	}
+
+	auth.refunded += amount
+	tx := &Transaction{ID: f.nextID("ref"), AuthorizationID: authorizationID, Amount: amount}
+	if reference != "" {
+		f.refunds[reference] = tx
+	}
+	return tx, nil
+}
+
+func (f *FakeProvider) authorization(id string) (*fakeAuthorization, error) {
+	auth, ok := f.authorizations[id]
+	if !ok {
+		return nil, fmt.Errorf("fake provider: authorization %s not found", id)
+	}
+	return auth, nil
+}
+
+func (f *FakeProvider) nextID(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("fake_%s_%06d", prefix, f.seq)
+}
@@ -0,0 +1,121 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeProvider(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *FakeProvider)
+	}{
+		{
+			name: "authorize and capture",
+			test: func(t *testing.T, provider *FakeProvider) {
+				auth, err := provider.Authorize(context.Background(), AuthorizeRequest{Token: "tok_visa", Amount: 100})
+				require.NoError(t, err)
+				require.Equal(t, "fake_auth_000001", auth.ID)
+
+				capture, err := provider.Capture(context.Background(), auth.AuthorizationID, 100)
+				require.NoError(t, err)
+				require.Equal(t, "fake_cap_000002", capture.ID)
+				require.Equal(t, auth.AuthorizationID, capture.AuthorizationID)
+			},
+		},
+		{
+			name: "declined on authorize",
+			test: func(t *testing.T, provider *FakeProvider) {
+				_, err := provider.Authorize(context.Background(), AuthorizeRequest{Token: FakeTokenDeclined, Amount: 100})
+				var declined *DeclinedError
+				require.True(t, errors.As(err, &declined))
+				require.Equal(t, "card_declined", declined.Code)
+			},
+		},
+		{
+			name: "declined on capture",
+			test: func(t *testing.T, provider *FakeProvider) {
+				auth, err := provider.Authorize(context.Background(), AuthorizeRequest{Token: FakeTokenCaptureDeclined, Amount: 100})
+				require.NoError(t, err)
+
+				_, err = provider.Capture(context.Background(), auth.AuthorizationID, 100)
+				var declined *DeclinedError
+				require.True(t, errors.As(err, &declined))
+				require.Equal(t, "capture", declined.Op)
+
+				_, err = provider.Void(context.Background(), auth.AuthorizationID)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "cannot capture more than authorized",
+			test: func(t *testing.T, provider *FakeProvider) {
+				auth, err := provider.Authorize(context.Background(), AuthorizeRequest{Amount: 100})
+				require.NoError(t, err)
+				_, err = provider.Capture(context.Background(), auth.AuthorizationID, 100.01)
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "cannot void captured authorization",
+			test: func(t *testing.T, provider *FakeProvider) {
+				auth, err := provider.Authorize(context.Background(), AuthorizeRequest{Amount: 100})
+				require.NoError(t, err)
+				_, err = provider.Capture(context.Background(), auth.AuthorizationID, 100)
+				require.NoError(t, err)
+				_, err = provider.Void(context.Background(), auth.AuthorizationID)
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "partial refunds up to captured amount",
+			test: func(t *testing.T, provider *FakeProvider) {
+				auth, err := provider.Authorize(context.Background(), AuthorizeRequest{Amount: 100})
+				require.NoError(t, err)
+				_, err = provider.Capture(context.Background(), auth.AuthorizationID, 100)
+				require.NoError(t, err)
+
+				_, err = provider.Refund(context.Background(), auth.AuthorizationID, 60, "refund-1")
+				require.NoError(t, err)
+				_, err = provider.Refund(context.Background(), auth.AuthorizationID, 40, "refund-2")
+				require.NoError(t, err)
+				_, err = provider.Refund(context.Background(), auth.AuthorizationID, 1, "refund-3")
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "repeated refund with the same reference",
+			test: func(t *testing.T, provider *FakeProvider) {
+				auth, err := provider.Authorize(context.Background(), AuthorizeRequest{Amount: 100})
+				require.NoError(t, err)
+				_, err = provider.Capture(context.Background(), auth.AuthorizationID, 100)
+				require.NoError(t, err)
+
+				first, err := provider.Refund(context.Background(), auth.AuthorizationID, 60, "refund-1")
+				require.NoError(t, err)
+				second, err := provider.Refund(context.Background(), auth.AuthorizationID, 60, "refund-1")
+				require.NoError(t, err)
+				require.Equal(t, first.ID, second.ID)
+				// Повтор не вернул деньги второй раз
+				_, err = provider.Refund(context.Background(), auth.AuthorizationID, 40, "refund-2")
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown authorization",
+			test: func(t *testing.T, provider *FakeProvider) {
+				_, err := provider.Capture(context.Background(), "fake_auth_999999", 1)
+				require.ErrorContains(t, err, "not found")
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, NewFakeProvider())
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+)
+
+// Provider - платёжный шлюз. Деньги по заказу сначала авторизуются (холдируются),
+// затем списываются через Capture; неиспользованную авторизацию можно отменить через Void,
+// списанные деньги вернуть через Refund.
+//
+// Refund идемпотентен по reference: повтор с тем же reference возвращает уже сделанную
+// операцию, поэтому возврат можно безопасно повторять после сбоя.
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Transaction, error)
+	Capture(ctx context.Context, authorizationID string, amount float64) (*Transaction, error)
+	Void(ctx context.Context, authorizationID string) (*Transaction, error)
+	Refund(ctx context.Context, authorizationID string, amount float64, reference string) (*Transaction, error)
+}
+
+type AuthorizeRequest struct {
+	Reference string // Наш идентификатор платежа, уходит в шлюз для сверки
+	Method    string // Способ оплаты из заказа, например "card"
+	Token     string // Токен карты/кошелька, выданный шлюзом на клиенте
+	Amount    float64
+}
+
+type Transaction struct {
+	ID              string // Идентификатор конкретной операции в шлюзе
+	AuthorizationID string // Идентификатор авторизации, к которой относится операция
+	Amount          float64
+}
+
+// DeclinedError возвращается, когда шлюз отказал в операции (а не когда он недоступен).
+type DeclinedError struct {
+	Op     string // Операция шлюза, например "authorize"
+	Code   string // Код отказа шлюза, например "card_declined"
+	Reason string
+}
+
+func (e *DeclinedError) Error() string {
+	return fmt.Sprintf("payment %s declined: %s (%s)", e.Op, e.Reason, e.Code)
+}
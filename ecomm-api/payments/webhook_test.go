@@ -0,0 +1,66 @@
+package payments
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookVerifier(t *testing.T) {
+	secret := []byte("whsec_test")
+	payload := []byte(`{"id":"evt_1","type":"payment.captured","authorization_id":"fake_auth_000001","amount":130}`)
+	now := time.Unix(1_700_000_000, 0)
+
+	newVerifier := func() *WebhookVerifier {
+		v := NewWebhookVerifier(secret, 5*time.Minute)
+		v.Now = func() time.Time { return now }
+		return v
+	}
+
+	tcs := []struct {
+		name   string
+		header string
+		want   error
+	}{
+		{name: "valid signature", header: Sign(secret, now, payload)},
+		{name: "signed slightly in the past", header: Sign(secret, now.Add(-4*time.Minute), payload)},
+		{name: "wrong secret", header: Sign([]byte("other"), now, payload), want: ErrInvalidSignature},
+		{name: "replayed after tolerance", header: Sign(secret, now.Add(-6*time.Minute), payload), want: ErrSignatureExpired},
+		{name: "timestamp from the future", header: Sign(secret, now.Add(10*time.Minute), payload), want: ErrSignatureExpired},
+		{name: "empty header", header: "", want: ErrInvalidSignature},
+		{name: "missing signature", header: "t=1700000000", want: ErrInvalidSignature},
+		{name: "garbage timestamp", header: "t=abc,v1=00", want: ErrInvalidSignature},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := newVerifier().Verify(tc.header, payload)
+			if tc.want == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.want)
+		})
+	}
+
+	t.Run("tampered payload", func(t *testing.T) {
+		header := Sign(secret, now, payload)
+		err := newVerifier().Verify(header, []byte(`{"id":"evt_1","type":"payment.captured","amount":1}`))
+		require.ErrorIs(t, err, ErrInvalidSignature)
+	})
+}
+
+func TestParseEvent(t *testing.T) {
+	event, err := ParseEvent([]byte(`{"id":"evt_1","type":"payment.captured","created":1700000000,"authorization_id":"fake_auth_000001","amount":130}`))
+	require.NoError(t, err)
+	require.Equal(t, "evt_1", event.ID)
+	require.Equal(t, EventPaymentCaptured, event.Type)
+	require.InDelta(t, 130.0, event.Amount, 0.001)
+
+	_, err = ParseEvent([]byte(`{"type":"payment.captured"}`))
+	require.Error(t, err)
+
+	_, err = ParseEvent([]byte(`not json`))
+	require.Error(t, err)
+}
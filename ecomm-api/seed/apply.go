@@ -0,0 +1,142 @@
+package seed
+
+import (
+	"context"
+	"ecomm/domain"
+	"ecomm/ecomm-api/service"
+	"ecomm/ecomm-api/storer"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ProgressFunc вызывается после каждой записанной сущности этапа stage.
+type ProgressFunc func(stage string, done int, total int)
+
+// Apply записывает набор через storer. База должна быть пустой (см. storer.TruncateAll):
+// артикулы, slug категорий и email в наборе фиксированы и иначе столкнутся с уникальными индексами.
+func Apply(ctx context.Context, st *storer.PostgresStorer, ds *Dataset, progress ProgressFunc) error {
+	if progress == nil {
+		progress = func(string, int, int) {}
+	}
+
+	categoryIDs := make([]int64, len(ds.Categories))
+	for i, c := range ds.Categories {
+		category := &domain.Category{Name: c.Name, Slug: c.Slug}
+		if c.Parent >= 0 {
+			category.ParentID = &categoryIDs[c.Parent]
+		}
+		created, err := st.CreateCategory(ctx, category)
+		if err != nil {
+			return fmt.Errorf("error seeding category %s: %w", c.Slug, err)
+		}
+		categoryIDs[i] = created.ID
+		progress("categories", i+1, len(ds.Categories))
+	}
+
+	products := make([]*domain.Product, len(ds.Products))
+	for i, p := range ds.Products {
+		sku := p.SKU
+		created, err := st.CreateProduct(ctx, &domain.Product{
+			SKU:          &sku,
+			Name:         p.Name,
+			Image:        "/images/seed/" + p.SKU + ".jpg",
+			CategoryID:   categoryIDs[p.Category],
+			Description:  p.Description,
+			Price:        p.Price,
+			CountInStock: p.CountInStock,
+		})
+		if err != nil {
+			return fmt.Errorf("error seeding product %s: %w", p.SKU, err)
+		}
+		products[i] = created
+		progress("products", i+1, len(ds.Products))
+	}
+
+	// bcrypt медленный намеренно, поэтому хэш общего пароля считаем один раз
+	password, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+	userIDs := make([]int64, len(ds.Users))
+	for i, u := range ds.Users {
+		created, err := st.CreateUser(ctx, &domain.User{Name: u.Name, Email: u.Email, Password: string(password), IsAdmin: u.IsAdmin})
+		if err != nil {
+			return fmt.Errorf("error seeding user %s: %w", u.Email, err)
+		}
+		userIDs[i] = created.ID
+		progress("users", i+1, len(ds.Users))
+	}
+
+	for i, o := range ds.Orders {
+		if err := applyOrder(ctx, st, i, o, userIDs, products); err != nil {
+			return err
+		}
+		progress("orders", i+1, len(ds.Orders))
+	}
+
+	for i, r := range ds.Reviews {
+		review, err := st.CreateReview(ctx, &domain.Review{
+			ProductID: products[r.Product].ID,
+			UserID:    userIDs[r.User],
+			Rating:    r.Rating,
+			Comment:   r.Comment,
+			Status:    domain.ReviewStatusPending,
+		})
+		if err != nil {
+			return fmt.Errorf("error seeding review %d: %w", i+1, err)
+		}
+		if r.Approved {
+			// Одобрение пересчитывает рейтинг товара
+			if _, err := st.UpdateReviewStatus(ctx, review.ID, []string{domain.ReviewStatusPending}, domain.ReviewStatusApproved); err != nil {
+				return fmt.Errorf("error approving review %d: %w", i+1, err)
+			}
+		}
+		progress("reviews", i+1, len(ds.Reviews))
+	}
+	return nil
+}
+
+func applyOrder(ctx context.Context, st *storer.PostgresStorer, n int, o Order, userIDs []int64, products []*domain.Product) error {
+	order := &domain.Order{
+		UserID:        userIDs[o.User],
+		PaymentMethod: o.PaymentMethod,
+		Status:        domain.OrderStatusPending,
+	}
+	for _, item := range o.Items {
+		p := products[item.Product]
+		order.Items = append(order.Items, domain.OrderItem{
+			Name:      p.Name,
+			Quantity:  item.Quantity,
+			Image:     p.Image,
+			Price:     p.Price,
+			ProductID: p.ID,
+		})
+	}
+	service.PriceOrder(order)
+
+	// Оплаченные заказы получают списанный платеж, как после ответа настоящего шлюза
+	var payment *domain.Payment
+	if o.Status == domain.OrderStatusPaid {
+		payment = &domain.Payment{
+			Provider:        domain.PaymentProviderSeed,
+			Method:          order.PaymentMethod,
+			Status:          domain.PaymentStatusCaptured,
+			Amount:          order.TotalPrice,
+			CapturedAmount:  order.TotalPrice,
+			AuthorizationID: fmt.Sprintf("seed_auth_%d", n+1),
+		}
+	}
+	created, err := st.CreateOrder(ctx, order, payment)
+	if err != nil {
+		return fmt.Errorf("error seeding order %d: %w", n+1, err)
+	}
+
+	if o.Status == domain.OrderStatusCancelled {
+		_, _, err := st.CancelOrder(ctx, created.ID, []string{domain.OrderStatusPending}, "customer changed their mind", nil)
+		if err != nil {
+			return fmt.Errorf("error cancelling seeded order %d: %w", n+1, err)
+		}
+	}
+	return nil
+}
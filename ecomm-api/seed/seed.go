@@ -0,0 +1,262 @@
+// Package seed генерирует воспроизводимые тестовые данные для локальной разработки:
+// дерево категорий, каталог, пользователей, историю заказов и отзывы.
+//
+// Generate строит набор данных без обращения к базе - один и тот же профиль и seed всегда дают
+// один и тот же набор. Apply записывает его через storer, поэтому заказы проходят те же
+// проверки остатков и транзакции, что и настоящие.
+package seed
+
+import (
+	"ecomm/domain"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// Profile - размеры генерируемого набора.
+type Profile struct {
+	Name             string
+	Categories       int // Корневые категории
+	Subcategories    int // Подкатегорий у каждой корневой
+	Products         int
+	Users            int // Без учета администратора
+	Orders           int
+	MaxItemsPerOrder int
+	MaxStock         int     // Начальный остаток товара - от 1 до MaxStock
+	ReviewRate       float64 // Доля купленных позиций, на которые оставлен отзыв
+}
+
+var Profiles = map[string]Profile{
+	"small": {
+		Name: "small", Categories: 4, Subcategories: 2, Products: 40, Users: 10,
+		Orders: 60, MaxItemsPerOrder: 3, MaxStock: 50, ReviewRate: 0.3,
+	},
+	"medium": {
+		Name: "medium", Categories: 8, Subcategories: 4, Products: 1_000, Users: 200,
+		Orders: 3_000, MaxItemsPerOrder: 5, MaxStock: 200, ReviewRate: 0.2,
+	},
+	"load-test": {
+		Name: "load-test", Categories: 20, Subcategories: 6, Products: 20_000, Users: 5_000,
+		Orders: 100_000, MaxItemsPerOrder: 6, MaxStock: 1_000, ReviewRate: 0.05,
+	},
+}
+
+// ProfileNames возвращает имена профилей по возрастанию размера.
+func ProfileNames() []string {
+	names := make([]string, 0, len(Profiles))
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return Profiles[names[i]].Products < Profiles[names[j]].Products
+	})
+	return names
+}
+
+// Ссылки между сущностями набора - индексы в срезах Dataset, id появляются только в Apply.
+type (
+	Category struct {
+		Name   string
+		Slug   string
+		Parent int // -1 - корневая категория
+	}
+	Product struct {
+		SKU          string
+		Name         string
+		Description  string
+		Category     int
+		Price        float64
+		CountInStock int64
+	}
+	User struct {
+		Name    string
+		Email   string
+		IsAdmin bool
+	}
+	OrderItem struct {
+		Product  int
+		Quantity int64
+	}
+	Order struct {
+		User          int
+		PaymentMethod string
+		Status        string
+		Items         []OrderItem
+	}
+	Review struct {
+		User     int
+		Product  int
+		Rating   int64
+		Comment  string
+		Approved bool
+	}
+)
+
+type Dataset struct {
+	Profile    Profile
+	Seed       uint64
+	Categories []Category
+	Products   []Product
+	Users      []User
+	Orders     []Order
+	Reviews    []Review
+}
+
+const (
+	AdminEmail = "admin@example.com"
+	// Пароль всех сгенерированных пользователей
+	Password = "password123"
+)
+
+var (
+	categoryNames = []string{"Electronics", "Home", "Garden", "Sports", "Books", "Toys", "Clothing", "Kitchen",
+		"Office", "Beauty", "Automotive", "Music", "Pets", "Health", "Outdoors", "Crafts"}
+	subcategoryNames = []string{"Essentials", "Accessories", "Premium", "Basics", "Kids", "Travel", "Vintage", "Pro"}
+	adjectives       = []string{"Compact", "Classic", "Deluxe", "Eco", "Smart", "Rugged", "Portable", "Vintage",
+		"Modern", "Ultra", "Lightweight", "Wireless", "Handmade", "Foldable", "Premium", "Everyday"}
+	materials = []string{"Bamboo", "Steel", "Cotton", "Oak", "Ceramic", "Leather", "Glass", "Aluminium", "Wool", "Linen"}
+	nouns     = []string{"Lamp", "Chair", "Backpack", "Speaker", "Mug", "Notebook", "Blanket", "Bottle", "Clock",
+		"Headphones", "Planter", "Jacket", "Kettle", "Tent", "Desk", "Watch"}
+	firstNames     = []string{"Alex", "Maria", "Ivan", "Olga", "Sam", "Nina", "Pavel", "Anna", "Chris", "Elena"}
+	lastNames      = []string{"Smirnov", "Garcia", "Kim", "Novak", "Ivanova", "Miller", "Petrov", "Silva", "Chen", "Orlova"}
+	paymentMethods = []string{"card", "card", "card", "paypal"}
+	reviewComments = []string{"", "Exactly as described.", "Good value for the price.", "Arrived quickly.",
+		"Would buy again.", "Does the job.", "Not bad, but the packaging was damaged."}
+)
+
+// Generate строит набор данных профиля. Результат зависит только от profile и seed.
+func Generate(profile Profile, seed uint64) *Dataset {
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	ds := &Dataset{Profile: profile, Seed: seed}
+
+	// Товары кладем только в листья дерева категорий
+	var leaves []int
+	for i := 0; i < profile.Categories; i++ {
+		name := numbered(categoryNames, i)
+		ds.Categories = append(ds.Categories, Category{Name: name, Slug: slugify(name), Parent: -1})
+		parent := len(ds.Categories) - 1
+		if profile.Subcategories == 0 {
+			leaves = append(leaves, parent)
+		}
+		for j := 0; j < profile.Subcategories; j++ {
+			subName := name + " " + numbered(subcategoryNames, j)
+			ds.Categories = append(ds.Categories, Category{Name: subName, Slug: slugify(subName), Parent: parent})
+			leaves = append(leaves, len(ds.Categories)-1)
+		}
+	}
+
+	for i := 0; i < profile.Products; i++ {
+		noun := pick(rng, nouns)
+		material := pick(rng, materials)
+		ds.Products = append(ds.Products, Product{
+			SKU:          fmt.Sprintf("SEED-%06d", i+1),
+			Name:         fmt.Sprintf("%s %s %s", pick(rng, adjectives), material, noun),
+			Description:  fmt.Sprintf("%s %s made of %s.", pick(rng, adjectives), strings.ToLower(noun), strings.ToLower(material)),
+			Category:     leaves[rng.IntN(len(leaves))],
+			Price:        float64(rng.IntN(49_901)+99) / 100,
+			CountInStock: int64(rng.IntN(profile.MaxStock) + 1),
+		})
+	}
+
+	ds.Users = append(ds.Users, User{Name: "Admin", Email: AdminEmail, IsAdmin: true})
+	for i := 0; i < profile.Users; i++ {
+		ds.Users = append(ds.Users, User{
+			Name:  pick(rng, firstNames) + " " + pick(rng, lastNames),
+			Email: fmt.Sprintf("user%d@example.com", i+1),
+		})
+	}
+
+	generateOrders(rng, ds)
+	return ds
+}
+
+// generateOrders набирает заказы из оставшегося остатка, поэтому Apply не упрется в нехватку товара.
+// Отменяются только неоплаченные заказы: возврат денег в сиде не нужен.
+func generateOrders(rng *rand.Rand, ds *Dataset) {
+	profile := ds.Profile
+	if profile.Users == 0 || len(ds.Products) == 0 {
+		return
+	}
+	stock := make([]int64, len(ds.Products))
+	for i, p := range ds.Products {
+		stock[i] = p.CountInStock
+	}
+	reviewed := map[[2]int]bool{}
+
+	for len(ds.Orders) < profile.Orders {
+		order := Order{
+			User:          1 + rng.IntN(profile.Users),
+			PaymentMethod: pick(rng, paymentMethods),
+		}
+		switch r := rng.Float64(); {
+		case r < 0.1:
+			order.Status = domain.OrderStatusPending
+		case r < 0.2:
+			order.Status = domain.OrderStatusCancelled
+		default:
+			order.Status = domain.OrderStatusPaid
+		}
+
+		inOrder := map[int]bool{}
+		items := 1 + rng.IntN(profile.MaxItemsPerOrder)
+		// Число попыток ограничено, чтобы распроданный каталог не зациклил генерацию
+		for attempt := 0; len(order.Items) < items && attempt < items*4; attempt++ {
+			product := rng.IntN(len(ds.Products))
+			if inOrder[product] || stock[product] == 0 {
+				continue
+			}
+			quantity := min(int64(1+rng.IntN(3)), stock[product])
+			stock[product] -= quantity
+			inOrder[product] = true
+			order.Items = append(order.Items, OrderItem{Product: product, Quantity: quantity})
+		}
+		if len(order.Items) == 0 {
+			return // Каталог распродан
+		}
+		ds.Orders = append(ds.Orders, order)
+
+		if order.Status == domain.OrderStatusCancelled {
+			// Отмена в Apply вернет товар на склад
+			for _, item := range order.Items {
+				stock[item.Product] += item.Quantity
+			}
+		}
+		if order.Status != domain.OrderStatusPaid {
+			continue
+		}
+		for _, item := range order.Items {
+			key := [2]int{order.User, item.Product}
+			if reviewed[key] || rng.Float64() >= profile.ReviewRate {
+				continue
+			}
+			reviewed[key] = true
+			ds.Reviews = append(ds.Reviews, Review{
+				User:    order.User,
+				Product: item.Product,
+				// Оценки смещены к хорошим, как в живых магазинах
+				Rating:   int64(math.Max(1, 5-math.Floor(rng.ExpFloat64()))),
+				Comment:  pick(rng, reviewComments),
+				Approved: rng.Float64() < 0.8,
+			})
+		}
+	}
+}
+
+func pick[T any](rng *rand.Rand, values []T) T {
+	return values[rng.IntN(len(values))]
+}
+
+// numbered возвращает i-е имя из списка, а когда имена кончаются - имя с номером круга.
+func numbered(names []string, i int) string {
+	name := names[i%len(names)]
+	if round := i / len(names); round > 0 {
+		name = fmt.Sprintf("%s %d", name, round+1)
+	}
+	return name
+}
+
+func slugify(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), " ", "-")
+}
@@ -0,0 +1,113 @@
+package seed
+
+import (
+	"ecomm/domain"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{
+			name: "same seed gives same dataset",
+			test: func(t *testing.T) {
+				require.Equal(t, Generate(Profiles["small"], 42), Generate(Profiles["small"], 42))
+			},
+		},
+		{
+			name: "different seeds give different datasets",
+			test: func(t *testing.T) {
+				require.NotEqual(t, Generate(Profiles["small"], 1).Products, Generate(Profiles["small"], 2).Products)
+			},
+		},
+		{
+			name: "profile sizes",
+			test: func(t *testing.T) {
+				profile := Profiles["small"]
+				ds := Generate(profile, 1)
+				require.Len(t, ds.Categories, profile.Categories*(1+profile.Subcategories))
+				require.Len(t, ds.Products, profile.Products)
+				require.Len(t, ds.Users, profile.Users+1)
+				require.Len(t, ds.Orders, profile.Orders)
+				require.True(t, ds.Users[0].IsAdmin)
+				require.Equal(t, AdminEmail, ds.Users[0].Email)
+			},
+		},
+		{
+			name: "orders never oversell stock",
+			test: func(t *testing.T) {
+				// Маленький остаток заставляет генератор упираться в распроданные товары
+				profile := Profile{Name: "tight", Categories: 1, Subcategories: 1, Products: 5, Users: 3,
+					Orders: 200, MaxItemsPerOrder: 4, MaxStock: 3, ReviewRate: 1}
+				ds := Generate(profile, 7)
+				stock := make([]int64, len(ds.Products))
+				for i, p := range ds.Products {
+					stock[i] = p.CountInStock
+				}
+				for _, o := range ds.Orders {
+					require.NotEmpty(t, o.Items)
+					for _, item := range o.Items {
+						stock[item.Product] -= item.Quantity
+						require.GreaterOrEqual(t, stock[item.Product], int64(0))
+					}
+					if o.Status == domain.OrderStatusCancelled {
+						for _, item := range o.Items {
+							stock[item.Product] += item.Quantity
+						}
+					}
+				}
+			},
+		},
+		{
+			name: "reviews are unique and come from paid orders",
+			test: func(t *testing.T) {
+				ds := Generate(Profiles["small"], 3)
+				bought := map[[2]int]bool{}
+				for _, o := range ds.Orders {
+					if o.Status != domain.OrderStatusPaid {
+						continue
+					}
+					for _, item := range o.Items {
+						bought[[2]int{o.User, item.Product}] = true
+					}
+				}
+				seen := map[[2]int]bool{}
+				for _, r := range ds.Reviews {
+					key := [2]int{r.User, r.Product}
+					require.True(t, bought[key])
+					require.False(t, seen[key])
+					seen[key] = true
+					require.GreaterOrEqual(t, r.Rating, int64(1))
+					require.LessOrEqual(t, r.Rating, int64(5))
+				}
+			},
+		},
+		{
+			name: "products only in leaf categories",
+			test: func(t *testing.T) {
+				ds := Generate(Profiles["small"], 1)
+				parents := map[int]bool{}
+				for _, c := range ds.Categories {
+					if c.Parent >= 0 {
+						parents[c.Parent] = true
+					}
+				}
+				for _, p := range ds.Products {
+					require.False(t, parents[p.Category])
+				}
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, tc.test)
+	}
+}
+
+func TestProfileNames(t *testing.T) {
+	require.Equal(t, []string{"small", "medium", "load-test"}, ProfileNames())
+}
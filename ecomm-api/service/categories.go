@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"ecomm/domain"
+	categoryDto "ecomm/ecomm-api/handler/dto/category"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/mapper"
+	"strings"
+	"unicode"
+)
+
+func (s *Service) CreateCategory(ctx context.Context, req *categoryDto.CreateCategoryReq) (categoryDto.CategoryRes, error) {
+	op := "createCategory"
+	c, err := s.categoryFromReq(ctx, op, req.Name, req.Slug, req.ParentSlug)
+	if err != nil {
+		return categoryDto.CategoryRes{}, err
+	}
+
+	c, err = s.storer.CreateCategory(ctx, c)
+	if err != nil {
+		return categoryDto.CategoryRes{}, fromStorerError(err)
+	}
+	return mapper.MapToCategoryRes(c), nil
+}
+
+func (s *Service) GetCategory(ctx context.Context, slug string) (categoryDto.CategoryRes, error) {
+	c, err := s.storer.GetCategoryBySlug(ctx, slug)
+	if err != nil {
+		return categoryDto.CategoryRes{}, fromStorerError(err)
+	}
+	return mapper.MapToCategoryRes(c), nil
+}
+
+func (s *Service) GetCategories(ctx context.Context) ([]categoryDto.CategoryRes, error) {
+	categories, err := s.storer.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToCategoryResList(categories), nil
+}
+
+func (s *Service) UpdateCategory(ctx context.Context, slug string, req *categoryDto.UpdateCategoryReq) (categoryDto.CategoryRes, error) {
+	op := "updateCategory"
+	current, err := s.storer.GetCategoryBySlug(ctx, slug)
+	if err != nil {
+		return categoryDto.CategoryRes{}, fromStorerError(err)
+	}
+	c, err := s.categoryFromReq(ctx, op, req.Name, req.Slug, req.ParentSlug)
+	if err != nil {
+		return categoryDto.CategoryRes{}, err
+	}
+	c.ID = current.ID
+
+	if err := s.storer.UpdateCategory(ctx, c); err != nil {
+		return categoryDto.CategoryRes{}, fromStorerError(err)
+	}
+	return mapper.MapToCategoryRes(c), nil
+}
+
+func (s *Service) DeleteCategory(ctx context.Context, slug string) error {
+	c, err := s.storer.GetCategoryBySlug(ctx, slug)
+	if err != nil {
+		return fromStorerError(err)
+	}
+	return fromStorerError(s.storer.DeleteCategory(ctx, c.ID))
+}
+
+// GetCategoryProducts возвращает товары категории вместе с товарами всех подкатегорий.
+func (s *Service) GetCategoryProducts(ctx context.Context, slug string) ([]productDto.ProductRes, error) {
+	c, err := s.storer.GetCategoryBySlug(ctx, slug)
+	if err != nil {
+		return nil, fromStorerError(err)
+	}
+	products, err := s.storer.GetCategoryProducts(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToProductResList(products), nil
+}
+
+func (s *Service) categoryFromReq(ctx context.Context, op string, name string, slug string, parentSlug string) (*domain.Category, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, NewErrValidation(op, "name is required", nil)
+	}
+	if slug == "" {
+		slug = slugify(name)
+	}
+	if slug == "" || slug != slugify(slug) {
+		return nil, NewErrValidation(op, "slug must contain only lowercase letters, digits and dashes", nil)
+	}
+
+	c := &domain.Category{Name: name, Slug: slug}
+	if parentSlug != "" {
+		parent, err := s.storer.GetCategoryBySlug(ctx, parentSlug)
+		if err != nil {
+			return nil, fromStorerError(err)
+		}
+		c.ParentID = &parent.ID
+	}
+	return c, nil
+}
+
+// slugify строит slug так же, как миграция категорий: нижний регистр,
+// всё кроме букв и цифр схлопывается в один дефис, дефисы по краям отрезаются.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
@@ -0,0 +1,13 @@
+package service
+
+import "time"
+
+// ParseDate разбирает дату в RFC 3339 или YYYY-MM-DD и сообщает, была ли она без времени.
+// Им пользуются и HTTP API, и CLI, чтобы фильтры по датам понимались одинаково.
+func ParseDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	return t, true, err
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"ecomm/ecomm-api/storer"
+	"errors"
 	"fmt"
 	"time"
 )
@@ -58,7 +60,7 @@ func NewNotEnoughStock(op string, resource string, id interface{}, requested int
 }
 
 func (e *ErrNotEnoughStock) Error() string {
-	return fmt.Sprintf("not enough stock for product with id %d. Requested: %d, Available: %d", e.ID, e.Requested, e.Available)
+	return fmt.Sprintf("not enough stock for %s with id %v. Requested: %d, Available: %d", e.Resource, e.ID, e.Requested, e.Available)
 }
 
 func (e *ErrNotEnoughStock) Unwrap() error {
@@ -89,3 +91,238 @@ func (e *ErrNotFoundProductForOrder) Error() string {
 func (e *ErrNotFoundProductForOrder) Unwrap() error {
 	return e.Err
 }
+
+type ErrPaymentDeclined struct {
+	Op        string
+	Code      string // Код отказа платёжного шлюза
+	Reason    string
+	Timestamp time.Time
+	Err       error
+}
+
+func NewErrPaymentDeclined(op string, code string, reason string, err error) *ErrPaymentDeclined {
+	return &ErrPaymentDeclined{
+		Op:        op,
+		Code:      code,
+		Reason:    reason,
+		Timestamp: time.Now(),
+		Err:       err,
+	}
+}
+
+func (e *ErrPaymentDeclined) Error() string {
+	return fmt.Sprintf("operation %s: payment declined: %s (%s)", e.Op, e.Reason, e.Code)
+}
+
+func (e *ErrPaymentDeclined) Unwrap() error {
+	return e.Err
+}
+
+type ErrValidation struct {
+	Op        string
+	Message   string // Сообщение, которое можно показать клиенту
+	Timestamp time.Time
+	Err       error
+}
+
+func NewErrValidation(op string, message string, err error) *ErrValidation {
+	return &ErrValidation{
+		Op:        op,
+		Message:   message,
+		Timestamp: time.Now(),
+		Err:       err,
+	}
+}
+
+func (e *ErrValidation) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("operation %s: %s: %s", e.Op, e.Message, e.Err.Error())
+	}
+	return fmt.Sprintf("operation %s: %s", e.Op, e.Message)
+}
+
+func (e *ErrValidation) Unwrap() error {
+	return e.Err
+}
+
+// ErrConflict - операция противоречит текущему состоянию ресурса
+// (дубликат уникального поля, недопустимый переход статуса и т.п.).
+type ErrConflict struct {
+	Op        string
+	Resource  string
+	Message   string
+	Timestamp time.Time
+	Err       error
+}
+
+func NewErrConflict(op string, resource string, message string, err error) *ErrConflict {
+	return &ErrConflict{
+		Op:        op,
+		Resource:  resource,
+		Message:   message,
+		Timestamp: time.Now(),
+		Err:       err,
+	}
+}
+
+func (e *ErrConflict) Error() string {
+	return fmt.Sprintf("operation %s: %s conflict: %s", e.Op, e.Resource, e.Message)
+}
+
+func (e *ErrConflict) Unwrap() error {
+	return e.Err
+}
+
+type ErrUnauthorized struct {
+	Op        string
+	Message   string
+	Timestamp time.Time
+	Err       error
+}
+
+func NewErrUnauthorized(op string, message string, err error) *ErrUnauthorized {
+	return &ErrUnauthorized{
+		Op:        op,
+		Message:   message,
+		Timestamp: time.Now(),
+		Err:       err,
+	}
+}
+
+func (e *ErrUnauthorized) Error() string {
+	return fmt.Sprintf("operation %s: unauthorized: %s", e.Op, e.Message)
+}
+
+func (e *ErrUnauthorized) Unwrap() error {
+	return e.Err
+}
+
+// ErrPreconditionFailed - клиент изменяет ресурс по устаревшей версии (If-Match не совпал).
+type ErrPreconditionFailed struct {
+	Op        string
+	Message   string
+	Timestamp time.Time
+	Err       error
+}
+
+func NewErrPreconditionFailed(op string, message string, err error) *ErrPreconditionFailed {
+	return &ErrPreconditionFailed{
+		Op:        op,
+		Message:   message,
+		Timestamp: time.Now(),
+		Err:       err,
+	}
+}
+
+func (e *ErrPreconditionFailed) Error() string {
+	return fmt.Sprintf("operation %s: precondition failed: %s", e.Op, e.Message)
+}
+
+func (e *ErrPreconditionFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrPreconditionRequired - изменение без If-Match запрещено, чтобы не затереть чужие правки.
+type ErrPreconditionRequired struct {
+	Op        string
+	Message   string
+	Timestamp time.Time
+}
+
+func NewErrPreconditionRequired(op string, message string) *ErrPreconditionRequired {
+	return &ErrPreconditionRequired{
+		Op:        op,
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+}
+
+func (e *ErrPreconditionRequired) Error() string {
+	return fmt.Sprintf("operation %s: precondition required: %s", e.Op, e.Message)
+}
+
+// fromStorerError переводит ошибки хранилища в ошибки сервиса, понятные обработчикам.
+// Остальные ошибки возвращаются как есть.
+func fromStorerError(err error) error {
+	var (
+		notFoundError      *storer.NotFoundError
+		alreadyExistsError *storer.AlreadyExistsError
+		invalidStateError  *storer.InvalidStateError
+		versionError       *storer.VersionMismatchError
+	)
+
+	switch {
+	case errors.As(err, &notFoundError):
+		return &ErrNotFound{
+			Op:        notFoundError.Op,
+			ID:        notFoundError.ID,
+			Resource:  notFoundError.Resource,
+			Timestamp: notFoundError.Timestamp,
+			Err:       err,
+		}
+	case errors.As(err, &alreadyExistsError):
+		return NewErrConflict(alreadyExistsError.Op, alreadyExistsError.Resource,
+			fmt.Sprintf("%s %v already exists", alreadyExistsError.Resource, alreadyExistsError.Key), err)
+	case errors.As(err, &invalidStateError):
+		return NewErrConflict(invalidStateError.Op, invalidStateError.Resource,
+			fmt.Sprintf("%s with id %v is %s", invalidStateError.Resource, invalidStateError.ID, invalidStateError.Status), err)
+	case errors.As(err, &versionError):
+		return NewErrPreconditionFailed(versionError.Op,
+			fmt.Sprintf("%s with id %v has been modified, current version is %d", versionError.Resource, versionError.ID, versionError.Current), err)
+	}
+	return err
+}
+
+type ErrForbidden struct {
+	Op        string
+	Message   string
+	Timestamp time.Time
+}
+
+func NewErrForbidden(op string, message string) *ErrForbidden {
+	return &ErrForbidden{
+		Op:        op,
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+}
+
+func (e *ErrForbidden) Error() string {
+	return fmt.Sprintf("operation %s: forbidden: %s", e.Op, e.Message)
+}
+
+type ErrUnsupportedMediaType struct {
+	Op        string
+	Message   string
+	Timestamp time.Time
+}
+
+func NewErrUnsupportedMediaType(op string, message string) *ErrUnsupportedMediaType {
+	return &ErrUnsupportedMediaType{
+		Op:        op,
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+}
+
+func (e *ErrUnsupportedMediaType) Error() string {
+	return fmt.Sprintf("operation %s: unsupported media type: %s", e.Op, e.Message)
+}
+
+type ErrPayloadTooLarge struct {
+	Op        string
+	Message   string
+	Timestamp time.Time
+}
+
+func NewErrPayloadTooLarge(op string, message string) *ErrPayloadTooLarge {
+	return &ErrPayloadTooLarge{
+		Op:        op,
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+}
+
+func (e *ErrPayloadTooLarge) Error() string {
+	return fmt.Sprintf("operation %s: payload too large: %s", e.Op, e.Message)
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"ecomm/domain"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/storer"
+	"ecomm/mapper"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+	ExportFormatXLSX  = "xlsx"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:   "text/csv; charset=utf-8",
+	ExportFormatJSONL: "application/x-ndjson",
+	ExportFormatXLSX:  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// ExportContentType возвращает Content-Type файла выгрузки или ошибку валидации для неизвестного формата.
+func ExportContentType(format string) (string, error) {
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return "", NewErrValidation("exportContentType",
+			fmt.Sprintf("format must be %s, %s or %s", ExportFormatCSV, ExportFormatJSONL, ExportFormatXLSX), nil)
+	}
+	return contentType, nil
+}
+
+var (
+	productExportColumns = []string{"id", "sku", "name", "image", "category_id", "description", "price", "count_in_stock",
+		"rating", "num_reviews", "version", "created_at", "updated_at", "deleted_at"}
+	// Заказ в таблице занимает по строке на позицию, поля заказа повторяются
+	orderExportColumns = []string{"order_id", "user_id", "status", "payment_method", "tax_price", "shipping_price", "total_price",
+		"refunded_price", "created_at", "updated_at", "item_id", "product_id", "variant_id", "item_name", "quantity", "item_price"}
+)
+
+// ExportProducts пишет товары в w в формате format. Данные читаются из базы порциями и сразу пишутся,
+// поэтому память не зависит от размера каталога (XLSX копится во временном файле библиотеки).
+func (s *Service) ExportProducts(ctx context.Context, w io.Writer, format string, req *productDto.ExportProductsReq) error {
+	filter, err := s.productExportFilter(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return writeExport(w, format, productExportColumns, func(write exportRecordFunc) error {
+		return s.storer.ExportProducts(ctx, filter, func(products []*domain.Product) error {
+			for _, p := range products {
+				if err := write(mapper.MapToProductRes(p), productExportRow(p)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (s *Service) productExportFilter(ctx context.Context, req *productDto.ExportProductsReq) (storer.ProductExportFilter, error) {
+	filter := storer.ProductExportFilter{
+		UpdatedSince:   req.UpdatedSince,
+		InStock:        req.InStock,
+		IncludeDeleted: req.IncludeDeleted,
+	}
+	if req.Category != "" {
+		c, err := s.storer.GetCategoryBySlug(ctx, req.Category)
+		if err != nil {
+			return filter, fromStorerError(err)
+		}
+		filter.CategoryID = c.ID
+	}
+	return filter, nil
+}
+
+// ExportOrders пишет заказы с позициями в w. Фильтры те же, что у списка заказов, страница не учитывается.
+func (s *Service) ExportOrders(ctx context.Context, w io.Writer, format string, req *orderDto.GetOrdersReq) error {
+	op := "exportOrders"
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		return NewErrValidation(op, "from must be before to", nil)
+	}
+	if req.MinTotal != nil && req.MaxTotal != nil && *req.MinTotal > *req.MaxTotal {
+		return NewErrValidation(op, "min_total must not exceed max_total", nil)
+	}
+	filter := storer.OrderFilter{
+		UserID:   req.UserID,
+		Status:   req.Status,
+		From:     req.From,
+		To:       req.To,
+		MinTotal: req.MinTotal,
+		MaxTotal: req.MaxTotal,
+	}
+
+	return writeExport(w, format, orderExportColumns, func(write exportRecordFunc) error {
+		return s.storer.ExportOrders(ctx, filter, func(orders []*domain.Order) error {
+			for _, order := range orders {
+				if err := write(mapper.MapToOrderRes(order), orderExportRows(order)...); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// exportRecordFunc пишет одну запись: object уходит в JSON Lines, rows - в табличные форматы.
+type exportRecordFunc func(object interface{}, rows ...[]interface{}) error
+
+func writeExport(w io.Writer, format string, columns []string, export func(exportRecordFunc) error) error {
+	if _, err := ExportContentType(format); err != nil {
+		return err
+	}
+
+	switch format {
+	case ExportFormatJSONL:
+		buf := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buf)
+		err := export(func(object interface{}, _ ...[]interface{}) error {
+			return encoder.Encode(object)
+		})
+		if err != nil {
+			return err
+		}
+		return buf.Flush()
+
+	case ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+		record := make([]string, len(columns))
+		err := export(func(_ interface{}, rows ...[]interface{}) error {
+			for _, row := range rows {
+				for i, value := range row {
+					record[i] = csvExportValue(value)
+				}
+				if err := writer.Write(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return writeXLSXExport(w, columns, export)
+}
+
+// writeXLSXExport пишет лист через потоковый writer excelize: строки уходят во временный файл,
+// а в w книга записывается целиком в конце, поэтому ошибка выгрузки не оставляет клиенту обрезанный файл.
+func writeXLSXExport(w io.Writer, columns []string, export func(exportRecordFunc) error) error {
+	op := "exportXLSX"
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+	stream, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return fmt.Errorf("error creating xlsx sheet: %w", err)
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+	if err := stream.SetRow("A1", header); err != nil {
+		return fmt.Errorf("error writing xlsx header: %w", err)
+	}
+	rowNumber := 1
+	err = export(func(_ interface{}, rows ...[]interface{}) error {
+		for _, row := range rows {
+			rowNumber++
+			if rowNumber > excelize.TotalRows {
+				return NewErrValidation(op, fmt.Sprintf("xlsx is limited to %d rows, use csv or jsonl", excelize.TotalRows), nil)
+			}
+			cell, err := excelize.CoordinatesToCellName(1, rowNumber)
+			if err != nil {
+				return err
+			}
+			if err := stream.SetRow(cell, row); err != nil {
+				return fmt.Errorf("error writing xlsx row %d: %w", rowNumber, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := stream.Flush(); err != nil {
+		return fmt.Errorf("error flushing xlsx sheet: %w", err)
+	}
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("error writing xlsx: %w", err)
+	}
+	return nil
+}
+
+func productExportRow(p *domain.Product) []interface{} {
+	return []interface{}{p.ID, optional(p.SKU), p.Name, p.Image, p.CategoryID, p.Description, p.Price, p.CountInStock,
+		p.Rating, p.NumReviews, p.Version, p.CreatedAt, optional(p.UpdatedAt), optional(p.DeletedAt)}
+}
+
+func orderExportRows(order *domain.Order) [][]interface{} {
+	orderFields := []interface{}{order.ID, order.UserID, order.Status, order.PaymentMethod, order.TaxPrice, order.ShippingPrice,
+		order.TotalPrice, order.RefundedPrice, order.CreatedAt, optional(order.UpdatedAt)}
+	if len(order.Items) == 0 {
+		return [][]interface{}{append(orderFields, nil, nil, nil, nil, nil, nil)}
+	}
+	rows := make([][]interface{}, 0, len(order.Items))
+	for _, item := range order.Items {
+		row := append(append([]interface{}{}, orderFields...),
+			item.ID, item.ProductID, optional(item.VariantID), item.Name, item.Quantity, item.Price)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// optional разыменовывает необязательное поле: nil дает пустую ячейку.
+func optional[T any](value *T) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// csvExportValue форматирует ячейку CSV. Строка, которую Excel или LibreOffice приняли бы за формулу
+// (например, название товара "=HYPERLINK(...)"), экранируется апострофом. Числа не трогаются: "-5" - не формула.
+func csvExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
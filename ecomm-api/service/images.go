@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"ecomm/domain"
+	"ecomm/ecomm-api/blobstore"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/mapper"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MaxImageSize   = 10 << 20
+	maxImagePixels = 40_000_000 // Защита от "бомб": маленький файл, который распаковывается в гигабайты
+	thumbnailSize  = 320
+)
+
+// Тип картинки определяется по содержимому, а не по заголовкам клиента
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// UploadProductImage сохраняет картинку и ее уменьшенную копию в BlobStore и добавляет ее в конец списка картинок товара.
+// Первая загруженная картинка становится главной - Product.Image.
+func (s *Service) UploadProductImage(ctx context.Context, productID int64, data []byte) (productDto.ProductImageRes, error) {
+	op := "uploadProductImage"
+
+	if len(data) > MaxImageSize {
+		return productDto.ProductImageRes{}, NewErrPayloadTooLarge(op, fmt.Sprintf("image must not exceed %d bytes", MaxImageSize))
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return productDto.ProductImageRes{}, NewErrUnsupportedMediaType(op, fmt.Sprintf("%s is not a supported image type", contentType))
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return productDto.ProductImageRes{}, NewErrValidation(op, "invalid image", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return productDto.ProductImageRes{}, NewErrPayloadTooLarge(op, fmt.Sprintf("image must not exceed %d pixels", maxImagePixels))
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return productDto.ProductImageRes{}, NewErrValidation(op, "invalid image", err)
+	}
+	thumbnail, thumbnailExt, err := encodeThumbnail(img, contentType)
+	if err != nil {
+		return productDto.ProductImageRes{}, err
+	}
+
+	if _, err := s.storer.GetProduct(ctx, productID); err != nil {
+		return productDto.ProductImageRes{}, fromStorerError(err)
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return productDto.ProductImageRes{}, err
+	}
+	productImage := &domain.ProductImage{
+		ProductID:    productID,
+		BlobKey:      path.Join("products", fmt.Sprint(productID), name+ext),
+		ThumbnailKey: path.Join("products", fmt.Sprint(productID), name+"_thumb"+thumbnailExt),
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		Width:        int64(config.Width),
+		Height:       int64(config.Height),
+	}
+	if err := s.blobs.Put(ctx, productImage.BlobKey, bytes.NewReader(data)); err != nil {
+		return productDto.ProductImageRes{}, err
+	}
+	if err := s.blobs.Put(ctx, productImage.ThumbnailKey, bytes.NewReader(thumbnail)); err != nil {
+		s.deleteImageBlobs(ctx, productImage)
+		return productDto.ProductImageRes{}, err
+	}
+
+	created, err := s.storer.CreateProductImage(ctx, productImage, mapper.ImagesPath)
+	if err != nil {
+		s.deleteImageBlobs(ctx, productImage)
+		return productDto.ProductImageRes{}, fromStorerError(err)
+	}
+	return mapper.MapToProductImageRes(created), nil
+}
+
+func (s *Service) GetProductImages(ctx context.Context, productID int64) ([]productDto.ProductImageRes, error) {
+	if _, err := s.storer.GetProduct(ctx, productID); err != nil {
+		return []productDto.ProductImageRes{}, fromStorerError(err)
+	}
+	images, err := s.storer.GetProductImages(ctx, productID)
+	if err != nil {
+		return []productDto.ProductImageRes{}, err
+	}
+	return mapper.MapToProductImageResList(images), nil
+}
+
+// ReorderProductImages задает новый порядок картинок: первая в списке становится главной.
+func (s *Service) ReorderProductImages(ctx context.Context, productID int64, reorderReq *productDto.ReorderProductImagesReq) ([]productDto.ProductImageRes, error) {
+	op := "reorderProductImages"
+	images, err := s.storer.GetProductImages(ctx, productID)
+	if err != nil {
+		return []productDto.ProductImageRes{}, err
+	}
+
+	current := make([]int64, 0, len(images))
+	for _, img := range images {
+		current = append(current, img.ID)
+	}
+	requested := slices.Clone(reorderReq.ImageIDs)
+	slices.Sort(current)
+	slices.Sort(requested)
+	if !slices.Equal(current, requested) {
+		return []productDto.ProductImageRes{}, NewErrValidation(op, "image_ids must list every image of the product exactly once", nil)
+	}
+
+	images, err = s.storer.ReorderProductImages(ctx, productID, reorderReq.ImageIDs, mapper.ImagesPath)
+	if err != nil {
+		return []productDto.ProductImageRes{}, fromStorerError(err)
+	}
+	return mapper.MapToProductImageResList(images), nil
+}
+
+func (s *Service) DeleteProductImage(ctx context.Context, productID int64, id int64) error {
+	img, err := s.storer.DeleteProductImage(ctx, productID, id, mapper.ImagesPath)
+	if err != nil {
+		return fromStorerError(err)
+	}
+	s.deleteImageBlobs(ctx, img)
+	return nil
+}
+
+// OpenImage открывает сохраненный файл картинки или миниатюры по ключу.
+func (s *Service) OpenImage(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	op := "openImage"
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		return nil, "", NewErrNotFound(op, "image", key, nil)
+	}
+	r, err := s.blobs.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrNotFound) || errors.Is(err, blobstore.ErrInvalidKey) {
+		return nil, "", NewErrNotFound(op, "image", key, err)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return r, contentType, nil
+}
+
+// deleteImageBlobs удаляет файлы картинки. Ошибка только логируется:
+// запись о картинке уже удалена или не создана, а лишний файл ничего не ломает.
+func (s *Service) deleteImageBlobs(ctx context.Context, img *domain.ProductImage) {
+	for _, key := range []string{img.BlobKey, img.ThumbnailKey} {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			log.Printf("error deleting image blob %s: %v", key, err)
+		}
+	}
+}
+
+// encodeThumbnail уменьшает картинку так, чтобы она помещалась в квадрат thumbnailSize, сохраняя пропорции.
+// Фотографии остаются в JPEG, остальное сохраняется в PNG, чтобы не потерять прозрачность.
+func encodeThumbnail(img image.Image, contentType string) ([]byte, string, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > thumbnailSize || height > thumbnailSize {
+		if width >= height {
+			width, height = thumbnailSize, max(1, height*thumbnailSize/width)
+		} else {
+			width, height = max(1, width*thumbnailSize/height), thumbnailSize
+		}
+	}
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", fmt.Errorf("error encoding thumbnail: %w", err)
+		}
+		return buf.Bytes(), ".jpg", nil
+	}
+	if err := png.Encode(&buf, thumbnail); err != nil {
+		return nil, "", fmt.Errorf("error encoding thumbnail: %w", err)
+	}
+	return buf.Bytes(), ".png", nil
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating image name: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"ecomm/domain"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/storer"
+	"ecomm/mapper"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	ImportFormatCSV        = "csv"
+	ImportFormatJSONL      = "jsonl"
+	DefaultImportChunkSize = 500
+	maxImportChunkSize     = 5000
+	maxImportErrors        = 1000    // Больше ошибок в отчет не попадает, чтобы сломанный файл не дал ответ в сотни мегабайт
+	maxImportLineSize      = 1 << 20 // Максимальная длина строки JSON Lines
+)
+
+type ImportOptions struct {
+	Format    string
+	DryRun    bool
+	ChunkSize int
+}
+
+// importRowError - ошибка разбора одной строки файла: строка попадает в отчет, импорт продолжается.
+type importRowError struct {
+	line int
+	err  error
+}
+
+func (e *importRowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+// importRowReader возвращает строки файла по одной, io.EOF - конец файла.
+type importRowReader func() (int, *productDto.ImportProductRow, error)
+
+// ImportProducts читает товары из r построчно и сохраняет их пачками по opts.ChunkSize.
+// Файл целиком в память не загружается. Ошибки отдельных строк собираются в отчет,
+// а ошибка формата всего файла (например, неизвестная колонка CSV) прерывает импорт.
+// Уже сохраненные пачки при этом остаются в базе.
+func (s *Service) ImportProducts(ctx context.Context, r io.Reader, opts ImportOptions) (productDto.ImportReportRes, error) {
+	op := "importProducts"
+	report := productDto.ImportReportRes{DryRun: opts.DryRun, Errors: []productDto.ImportRowErrorRes{}}
+
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultImportChunkSize
+	}
+	if chunkSize < 0 || chunkSize > maxImportChunkSize {
+		return report, NewErrValidation(op, fmt.Sprintf("chunk size must be between 1 and %d", maxImportChunkSize), nil)
+	}
+
+	var next importRowReader
+	switch opts.Format {
+	case ImportFormatCSV:
+		reader, err := newCSVImportReader(op, r)
+		if err != nil {
+			return report, err
+		}
+		next = reader
+	case ImportFormatJSONL:
+		next = newJSONLImportReader(op, r)
+	default:
+		return report, NewErrValidation(op, fmt.Sprintf("format must be %s or %s", ImportFormatCSV, ImportFormatJSONL), nil)
+	}
+
+	categories := map[string]int64{}
+	chunk := make([]storer.ImportRow, 0, chunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		results, err := s.storer.ImportProducts(ctx, chunk, opts.DryRun)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			switch {
+			case result.Err != nil:
+				addImportError(&report, result.Line, result.Err)
+			case result.Created:
+				report.Created++
+			default:
+				report.Updated++
+			}
+		}
+		chunk = chunk[:0]
+		return nil
+	}
+
+	for {
+		line, row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr *importRowError
+		if errors.As(err, &rowErr) {
+			report.Total++
+			addImportError(&report, rowErr.line, rowErr.err)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Total++
+		p, err := s.productFromImportRow(ctx, op, row, categories)
+		if err != nil {
+			addImportError(&report, line, err)
+			continue
+		}
+		chunk = append(chunk, storer.ImportRow{Line: line, Product: p})
+		if len(chunk) == chunkSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// productFromImportRow проверяет строку так же, как создание товара через API.
+// Категории по slug кэшируются: в файле обычно много товаров одной категории.
+func (s *Service) productFromImportRow(ctx context.Context, op string, row *productDto.ImportProductRow, categories map[string]int64) (*domain.Product, error) {
+	categoryID := row.CategoryID
+	if row.Category != "" {
+		if categoryID != 0 {
+			return nil, NewErrValidation(op, "category and category_id are mutually exclusive", nil)
+		}
+		id, ok := categories[row.Category]
+		if !ok {
+			c, err := s.storer.GetCategoryBySlug(ctx, row.Category)
+			if err != nil {
+				return nil, fromStorerError(err)
+			}
+			id = c.ID
+			categories[row.Category] = id
+		}
+		categoryID = id
+	}
+
+	p := mapper.MapToProductFromImportProductRow(row, categoryID)
+	if err := validateProduct(op, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// addImportError добавляет ошибку строки в отчет. Failed считает все ошибки, даже не вошедшие в отчет.
+func addImportError(report *productDto.ImportReportRes, line int, err error) {
+	report.Failed++
+	if len(report.Errors) >= maxImportErrors {
+		report.ErrorsTruncated = true
+		return
+	}
+	report.Errors = append(report.Errors, productDto.ImportRowErrorRes{Line: line, Message: importErrorMessage(err)})
+}
+
+var importCSVColumns = []string{"sku", "name", "image", "category", "category_id", "description", "price", "count_in_stock"}
+
+// newCSVImportReader читает CSV с заголовком. Порядок колонок любой, лишние колонки запрещены,
+// чтобы опечатка в заголовке не превратилась в молча пустое поле.
+func newCSVImportReader(op string, r io.Reader) (importRowReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, NewErrValidation(op, "csv header is required", nil)
+	}
+	if err != nil {
+		return nil, csvImportError(op, err)
+	}
+	// Запись переиспользуется следующим Read, поэтому запоминаем только число колонок
+	fieldCount := len(header)
+	columns := make(map[string]int, fieldCount)
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // BOM, который добавляет Excel
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(importCSVColumns, name) {
+			return nil, NewErrValidation(op, fmt.Sprintf("unknown csv column %q", name), nil)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, NewErrValidation(op, fmt.Sprintf("duplicate csv column %q", name), nil)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, NewErrValidation(op, "csv column \"name\" is required", nil)
+	}
+
+	return func() (int, *productDto.ImportProductRow, error) {
+		for {
+			record, err := reader.Read()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return 0, nil, io.EOF
+				}
+				return 0, nil, csvImportError(op, err)
+			}
+			line, _ := reader.FieldPos(0)
+			if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+				continue
+			}
+			if len(record) != fieldCount {
+				return line, nil, &importRowError{line: line,
+					err: NewErrValidation(op, fmt.Sprintf("expected %d fields, got %d", fieldCount, len(record)), nil)}
+			}
+			row, err := csvImportRow(op, columns, record)
+			if err != nil {
+				return line, nil, &importRowError{line: line, err: err}
+			}
+			return line, row, nil
+		}
+	}, nil
+}
+
+func csvImportRow(op string, columns map[string]int, record []string) (*productDto.ImportProductRow, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	row := &productDto.ImportProductRow{
+		SKU:         field("sku"),
+		Name:        field("name"),
+		Image:       field("image"),
+		Category:    strings.TrimSpace(field("category")),
+		Description: field("description"),
+	}
+
+	var err error
+	if value := strings.TrimSpace(field("category_id")); value != "" {
+		if row.CategoryID, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, NewErrValidation(op, "category_id must be an integer", err)
+		}
+	}
+	if value := strings.TrimSpace(field("price")); value != "" {
+		if row.Price, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, NewErrValidation(op, "price must be a number", err)
+		}
+	}
+	if value := strings.TrimSpace(field("count_in_stock")); value != "" {
+		if row.CountInStock, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, NewErrValidation(op, "count_in_stock must be an integer", err)
+		}
+	}
+	return row, nil
+}
+
+// csvImportError - синтаксическая ошибка CSV (например, незакрытая кавычка): после нее
+// границы строк уже не определить, поэтому импорт прерывается.
+func csvImportError(op string, err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return NewErrValidation(op, fmt.Sprintf("invalid csv at line %d: %v", parseErr.StartLine, parseErr.Err), err)
+	}
+	return err
+}
+
+// newJSONLImportReader читает JSON Lines: один объект товара на строку, пустые строки пропускаются.
+func newJSONLImportReader(op string, r io.Reader) importRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineSize)
+	line := 0
+
+	return func() (int, *productDto.ImportProductRow, error) {
+		for scanner.Scan() {
+			line++
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			row := &productDto.ImportProductRow{}
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(row); err != nil {
+				return line, nil, &importRowError{line: line, err: NewErrValidation(op, "invalid json", err)}
+			}
+			row.Category = strings.TrimSpace(row.Category)
+			return line, row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return 0, nil, NewErrValidation(op, fmt.Sprintf("line %d exceeds %d bytes", line+1, maxImportLineSize), err)
+			}
+			return 0, nil, err
+		}
+		return 0, nil, io.EOF
+	}
+}
+
+// importErrorMessage - текст ошибки строки для отчета. Внутренние ошибки не раскрываются клиенту.
+func importErrorMessage(err error) string {
+	var (
+		errValidation  *ErrValidation
+		errConflict    *ErrConflict
+		errNotFound    *ErrNotFound
+		ambiguousMatch *storer.AmbiguousMatchError
+	)
+	err = fromStorerError(err)
+	switch {
+	case errors.As(err, &errValidation):
+		if errValidation.Err != nil {
+			return fmt.Sprintf("%s: %v", errValidation.Message, errValidation.Err)
+		}
+		return errValidation.Message
+	case errors.As(err, &errConflict):
+		return errConflict.Message
+	case errors.As(err, &errNotFound):
+		return fmt.Sprintf("%s with id %v not found", errNotFound.Resource, errNotFound.ID)
+	case errors.As(err, &ambiguousMatch):
+		return fmt.Sprintf("%d %s match %v, set sku to choose one", ambiguousMatch.Count, ambiguousMatch.Resource, ambiguousMatch.Key)
+	}
+	log.Printf("error importing product: %v", err)
+	return "internal error"
+}
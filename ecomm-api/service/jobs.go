@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"ecomm/domain"
+	jobDto "ecomm/ecomm-api/handler/dto/job"
+	"ecomm/ecomm-api/storer"
+	"ecomm/mapper"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	DefaultJobsLimit = 50
+	MaxJobsLimit     = 500
+)
+
+// GetJobs - задачи фоновой очереди, новые первыми. Пустые status и jobType не ограничивают выборку.
+func (s *Service) GetJobs(ctx context.Context, status string, jobType string, limit int64) ([]jobDto.JobRes, error) {
+	op := "getJobs"
+	if status != "" && !slices.Contains(domain.JobStatuses, status) {
+		return nil, NewErrValidation(op, fmt.Sprintf("unknown job status %q, expected one of %s",
+			status, strings.Join(domain.JobStatuses, ", ")), nil)
+	}
+	switch {
+	case limit == 0:
+		limit = DefaultJobsLimit
+	case limit < 0 || limit > MaxJobsLimit:
+		return nil, NewErrValidation(op, fmt.Sprintf("limit must be between 1 and %d", MaxJobsLimit), nil)
+	}
+
+	jobs, err := s.storer.GetJobs(ctx, storer.JobFilter{Status: status, Type: jobType, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToJobResList(jobs), nil
+}
+
+func (s *Service) GetJob(ctx context.Context, id int64) (jobDto.JobRes, error) {
+	job, err := s.storer.GetJob(ctx, id)
+	if err != nil {
+		return jobDto.JobRes{}, fromStorerError(err)
+	}
+	return mapper.MapToJobRes(job), nil
+}
+
+// RetryJob возвращает задачу из dead в очередь с полным набором попыток.
+func (s *Service) RetryJob(ctx context.Context, id int64) (jobDto.JobRes, error) {
+	op := "retryJob"
+	job, err := s.storer.GetJob(ctx, id)
+	if err != nil {
+		return jobDto.JobRes{}, fromStorerError(err)
+	}
+	if job.Status != domain.JobDead {
+		return jobDto.JobRes{}, NewErrConflict(op, "job",
+			fmt.Sprintf("job with id %d is %s, only dead jobs can be retried", id, job.Status), nil)
+	}
+
+	job, err = s.storer.RetryJob(ctx, id)
+	if err != nil {
+		return jobDto.JobRes{}, fromStorerError(err)
+	}
+	return mapper.MapToJobRes(job), nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"ecomm/domain"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	"ecomm/ecomm-api/storer"
+	"ecomm/ecomm-api/token"
+	"ecomm/mapper"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	defaultOrdersPageSize = 20
+	maxOrdersPageSize     = 100
+)
+
+// Отменить можно только ещё не отправленный заказ. Заказ в pending может ждать ответа шлюза:
+// storer.CancelOrder закрывает его платеж, а CompleteOrderPayment и FailOrderPayment
+// под блокировкой заказа не трогают уже отмененный заказ.
+var cancellableOrderStatuses = []string{
+	domain.OrderStatusPending,
+	domain.OrderStatusPaid,
+	domain.OrderStatusPaymentFailed,
+}
+
+// CancelOrder отменяет заказ покупателя (или любой заказ, если отменяет администратор),
+// возвращает товары на склад и деньги за оплаченный заказ.
+func (s *Service) CancelOrder(ctx context.Context, id int64, user *token.UserClaims, cancelOrderReq *orderDto.CancelOrderReq) (orderDto.OrderRes, error) {
+	op := "cancelOrder"
+
+	reason := strings.TrimSpace(cancelOrderReq.Reason)
+	if reason == "" {
+		return orderDto.OrderRes{}, NewErrValidation(op, "cancellation reason is required", nil)
+	}
+
+	if _, err := s.getOwnedOrder(ctx, op, id, user); err != nil {
+		return orderDto.OrderRes{}, err
+	}
+
+	_, refund, err := s.storer.CancelOrder(ctx, id, cancellableOrderStatuses, reason, checkRefundAmount(op, true))
+	if err != nil {
+		return orderDto.OrderRes{}, fromStorerError(err)
+	}
+	// Заказ уже отменен: если вернуть деньги сейчас не вышло, возврат виден в заказе со своим статусом
+	if refund != nil {
+		if err := s.settleRefund(ctx, op, refund); err != nil {
+			log.Printf("refund %d for cancelled order %d is not settled: %v", refund.ID, id, err)
+		}
+	}
+
+	order, err := s.storer.GetOrder(ctx, id)
+	if err != nil {
+		return orderDto.OrderRes{}, fromStorerError(err)
+	}
+	return mapper.MapToOrderRes(order), nil
+}
+
+const maxTrackingNumberLength = 128
+
+// ShipOrder отмечает оплаченный заказ отправленным. Покупатель получит письмо с трек-номером.
+func (s *Service) ShipOrder(ctx context.Context, id int64, shipOrderReq *orderDto.ShipOrderReq) (orderDto.OrderRes, error) {
+	op := "shipOrder"
+	var trackingNumber *string
+	if value := strings.TrimSpace(shipOrderReq.TrackingNumber); value != "" {
+		if len(value) > maxTrackingNumberLength {
+			return orderDto.OrderRes{}, NewErrValidation(op,
+				fmt.Sprintf("tracking number must be at most %d characters", maxTrackingNumberLength), nil)
+		}
+		trackingNumber = &value
+	}
+
+	if _, err := s.storer.ShipOrder(ctx, id, trackingNumber); err != nil {
+		return orderDto.OrderRes{}, fromStorerError(err)
+	}
+	order, err := s.storer.GetOrder(ctx, id)
+	if err != nil {
+		return orderDto.OrderRes{}, fromStorerError(err)
+	}
+	return mapper.MapToOrderRes(order), nil
+}
+
+// GetOrder отдаёт заказ его владельцу или администратору.
+func (s *Service) GetOrder(ctx context.Context, id int64, user *token.UserClaims) (orderDto.OrderRes, error) {
+	order, err := s.getOwnedOrder(ctx, "getOrder", id, user)
+	if err != nil {
+		return orderDto.OrderRes{}, err
+	}
+	return mapper.MapToOrderRes(order), nil
+}
+
+// GetMyOrders - история заказов текущего пользователя.
+func (s *Service) GetMyOrders(ctx context.Context, user *token.UserClaims, getOrdersReq *orderDto.GetOrdersReq) (orderDto.OrdersPageRes, error) {
+	req := *getOrdersReq
+	req.UserID = user.ID
+	return s.getOrdersPage(ctx, "getMyOrders", &req)
+}
+
+// GetOrders - список всех заказов для администратора.
+func (s *Service) GetOrders(ctx context.Context, getOrdersReq *orderDto.GetOrdersReq) (orderDto.OrdersPageRes, error) {
+	return s.getOrdersPage(ctx, "getOrders", getOrdersReq)
+}
+
+func (s *Service) getOrdersPage(ctx context.Context, op string, getOrdersReq *orderDto.GetOrdersReq) (orderDto.OrdersPageRes, error) {
+	page, pageSize := getOrdersReq.Page, getOrdersReq.PageSize
+	if page == 0 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = defaultOrdersPageSize
+	}
+	if page < 0 || pageSize < 0 || pageSize > maxOrdersPageSize {
+		return orderDto.OrdersPageRes{}, NewErrValidation(op,
+			fmt.Sprintf("page must be positive and page_size between 1 and %d", maxOrdersPageSize), nil)
+	}
+	if getOrdersReq.From != nil && getOrdersReq.To != nil && !getOrdersReq.From.Before(*getOrdersReq.To) {
+		return orderDto.OrdersPageRes{}, NewErrValidation(op, "from must be before to", nil)
+	}
+	if getOrdersReq.MinTotal != nil && getOrdersReq.MaxTotal != nil && *getOrdersReq.MinTotal > *getOrdersReq.MaxTotal {
+		return orderDto.OrdersPageRes{}, NewErrValidation(op, "min_total must not exceed max_total", nil)
+	}
+
+	filter := storer.OrderFilter{
+		UserID:   getOrdersReq.UserID,
+		Status:   getOrdersReq.Status,
+		From:     getOrdersReq.From,
+		To:       getOrdersReq.To,
+		MinTotal: getOrdersReq.MinTotal,
+		MaxTotal: getOrdersReq.MaxTotal,
+	}
+	total, err := s.storer.CountOrders(ctx, filter)
+	if err != nil {
+		return orderDto.OrdersPageRes{}, err
+	}
+
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+	orders, err := s.storer.GetOrders(ctx, filter)
+	if err != nil {
+		return orderDto.OrdersPageRes{}, err
+	}
+
+	return orderDto.OrdersPageRes{
+		Orders:   mapper.MapToOrderResList(orders),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// getOwnedOrder загружает заказ и проверяет, что пользователь - его владелец или администратор.
+func (s *Service) getOwnedOrder(ctx context.Context, op string, id int64, user *token.UserClaims) (*domain.Order, error) {
+	order, err := s.storer.GetOrder(ctx, id)
+	if err != nil {
+		return nil, fromStorerError(err)
+	}
+	if !user.IsAdmin && order.UserID != user.ID {
+		return nil, NewErrForbidden(op, "order belongs to another user")
+	}
+	return order, nil
+}
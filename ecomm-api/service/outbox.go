@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	outboxDto "ecomm/ecomm-api/handler/dto/outbox"
+	"ecomm/mapper"
+	"fmt"
+)
+
+const (
+	DefaultDeadOutboxEventsLimit = 50
+	MaxDeadOutboxEventsLimit     = 500
+)
+
+// GetDeadOutboxEvents - события, которые relay отложил, исчерпав попытки, старые первыми.
+func (s *Service) GetDeadOutboxEvents(ctx context.Context, limit int64) ([]outboxDto.OutboxEventRes, error) {
+	op := "getDeadOutboxEvents"
+	switch {
+	case limit == 0:
+		limit = DefaultDeadOutboxEventsLimit
+	case limit < 0 || limit > MaxDeadOutboxEventsLimit:
+		return nil, NewErrValidation(op, fmt.Sprintf("limit must be between 1 and %d", MaxDeadOutboxEventsLimit), nil)
+	}
+
+	events, err := s.storer.GetDeadOutboxEvents(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToOutboxEventResList(events), nil
+}
+
+// RetryOutboxEvent возвращает отложенное событие в очередь relay с полным набором попыток.
+func (s *Service) RetryOutboxEvent(ctx context.Context, id int64) (outboxDto.OutboxEventRes, error) {
+	event, err := s.storer.RetryOutboxEvent(ctx, id)
+	if err != nil {
+		return outboxDto.OutboxEventRes{}, fromStorerError(err)
+	}
+	return mapper.MapToOutboxEventRes(event), nil
+}
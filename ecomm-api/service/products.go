@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"ecomm/domain"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/storer"
+	"ecomm/mapper"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// PatchProduct применяет JSON Merge Patch к товару версии version.
+// Проверяется товар целиком после слияния, а в базе меняются только присланные поля.
+func (s *Service) PatchProduct(ctx context.Context, id int64, version int64, patch *productDto.PatchProductReq) (productDto.ProductRes, error) {
+	op := "patchProduct"
+	p, err := s.storer.GetProduct(ctx, id)
+	if err != nil {
+		return productDto.ProductRes{}, fromStorerError(err)
+	}
+	if p.Version != version {
+		return productDto.ProductRes{}, NewErrPreconditionFailed(op,
+			fmt.Sprintf("product with id %d has been modified, current version is %d", id, p.Version), nil)
+	}
+
+	mapper.ApplyPatchProductReq(p, patch)
+	if err := validateProduct(op, p); err != nil {
+		return productDto.ProductRes{}, err
+	}
+
+	changes := mapper.MapToProductChangesFromPatchProductReq(patch)
+	if len(changes) == 0 {
+		return mapper.MapToProductRes(p), nil
+	}
+
+	p, err = s.storer.PatchProduct(ctx, id, version, changes)
+	if err != nil {
+		return productDto.ProductRes{}, fromStorerError(err)
+	}
+	return mapper.MapToProductRes(p), nil
+}
+
+// RestoreProduct возвращает в каталог мягко удаленный товар.
+func (s *Service) RestoreProduct(ctx context.Context, id int64) (productDto.ProductRes, error) {
+	p, err := s.storer.RestoreProduct(ctx, id)
+	if err != nil {
+		return productDto.ProductRes{}, fromStorerError(err)
+	}
+	return mapper.MapToProductRes(p), nil
+}
+
+// AdjustProductStock меняет остаток товара на delta: положительная - приход, отрицательная - списание.
+func (s *Service) AdjustProductStock(ctx context.Context, id int64, delta int64) (productDto.ProductRes, error) {
+	op := "adjustProductStock"
+	if delta == 0 {
+		return productDto.ProductRes{}, NewErrValidation(op, "delta must not be zero", nil)
+	}
+	p, _, err := s.storer.AdjustProductStock(ctx, id, nil, delta)
+	if err != nil {
+		return productDto.ProductRes{}, stockAdjustmentError(op, err)
+	}
+	return mapper.MapToProductRes(p), nil
+}
+
+// AdjustVariantStock меняет на delta остаток варианта товара.
+func (s *Service) AdjustVariantStock(ctx context.Context, productID int64, variantID int64, delta int64) (productDto.ProductVariantRes, error) {
+	op := "adjustVariantStock"
+	if delta == 0 {
+		return productDto.ProductVariantRes{}, NewErrValidation(op, "delta must not be zero", nil)
+	}
+	_, variant, err := s.storer.AdjustProductStock(ctx, productID, &variantID, delta)
+	if err != nil {
+		return productDto.ProductVariantRes{}, stockAdjustmentError(op, err)
+	}
+	return mapper.MapToProductVariantRes(variant), nil
+}
+
+func stockAdjustmentError(op string, err error) error {
+	var insufficientStock *storer.InsufficientStockError
+	switch {
+	case errors.As(err, &insufficientStock) && insufficientStock.VariantID != nil:
+		return NewNotEnoughStock(op, "product variant", *insufficientStock.VariantID,
+			insufficientStock.Requested, insufficientStock.Available, err)
+	case errors.As(err, &insufficientStock):
+		return NewNotEnoughStock(op, "product", insufficientStock.ProductID,
+			insufficientStock.Requested, insufficientStock.Available, err)
+	}
+	return fromStorerError(err)
+}
+
+// ListProducts возвращает страницу каталога в порядке id. Категория включает подкатегории,
+// inStock == nil не фильтрует по остатку.
+func (s *Service) ListProducts(ctx context.Context, category string, inStock *bool, limit int, offset int) ([]productDto.ProductRes, error) {
+	filter, err := s.productExportFilter(ctx, &productDto.ExportProductsReq{Category: category})
+	if err != nil {
+		return nil, err
+	}
+	if inStock != nil {
+		filter.InStock, filter.OutOfStock = *inStock, !*inStock
+	}
+	products, err := s.storer.ListProducts(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToProductResList(products), nil
+}
+
+// Сколько товаров StreamProducts читает одним запросом
+const streamPageSize = 500
+
+// StreamProducts передает в fn товары по одному, читая их из базы страницами по id.
+// Между страницами транзакция не держится: медленный получатель не задерживает очистку базы,
+// зато товар, измененный во время чтения, может прийти уже в новом виде.
+// Ошибка fn прерывает чтение и возвращается как есть.
+func (s *Service) StreamProducts(ctx context.Context, req *productDto.ExportProductsReq, fn func(productDto.ProductRes) error) error {
+	filter, err := s.productExportFilter(ctx, req)
+	if err != nil {
+		return err
+	}
+	var afterID int64
+	for {
+		products, err := s.storer.GetProductsPage(ctx, filter, afterID, streamPageSize)
+		if err != nil {
+			return err
+		}
+		for _, p := range products {
+			if err := fn(mapper.MapToProductRes(p)); err != nil {
+				return err
+			}
+		}
+		if len(products) < streamPageSize {
+			return nil
+		}
+		afterID = products[len(products)-1].ID
+	}
+}
+
+// Совпадает с размером колонки products.sku
+const maxSKULength = 64
+
+func validateProduct(op string, p *domain.Product) error {
+	switch {
+	case p.Name == "":
+		return NewErrValidation(op, "name is required", nil)
+	case p.Image == "":
+		return NewErrValidation(op, "image is required", nil)
+	case p.CategoryID <= 0:
+		return NewErrValidation(op, "category_id is required", nil)
+	case p.Price < 0:
+		return NewErrValidation(op, "price must not be negative", nil)
+	case p.CountInStock < 0:
+		return NewErrValidation(op, "count_in_stock must not be negative", nil)
+	case p.SKU != nil && utf8.RuneCountInString(*p.SKU) > maxSKULength:
+		return NewErrValidation(op, fmt.Sprintf("sku must not exceed %d characters", maxSKULength), nil)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"ecomm/domain"
+	orderDto "ecomm/ecomm-api/handler/dto/order"
+	returnDto "ecomm/ecomm-api/handler/dto/returns"
+	"ecomm/ecomm-api/payments"
+	"ecomm/ecomm-api/storer"
+	"ecomm/ecomm-api/token"
+	"ecomm/mapper"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Вернуть можно оплаченный или уже отправленный заказ
+var returnableOrderStatuses = map[string]bool{
+	domain.OrderStatusPaid:    true,
+	domain.OrderStatusShipped: true,
+}
+
+func (s *Service) CreateReturn(ctx context.Context, orderID int64, user *token.UserClaims, createReturnReq *returnDto.CreateReturnReq) (returnDto.ReturnRes, error) {
+	op := "createReturn"
+
+	if createReturnReq.Quantity <= 0 {
+		return returnDto.ReturnRes{}, NewErrValidation(op, "invalid quantity", nil)
+	}
+	if strings.TrimSpace(createReturnReq.Reason) == "" {
+		return returnDto.ReturnRes{}, NewErrValidation(op, "reason is required", nil)
+	}
+
+	order, err := s.getOwnedOrder(ctx, op, orderID, user)
+	if err != nil {
+		return returnDto.ReturnRes{}, err
+	}
+	if !returnableOrderStatuses[order.Status] {
+		return returnDto.ReturnRes{}, NewErrConflict(op, "order",
+			fmt.Sprintf("order with id %d is %s and cannot be returned", order.ID, order.Status), nil)
+	}
+
+	ret, err := s.storer.CreateReturn(ctx, &domain.Return{
+		OrderID:     orderID,
+		OrderItemID: createReturnReq.OrderItemID,
+		Quantity:    createReturnReq.Quantity,
+		Reason:      strings.TrimSpace(createReturnReq.Reason),
+		Status:      domain.ReturnStatusRequested,
+	})
+	if err != nil {
+		var quantityError *storer.ReturnQuantityError
+		if errors.As(err, &quantityError) {
+			return returnDto.ReturnRes{}, NewErrValidation(op,
+				fmt.Sprintf("cannot return %d items, %d left to return", quantityError.Requested, quantityError.Available), err)
+		}
+		return returnDto.ReturnRes{}, fromStorerError(err)
+	}
+
+	return mapper.MapToReturnRes(ret), nil
+}
+
+func (s *Service) GetOrderReturns(ctx context.Context, orderID int64, user *token.UserClaims) ([]returnDto.ReturnRes, error) {
+	if _, err := s.getOwnedOrder(ctx, "getOrderReturns", orderID, user); err != nil {
+		return []returnDto.ReturnRes{}, err
+	}
+
+	returns, err := s.storer.GetReturnsByOrderID(ctx, orderID)
+	if err != nil {
+		return []returnDto.ReturnRes{}, err
+	}
+	return mapper.MapToReturnResList(returns), nil
+}
+
+func (s *Service) GetReturns(ctx context.Context, status string) ([]returnDto.ReturnRes, error) {
+	returns, err := s.storer.GetReturns(ctx, status)
+	if err != nil {
+		return []returnDto.ReturnRes{}, err
+	}
+	return mapper.MapToReturnResList(returns), nil
+}
+
+func (s *Service) ApproveReturn(ctx context.Context, id int64, reviewReturnReq *returnDto.ReviewReturnReq) (returnDto.ReturnRes, error) {
+	ret, err := s.storer.UpdateReturnStatus(ctx, id,
+		[]string{domain.ReturnStatusRequested}, domain.ReturnStatusApproved, reviewReturnReq.Note)
+	if err != nil {
+		return returnDto.ReturnRes{}, fromStorerError(err)
+	}
+	return mapper.MapToReturnRes(ret), nil
+}
+
+func (s *Service) RejectReturn(ctx context.Context, id int64, reviewReturnReq *returnDto.ReviewReturnReq) (returnDto.ReturnRes, error) {
+	ret, err := s.storer.UpdateReturnStatus(ctx, id,
+		[]string{domain.ReturnStatusRequested, domain.ReturnStatusApproved}, domain.ReturnStatusRejected, reviewReturnReq.Note)
+	if err != nil {
+		return returnDto.ReturnRes{}, fromStorerError(err)
+	}
+	return mapper.MapToReturnRes(ret), nil
+}
+
+// ReceiveReturn вызывается, когда товар физически пришёл на склад: он снова доступен к продаже.
+func (s *Service) ReceiveReturn(ctx context.Context, id int64, reviewReturnReq *returnDto.ReviewReturnReq) (returnDto.ReturnRes, error) {
+	ret, err := s.storer.ReceiveReturn(ctx, id, reviewReturnReq.Note)
+	if err != nil {
+		return returnDto.ReturnRes{}, fromStorerError(err)
+	}
+	return mapper.MapToReturnRes(ret), nil
+}
+
+func (s *Service) RefundReturn(ctx context.Context, id int64, refundReturnReq *returnDto.RefundReturnReq) (orderDto.RefundRes, error) {
+	op := "refundReturn"
+
+	if refundReturnReq.Amount != nil && *refundReturnReq.Amount <= 0 {
+		return orderDto.RefundRes{}, NewErrValidation(op, "invalid refund amount", nil)
+	}
+
+	ret, err := s.storer.GetReturn(ctx, id)
+	if err != nil {
+		return orderDto.RefundRes{}, fromStorerError(err)
+	}
+	order, err := s.storer.GetOrder(ctx, ret.OrderID)
+	if err != nil {
+		return orderDto.RefundRes{}, fromStorerError(err)
+	}
+
+	var amount float64
+	if refundReturnReq.Amount != nil {
+		amount = *refundReturnReq.Amount
+	} else {
+		index := slices.IndexFunc(order.Items, func(item domain.OrderItem) bool { return item.ID == ret.OrderItemID })
+		if index < 0 {
+			return orderDto.RefundRes{}, NewErrNotFound(op, "order item", ret.OrderItemID, nil)
+		}
+		item := order.Items[index]
+		amount = roundMoney(item.Price * float64(ret.Quantity) * (1 + taxRate))
+	}
+
+	refund, err := s.refund(ctx, op, &domain.Refund{
+		OrderID:  ret.OrderID,
+		ReturnID: &ret.ID,
+		Amount:   amount,
+		Reason:   fmt.Sprintf("return #%d: %s", ret.ID, ret.Reason),
+	}, false)
+	if err != nil {
+		return orderDto.RefundRes{}, err
+	}
+	return mapper.MapToRefundRes(refund), nil
+}
+
+// RefundOrder возвращает деньги по заказу без заявки на возврат, например в качестве компенсации.
+func (s *Service) RefundOrder(ctx context.Context, orderID int64, createRefundReq *orderDto.CreateRefundReq) (orderDto.RefundRes, error) {
+	op := "refundOrder"
+
+	var amount float64
+	if createRefundReq.Amount != nil {
+		if *createRefundReq.Amount <= 0 {
+			return orderDto.RefundRes{}, NewErrValidation(op, "invalid refund amount", nil)
+		}
+		amount = *createRefundReq.Amount
+	}
+
+	refund, err := s.refund(ctx, op, &domain.Refund{
+		OrderID: orderID,
+		Amount:  amount,
+		Reason:  strings.TrimSpace(createRefundReq.Reason),
+	}, createRefundReq.Amount == nil)
+	if err != nil {
+		return orderDto.RefundRes{}, err
+	}
+	return mapper.MapToRefundRes(refund), nil
+}
+
+// refund записывает возврат refund.Amount (при wholePayment - весь остаток платежа) и сразу проводит его через шлюз.
+// Если шлюз недоступен, возврат остается pending и его проведет SettlePendingRefunds.
+func (s *Service) refund(ctx context.Context, op string, refund *domain.Refund, wholePayment bool) (*domain.Refund, error) {
+	created, err := s.storer.CreateRefund(ctx, refund, checkRefundAmount(op, wholePayment))
+	if err != nil {
+		return nil, fromStorerError(err)
+	}
+	if err := s.settleRefund(ctx, op, created); err != nil {
+		var declined *ErrPaymentDeclined
+		if errors.As(err, &declined) {
+			return nil, err
+		}
+		log.Printf("refund %d for order %d is pending: %v", created.ID, created.OrderID, err)
+	}
+	return created, nil
+}
+
+// checkRefundAmount проверяет сумму по заблокированному платежу. При wholePayment сумма берется
+// из платежа - весь еще не возвращенный остаток.
+func checkRefundAmount(op string, wholePayment bool) storer.RefundFunc {
+	return func(payment *domain.Payment, refund *domain.Refund) error {
+		refundable := roundMoney(payment.CapturedAmount - payment.RefundedAmount)
+		if wholePayment {
+			refund.Amount = refundable
+		}
+		refund.Amount = roundMoney(refund.Amount)
+		if refund.Amount <= 0 || refund.Amount > refundable {
+			return NewErrValidation(op,
+				fmt.Sprintf("refund amount %.2f exceeds refundable amount %.2f", refund.Amount, refundable), nil)
+		}
+		return nil
+	}
+}
+
+// settleRefund возвращает деньги по записанному возврату через шлюз. Повторять безопасно:
+// шлюз узнает возврат по reference и не вернет деньги дважды.
+func (s *Service) settleRefund(ctx context.Context, op string, refund *domain.Refund) error {
+	payment, err := s.storer.GetPayment(ctx, refund.PaymentID)
+	if err != nil {
+		return err
+	}
+	// Платежи тестовых данных не проходили через шлюз, и шлюз не знает их авторизаций
+	if payment.Provider == domain.PaymentProviderSeed {
+		if err := s.storer.CompleteRefund(ctx, refund.ID, ""); err != nil {
+			return err
+		}
+		refund.Status = domain.RefundStatusSucceeded
+		return nil
+	}
+
+	tx, err := s.payments.Refund(ctx, payment.AuthorizationID, refund.Amount, refundReference(refund.ID))
+	var declined *payments.DeclinedError
+	if errors.As(err, &declined) {
+		if err := s.storer.FailRefund(ctx, refund.ID, declined.Error()); err != nil {
+			return err
+		}
+		refund.Status = domain.RefundStatusFailed
+		return NewErrPaymentDeclined(op, declined.Code, declined.Reason, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error refunding payment: %w", err)
+	}
+
+	if err := s.storer.CompleteRefund(ctx, refund.ID, tx.ID); err != nil {
+		return err
+	}
+	refund.Status = domain.RefundStatusSucceeded
+	refund.ProviderRefundID = tx.ID
+	return nil
+}
+
+// refundReference - ключ идемпотентности возврата в шлюзе, он же приходит в событии payment.refunded.
+func refundReference(id int64) string {
+	return fmt.Sprintf("refund-%d", id)
+}
+
+// pendingRefundsBatch - сколько возвратов проводит один запуск SettlePendingRefunds.
+const pendingRefundsBatch = 100
+
+// SettlePendingRefunds проводит через шлюз возвраты, которые не удалось провести сразу.
+// Отказ шлюза завершает возврат со статусом failed, остальные ошибки оставляют его до следующего запуска.
+func (s *Service) SettlePendingRefunds(ctx context.Context) (int, error) {
+	refunds, err := s.storer.GetPendingRefunds(ctx, pendingRefundsBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	var errs []error
+	for i := range refunds {
+		err := s.settleRefund(ctx, "settleRefunds", &refunds[i])
+		var declined *ErrPaymentDeclined
+		switch {
+		case errors.As(err, &declined):
+			log.Printf("refund %d for order %d declined: %v", refunds[i].ID, refunds[i].OrderID, err)
+		case err != nil:
+			errs = append(errs, fmt.Errorf("refund %d: %w", refunds[i].ID, err))
+		default:
+			settled++
+		}
+	}
+	return settled, errors.Join(errs...)
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"ecomm/domain"
+	reviewDto "ecomm/ecomm-api/handler/dto/review"
+	"ecomm/ecomm-api/storer"
+	"ecomm/ecomm-api/token"
+	"ecomm/mapper"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxReviewCommentLength = 2000
+
+// Оставить отзыв может только тот, кто купил товар: заказ оплачен или уже отправлен
+var purchasedOrderStatuses = []string{domain.OrderStatusPaid, domain.OrderStatusShipped}
+
+func (s *Service) CreateReview(ctx context.Context, productID int64, user *token.UserClaims, createReviewReq *reviewDto.CreateReviewReq) (reviewDto.ReviewRes, error) {
+	op := "createReview"
+
+	comment := strings.TrimSpace(createReviewReq.Comment)
+	switch {
+	case createReviewReq.Rating < 1 || createReviewReq.Rating > 5:
+		return reviewDto.ReviewRes{}, NewErrValidation(op, "rating must be between 1 and 5", nil)
+	case utf8.RuneCountInString(comment) > maxReviewCommentLength:
+		return reviewDto.ReviewRes{}, NewErrValidation(op, "comment is too long", nil)
+	}
+
+	if _, err := s.storer.GetProduct(ctx, productID); err != nil {
+		return reviewDto.ReviewRes{}, fromStorerError(err)
+	}
+	purchased, err := s.storer.HasPurchasedProduct(ctx, user.ID, productID, purchasedOrderStatuses)
+	if err != nil {
+		return reviewDto.ReviewRes{}, err
+	}
+	if !purchased {
+		return reviewDto.ReviewRes{}, NewErrForbidden(op, "only customers who bought the product can review it")
+	}
+
+	review, err := s.storer.CreateReview(ctx, &domain.Review{
+		ProductID: productID,
+		UserID:    user.ID,
+		Rating:    createReviewReq.Rating,
+		Comment:   comment,
+		Status:    domain.ReviewStatusPending,
+	})
+	if err != nil {
+		return reviewDto.ReviewRes{}, fromStorerError(err)
+	}
+	return mapper.MapToReviewRes(review), nil
+}
+
+// GetProductReviews возвращает опубликованные (одобренные) отзывы о товаре.
+func (s *Service) GetProductReviews(ctx context.Context, productID int64) ([]reviewDto.ReviewRes, error) {
+	if _, err := s.storer.GetProduct(ctx, productID); err != nil {
+		return []reviewDto.ReviewRes{}, fromStorerError(err)
+	}
+	reviews, err := s.storer.GetReviews(ctx, storer.ReviewFilter{ProductID: productID, Status: domain.ReviewStatusApproved})
+	if err != nil {
+		return []reviewDto.ReviewRes{}, err
+	}
+	return mapper.MapToReviewResList(reviews), nil
+}
+
+// GetReviewsByProductIDs возвращает опубликованные отзывы нескольких товаров одним запросом, по id товара.
+// Существование товаров не проверяется: отзывы удаленного товара тоже вернутся.
+func (s *Service) GetReviewsByProductIDs(ctx context.Context, productIDs []int64) (map[int64][]reviewDto.ReviewRes, error) {
+	reviews, err := s.storer.GetReviewsByProductIDs(ctx, productIDs, domain.ReviewStatusApproved)
+	if err != nil {
+		return nil, err
+	}
+	byProduct := make(map[int64][]reviewDto.ReviewRes, len(productIDs))
+	for _, review := range reviews {
+		byProduct[review.ProductID] = append(byProduct[review.ProductID], mapper.MapToReviewRes(review))
+	}
+	return byProduct, nil
+}
+
+// GetReviews - список отзывов для модерации, пустой status - все отзывы.
+func (s *Service) GetReviews(ctx context.Context, productID int64, status string) ([]reviewDto.ReviewRes, error) {
+	reviews, err := s.storer.GetReviews(ctx, storer.ReviewFilter{ProductID: productID, Status: status})
+	if err != nil {
+		return []reviewDto.ReviewRes{}, err
+	}
+	return mapper.MapToReviewResList(reviews), nil
+}
+
+func (s *Service) ApproveReview(ctx context.Context, id int64) (reviewDto.ReviewRes, error) {
+	review, err := s.storer.UpdateReviewStatus(ctx, id,
+		[]string{domain.ReviewStatusPending, domain.ReviewStatusRejected}, domain.ReviewStatusApproved)
+	if err != nil {
+		return reviewDto.ReviewRes{}, fromStorerError(err)
+	}
+	return mapper.MapToReviewRes(review), nil
+}
+
+// RejectReview скрывает отзыв, в том числе уже одобренный - тогда он перестает влиять на рейтинг.
+func (s *Service) RejectReview(ctx context.Context, id int64) (reviewDto.ReviewRes, error) {
+	review, err := s.storer.UpdateReviewStatus(ctx, id,
+		[]string{domain.ReviewStatusPending, domain.ReviewStatusApproved}, domain.ReviewStatusRejected)
+	if err != nil {
+		return reviewDto.ReviewRes{}, fromStorerError(err)
+	}
+	return mapper.MapToReviewRes(review), nil
+}
@@ -3,26 +3,51 @@ package service
 import (
 	"context"
 	"ecomm/domain"
+	"ecomm/ecomm-api/blobstore"
 	orderDto "ecomm/ecomm-api/handler/dto/order"
 	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/ecomm-api/payments"
 	"ecomm/ecomm-api/storer"
+	"ecomm/ecomm-api/token"
 	"ecomm/mapper"
 	"errors"
 	"fmt"
+	"log"
 )
 
 type Service struct {
-	storer *storer.PostgresStorer
+	storer   *storer.PostgresStorer
+	payments payments.Provider
+	blobs    blobstore.BlobStore
 }
 
 var productNotFoundError *storer.NotFoundError
 
-func NewService(storer *storer.PostgresStorer) *Service {
-	return &Service{storer: storer}
+const (
+	taxRate       = 0.1
+	shippingPrice = 150
+)
+
+// PriceOrder считает налог, доставку и итоговую сумму заказа по ценам и количеству его позиций.
+func PriceOrder(order *domain.Order) {
+	var itemsPrice float64
+	for _, item := range order.Items {
+		itemsPrice += item.Price * float64(item.Quantity)
+	}
+	order.TaxPrice = itemsPrice * taxRate
+	order.ShippingPrice = shippingPrice
+	order.TotalPrice = itemsPrice + order.TaxPrice + shippingPrice
+}
+
+func NewService(storer *storer.PostgresStorer, payments payments.Provider, blobs blobstore.BlobStore) *Service {
+	return &Service{storer: storer, payments: payments, blobs: blobs}
 }
 
 func (s *Service) CreateProduct(ctx context.Context, createProductReq *productDto.CreateProductReq) (productDto.ProductRes, error) {
 	p := mapper.MapToProductFromCreateProductReq(createProductReq)
+	if err := validateProduct("createProduct", p); err != nil {
+		return productDto.ProductRes{}, err
+	}
 
 	p, err := s.storer.CreateProduct(ctx, p)
 	if err != nil {
@@ -60,9 +85,23 @@ func (s *Service) GetProducts(ctx context.Context) ([]productDto.ProductRes, err
 	return productResList, nil
 }
 
-func (s *Service) UpdateProduct(ctx context.Context, id int64, updateProductReq *productDto.UpdateProductReq) (productDto.ProductRes, error) {
+// GetProductsByIDs возвращает найденные товары из ids одним запросом, удаленные и несуществующие пропускаются.
+func (s *Service) GetProductsByIDs(ctx context.Context, ids []int64) ([]productDto.ProductRes, error) {
+	products, err := s.storer.GetProductsByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToProductResList(products), nil
+}
+
+// UpdateProduct перезаписывает товар, если его версия всё ещё равна version, прочитанной клиентом.
+func (s *Service) UpdateProduct(ctx context.Context, id int64, version int64, updateProductReq *productDto.UpdateProductReq) (productDto.ProductRes, error) {
 	p := mapper.MapToProductFromUpdateProductReq(updateProductReq)
 	p.ID = id
+	p.Version = version
+	if err := validateProduct("updateProduct", p); err != nil {
+		return productDto.ProductRes{}, err
+	}
 	err := s.storer.UpdateProduct(ctx, p)
 	if err != nil {
 		if errors.As(err, &productNotFoundError) {
@@ -74,14 +113,14 @@ func (s *Service) UpdateProduct(ctx context.Context, id int64, updateProductReq
 				Err:       err,
 			}
 		}
-		return productDto.ProductRes{}, err
+		return productDto.ProductRes{}, fromStorerError(err)
 	}
 	productRes := mapper.MapToProductRes(p)
 	return productRes, nil
 }
 
-func (s *Service) DeleteProduct(ctx context.Context, id int64) error {
-	err := s.storer.DeleteProduct(ctx, id)
+func (s *Service) DeleteProduct(ctx context.Context, id int64, version int64) error {
+	err := s.storer.DeleteProduct(ctx, id, version)
 	if err != nil {
 		if errors.As(err, &productNotFoundError) {
 			return &ErrNotFound{
@@ -92,12 +131,12 @@ func (s *Service) DeleteProduct(ctx context.Context, id int64) error {
 				Err:       err,
 			}
 		}
-		return err
+		return fromStorerError(err)
 	}
 	return nil
 }
 
-func (s *Service) CreateOrder(ctx context.Context, createOrderReq *orderDto.CreateOrderReq) (orderDto.OrderRes, error) {
+func (s *Service) CreateOrder(ctx context.Context, user *token.UserClaims, createOrderReq *orderDto.CreateOrderReq) (orderDto.OrderRes, error) {
 	op := "createOrder"
 
 	if createOrderReq.PaymentMethod == "" {
@@ -136,54 +175,245 @@ func (s *Service) CreateOrder(ctx context.Context, createOrderReq *orderDto.Crea
 		productMap[product.ID] = product
 	}
 
+	variants, err := s.storer.GetProductVariants(ctx, productIDs)
+	if err != nil {
+		return orderDto.OrderRes{}, fmt.Errorf("failed to get product variants for order: %w", err)
+	}
+	variantMap := make(map[int64]*domain.ProductVariant, len(variants))
+	hasVariants := make(map[int64]bool)
+	for _, variant := range variants {
+		variantMap[variant.ID] = variant
+		hasVariants[variant.ProductID] = true
+	}
+
 	domainItems := make([]domain.OrderItem, 0, len(createOrderReq.Items))
-	var itemsPrice float64 = 0
 
 	for _, item := range createOrderReq.Items {
 		product := productMap[item.ProductID]
 
-		if product.CountInStock < item.Quantity {
-			return orderDto.OrderRes{},
-				NewNotEnoughStock(op, "product", product.ID, item.Quantity, product.CountInStock, nil)
-		}
-
-		orderItem := domain.OrderItem{
-			Name:      product.Name,
-			Quantity:  item.Quantity,
-			Image:     product.Image,
-			Price:     product.Price,
-			ProductID: product.ID,
+		var orderItem domain.OrderItem
+		switch {
+		case item.VariantID != nil:
+			variant, ok := variantMap[*item.VariantID]
+			if !ok || variant.ProductID != product.ID {
+				return orderDto.OrderRes{}, NewErrNotFound(op, "product variant", *item.VariantID, nil)
+			}
+			if variant.CountInStock < item.Quantity {
+				return orderDto.OrderRes{},
+					NewNotEnoughStock(op, "product variant", variant.ID, item.Quantity, variant.CountInStock, nil)
+			}
+			orderItem = mapper.MapToOrderItemFromProductVariant(product, variant, item.Quantity)
+		case hasVariants[product.ID]:
+			// Остаток и цена у такого товара есть только у вариантов
+			return orderDto.OrderRes{}, NewErrValidation(op,
+				fmt.Sprintf("variant_id is required for product with id %d", product.ID), nil)
+		default:
+			if product.CountInStock < item.Quantity {
+				return orderDto.OrderRes{},
+					NewNotEnoughStock(op, "product", product.ID, item.Quantity, product.CountInStock, nil)
+			}
+			orderItem = domain.OrderItem{
+				Name:      product.Name,
+				Quantity:  item.Quantity,
+				Image:     product.Image,
+				Price:     product.Price,
+				ProductID: product.ID,
+			}
 		}
 		domainItems = append(domainItems, orderItem)
-
-		itemsPrice += product.Price * float64(item.Quantity)
 	}
 
-	const taxRate = 0.1
-	const shippingPrice = 150
-
-	taxPrice := itemsPrice * taxRate
-	totalPrice := itemsPrice + taxPrice + shippingPrice
-
 	orderToCreate := domain.Order{
+		UserID:        user.ID,
 		PaymentMethod: createOrderReq.PaymentMethod,
-		TaxPrice:      taxPrice,
-		ShippingPrice: shippingPrice,
-		TotalPrice:    totalPrice,
+		Status:        domain.OrderStatusPending,
 		Items:         domainItems,
 	}
-
-	createdOrder, err := s.storer.CreateOrder(ctx, &orderToCreate)
+	PriceOrder(&orderToCreate)
+
+	createdOrder, err := s.storer.CreateOrder(ctx, &orderToCreate, &domain.Payment{
+		Provider: s.payments.Name(),
+		Method:   orderToCreate.PaymentMethod,
+		Status:   domain.PaymentStatusPending,
+		Amount:   orderToCreate.TotalPrice,
+	})
 	if err != nil {
+		var (
+			insufficientStock *storer.InsufficientStockError
+			notFound          *storer.NotFoundError
+		)
+		switch {
+		case errors.As(err, &insufficientStock) && insufficientStock.VariantID != nil:
+			return orderDto.OrderRes{}, NewNotEnoughStock(op, "product variant", *insufficientStock.VariantID,
+				insufficientStock.Requested, insufficientStock.Available, err)
+		case errors.As(err, &insufficientStock):
+			return orderDto.OrderRes{}, NewNotEnoughStock(op, "product", insufficientStock.ProductID,
+				insufficientStock.Requested, insufficientStock.Available, err)
+		case errors.As(err, &notFound):
+			// Товар удалили после проверки корзины
+			return orderDto.OrderRes{}, fromStorerError(err)
+		}
 		return orderDto.OrderRes{}, fmt.Errorf("failed to create order: %w", err)
 	}
 
+	if err := s.payOrder(ctx, op, createdOrder, createOrderReq.PaymentToken); err != nil {
+		return orderDto.OrderRes{}, err
+	}
+
 	orderRes := mapper.MapToOrderRes(createdOrder)
 
 	return orderRes, nil
 
 }
 
+// payOrder списывает деньги за заказ, уже сохраненный с pending-платежом. Шлюз вызывается вне транзакции,
+// чтобы сетевой запрос не держал блокировки остатков и соединение с базой.
+// Если списать не удалось, заказ отменяется и товары возвращаются на склад.
+func (s *Service) payOrder(ctx context.Context, op string, order *domain.Order, token string) error {
+	// Заказ уже записан: его нужно довести до конца, даже если клиент отключился
+	ctx = context.WithoutCancel(ctx)
+
+	capture, err := s.chargeOrder(ctx, order, token)
+	if err != nil {
+		if failErr := s.storer.FailOrderPayment(ctx, order, "payment failed"); failErr != nil {
+			log.Printf("failed to cancel order %d after payment error: %v", order.ID, failErr)
+		}
+		var declined *payments.DeclinedError
+		if errors.As(err, &declined) {
+			return NewErrPaymentDeclined(op, declined.Code, declined.Reason, err)
+		}
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+
+	if err := s.storer.CompleteOrderPayment(ctx, order, capture.AuthorizationID, capture.Amount); err != nil {
+		// Деньги уже списаны, а записать это не удалось - возвращаем их покупателю
+		s.releasePayment(ctx, capture.AuthorizationID, capture.Amount)
+		// Заказ отменили, пока шлюз списывал деньги: товары уже вернул CancelOrder
+		var invalidState *storer.InvalidStateError
+		if errors.As(err, &invalidState) {
+			return fromStorerError(err)
+		}
+		if failErr := s.storer.FailOrderPayment(ctx, order, "payment failed"); failErr != nil {
+			log.Printf("failed to cancel order %d after payment error: %v", order.ID, failErr)
+		}
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+	return nil
+}
+
+// chargeOrder авторизует полную сумму заказа и сразу списывает её.
+// Если списание отклонено, авторизация отменяется, чтобы не держать деньги покупателя.
+func (s *Service) chargeOrder(ctx context.Context, order *domain.Order, token string) (*payments.Transaction, error) {
+	auth, err := s.payments.Authorize(ctx, payments.AuthorizeRequest{
+		Reference: fmt.Sprintf("order-%d", order.ID),
+		Method:    order.PaymentMethod,
+		Token:     token,
+		Amount:    order.TotalPrice,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error authorizing payment: %w", err)
+	}
+
+	if _, err := s.payments.Capture(ctx, auth.AuthorizationID, auth.Amount); err != nil {
+		if _, voidErr := s.payments.Void(ctx, auth.AuthorizationID); voidErr != nil {
+			log.Printf("failed to void authorization %s: %v", auth.AuthorizationID, voidErr)
+		}
+		return nil, fmt.Errorf("error capturing payment: %w", err)
+	}
+
+	return auth, nil
+}
+
+// releasePayment возвращает деньги по списанию, которое не удалось записать в заказ.
+func (s *Service) releasePayment(ctx context.Context, authorizationID string, amount float64) {
+	if _, err := s.payments.Refund(ctx, authorizationID, amount, "release-"+authorizationID); err != nil {
+		log.Printf("failed to refund authorization %s: %v", authorizationID, err)
+	}
+}
+
+// HandlePaymentWebhook применяет уже проверенное по подписи уведомление шлюза.
+// Возвращает false, если событие с таким ID уже обрабатывалось.
+func (s *Service) HandlePaymentWebhook(ctx context.Context, payload []byte) (bool, error) {
+	op := "handlePaymentWebhook"
+
+	event, err := payments.ParseEvent(payload)
+	if err != nil {
+		return false, NewErrValidation(op, "invalid webhook event", err)
+	}
+
+	paymentEvent := &domain.PaymentEvent{
+		ID:              event.ID,
+		Provider:        s.payments.Name(),
+		Type:            event.Type,
+		AuthorizationID: event.AuthorizationID,
+		Payload:         string(payload),
+	}
+
+	applied, err := s.storer.ApplyPaymentEvent(ctx, paymentEvent, paymentEventTransition(event))
+	if err != nil {
+		return false, fromStorerError(err)
+	}
+	return applied, nil
+}
+
+// paymentEventTransition описывает, какие переходы статуса платежа допускает событие.
+// События, пришедшие не по порядку (например, captured после voided), записываются, но ничего не меняют.
+func paymentEventTransition(event *payments.Event) storer.PaymentEventFunc {
+	return func(payment *domain.Payment, refunds []domain.Refund) (string, error) {
+		switch {
+		case event.Type == payments.EventPaymentCaptured && payment.Status == domain.PaymentStatusAuthorized:
+			payment.Status = domain.PaymentStatusCaptured
+			payment.CapturedAmount = payment.Amount
+			if event.Amount > 0 {
+				payment.CapturedAmount = event.Amount
+			}
+			return domain.OrderStatusPaid, nil
+		case event.Type == payments.EventPaymentFailed && payment.Status == domain.PaymentStatusAuthorized,
+			event.Type == payments.EventPaymentVoided && payment.Status == domain.PaymentStatusAuthorized:
+			payment.Status = domain.PaymentStatusFailed
+			if event.Type == payments.EventPaymentVoided {
+				payment.Status = domain.PaymentStatusVoided
+			}
+			return domain.OrderStatusPaymentFailed, nil
+		case event.Type == payments.EventPaymentRefunded && isRecordedRefund(event, refunds):
+			// Наш возврат уже учтен в платеже и заказе, когда его записали
+			return "", nil
+		case event.Type == payments.EventPaymentRefunded &&
+			(payment.Status == domain.PaymentStatusCaptured || payment.Status == domain.PaymentStatusPartiallyRefunded):
+			// Сумма не указана - возвращено все, что осталось
+			refunded := payment.CapturedAmount - payment.RefundedAmount
+			if event.Amount > 0 && event.Amount < refunded {
+				refunded = event.Amount
+			}
+			payment.RefundedAmount += refunded
+			if payment.RefundedAmount < payment.CapturedAmount {
+				payment.Status = domain.PaymentStatusPartiallyRefunded
+				return "", nil
+			}
+			payment.Status = domain.PaymentStatusRefunded
+			return domain.OrderStatusRefunded, nil
+		}
+
+		log.Printf("payment event %s (%s) ignored for payment %d in status %s",
+			event.ID, event.Type, payment.ID, payment.Status)
+		return "", nil
+	}
+}
+
+// isRecordedRefund сообщает, что событие о возврате пришло по возврату, который сделали мы:
+// шлюз присылает id операции, записанный в CompleteRefund, или наш reference из settleRefund.
+func isRecordedRefund(event *payments.Event, refunds []domain.Refund) bool {
+	for _, refund := range refunds {
+		if event.RefundID != "" && event.RefundID == refund.ProviderRefundID {
+			return true
+		}
+		if event.Reference == refundReference(refund.ID) {
+			return true
+		}
+	}
+	return false
+}
+
 func isValidOrderItems(items []orderDto.CreateOrderItemReq) error {
 	for _, item := range items {
 		if item.Quantity <= 0 {
@@ -192,6 +422,9 @@ func isValidOrderItems(items []orderDto.CreateOrderItemReq) error {
 		if item.ProductID < 0 {
 			return errors.New("invalid product id")
 		}
+		if item.VariantID != nil && *item.VariantID <= 0 {
+			return errors.New("invalid variant id")
+		}
 	}
 	return nil
 }
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"ecomm/domain"
+	userDto "ecomm/ecomm-api/handler/dto/user"
+	"ecomm/ecomm-api/jobs"
+	"ecomm/ecomm-api/notifications"
+	"ecomm/mapper"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+
+func (s *Service) CreateUser(ctx context.Context, createUserReq *userDto.CreateUserReq) (userDto.UserRes, error) {
+	op := "createUser"
+
+	email := strings.ToLower(strings.TrimSpace(createUserReq.Email))
+	if strings.TrimSpace(createUserReq.Name) == "" {
+		return userDto.UserRes{}, NewErrValidation(op, "name is required", nil)
+	}
+	if _, err := mail.ParseAddress(email); err != nil {
+		return userDto.UserRes{}, NewErrValidation(op, "invalid email", err)
+	}
+	if len(createUserReq.Password) < minPasswordLength {
+		return userDto.UserRes{}, NewErrValidation(op, fmt.Sprintf("password must be at least %d characters", minPasswordLength), nil)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(createUserReq.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return userDto.UserRes{}, fmt.Errorf("error hashing password: %w", err)
+	}
+
+	u, err := s.storer.CreateUser(ctx, &domain.User{
+		Name:     strings.TrimSpace(createUserReq.Name),
+		Email:    email,
+		Password: string(hashedPassword),
+	})
+	if err != nil {
+		return userDto.UserRes{}, fromStorerError(err)
+	}
+
+	return mapper.MapToUserRes(u), nil
+}
+
+// LoginUser проверяет пароль. Для неизвестного email и неверного пароля ошибка одна и та же,
+// чтобы по ответу нельзя было перебирать зарегистрированные адреса.
+func (s *Service) LoginUser(ctx context.Context, loginUserReq *userDto.LoginUserReq) (userDto.UserRes, error) {
+	op := "loginUser"
+
+	u, err := s.storer.GetUserByEmail(ctx, strings.ToLower(strings.TrimSpace(loginUserReq.Email)))
+	if err != nil {
+		if errors.As(fromStorerError(err), new(*ErrNotFound)) {
+			return userDto.UserRes{}, NewErrUnauthorized(op, "invalid email or password", err)
+		}
+		return userDto.UserRes{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(loginUserReq.Password)); err != nil {
+		return userDto.UserRes{}, NewErrUnauthorized(op, "invalid email or password", err)
+	}
+
+	return mapper.MapToUserRes(u), nil
+}
+
+// RequestPasswordReset ставит в очередь письмо со ссылкой для сброса пароля. Ответ не зависит
+// от того, зарегистрирован ли email. Повторные запросы в течение минуты не создают новых писем.
+func (s *Service) RequestPasswordReset(ctx context.Context, req *userDto.RequestPasswordResetReq) error {
+	op := "requestPasswordReset"
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		return NewErrValidation(op, "invalid email", err)
+	}
+
+	u, err := s.storer.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.As(fromStorerError(err), new(*ErrNotFound)) {
+			return nil
+		}
+		return err
+	}
+	key := fmt.Sprintf("password-reset:%d:%d", u.ID, time.Now().Truncate(time.Minute).Unix())
+	_, err = notifications.PasswordResetEmail.Enqueue(ctx, s.storer, notifications.PasswordResetArgs{UserID: u.ID}, jobs.UniqueKey(key))
+	return err
+}
+
+// ResetPassword меняет пароль по токену из письма. Неизвестный, использованный и просроченный
+// токены дают одну и ту же ошибку.
+func (s *Service) ResetPassword(ctx context.Context, req *userDto.ResetPasswordReq) error {
+	op := "resetPassword"
+	if len(req.Password) < minPasswordLength {
+		return NewErrValidation(op, fmt.Sprintf("password must be at least %d characters", minPasswordLength), nil)
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+
+	_, err = s.storer.ResetPassword(ctx, domain.HashPasswordResetToken(strings.TrimSpace(req.Token)), string(hashedPassword))
+	if err != nil {
+		if errors.As(fromStorerError(err), new(*ErrNotFound)) {
+			return NewErrValidation(op, "invalid or expired password reset token", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// SetUserAdmin выдает или отзывает права администратора. Уже выданные токены
+// сохраняют старое значение is_admin до истечения срока.
+func (s *Service) SetUserAdmin(ctx context.Context, email string, isAdmin bool) (userDto.UserRes, error) {
+	u, err := s.storer.SetUserAdmin(ctx, strings.ToLower(strings.TrimSpace(email)), isAdmin)
+	if err != nil {
+		return userDto.UserRes{}, fromStorerError(err)
+	}
+	return mapper.MapToUserRes(u), nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"ecomm/domain"
+	productDto "ecomm/ecomm-api/handler/dto/product"
+	"ecomm/mapper"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+func (s *Service) CreateProductOption(ctx context.Context, productID int64, req *productDto.CreateProductOptionReq) (productDto.ProductOptionRes, error) {
+	op := "createProductOption"
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return productDto.ProductOptionRes{}, NewErrValidation(op, "name is required", nil)
+	}
+	if len(req.Values) == 0 {
+		return productDto.ProductOptionRes{}, NewErrValidation(op, "values are required", nil)
+	}
+	for i, value := range req.Values {
+		if strings.TrimSpace(value) == "" || slices.Contains(req.Values[:i], value) {
+			return productDto.ProductOptionRes{}, NewErrValidation(op, "values must be non-empty and unique", nil)
+		}
+	}
+
+	if _, err := s.storer.GetProduct(ctx, productID); err != nil {
+		return productDto.ProductOptionRes{}, fromStorerError(err)
+	}
+	option, err := s.storer.CreateProductOption(ctx, &domain.ProductOption{
+		ProductID: productID,
+		Name:      name,
+		Values:    req.Values,
+	})
+	if err != nil {
+		return productDto.ProductOptionRes{}, fromStorerError(err)
+	}
+	return mapper.MapToProductOptionRes(option), nil
+}
+
+func (s *Service) GetProductOptions(ctx context.Context, productID int64) ([]productDto.ProductOptionRes, error) {
+	if _, err := s.storer.GetProduct(ctx, productID); err != nil {
+		return nil, fromStorerError(err)
+	}
+	options, err := s.storer.GetProductOptions(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToProductOptionResList(options), nil
+}
+
+// CreateProductVariant добавляет вариант товара. У варианта должно быть ровно по одному
+// допустимому значению для каждой опции товара.
+func (s *Service) CreateProductVariant(ctx context.Context, productID int64, req *productDto.CreateProductVariantReq) (productDto.ProductVariantRes, error) {
+	op := "createProductVariant"
+	req.SKU = strings.TrimSpace(req.SKU)
+	switch {
+	case req.SKU == "":
+		return productDto.ProductVariantRes{}, NewErrValidation(op, "sku is required", nil)
+	case req.Price < 0:
+		return productDto.ProductVariantRes{}, NewErrValidation(op, "price must not be negative", nil)
+	case req.CountInStock < 0:
+		return productDto.ProductVariantRes{}, NewErrValidation(op, "count_in_stock must not be negative", nil)
+	}
+
+	if _, err := s.storer.GetProduct(ctx, productID); err != nil {
+		return productDto.ProductVariantRes{}, fromStorerError(err)
+	}
+	options, err := s.storer.GetProductOptions(ctx, productID)
+	if err != nil {
+		return productDto.ProductVariantRes{}, err
+	}
+	if err := validateVariantOptions(op, options, req.Options); err != nil {
+		return productDto.ProductVariantRes{}, err
+	}
+
+	variant, err := s.storer.CreateProductVariant(ctx, mapper.MapToProductVariantFromCreateProductVariantReq(productID, req))
+	if err != nil {
+		return productDto.ProductVariantRes{}, fromStorerError(err)
+	}
+	return mapper.MapToProductVariantRes(variant), nil
+}
+
+func (s *Service) GetProductVariants(ctx context.Context, productID int64) ([]productDto.ProductVariantRes, error) {
+	if _, err := s.storer.GetProduct(ctx, productID); err != nil {
+		return nil, fromStorerError(err)
+	}
+	variants, err := s.storer.GetProductVariants(ctx, []int64{productID})
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToProductVariantResList(variants), nil
+}
+
+func validateVariantOptions(op string, options []*domain.ProductOption, values map[string]string) error {
+	if len(options) == 0 {
+		return NewErrValidation(op, "product has no options, add options before variants", nil)
+	}
+	if len(values) != len(options) {
+		return NewErrValidation(op, fmt.Sprintf("variant must set exactly %d options", len(options)), nil)
+	}
+	for _, option := range options {
+		value, ok := values[option.Name]
+		if !ok {
+			return NewErrValidation(op, fmt.Sprintf("option %s is required", option.Name), nil)
+		}
+		if !slices.Contains(option.Values, value) {
+			return NewErrValidation(op, fmt.Sprintf("%q is not a valid value of option %s", value, option.Name), nil)
+		}
+	}
+	return nil
+}
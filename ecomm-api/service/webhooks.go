@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"ecomm/domain"
+	webhookDto "ecomm/ecomm-api/handler/dto/webhook"
+	"ecomm/ecomm-api/storer"
+	"ecomm/ecomm-api/webhooks"
+	"ecomm/mapper"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const (
+	minWebhookSecretLength = 16
+	maxWebhookSecretLength = 128
+
+	DefaultWebhookDeliveriesLimit = 50
+	MaxWebhookDeliveriesLimit     = 500
+)
+
+func (s *Service) CreateWebhookSubscription(ctx context.Context, req *webhookDto.CreateWebhookSubscriptionReq) (webhookDto.WebhookSubscriptionRes, error) {
+	op := "createWebhookSubscription"
+	subscription, err := webhookSubscriptionFromReq(op, req.URL, req.EventTypes, req.Secret)
+	if err != nil {
+		return webhookDto.WebhookSubscriptionRes{}, err
+	}
+	if subscription.Secret == "" {
+		if subscription.Secret, err = newWebhookSecret(); err != nil {
+			return webhookDto.WebhookSubscriptionRes{}, err
+		}
+	}
+	subscription.Enabled = true
+
+	subscription, err = s.storer.CreateWebhookSubscription(ctx, subscription)
+	if err != nil {
+		return webhookDto.WebhookSubscriptionRes{}, fromStorerError(err)
+	}
+	res := mapper.MapToWebhookSubscriptionRes(subscription)
+	res.Secret = subscription.Secret
+	return res, nil
+}
+
+func (s *Service) GetWebhookSubscriptions(ctx context.Context) ([]webhookDto.WebhookSubscriptionRes, error) {
+	subscriptions, err := s.storer.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToWebhookSubscriptionResList(subscriptions), nil
+}
+
+func (s *Service) GetWebhookSubscription(ctx context.Context, id int64) (webhookDto.WebhookSubscriptionRes, error) {
+	subscription, err := s.storer.GetWebhookSubscription(ctx, id)
+	if err != nil {
+		return webhookDto.WebhookSubscriptionRes{}, fromStorerError(err)
+	}
+	return mapper.MapToWebhookSubscriptionRes(subscription), nil
+}
+
+func (s *Service) UpdateWebhookSubscription(ctx context.Context, id int64, req *webhookDto.UpdateWebhookSubscriptionReq) (webhookDto.WebhookSubscriptionRes, error) {
+	op := "updateWebhookSubscription"
+	current, err := s.storer.GetWebhookSubscription(ctx, id)
+	if err != nil {
+		return webhookDto.WebhookSubscriptionRes{}, fromStorerError(err)
+	}
+	subscription, err := webhookSubscriptionFromReq(op, req.URL, req.EventTypes, req.Secret)
+	if err != nil {
+		return webhookDto.WebhookSubscriptionRes{}, err
+	}
+	subscription.ID = id
+	rotated := subscription.Secret != ""
+	if !rotated {
+		subscription.Secret = current.Secret
+	}
+	subscription.Enabled = current.Enabled
+	if req.Enabled != nil {
+		subscription.Enabled = *req.Enabled
+	}
+
+	if err := s.storer.UpdateWebhookSubscription(ctx, subscription); err != nil {
+		return webhookDto.WebhookSubscriptionRes{}, fromStorerError(err)
+	}
+	res := mapper.MapToWebhookSubscriptionRes(subscription)
+	if rotated {
+		res.Secret = subscription.Secret
+	}
+	return res, nil
+}
+
+func (s *Service) DeleteWebhookSubscription(ctx context.Context, id int64) error {
+	return fromStorerError(s.storer.DeleteWebhookSubscription(ctx, id))
+}
+
+// GetWebhookDeliveries - журнал доставок подписки, новые первыми. Пустой status - все доставки.
+func (s *Service) GetWebhookDeliveries(ctx context.Context, subscriptionID int64, status string, limit int64) ([]webhookDto.WebhookDeliveryRes, error) {
+	op := "getWebhookDeliveries"
+	switch status {
+	case "", domain.WebhookDeliveryPending, domain.WebhookDeliverySucceeded, domain.WebhookDeliveryFailed:
+	default:
+		return nil, NewErrValidation(op, fmt.Sprintf("unknown delivery status %q", status), nil)
+	}
+	switch {
+	case limit == 0:
+		limit = DefaultWebhookDeliveriesLimit
+	case limit < 0 || limit > MaxWebhookDeliveriesLimit:
+		return nil, NewErrValidation(op, fmt.Sprintf("limit must be between 1 and %d", MaxWebhookDeliveriesLimit), nil)
+	}
+
+	if _, err := s.storer.GetWebhookSubscription(ctx, subscriptionID); err != nil {
+		return nil, fromStorerError(err)
+	}
+	deliveries, err := s.storer.GetWebhookDeliveries(ctx, storer.WebhookDeliveryFilter{
+		SubscriptionID: subscriptionID,
+		Status:         status,
+		Limit:          limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mapper.MapToWebhookDeliveryResList(deliveries), nil
+}
+
+// RedeliverWebhook отправляет событие заново с полным набором попыток. Отключенной подписке
+// ничего не отправляется, поэтому сначала ее нужно включить.
+func (s *Service) RedeliverWebhook(ctx context.Context, subscriptionID int64, deliveryID int64) (webhookDto.WebhookDeliveryRes, error) {
+	op := "redeliverWebhook"
+	subscription, err := s.storer.GetWebhookSubscription(ctx, subscriptionID)
+	if err != nil {
+		return webhookDto.WebhookDeliveryRes{}, fromStorerError(err)
+	}
+	if !subscription.Enabled {
+		return webhookDto.WebhookDeliveryRes{}, NewErrConflict(op, "webhook subscription",
+			fmt.Sprintf("webhook subscription with id %d is disabled", subscriptionID), nil)
+	}
+
+	delivery, err := s.storer.RedeliverWebhook(ctx, subscriptionID, deliveryID)
+	if err != nil {
+		return webhookDto.WebhookDeliveryRes{}, fromStorerError(err)
+	}
+	return mapper.MapToWebhookDeliveryRes(delivery), nil
+}
+
+func webhookSubscriptionFromReq(op string, rawURL string, eventTypes []string, secret string) (*domain.WebhookSubscription, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, NewErrValidation(op, "url must be an absolute http or https URL", err)
+	}
+	// Имена проверяет диспетчер при соединении, здесь отсекаются очевидные внутренние адреса
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, NewErrValidation(op, "url must point to a public host", nil)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !webhooks.IsPublicAddress(addr) {
+		return nil, NewErrValidation(op, "url must point to a public host", nil)
+	}
+	if len(eventTypes) == 0 {
+		return nil, NewErrValidation(op, "at least one event type is required", nil)
+	}
+	types := make(domain.WebhookEventTypes, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		if !slices.Contains(domain.EventTypes, eventType) {
+			return nil, NewErrValidation(op, fmt.Sprintf("unknown event type %q, expected one of %s",
+				eventType, strings.Join(domain.EventTypes, ", ")), nil)
+		}
+		if !slices.Contains(types, eventType) {
+			types = append(types, eventType)
+		}
+	}
+	if secret != "" && (len(secret) < minWebhookSecretLength || len(secret) > maxWebhookSecretLength) {
+		return nil, NewErrValidation(op, fmt.Sprintf("secret must be from %d to %d characters long",
+			minWebhookSecretLength, maxWebhookSecretLength), nil)
+	}
+	return &domain.WebhookSubscription{URL: u.String(), EventTypes: types, Secret: secret}, nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
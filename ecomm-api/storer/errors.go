@@ -34,3 +34,153 @@ func (e *NotFoundError) Error() string {
 func (e *NotFoundError) Unwrap() error {
 	return e.Err
 }
+
+type InsufficientStockError struct {
+	Op        string
+	ProductID int64
+	VariantID *int64 // Если не хватило остатка варианта товара
+	Requested int64
+	Available int64
+	Timestamp time.Time
+}
+
+func NewInsufficientStockError(op string, productID int64, requested int64, available int64) *InsufficientStockError {
+	return &InsufficientStockError{
+		Op:        op,
+		ProductID: productID,
+		Requested: requested,
+		Available: available,
+		Timestamp: time.Now(),
+	}
+}
+
+func (e *InsufficientStockError) Error() string {
+	if e.VariantID != nil {
+		return fmt.Sprintf("operation %s: not enough stock for variant with id %d of product with id %d. Requested: %d, Available: %d",
+			e.Op, *e.VariantID, e.ProductID, e.Requested, e.Available)
+	}
+	return fmt.Sprintf("operation %s: not enough stock for product with id %d. Requested: %d, Available: %d",
+		e.Op, e.ProductID, e.Requested, e.Available)
+}
+
+type AlreadyExistsError struct {
+	Op        string
+	Resource  string
+	Key       interface{} // Значение уникального ключа, например email
+	Timestamp time.Time
+	Err       error
+}
+
+func NewAlreadyExistsError(op, resource string, key interface{}, err error) *AlreadyExistsError {
+	return &AlreadyExistsError{
+		Op:        op,
+		Resource:  resource,
+		Key:       key,
+		Timestamp: time.Now(),
+		Err:       err,
+	}
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return fmt.Sprintf("operation %s: %s %v already exists", e.Op, e.Resource, e.Key)
+}
+
+func (e *AlreadyExistsError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidStateError - ресурс существует, но его текущий статус не допускает операцию.
+type InvalidStateError struct {
+	Op        string
+	Resource  string
+	ID        interface{}
+	Status    string
+	Timestamp time.Time
+}
+
+func NewInvalidStateError(op, resource string, id interface{}, status string) *InvalidStateError {
+	return &InvalidStateError{
+		Op:        op,
+		Resource:  resource,
+		ID:        id,
+		Status:    status,
+		Timestamp: time.Now(),
+	}
+}
+
+func (e *InvalidStateError) Error() string {
+	return fmt.Sprintf("operation %s: %s with id %v is %s", e.Op, e.Resource, e.ID, e.Status)
+}
+
+// ReturnQuantityError - по позиции заказа просят вернуть больше, чем в ней осталось.
+type ReturnQuantityError struct {
+	Op          string
+	OrderItemID int64
+	Requested   int64
+	Available   int64
+	Timestamp   time.Time
+}
+
+func NewReturnQuantityError(op string, orderItemID int64, requested int64, available int64) *ReturnQuantityError {
+	return &ReturnQuantityError{
+		Op:          op,
+		OrderItemID: orderItemID,
+		Requested:   requested,
+		Available:   available,
+		Timestamp:   time.Now(),
+	}
+}
+
+func (e *ReturnQuantityError) Error() string {
+	return fmt.Sprintf("operation %s: cannot return %d of order item with id %d, %d left to return",
+		e.Op, e.Requested, e.OrderItemID, e.Available)
+}
+
+// VersionMismatchError - ресурс изменили после того, как клиент прочитал его версию.
+type VersionMismatchError struct {
+	Op        string
+	Resource  string
+	ID        interface{}
+	Expected  int64
+	Current   int64
+	Timestamp time.Time
+}
+
+func NewVersionMismatchError(op, resource string, id interface{}, expected int64, current int64) *VersionMismatchError {
+	return &VersionMismatchError{
+		Op:        op,
+		Resource:  resource,
+		ID:        id,
+		Expected:  expected,
+		Current:   current,
+		Timestamp: time.Now(),
+	}
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("operation %s: %s with id %v has version %d, expected %d",
+		e.Op, e.Resource, e.ID, e.Current, e.Expected)
+}
+
+// AmbiguousMatchError - по ключу нашлось несколько записей, и нельзя выбрать, какую менять.
+type AmbiguousMatchError struct {
+	Op        string
+	Resource  string
+	Key       interface{}
+	Count     int
+	Timestamp time.Time
+}
+
+func NewAmbiguousMatchError(op, resource string, key interface{}, count int) *AmbiguousMatchError {
+	return &AmbiguousMatchError{
+		Op:        op,
+		Resource:  resource,
+		Key:       key,
+		Count:     count,
+		Timestamp: time.Now(),
+	}
+}
+
+func (e *AmbiguousMatchError) Error() string {
+	return fmt.Sprintf("operation %s: %d %s match %v", e.Op, e.Count, e.Resource, e.Key)
+}
@@ -2,11 +2,16 @@ package storer
 
 import (
 	"context"
+	"database/sql"
 	"ecomm/domain"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type PostgresStorer struct {
@@ -14,37 +19,89 @@ type PostgresStorer struct {
 }
 
 const (
-	queryToInsertProduct = "INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) VALUES (:name, :image, :category, :description, :rating, :num_reviews, :price, :count_in_stock) RETURNING *"
-	queryToSelectProduct = "SELECT * FROM products WHERE id=:id"
+	queryToInsertProduct = "INSERT INTO products (sku, name, image, category_id, description, price, count_in_stock) VALUES (:sku, :name, :image, :category_id, :description, :price, :count_in_stock) RETURNING *"
+	queryToSelectProduct = "SELECT * FROM products WHERE id=:id AND deleted_at IS NULL"
 
-	queryToUpdateProduct = "UPDATE products SET name=:name, image=:image, category=:category, description=:description, rating=:rating, num_reviews=:num_reviews, price=:price, count_in_stock=:count_in_stock, updated_at=NOW() WHERE id=:id RETURNING *"
+	queryToDeleteProduct  = "UPDATE products SET deleted_at=NOW(), version=version+1, updated_at=NOW() WHERE id=$1 AND version=$2 AND deleted_at IS NULL"
+	queryToRestoreProduct = "UPDATE products SET deleted_at=NULL, version=version+1, updated_at=NOW() WHERE id=$1 AND deleted_at IS NOT NULL RETURNING *"
+	queryToAdjustStock    = "UPDATE products SET count_in_stock=count_in_stock+$1, version=version+1, updated_at=NOW() WHERE id=$2 AND deleted_at IS NULL AND count_in_stock+$1 >= 0 RETURNING *"
+	// Товар варианта блокируется отдельно, см. adjustVariantStock
+	queryToAdjustVariantStock = "UPDATE product_variants SET count_in_stock=count_in_stock+$1, version=version+1, updated_at=NOW() WHERE id=$2 AND product_id=$3 AND count_in_stock+$1 >= 0 RETURNING *"
+	queryToSelectVariantStock = "SELECT count_in_stock FROM product_variants WHERE id=$1 AND product_id=$2"
 
-	queryToInsertOrder     = "INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (:payment_method, :tax_price, :shipping_price, :total_price) RETURNING *"
-	queryToInsertOrderItem = "INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (:name, :quantity, :image, :price, :product_id, :order_id) RETURNING *"
+	queryToUpdateProduct = "UPDATE products SET sku=:sku, name=:name, image=:image, category_id=:category_id, description=:description, price=:price, count_in_stock=:count_in_stock, version=version+1, updated_at=NOW() WHERE id=:id AND version=:version AND deleted_at IS NULL RETURNING *"
 
-	queryToGetOrder = "SELECT * FROM orders WHERE id=:id"
+	queryToInsertOrder          = "INSERT INTO orders (user_id, payment_method, status, tax_price, shipping_price, total_price) VALUES (:user_id, :payment_method, :status, :tax_price, :shipping_price, :total_price) RETURNING *"
+	queryToInsertOrderItems     = "WITH input AS MATERIALIZED (SELECT nextval(pg_get_serial_sequence('order_items', 'id')) AS id, v.* FROM unnest($1::varchar[], $2::int[], $3::varchar[], $4::numeric[], $5::int[], $6::int[]) WITH ORDINALITY AS v(name, quantity, image, price, product_id, variant_id, ordinal)), inserted AS (INSERT INTO order_items (id, name, quantity, image, price, product_id, variant_id, order_id) SELECT id, name, quantity, image, price, product_id, variant_id, $7 FROM input RETURNING *) SELECT inserted.*, input.ordinal FROM inserted JOIN input USING (id)"
+	queryToDecreaseStock        = "UPDATE products p SET count_in_stock = p.count_in_stock - v.quantity, version=p.version+1, updated_at=NOW() FROM unnest($1::int[], $2::int[]) AS v(id, quantity) WHERE p.id = v.id AND p.count_in_stock >= v.quantity AND p.deleted_at IS NULL RETURNING p.id"
+	queryToDecreaseVariantStock = "UPDATE product_variants pv SET count_in_stock = pv.count_in_stock - v.quantity, version=pv.version+1, updated_at=NOW() FROM unnest($1::int[], $2::int[]) AS v(id, quantity) WHERE pv.id = v.id AND pv.count_in_stock >= v.quantity RETURNING pv.id"
+	queryToInsertPayment        = "INSERT INTO payments (order_id, provider, method, status, amount, captured_amount, authorization_id) VALUES (:order_id, :provider, :method, :status, :amount, :captured_amount, :authorization_id) RETURNING *"
+	queryToSetOrderStatus       = "UPDATE orders SET status=$1, updated_at=NOW() WHERE id=$2"
+	queryToCapturePayment       = "UPDATE payments SET status=$1, captured_amount=$2, authorization_id=$3, updated_at=NOW() WHERE id=$4 AND status='pending' RETURNING *"
+	queryToFailPendingPayment   = "UPDATE payments SET status=$1, updated_at=NOW() WHERE id=$2 AND status='pending'"
+	queryToFailOrderPayments    = "UPDATE payments SET status=$1, updated_at=NOW() WHERE order_id=$2 AND status='pending'"
+
+	queryToInsertPaymentEvent   = "INSERT INTO payment_events (id, provider, type, authorization_id, payload) VALUES (:id, :provider, :type, :authorization_id, :payload) ON CONFLICT (provider, id) DO NOTHING"
+	queryToSelectPaymentForAuth = "SELECT * FROM payments WHERE provider=$1 AND authorization_id=$2 FOR UPDATE"
+	queryToSelectPayment        = "SELECT * FROM payments WHERE id=$1"
+	queryToUpdatePaymentStatus  = "UPDATE payments SET status=$1, captured_amount=$2, refunded_amount=$3, updated_at=NOW() WHERE id=$4"
+	queryToSelectPaymentRefunds = "SELECT * FROM refunds WHERE payment_id=$1 ORDER BY id"
+	queryToSetEventOrderStatus  = "UPDATE orders SET status=$1, updated_at=NOW() WHERE id=$2 AND status <> 'cancelled'"
+
+	queryToGetOrder          = "SELECT * FROM orders WHERE id=$1"
+	queryToSelectOrdersItems = "SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY order_id, id"
+
+	queryToLockOrder           = "SELECT * FROM orders WHERE id=$1 FOR UPDATE"
+	queryToCountOpenReturns    = "SELECT COUNT(*) FROM returns WHERE order_id=$1 AND status <> 'rejected'"
+	queryToRestoreOrderStock   = "UPDATE products p SET count_in_stock = p.count_in_stock + oi.quantity, version=p.version+1, updated_at=NOW() FROM (SELECT product_id, SUM(quantity) AS quantity FROM order_items WHERE order_id=$1 AND variant_id IS NULL GROUP BY product_id) oi WHERE p.id = oi.product_id"
+	queryToRestoreVariantStock = "UPDATE product_variants pv SET count_in_stock = pv.count_in_stock + oi.quantity, version=pv.version+1, updated_at=NOW() FROM (SELECT variant_id, SUM(quantity) AS quantity FROM order_items WHERE order_id=$1 AND variant_id IS NOT NULL GROUP BY variant_id) oi WHERE pv.id = oi.variant_id"
+	queryToMarkOrderCancelled  = "UPDATE orders SET status=$1, cancellation_reason=$2, cancelled_at=NOW(), updated_at=NOW() WHERE id=$3 RETURNING *"
+	queryToMarkOrderShipped    = "UPDATE orders SET status=$1, tracking_number=$2, shipped_at=NOW(), updated_at=NOW() WHERE id=$3 RETURNING *"
 )
 
 func NewPostgresStorer(db *sqlx.DB) *PostgresStorer {
 	return &PostgresStorer{db: db}
 }
 
+// CreateProduct добавляет товар и пишет событие product.created в той же транзакции.
 func (postgres *PostgresStorer) CreateProduct(ctx context.Context, p *domain.Product) (*domain.Product, error) {
-	rows, err := postgres.db.NamedQueryContext(ctx, queryToInsertProduct, p)
+	op := "storer.CreateProduct"
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertProduct(ctx, tx, p); err != nil {
+			if categoryErr := missingCategoryError(op, p.CategoryID, err); categoryErr != nil {
+				return categoryErr
+			}
+			if skuErr := duplicateSKUError(op, p.SKU, err); skuErr != nil {
+				return skuErr
+			}
+			return fmt.Errorf("Error inserting product: %w", err)
+		}
+		return insertProductEvent(ctx, tx, domain.EventProductCreated, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// insertProduct вставляет товар и сканирует созданную строку в p.
+func insertProduct(ctx context.Context, tx *sqlx.Tx, p *domain.Product) error {
+	rows, err := sqlx.NamedQueryContext(ctx, tx, queryToInsertProduct, p)
 	if err != nil {
-		return nil, fmt.Errorf("Error inserting product: %w", err)
+		return err
 	}
 	defer rows.Close()
 
-	if rows.Next() {
-		if err := rows.StructScan(p); err != nil {
-			return nil, fmt.Errorf("Error scanning rows: %w", err)
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
 		}
-	} else {
-		return nil, errors.New("product not created")
+		return errors.New("product not created")
 	}
-
-	return p, nil
+	if err := rows.StructScan(p); err != nil {
+		return fmt.Errorf("Error scanning rows: %w", err)
+	}
+	return nil
 }
 
 func (postgres *PostgresStorer) GetProduct(ctx context.Context, id int64) (*domain.Product, error) {
@@ -75,7 +132,7 @@ func (postgres *PostgresStorer) GetProductsByIDs(ctx context.Context, ids []int6
 	if len(ids) == 0 {
 		return []*domain.Product{}, nil
 	}
-	query := "SELECT * FROM products WHERE id IN (?)"
+	query := "SELECT * FROM products WHERE id IN (?) AND deleted_at IS NULL"
 	query, args, err := sqlx.In(query, ids)
 	if err != nil {
 		return nil, fmt.Errorf("Error building query: %w", err)
@@ -91,7 +148,7 @@ func (postgres *PostgresStorer) GetProductsByIDs(ctx context.Context, ids []int6
 
 func (postgres *PostgresStorer) GetProducts(ctx context.Context) ([]*domain.Product, error) {
 	products := []*domain.Product{}
-	err := postgres.db.SelectContext(ctx, &products, "SELECT * FROM products")
+	err := postgres.db.SelectContext(ctx, &products, "SELECT * FROM products WHERE deleted_at IS NULL")
 	if err != nil {
 		return nil, fmt.Errorf("Error getting products: %w", err)
 	}
@@ -102,44 +159,276 @@ func (postgres *PostgresStorer) GetProducts(ctx context.Context) ([]*domain.Prod
 	return products, nil
 }
 
+// UpdateProduct обновляет товар, только если его версия в базе равна p.Version,
+// и увеличивает версию на единицу. Событие product.updated пишется в той же транзакции.
 func (postgres *PostgresStorer) UpdateProduct(ctx context.Context, p *domain.Product) error {
 	op := "storer.UpdateProduct"
-	rows, err := postgres.db.NamedQueryContext(ctx, queryToUpdateProduct, p)
+	return postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		updated, err := updateProduct(ctx, tx, p)
+		if err != nil {
+			if categoryErr := missingCategoryError(op, p.CategoryID, err); categoryErr != nil {
+				return categoryErr
+			}
+			if skuErr := duplicateSKUError(op, p.SKU, err); skuErr != nil {
+				return skuErr
+			}
+			return fmt.Errorf("Error updating product with id %d: %w", p.ID, err)
+		}
+		if !updated {
+			return postgres.productVersionError(ctx, op, p.ID, p.Version)
+		}
+		return insertProductUpdatedEvent(ctx, tx, p)
+	})
+}
+
+// updateProduct выполняет условный UPDATE и сканирует результат в p. false - ни одна строка не подошла.
+func updateProduct(ctx context.Context, tx *sqlx.Tx, p *domain.Product) (bool, error) {
+	rows, err := sqlx.NamedQueryContext(ctx, tx, queryToUpdateProduct, p)
 	if err != nil {
-		return fmt.Errorf("Error updating product with id %d: %w", p.ID, err)
+		return false, err
 	}
 	defer rows.Close()
 
-	if rows.Next() {
-		if err := rows.StructScan(p); err != nil {
-			return fmt.Errorf("Error scanning updated product: %w", err)
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	if err := rows.StructScan(p); err != nil {
+		return false, fmt.Errorf("Error scanning updated product: %w", err)
+	}
+	return true, nil
+}
+
+// patchableProductColumns - колонки, которые можно менять через PatchProduct.
+// Имена колонок попадают в SQL как есть, поэтому принимаем только их.
+var patchableProductColumns = map[string]bool{
+	"sku":            true,
+	"name":           true,
+	"image":          true,
+	"category_id":    true,
+	"description":    true,
+	"price":          true,
+	"count_in_stock": true,
+}
+
+// PatchProduct обновляет только колонки из changes, если версия товара в базе равна version.
+// Как и UpdateProduct, пишет событие product.updated в той же транзакции.
+func (postgres *PostgresStorer) PatchProduct(ctx context.Context, id int64, version int64, changes map[string]interface{}) (*domain.Product, error) {
+	op := "storer.PatchProduct"
+	columns := make([]string, 0, len(changes))
+	for column := range changes {
+		if !patchableProductColumns[column] {
+			return nil, fmt.Errorf("operation %s: column %q cannot be patched", op, column)
 		}
-	} else {
-		return NewNotFoundError(op, "product", p.ID, nil)
+		columns = append(columns, column)
 	}
+	// Сортируем, чтобы текст запроса не зависел от порядка обхода map
+	slices.Sort(columns)
 
-	return nil
+	sets := make([]string, 0, len(columns)+2)
+	args := make([]interface{}, 0, len(columns)+2)
+	for _, column := range columns {
+		args = append(args, changes[column])
+		sets = append(sets, fmt.Sprintf("%s=$%d", column, len(args)))
+	}
+	sets = append(sets, "version=version+1", "updated_at=NOW()")
+	args = append(args, id, version)
+	query := fmt.Sprintf("UPDATE products SET %s WHERE id=$%d AND version=$%d AND deleted_at IS NULL RETURNING *",
+		strings.Join(sets, ", "), len(args)-1, len(args))
+
+	product := domain.Product{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &product, query, args...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return postgres.productVersionError(ctx, op, id, version)
+		}
+		if categoryErr := missingCategoryError(op, changes["category_id"], err); categoryErr != nil {
+			return categoryErr
+		}
+		if sku, ok := changes["sku"].(*string); ok {
+			if skuErr := duplicateSKUError(op, sku, err); skuErr != nil {
+				return skuErr
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Error patching product with id %d: %w", id, err)
+		}
+		return insertProductUpdatedEvent(ctx, tx, &product)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
 }
 
-func (postgres *PostgresStorer) DeleteProduct(ctx context.Context, id int64) error {
+// DeleteProduct мягко удаляет товар (проставляет deleted_at), только если его версия в базе равна version.
+// Строка остается, чтобы позиции старых заказов продолжали на нее ссылаться.
+// Событие product.deleted пишется в той же транзакции.
+func (postgres *PostgresStorer) DeleteProduct(ctx context.Context, id int64, version int64) error {
 	op := "storer.DeleteProduct"
-	res, err := postgres.db.ExecContext(ctx, "DELETE FROM products WHERE id=$1", id)
+	return postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, queryToDeleteProduct, id, version)
+		if err != nil {
+			return fmt.Errorf("failed delete product with id %d: %w", id, err)
+		}
+		rowsAffected, err := res.RowsAffected()
+
+		if err != nil {
+			return fmt.Errorf("cannot get affected rows for product with id %d: %w", id, err)
+		}
+
+		if rowsAffected == 0 {
+			return postgres.productVersionError(ctx, op, id, version)
+		}
+		return insertOutboxEvent(ctx, tx, "product", id, domain.EventProductDeleted,
+			productDeletedEventPayload{ProductID: id, Version: version + 1})
+	})
+}
+
+// AdjustProductStock атомарно меняет остаток на delta, не давая ему уйти в минус,
+// и пишет событие product.stock_changed в той же транзакции. Если задан variantID, меняется остаток
+// этого варианта товара и возвращается только вариант: у товара с вариантами своего остатка нет.
+func (postgres *PostgresStorer) AdjustProductStock(ctx context.Context, id int64, variantID *int64, delta int64) (*domain.Product, *domain.ProductVariant, error) {
+	op := "storer.AdjustProductStock"
+	if variantID != nil {
+		return postgres.adjustVariantStock(ctx, op, id, *variantID, delta)
+	}
+
+	product := domain.Product{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &product, queryToAdjustStock, delta, id); err != nil {
+			return err
+		}
+		return insertOutboxEvent(ctx, tx, "product", id, domain.EventProductStockChanged, productStockChangedEventPayload{
+			ProductID:    id,
+			Delta:        delta,
+			CountInStock: product.CountInStock,
+			Version:      product.Version,
+		})
+	})
+	if err == nil {
+		return &product, nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("error adjusting stock of product with id %d: %w", id, err)
+	}
+
+	// Ничего не обновилось: либо товара нет, либо остатка не хватает на списание
+	current, err := postgres.GetProduct(ctx, id)
 	if err != nil {
-		return fmt.Errorf("failed delete product with id %d: %w", id, err)
+		return nil, nil, err
 	}
-	rowsAffected, err := res.RowsAffected()
+	return nil, nil, NewInsufficientStockError(op, id, -delta, current.CountInStock)
+}
 
+// adjustVariantStock блокирует товар: событие пишется от его имени, и события товара должны идти по порядку.
+// Заодно вариант удаленного товара не меняется, как и сам товар.
+func (postgres *PostgresStorer) adjustVariantStock(ctx context.Context, op string, productID int64, variantID int64, delta int64) (*domain.Product, *domain.ProductVariant, error) {
+	variant := domain.ProductVariant{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockProduct(ctx, tx, op, productID); err != nil {
+			return err
+		}
+		if err := tx.GetContext(ctx, &variant, queryToAdjustVariantStock, delta, variantID, productID); err != nil {
+			return err
+		}
+		return insertOutboxEvent(ctx, tx, "product", productID, domain.EventProductStockChanged, productStockChangedEventPayload{
+			ProductID:    productID,
+			VariantID:    &variantID,
+			Delta:        delta,
+			CountInStock: variant.CountInStock,
+			Version:      variant.Version,
+		})
+	})
+	if err == nil {
+		return nil, &variant, nil
+	}
+	var notFoundErr *NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil, nil, notFoundErr
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, fmt.Errorf("error adjusting stock of product variant with id %d: %w", variantID, err)
+	}
+
+	var available int64
+	err = postgres.db.GetContext(ctx, &available, queryToSelectVariantStock, variantID, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, NewNotFoundError(op, "product variant", variantID, nil)
+	}
 	if err != nil {
-		return fmt.Errorf("cannot get affected rows for product with id %d: %w", id, err)
+		return nil, nil, fmt.Errorf("error getting stock of product variant with id %d: %w", variantID, err)
 	}
+	stockErr := NewInsufficientStockError(op, productID, -delta, available)
+	stockErr.VariantID = &variantID
+	return nil, nil, stockErr
+}
 
-	if rowsAffected == 0 {
-		return NewNotFoundError(op, "product", id, nil)
+// RestoreProduct возвращает мягко удаленный товар в каталог и пишет событие product.restored в той же транзакции.
+func (postgres *PostgresStorer) RestoreProduct(ctx context.Context, id int64) (*domain.Product, error) {
+	op := "storer.RestoreProduct"
+	product := domain.Product{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := tx.GetContext(ctx, &product, queryToRestoreProduct, id); err != nil {
+			return err
+		}
+		return insertProductEvent(ctx, tx, domain.EventProductRestored, &product)
+	})
+	if err == nil {
+		return &product, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error restoring product with id %d: %w", id, err)
+	}
+
+	// Ничего не обновилось: либо товара нет, либо он не удален
+	var exists bool
+	if err := postgres.db.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM products WHERE id=$1)", id); err != nil {
+		return nil, fmt.Errorf("error getting product with id %d: %w", id, err)
+	}
+	if !exists {
+		return nil, NewNotFoundError(op, "product", id, nil)
+	}
+	return nil, NewInvalidStateError(op, "product", id, "not deleted")
+}
+
+// missingCategoryError превращает нарушение внешнего ключа category_id в NotFoundError, иначе nil.
+func missingCategoryError(op string, categoryID interface{}, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolationCode {
+		return NewNotFoundError(op, "category", categoryID, err)
+	}
+	return nil
+}
+
+// duplicateSKUError превращает нарушение уникальности артикула в AlreadyExistsError, иначе nil.
+func duplicateSKUError(op string, sku *string, err error) error {
+	var pqErr *pq.Error
+	if sku != nil && errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+		return NewAlreadyExistsError(op, "product with sku", *sku, err)
 	}
 	return nil
 }
 
-func (postgres *PostgresStorer) CreateOrder(ctx context.Context, order *domain.Order) (*domain.Order, error) {
+// productVersionError выясняет, почему условный UPDATE/DELETE не затронул ни одной строки:
+// товара нет или его уже изменил кто-то другой.
+func (postgres *PostgresStorer) productVersionError(ctx context.Context, op string, id int64, expected int64) error {
+	var current int64
+	err := postgres.db.GetContext(ctx, &current, "SELECT version FROM products WHERE id=$1 AND deleted_at IS NULL", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewNotFoundError(op, "product", id, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting version of product with id %d: %w", id, err)
+	}
+	return NewVersionMismatchError(op, "product", id, expected, current)
+}
+
+// CreateOrder записывает заказ с позициями и списывает остатки. Если задан payment, он записывается как есть:
+// захваченный платеж сразу переводит заказ в paid. Платеж в статусе pending значит, что шлюз еще не вызывался:
+// деньги списываются после коммита, чтобы сетевой запрос не держал блокировки остатков, а результат
+// записывают CompleteOrderPayment или FailOrderPayment. Поэтому событие order.created для такого заказа
+// пишет CompleteOrderPayment, в остальных случаях оно пишется здесь.
+func (postgres *PostgresStorer) CreateOrder(ctx context.Context, order *domain.Order, payment *domain.Payment) (*domain.Order, error) {
 	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
 		// `createOrder` вернет тот же указатель, но с обновленным ID
 		var txErr error
@@ -152,13 +441,37 @@ func (postgres *PostgresStorer) CreateOrder(ctx context.Context, order *domain.O
 		for i := range order.Items {
 			// Присваиваем ID заказа каждому элементу
 			order.Items[i].OrderID = order.ID
+		}
+
+		if txErr = createOrderItems(ctx, tx, order.Items); txErr != nil {
+			return fmt.Errorf("error creating order item rows: %w", txErr)
+		}
 
-			txErr = createOrderItem(ctx, tx, &order.Items[i])
-			if txErr != nil {
-				return fmt.Errorf("error creating order item row: %w", txErr)
+		if txErr = decreaseStock(ctx, tx, order.Items); txErr != nil {
+			return txErr
+		}
+
+		if payment == nil {
+			return insertOrderCreatedEvent(ctx, tx, order)
+		}
+
+		payment.OrderID = order.ID
+		if txErr = createPayment(ctx, tx, payment); txErr != nil {
+			return fmt.Errorf("error creating payment row: %w", txErr)
+		}
+		order.Payment = payment
+
+		switch payment.Status {
+		case domain.PaymentStatusPending:
+			return nil
+		case domain.PaymentStatusCaptured:
+			if _, txErr = tx.ExecContext(ctx, queryToSetOrderStatus, domain.OrderStatusPaid, order.ID); txErr != nil {
+				return fmt.Errorf("error updating order status: %w", txErr)
 			}
+			order.Status = domain.OrderStatusPaid
 		}
-		return nil
+		// Событие пишется последним, чтобы в нем был итоговый статус заказа
+		return insertOrderCreatedEvent(ctx, tx, order)
 	})
 	if err != nil {
 		return nil, err // Возвращаем ошибку, если транзакция не удалась
@@ -167,6 +480,88 @@ func (postgres *PostgresStorer) CreateOrder(ctx context.Context, order *domain.O
 	return order, nil
 }
 
+// CompleteOrderPayment записывает списание по pending-платежу заказа, созданного CreateOrder:
+// платеж становится captured, заказ - paid, и пишется событие order.created.
+// Пока шлюз списывал деньги, заказ могли отменить: тогда возвращается InvalidStateError,
+// а списанные деньги должен вернуть вызывающий.
+func (postgres *PostgresStorer) CompleteOrderPayment(ctx context.Context, order *domain.Order, authorizationID string, amount float64) error {
+	op := "storer.CompleteOrderPayment"
+	payment := domain.Payment{}
+	return postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockPendingOrder(ctx, tx, op, order.ID); err != nil {
+			return err
+		}
+
+		err := tx.GetContext(ctx, &payment, queryToCapturePayment, domain.PaymentStatusCaptured, amount, authorizationID, order.Payment.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewInvalidStateError(op, "payment", order.Payment.ID, "not pending")
+		}
+		if err != nil {
+			return fmt.Errorf("error capturing payment with id %d: %w", order.Payment.ID, err)
+		}
+		if _, err := tx.ExecContext(ctx, queryToSetOrderStatus, domain.OrderStatusPaid, order.ID); err != nil {
+			return fmt.Errorf("error updating order status: %w", err)
+		}
+
+		order.Payment = &payment
+		order.Status = domain.OrderStatusPaid
+		return insertOrderCreatedEvent(ctx, tx, order)
+	})
+}
+
+// FailOrderPayment отмечает pending-платеж заказа неуспешным, возвращает товары на склад и отменяет заказ.
+// Событий нет: о заказе подписчики еще не знали, order.created пишется только после списания.
+// Заказ, который уже отменили, не трогается: его товары уже вернул CancelOrder.
+func (postgres *PostgresStorer) FailOrderPayment(ctx context.Context, order *domain.Order, reason string) error {
+	op := "storer.FailOrderPayment"
+	return postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockPendingOrder(ctx, tx, op, order.ID); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, queryToFailPendingPayment, domain.PaymentStatusFailed, order.Payment.ID)
+		if err != nil {
+			return fmt.Errorf("error failing payment with id %d: %w", order.Payment.ID, err)
+		}
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("cannot get affected rows for payment with id %d: %w", order.Payment.ID, err)
+		}
+		if rowsAffected == 0 {
+			return NewInvalidStateError(op, "payment", order.Payment.ID, "not pending")
+		}
+
+		if _, err := tx.ExecContext(ctx, queryToRestoreOrderStock, order.ID); err != nil {
+			return fmt.Errorf("error restoring stock for order with id %d: %w", order.ID, err)
+		}
+		if _, err := tx.ExecContext(ctx, queryToRestoreVariantStock, order.ID); err != nil {
+			return fmt.Errorf("error restoring variant stock for order with id %d: %w", order.ID, err)
+		}
+		if err := tx.GetContext(ctx, order, queryToMarkOrderCancelled, domain.OrderStatusCancelled, reason, order.ID); err != nil {
+			return fmt.Errorf("error cancelling order with id %d: %w", order.ID, err)
+		}
+		order.Payment.Status = domain.PaymentStatusFailed
+		return nil
+	})
+}
+
+// lockPendingOrder блокирует заказ и проверяет, что он все еще ждет оплаты.
+// Под той же блокировкой заказ отменяет CancelOrder, поэтому итог оплаты и отмена не пересекаются.
+func lockPendingOrder(ctx context.Context, tx *sqlx.Tx, op string, id int64) error {
+	order := domain.Order{}
+	err := tx.GetContext(ctx, &order, queryToLockOrder, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewNotFoundError(op, "order", id, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting order with id %d: %w", id, err)
+	}
+	if order.Status != domain.OrderStatusPending {
+		return NewInvalidStateError(op, "order", id, order.Status)
+	}
+	return nil
+}
+
 func createOrder(ctx context.Context, tx *sqlx.Tx, order *domain.Order) (*domain.Order, error) {
 	stmt, err := tx.PrepareNamedContext(ctx, queryToInsertOrder)
 	if err != nil {
@@ -192,46 +587,232 @@ func createOrder(ctx context.Context, tx *sqlx.Tx, order *domain.Order) (*domain
 	return order, nil
 }
 
-func createOrderItem(ctx context.Context, tx *sqlx.Tx, orderItem *domain.OrderItem) error {
-	stmt, err := tx.PrepareNamedContext(ctx, queryToInsertOrderItem)
+// insertedOrderItem - вставленная позиция и ее номер (с 1) в переданных массивах.
+type insertedOrderItem struct {
+	domain.OrderItem
+	Ordinal int64 `db:"ordinal"`
+}
 
+// createOrderItems вставляет позиции заказа одним INSERT из массивов и проставляет им id.
+// Порядок строк в RETURNING Postgres не обещает, поэтому каждая строка возвращается со своим
+// номером из WITH ORDINALITY: id берутся из последовательности заранее, по ним номер
+// и сопоставляется со вставленной строкой.
+func createOrderItems(ctx context.Context, tx *sqlx.Tx, items []domain.OrderItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	names := make([]string, len(items))
+	quantities := make([]int64, len(items))
+	images := make([]string, len(items))
+	prices := make([]float64, len(items))
+	productIDs := make([]int64, len(items))
+	variantIDs := make([]sql.NullInt64, len(items))
+	for i, item := range items {
+		names[i], quantities[i], images[i], prices[i], productIDs[i] = item.Name, item.Quantity, item.Image, item.Price, item.ProductID
+		if item.VariantID != nil {
+			variantIDs[i] = sql.NullInt64{Int64: *item.VariantID, Valid: true}
+		}
+	}
+
+	var inserted []insertedOrderItem
+	err := tx.SelectContext(ctx, &inserted, queryToInsertOrderItems, pq.Array(names), pq.Array(quantities), pq.Array(images),
+		pq.Array(prices), pq.Array(productIDs), pq.Array(variantIDs), items[0].OrderID)
 	if err != nil {
-		return fmt.Errorf("Error creating statement: %w", err)
+		return fmt.Errorf("Error creating orderItems: %w", err)
+	}
+	if len(inserted) != len(items) {
+		return fmt.Errorf("expected %d inserted order items, got %d", len(items), len(inserted))
+	}
+	for _, row := range inserted {
+		if row.Ordinal < 1 || row.Ordinal > int64(len(items)) {
+			return fmt.Errorf("unexpected ordinal %d of inserted order item", row.Ordinal)
+		}
+		items[row.Ordinal-1] = row.OrderItem
 	}
+	return nil
+}
 
-	defer stmt.Close()
-	rows, err := stmt.QueryxContext(ctx, orderItem)
+// decreaseStock списывает остатки по всем позициям заказа: одним UPDATE для товаров
+// и одним для вариантов. Одинаковые товары и варианты в разных позициях суммируются.
+func decreaseStock(ctx context.Context, tx *sqlx.Tx, items []domain.OrderItem) error {
+	var products, variants []domain.OrderItem
+	for _, item := range items {
+		if item.VariantID != nil {
+			variants = append(variants, item)
+		} else {
+			products = append(products, item)
+		}
+	}
 
+	err := decreaseStockBatch(ctx, tx, products, "product", queryToDecreaseStock, "SELECT count_in_stock FROM products WHERE id=$1 AND deleted_at IS NULL",
+		func(item domain.OrderItem) int64 { return item.ProductID })
 	if err != nil {
-		return fmt.Errorf("Error creating orderItem: %w", err)
+		return err
 	}
+	return decreaseStockBatch(ctx, tx, variants, "product variant", queryToDecreaseVariantStock, "SELECT count_in_stock FROM product_variants WHERE id=$1",
+		func(item domain.OrderItem) int64 { return *item.VariantID })
+}
 
-	defer rows.Close()
+// decreaseStockBatch списывает остатки строк, которые key выбирает из позиций.
+// decreaseQuery принимает массивы id и количеств и возвращает id строк, где остатка хватило.
+// Строки, которых нет (удаленный товар), decreaseQuery не возвращает - для них NotFoundError.
+func decreaseStockBatch(ctx context.Context, tx *sqlx.Tx, items []domain.OrderItem, resource string, decreaseQuery string, stockQuery string, key func(domain.OrderItem) int64) error {
+	op := "storer.decreaseStock"
+	requested := map[int64]int64{}
+	var ids []int64
+	for _, item := range items {
+		if _, ok := requested[key(item)]; !ok {
+			ids = append(ids, key(item))
+		}
+		requested[key(item)] += item.Quantity
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	// Строки блокируются в порядке id: иначе два заказа с теми же товарами в обратном
+	// порядке корзины захватят блокировки навстречу друг другу и упрутся в дедлок
+	slices.Sort(ids)
 
-	if !rows.Next() {
-		return fmt.Errorf("No rows selected: %w", err)
+	quantities := make([]int64, len(ids))
+	for i, id := range ids {
+		quantities[i] = requested[id]
 	}
-	if err := rows.StructScan(orderItem); err != nil {
-		return fmt.Errorf("Error scanning rows: %w", err)
+
+	var updated []int64
+	err := tx.SelectContext(ctx, &updated, decreaseQuery, pq.Array(ids), pq.Array(quantities))
+	if err != nil {
+		return fmt.Errorf("error decreasing stock: %w", err)
+	}
+	if len(updated) == len(ids) {
+		return nil
 	}
 
+	// Остатка не хватило (его успели выкупить после проверки в сервисе) или товар удален - узнаем, что именно
+	for _, item := range items {
+		id := key(item)
+		if slices.Contains(updated, id) {
+			continue
+		}
+		var available int64
+		err := tx.GetContext(ctx, &available, stockQuery, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, resource, id, err)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting stock for id %d: %w", id, err)
+		}
+		stockErr := NewInsufficientStockError(op, item.ProductID, requested[id], available)
+		stockErr.VariantID = item.VariantID
+		return stockErr
+	}
 	return nil
 }
 
-func (postgres *PostgresStorer) GetOrder(ctx context.Context, id int64) (*domain.Order, error) {
-	order := &domain.Order{}
-	rows, err := postgres.db.NamedQueryContext(ctx, queryToGetOrder, id)
+func createPayment(ctx context.Context, tx *sqlx.Tx, payment *domain.Payment) error {
+	stmt, err := tx.PrepareNamedContext(ctx, queryToInsertPayment)
 	if err != nil {
-		return nil, fmt.Errorf("Error getting order: %w", err)
+		return fmt.Errorf("Error creating statement: %w", err)
 	}
-	defer rows.Close()
+	defer stmt.Close()
 
-	if rows.Next() {
-		if err := rows.StructScan(order); err != nil {
-			return nil, fmt.Errorf("Error scanning rows: %w", err)
+	if err := stmt.GetContext(ctx, payment, payment); err != nil {
+		return fmt.Errorf("Error creating payment: %w", err)
+	}
+
+	return nil
+}
+
+// PaymentEventFunc применяет событие шлюза к заблокированному платежу и возвращает
+// новый статус заказа (пустая строка - статус заказа не меняется).
+// refunds - уже записанные возвраты платежа: по ним событие о нашем же возврате отличается от возврата в шлюзе.
+type PaymentEventFunc func(payment *domain.Payment, refunds []domain.Refund) (orderStatus string, err error)
+
+// ApplyPaymentEvent в одной транзакции записывает событие и меняет платёж и заказ.
+// Повторно присланное событие ничего не меняет и возвращает applied=false.
+// Отмененный заказ остается отмененным, какое бы событие ни пришло по его платежу.
+func (postgres *PostgresStorer) ApplyPaymentEvent(ctx context.Context, event *domain.PaymentEvent, apply PaymentEventFunc) (bool, error) {
+	op := "storer.ApplyPaymentEvent"
+	applied := false
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(ctx, queryToInsertPaymentEvent, event)
+		if err != nil {
+			return fmt.Errorf("error inserting payment event %s: %w", event.ID, err)
 		}
-	} else {
-		return nil, fmt.Errorf("Order with id %d not found", id)
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("cannot get affected rows for payment event %s: %w", event.ID, err)
+		}
+		if rowsAffected == 0 {
+			// Событие уже обработано
+			return nil
+		}
+
+		payment := domain.Payment{}
+		err = tx.GetContext(ctx, &payment, queryToSelectPaymentForAuth, event.Provider, event.AuthorizationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "payment", event.AuthorizationID, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting payment for authorization %s: %w", event.AuthorizationID, err)
+		}
+
+		var refunds []domain.Refund
+		if err := tx.SelectContext(ctx, &refunds, queryToSelectPaymentRefunds, payment.ID); err != nil {
+			return fmt.Errorf("error getting refunds for payment with id %d: %w", payment.ID, err)
+		}
+
+		refundedBefore := payment.RefundedAmount
+		orderStatus, err := apply(&payment, refunds)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, queryToUpdatePaymentStatus, payment.Status, payment.CapturedAmount, payment.RefundedAmount, payment.ID); err != nil {
+			return fmt.Errorf("error updating payment with id %d: %w", payment.ID, err)
+		}
+		// Возврат, сделанный на стороне шлюза, учитывается в заказе так же, как наш
+		if refunded := payment.RefundedAmount - refundedBefore; refunded > 0 {
+			if _, err := tx.ExecContext(ctx, queryToAddOrderRefund, refunded, payment.OrderID); err != nil {
+				return fmt.Errorf("error updating order with id %d: %w", payment.OrderID, err)
+			}
+		}
+		if orderStatus != "" {
+			if _, err := tx.ExecContext(ctx, queryToSetEventOrderStatus, orderStatus, payment.OrderID); err != nil {
+				return fmt.Errorf("error updating order status: %w", err)
+			}
+		}
+
+		applied = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return applied, nil
+}
+
+func (postgres *PostgresStorer) GetPayment(ctx context.Context, id int64) (*domain.Payment, error) {
+	op := "storer.GetPayment"
+	payment := &domain.Payment{}
+	err := postgres.db.GetContext(ctx, payment, queryToSelectPayment, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "payment", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting payment with id %d: %w", id, err)
+	}
+	return payment, nil
+}
+
+func (postgres *PostgresStorer) GetOrder(ctx context.Context, id int64) (*domain.Order, error) {
+	op := "storer.GetOrder"
+	order := &domain.Order{}
+	err := postgres.db.GetContext(ctx, order, queryToGetOrder, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "order", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting order: %w", err)
 	}
 
 	var items []domain.OrderItem
@@ -239,32 +820,216 @@ func (postgres *PostgresStorer) GetOrder(ctx context.Context, id int64) (*domain
 	if err != nil {
 		return nil, fmt.Errorf("error getting orderItems: %w", err)
 	}
-
 	order.Items = items
 
+	var payments []domain.Payment
+	err = postgres.db.SelectContext(ctx, &payments, "SELECT * FROM payments WHERE order_id=$1 ORDER BY id DESC LIMIT 1", id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting payment: %w", err)
+	}
+	if len(payments) > 0 {
+		order.Payment = &payments[0]
+	}
+
+	order.Refunds, err = postgres.GetRefundsByOrderID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
 	return order, nil
 
 }
 
-func (postgres *PostgresStorer) GetOrders(ctx context.Context) ([]*domain.Order, error) {
+// OrderFilter - условия выборки заказов. Нулевые значения полей не ограничивают выборку.
+type OrderFilter struct {
+	UserID   int64
+	Status   string
+	From     *time.Time // created_at >= From
+	To       *time.Time // created_at < To
+	MinTotal *float64
+	MaxTotal *float64
+	Limit    int64
+	Offset   int64
+}
+
+func (f OrderFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.UserID != 0 {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+	if f.MinTotal != nil {
+		add("total_price >= $%d", *f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		add("total_price <= $%d", *f.MaxTotal)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// GetOrders возвращает страницу заказов, новые первыми.
+func (postgres *PostgresStorer) GetOrders(ctx context.Context, filter OrderFilter) ([]*domain.Order, error) {
+	where, args := filter.where()
+	query := "SELECT * FROM orders" + where + " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
 	orders := []*domain.Order{}
-	err := postgres.db.SelectContext(ctx, &orders, "SELECT * FROM orders")
+	err := postgres.db.SelectContext(ctx, &orders, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error getting orders: %w", err)
 	}
 
-	for i := range orders {
-		var items []domain.OrderItem
-		err = postgres.db.SelectContext(ctx, &items, "SELECT * FROM order_items WHERE order_id=$1", orders[i].ID)
+	if err := loadOrderItems(ctx, postgres.db, orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// loadOrderItems одним запросом подгружает позиции для всей страницы заказов.
+func loadOrderItems(ctx context.Context, q sqlx.QueryerContext, orders []*domain.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(orders))
+	byID := make(map[int64]*domain.Order, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+		byID[order.ID] = order
+	}
+
+	var items []domain.OrderItem
+	err := sqlx.SelectContext(ctx, q, &items, queryToSelectOrdersItems, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error getting orderItems: %w", err)
+	}
+
+	for _, item := range items {
+		if order, ok := byID[item.OrderID]; ok {
+			order.Items = append(order.Items, item)
+		}
+	}
+	return nil
+}
 
+func (postgres *PostgresStorer) CountOrders(ctx context.Context, filter OrderFilter) (int64, error) {
+	where, args := filter.where()
+	var count int64
+	if err := postgres.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM orders"+where, args...); err != nil {
+		return 0, fmt.Errorf("error counting orders: %w", err)
+	}
+	return count, nil
+}
+
+// CancelOrder отменяет заказ, если он сейчас в одном из статусов from: возвращает товары на склад,
+// записывает возврат денег (если заказ был оплачен) и причину - всё в одной транзакции.
+// Возврат создается в статусе pending, как в CreateRefund; nil - возвращать нечего.
+func (postgres *PostgresStorer) CancelOrder(ctx context.Context, id int64, from []string, reason string, refundFn RefundFunc) (*domain.Order, *domain.Refund, error) {
+	op := "storer.CancelOrder"
+	order := &domain.Order{}
+	var refund *domain.Refund
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, order, queryToLockOrder, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "order", id, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting order with id %d: %w", id, err)
+		}
+		if !slices.Contains(from, order.Status) {
+			return NewInvalidStateError(op, "order", id, order.Status)
+		}
+
+		// Возвраты по заказу уже сами вернули (или вернут) товар на склад
+		var openReturns int64
+		if err := tx.GetContext(ctx, &openReturns, queryToCountOpenReturns, id); err != nil {
+			return fmt.Errorf("error counting returns for order with id %d: %w", id, err)
+		}
+		if openReturns > 0 {
+			return NewInvalidStateError(op, "order", id, "being returned")
+		}
+
+		if _, err := tx.ExecContext(ctx, queryToRestoreOrderStock, id); err != nil {
+			return fmt.Errorf("error restoring stock for order with id %d: %w", id, err)
+		}
+		if _, err := tx.ExecContext(ctx, queryToRestoreVariantStock, id); err != nil {
+			return fmt.Errorf("error restoring variant stock for order with id %d: %w", id, err)
+		}
+		// Шлюз мог еще не ответить по платежу заказа: платеж закрывается здесь же,
+		// и CompleteOrderPayment уже не переведет отмененный заказ в paid
+		if _, err := tx.ExecContext(ctx, queryToFailOrderPayments, domain.PaymentStatusFailed, id); err != nil {
+			return fmt.Errorf("error failing pending payments for order with id %d: %w", id, err)
+		}
+
+		payment, err := lockRefundablePayment(ctx, tx, id)
 		if err != nil {
-			return nil, fmt.Errorf("error getting orderItems: %w", err)
+			return err
+		}
+		if payment != nil {
+			refund = &domain.Refund{OrderID: id, Reason: "order cancelled: " + reason}
+			if err := createRefund(ctx, tx, payment, refund, refundFn); err != nil {
+				return err
+			}
 		}
 
-		orders[i].Items = items
+		if err := tx.GetContext(ctx, order, queryToMarkOrderCancelled, domain.OrderStatusCancelled, reason, id); err != nil {
+			return fmt.Errorf("error cancelling order with id %d: %w", id, err)
+		}
+		return insertOrderCancelledEvent(ctx, tx, order)
+	})
+	if err != nil {
+		return nil, nil, err
 	}
+	return order, refund, nil
+}
 
-	return orders, nil
+// ShipOrder отмечает оплаченный заказ отправленным и записывает событие order.shipped.
+func (postgres *PostgresStorer) ShipOrder(ctx context.Context, id int64, trackingNumber *string) (*domain.Order, error) {
+	op := "storer.ShipOrder"
+	order := &domain.Order{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, order, queryToLockOrder, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "order", id, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting order with id %d: %w", id, err)
+		}
+		if order.Status != domain.OrderStatusPaid {
+			return NewInvalidStateError(op, "order", id, order.Status)
+		}
+
+		if err := tx.GetContext(ctx, order, queryToMarkOrderShipped, domain.OrderStatusShipped, trackingNumber, id); err != nil {
+			return fmt.Errorf("error shipping order with id %d: %w", id, err)
+		}
+		return insertOrderShippedEvent(ctx, tx, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
 }
 
 func (postgres *PostgresStorer) DeleteOrder(ctx context.Context, id int64) error {
@@ -289,6 +1054,19 @@ func (postgres *PostgresStorer) DeleteOrder(ctx context.Context, id int64) error
 	return nil
 }
 
+// Все таблицы приложения, кроме служебной таблицы миграций
+const queryToTruncateAll = `TRUNCATE TABLE "product_images", "reviews", "refunds", "returns", "payment_events", "payments", "outbox_events",
+	"webhook_deliveries", "webhook_subscriptions", "jobs", "password_reset_tokens", "order_items", "orders", "product_variants", "product_options", "products", "categories", "users" RESTART IDENTITY CASCADE`
+
+// TruncateAll удаляет все данные и сбрасывает последовательности id. Нужен только для локальной
+// разработки (seed -reset): файлы картинок в BlobStore остаются.
+func (postgres *PostgresStorer) TruncateAll(ctx context.Context) error {
+	if _, err := postgres.db.ExecContext(ctx, queryToTruncateAll); err != nil {
+		return fmt.Errorf("error truncating tables: %w", err)
+	}
+	return nil
+}
+
 func (postgres *PostgresStorer) execTx(ctx context.Context, fn func(*sqlx.Tx) error) error {
 	tx, err := postgres.db.BeginTxx(ctx, nil)
 
@@ -0,0 +1,146 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	queryToInsertCategory       = "INSERT INTO categories (parent_id, name, slug) VALUES (:parent_id, :name, :slug) RETURNING *"
+	queryToSelectCategoryBySlug = "SELECT * FROM categories WHERE slug=$1"
+	queryToUpdateCategory       = "UPDATE categories SET parent_id=:parent_id, name=:name, slug=:slug, updated_at=NOW() WHERE id=:id RETURNING *"
+
+	// Категория сама и все её потомки
+	queryToSelectCategoryTree = "WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id=$1 UNION ALL SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id) SELECT id FROM tree"
+	queryToSelectTreeProducts = "WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id=$1 UNION ALL SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id) SELECT p.* FROM products p JOIN tree ON p.category_id = tree.id WHERE p.deleted_at IS NULL ORDER BY p.id"
+
+	// Категория и новый родитель со всеми его предками, блокируются в порядке id
+	queryToLockCategoryPath = "WITH RECURSIVE path AS (SELECT id, parent_id FROM categories WHERE id=$2 UNION ALL SELECT c.id, c.parent_id FROM categories c JOIN path p ON c.id = p.parent_id) SELECT id FROM categories WHERE id=$1 OR id IN (SELECT id FROM path) ORDER BY id FOR UPDATE"
+
+	foreignKeyViolationCode = "23503"
+)
+
+func (postgres *PostgresStorer) CreateCategory(ctx context.Context, c *domain.Category) (*domain.Category, error) {
+	op := "storer.CreateCategory"
+	rows, err := postgres.db.NamedQueryContext(ctx, queryToInsertCategory, c)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			return nil, NewAlreadyExistsError(op, "category", c.Slug, err)
+		}
+		return nil, fmt.Errorf("Error inserting category: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("category not created")
+	}
+	if err := rows.StructScan(c); err != nil {
+		return nil, fmt.Errorf("Error scanning rows: %w", err)
+	}
+	return c, nil
+}
+
+func (postgres *PostgresStorer) GetCategoryBySlug(ctx context.Context, slug string) (*domain.Category, error) {
+	op := "storer.GetCategoryBySlug"
+	category := domain.Category{}
+	err := postgres.db.GetContext(ctx, &category, queryToSelectCategoryBySlug, slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "category", slug, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting category: %w", err)
+	}
+	return &category, nil
+}
+
+func (postgres *PostgresStorer) GetCategories(ctx context.Context) ([]*domain.Category, error) {
+	categories := []*domain.Category{}
+	err := postgres.db.SelectContext(ctx, &categories, "SELECT * FROM categories ORDER BY parent_id NULLS FIRST, name")
+	if err != nil {
+		return nil, fmt.Errorf("Error getting categories: %w", err)
+	}
+	return categories, nil
+}
+
+// UpdateCategory перезаписывает категорию. Новый родитель не может быть самой категорией
+// или её потомком, иначе дерево превратится в цикл.
+//
+// Категория и цепочка предков нового родителя блокируются до проверки: два встречных
+// переноса (A под B и B под A) блокируют одни и те же строки, и второй проверяет дерево
+// уже после коммита первого.
+func (postgres *PostgresStorer) UpdateCategory(ctx context.Context, c *domain.Category) error {
+	op := "storer.UpdateCategory"
+	return postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if c.ParentID != nil {
+			var locked []int64
+			if err := tx.SelectContext(ctx, &locked, queryToLockCategoryPath, c.ID, *c.ParentID); err != nil {
+				return fmt.Errorf("error locking categories: %w", err)
+			}
+
+			var tree []int64
+			if err := tx.SelectContext(ctx, &tree, queryToSelectCategoryTree, c.ID); err != nil {
+				return fmt.Errorf("error getting subcategories of category with id %d: %w", c.ID, err)
+			}
+			if slices.Contains(tree, *c.ParentID) {
+				return NewInvalidStateError(op, "category", c.ID, fmt.Sprintf("an ancestor of category with id %d", *c.ParentID))
+			}
+		}
+
+		stmt, err := tx.PrepareNamedContext(ctx, queryToUpdateCategory)
+		if err != nil {
+			return fmt.Errorf("Error creating statement: %w", err)
+		}
+		defer stmt.Close()
+
+		err = stmt.GetContext(ctx, c, c)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "category", c.ID, nil)
+		}
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			return NewAlreadyExistsError(op, "category", c.Slug, err)
+		}
+		if err != nil {
+			return fmt.Errorf("Error updating category with id %d: %w", c.ID, err)
+		}
+		return nil
+	})
+}
+
+// DeleteCategory удаляет пустую категорию: без подкатегорий и без товаров, в том числе удаленных.
+func (postgres *PostgresStorer) DeleteCategory(ctx context.Context, id int64) error {
+	op := "storer.DeleteCategory"
+	res, err := postgres.db.ExecContext(ctx, "DELETE FROM categories WHERE id=$1", id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolationCode {
+			return NewInvalidStateError(op, "category", id, "not empty")
+		}
+		return fmt.Errorf("failed delete category with id %d: %w", id, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows for category with id %d: %w", id, err)
+	}
+	if rowsAffected == 0 {
+		return NewNotFoundError(op, "category", id, nil)
+	}
+	return nil
+}
+
+// GetCategoryProducts возвращает товары категории и всех её подкатегорий.
+func (postgres *PostgresStorer) GetCategoryProducts(ctx context.Context, categoryID int64) ([]*domain.Product, error) {
+	products := []*domain.Product{}
+	if err := postgres.db.SelectContext(ctx, &products, queryToSelectTreeProducts, categoryID); err != nil {
+		return nil, fmt.Errorf("Error getting products of category with id %d: %w", categoryID, err)
+	}
+	return products, nil
+}
@@ -0,0 +1,188 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+var categoryColumns = []string{"id", "parent_id", "name", "slug", "created_at", "updated_at"}
+
+func TestCreateCategory(t *testing.T) {
+	insertQuery := regexp.QuoteMeta("INSERT INTO categories (parent_id, name, slug) VALUES ($1, $2, $3) RETURNING *")
+	parentID := int64(1)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(insertQuery).
+					WithArgs(&parentID, "Phones", "phones").
+					WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(2, 1, "Phones", "phones", time.Now(), nil))
+
+				category, err := postgresTest.CreateCategory(context.Background(), &domain.Category{ParentID: &parentID, Name: "Phones", Slug: "phones"})
+				require.NoError(t, err)
+				require.Equal(t, int64(2), category.ID)
+				require.Equal(t, int64(1), *category.ParentID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "duplicate slug",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(insertQuery).
+					WillReturnError(&pq.Error{Code: uniqueViolationCode})
+
+				_, err := postgresTest.CreateCategory(context.Background(), &domain.Category{Name: "Phones", Slug: "phones"})
+				var existsErr *AlreadyExistsError
+				require.ErrorAs(t, err, &existsErr)
+				require.Equal(t, "phones", existsErr.Key)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestUpdateCategory(t *testing.T) {
+	treeQuery := regexp.QuoteMeta("WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id=$1 UNION ALL SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id) SELECT id FROM tree")
+	lockQuery := regexp.QuoteMeta("WITH RECURSIVE path AS (SELECT id, parent_id FROM categories WHERE id=$2 UNION ALL SELECT c.id, c.parent_id FROM categories c JOIN path p ON c.id = p.parent_id) SELECT id FROM categories WHERE id=$1 OR id IN (SELECT id FROM path) ORDER BY id FOR UPDATE")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "move under another branch",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				parentID := int64(5)
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(2, 5).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(5))
+				mock.ExpectQuery(treeQuery).WithArgs(2).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2).AddRow(3))
+				mock.ExpectPrepare(regexp.QuoteMeta("UPDATE categories SET parent_id=$1, name=$2, slug=$3, updated_at=NOW() WHERE id=$4 RETURNING *")).
+					ExpectQuery().
+					WithArgs(&parentID, "Phones", "phones", 2).
+					WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(2, 5, "Phones", "phones", time.Now(), time.Now()))
+				mock.ExpectCommit()
+
+				err := postgresTest.UpdateCategory(context.Background(), &domain.Category{ID: 2, ParentID: &parentID, Name: "Phones", Slug: "phones"})
+				require.NoError(t, err)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "move under own descendant",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				parentID := int64(3)
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(2, 3).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+				mock.ExpectQuery(treeQuery).WithArgs(2).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2).AddRow(3))
+				mock.ExpectRollback()
+
+				err := postgresTest.UpdateCategory(context.Background(), &domain.Category{ID: 2, ParentID: &parentID, Name: "Phones", Slug: "phones"})
+				var stateErr *InvalidStateError
+				require.ErrorAs(t, err, &stateErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "move to the root does not lock",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectPrepare(regexp.QuoteMeta("UPDATE categories SET parent_id=$1")).
+					ExpectQuery().
+					WithArgs(nil, "Phones", "phones", 2).
+					WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(2, nil, "Phones", "phones", time.Now(), time.Now()))
+				mock.ExpectCommit()
+
+				err := postgresTest.UpdateCategory(context.Background(), &domain.Category{ID: 2, Name: "Phones", Slug: "phones"})
+				require.NoError(t, err)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestDeleteCategory(t *testing.T) {
+	deleteQuery := regexp.QuoteMeta("DELETE FROM categories WHERE id=$1")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(deleteQuery).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				require.NoError(t, postgresTest.DeleteCategory(context.Background(), 2))
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "category has products or subcategories",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(deleteQuery).WithArgs(2).WillReturnError(&pq.Error{Code: foreignKeyViolationCode})
+
+				err := postgresTest.DeleteCategory(context.Background(), 2)
+				var stateErr *InvalidStateError
+				require.ErrorAs(t, err, &stateErr)
+				require.Equal(t, "not empty", stateErr.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestGetCategoryProducts(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id=$1 UNION ALL SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id) SELECT p.* FROM products p JOIN tree ON p.category_id = tree.id WHERE p.deleted_at IS NULL ORDER BY p.id")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "category_id"}).
+				AddRow(10, "phone", 1).
+				AddRow(11, "case", 4))
+
+		products, err := NewPostgresStorer(db).GetCategoryProducts(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, products, 2)
+		require.Equal(t, int64(4), products[1].CategoryID)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
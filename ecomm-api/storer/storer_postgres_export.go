@@ -0,0 +1,140 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Сколько строк читается с сервера за один FETCH. Память выгрузки ограничена одной такой порцией.
+const exportFetchSize = 1000
+
+// Выгрузка идет в одном снимке базы, иначе заказ и его позиции могли бы разойтись
+const queryToSetExportTx = "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY"
+
+// ProductExportFilter - условия выгрузки товаров. Нулевые значения полей не ограничивают выборку.
+type ProductExportFilter struct {
+	CategoryID     int64 // Вместе с подкатегориями
+	UpdatedSince   *time.Time
+	InStock        bool
+	OutOfStock     bool
+	IncludeDeleted bool
+}
+
+// query строит выборку товаров по фильтру в порядке id. afterID > 0 оставляет только товары после него.
+func (f ProductExportFilter) query(afterID int64) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.CategoryID != 0 {
+		add("category_id IN (WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id=$%d UNION ALL SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id) SELECT id FROM tree)", f.CategoryID)
+	}
+	if f.UpdatedSince != nil {
+		add("COALESCE(updated_at, created_at) >= $%d", *f.UpdatedSince)
+	}
+	if f.InStock {
+		conditions = append(conditions, "count_in_stock > 0")
+	}
+	if f.OutOfStock {
+		conditions = append(conditions, "count_in_stock = 0")
+	}
+	if !f.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if afterID > 0 {
+		add("id > $%d", afterID)
+	}
+
+	query := "SELECT * FROM products"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query + " ORDER BY id", args
+}
+
+// ExportProducts читает товары серверным курсором и передает их в fn порциями, не загружая выборку целиком.
+// Ошибка fn (например, клиент отключился) прерывает выгрузку.
+func (postgres *PostgresStorer) ExportProducts(ctx context.Context, filter ProductExportFilter, fn func([]*domain.Product) error) error {
+	query, args := filter.query(0)
+	return postgres.execExportTx(ctx, func(tx *sqlx.Tx) error {
+		return fetchCursor(ctx, tx, "products_export", query, args, fn)
+	})
+}
+
+// GetProductsPage возвращает до limit товаров по фильтру выгрузки с id больше afterID.
+// Чтение по ключу не держит транзакцию между страницами, но и не дает единого снимка каталога.
+func (postgres *PostgresStorer) GetProductsPage(ctx context.Context, filter ProductExportFilter, afterID int64, limit int) ([]*domain.Product, error) {
+	query, args := filter.query(afterID)
+	args = append(args, limit)
+	products := []*domain.Product{}
+	if err := postgres.db.SelectContext(ctx, &products, fmt.Sprintf("%s LIMIT $%d", query, len(args)), args...); err != nil {
+		return nil, fmt.Errorf("error getting products after id %d: %w", afterID, err)
+	}
+	return products, nil
+}
+
+// ListProducts возвращает страницу товаров по фильтру выгрузки: limit товаров после offset в порядке id.
+func (postgres *PostgresStorer) ListProducts(ctx context.Context, filter ProductExportFilter, limit int, offset int) ([]*domain.Product, error) {
+	query, args := filter.query(0)
+	args = append(args, limit, offset)
+	products := []*domain.Product{}
+	query = fmt.Sprintf("%s LIMIT $%d OFFSET $%d", query, len(args)-1, len(args))
+	if err := postgres.db.SelectContext(ctx, &products, query, args...); err != nil {
+		return nil, fmt.Errorf("error listing products: %w", err)
+	}
+	return products, nil
+}
+
+// ExportOrders выгружает заказы вместе с позициями. Limit и Offset фильтра не учитываются.
+func (postgres *PostgresStorer) ExportOrders(ctx context.Context, filter OrderFilter, fn func([]*domain.Order) error) error {
+	where, args := filter.where()
+	query := "SELECT * FROM orders" + where + " ORDER BY id"
+	return postgres.execExportTx(ctx, func(tx *sqlx.Tx) error {
+		return fetchCursor(ctx, tx, "orders_export", query, args, func(orders []*domain.Order) error {
+			if err := loadOrderItems(ctx, tx, orders); err != nil {
+				return err
+			}
+			return fn(orders)
+		})
+	})
+}
+
+func (postgres *PostgresStorer) execExportTx(ctx context.Context, fn func(*sqlx.Tx) error) error {
+	return postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, queryToSetExportTx); err != nil {
+			return fmt.Errorf("error starting export: %w", err)
+		}
+		return fn(tx)
+	})
+}
+
+// fetchCursor объявляет курсор для query и читает его порциями по exportFetchSize до конца выборки.
+// Курсор закрывается вместе с транзакцией.
+func fetchCursor[T any](ctx context.Context, tx *sqlx.Tx, name string, query string, args []interface{}, fn func([]*T) error) error {
+	if _, err := tx.ExecContext(ctx, "DECLARE "+name+" NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return fmt.Errorf("error declaring cursor %s: %w", name, err)
+	}
+	fetch := fmt.Sprintf("FETCH %d FROM %s", exportFetchSize, name)
+	for {
+		batch := make([]*T, 0, exportFetchSize)
+		if err := tx.SelectContext(ctx, &batch, fetch); err != nil {
+			return fmt.Errorf("error fetching from cursor %s: %w", name, err)
+		}
+		if len(batch) > 0 {
+			if err := fn(batch); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportFetchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportProducts(t *testing.T) {
+	productColumns := []string{"id", "sku", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at", "deleted_at"}
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "filtered cursor",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DECLARE products_export NO SCROLL CURSOR FOR SELECT * FROM products WHERE category_id IN (WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id=$1 ")).
+					WithArgs(int64(3), since).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("FETCH 1000 FROM products_export")).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "LAMP-1", "lamp", "lamp.jpg", 3, "", 4.5, 2, 10, 5, 1, time.Now(), nil, nil).
+						AddRow(2, nil, "chair", "chair.jpg", 4, "", 0, 0, 20, 1, 1, time.Now(), nil, nil))
+				mock.ExpectCommit()
+
+				var exported []*domain.Product
+				err := postgresTest.ExportProducts(context.Background(),
+					ProductExportFilter{CategoryID: 3, UpdatedSince: &since, InStock: true},
+					func(products []*domain.Product) error {
+						exported = append(exported, products...)
+						return nil
+					})
+				require.NoError(t, err)
+				require.Len(t, exported, 2)
+				require.Equal(t, "LAMP-1", *exported[0].SKU)
+				require.Nil(t, exported[1].SKU)
+			},
+		},
+		{
+			name: "callback error rolls back",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("SET TRANSACTION")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta("DECLARE products_export NO SCROLL CURSOR FOR SELECT * FROM products WHERE deleted_at IS NULL ORDER BY id")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("FETCH 1000 FROM products_export")).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, nil, "lamp", "lamp.jpg", 3, "", 0, 0, 10, 5, 1, time.Now(), nil, nil))
+				mock.ExpectRollback()
+
+				errClosed := errors.New("client went away")
+				err := postgresTest.ExportProducts(context.Background(), ProductExportFilter{},
+					func(products []*domain.Product) error { return errClosed })
+				require.ErrorIs(t, err, errClosed)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func TestExportOrders(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+	itemColumns := []string{"id", "name", "quantity", "image", "price", "product_id", "variant_id", "order_id"}
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("SET TRANSACTION")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("DECLARE orders_export NO SCROLL CURSOR FOR SELECT * FROM orders WHERE status = $1 ORDER BY id")).
+			WithArgs(domain.OrderStatusPaid).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta("FETCH 1000 FROM orders_export")).
+			WillReturnRows(sqlmock.NewRows(orderColumns).
+				AddRow(1, 7, "card", "paid", 1, 2, 13, time.Now(), nil).
+				AddRow(2, 8, "card", "paid", 1, 2, 23, time.Now(), nil))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY order_id, id")).
+			WithArgs(pq.Array([]int64{1, 2})).
+			WillReturnRows(sqlmock.NewRows(itemColumns).
+				AddRow(1, "lamp", 1, "lamp.jpg", 10, 1, nil, 1).
+				AddRow(2, "chair", 1, "chair.jpg", 20, 2, nil, 2))
+		mock.ExpectCommit()
+
+		var exported []*domain.Order
+		err := NewPostgresStorer(db).ExportOrders(context.Background(), OrderFilter{Status: domain.OrderStatusPaid, Limit: 10},
+			func(orders []*domain.Order) error {
+				exported = append(exported, orders...)
+				return nil
+			})
+		require.NoError(t, err)
+		require.Len(t, exported, 2)
+		require.Equal(t, "chair", exported[1].Items[0].Name)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetProductsPage(t *testing.T) {
+	productColumns := []string{"id", "name", "category_id", "count_in_stock", "created_at"}
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE count_in_stock > 0 AND deleted_at IS NULL AND id > $1 ORDER BY id LIMIT $2")).
+			WithArgs(int64(10), 2).
+			WillReturnRows(sqlmock.NewRows(productColumns).
+				AddRow(11, "lamp", 3, 5, time.Now()).
+				AddRow(14, "chair", 4, 1, time.Now()))
+
+		products, err := NewPostgresStorer(db).GetProductsPage(context.Background(), ProductExportFilter{InStock: true}, 10, 2)
+		require.NoError(t, err)
+		require.Len(t, products, 2)
+		require.Equal(t, int64(14), products[1].ID)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestListProducts(t *testing.T) {
+	productColumns := []string{"id", "name", "category_id", "count_in_stock", "created_at"}
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM products WHERE category_id IN (WITH RECURSIVE tree AS (SELECT id FROM categories WHERE id=$1 UNION ALL SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id) SELECT id FROM tree) AND count_in_stock = 0 AND deleted_at IS NULL ORDER BY id LIMIT $2 OFFSET $3")).
+			WithArgs(int64(3), 10, 20).
+			WillReturnRows(sqlmock.NewRows(productColumns).AddRow(25, "chair", 4, 0, time.Now()))
+
+		products, err := NewPostgresStorer(db).ListProducts(context.Background(), ProductExportFilter{CategoryID: 3, OutOfStock: true}, 10, 20)
+		require.NoError(t, err)
+		require.Len(t, products, 1)
+		require.Equal(t, int64(25), products[0].ID)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
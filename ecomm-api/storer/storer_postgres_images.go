@@ -0,0 +1,148 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	queryToLockProduct       = "SELECT id FROM products WHERE id=$1 AND deleted_at IS NULL FOR UPDATE"
+	queryToInsertProductImg  = "INSERT INTO product_images (product_id, position, blob_key, thumbnail_key, content_type, size, width, height) VALUES ($1, (SELECT COALESCE(MAX(position) + 1, 0) FROM product_images WHERE product_id=$1), $2, $3, $4, $5, $6, $7) RETURNING *"
+	queryToSelectProductImgs = "SELECT * FROM product_images WHERE product_id=$1 ORDER BY position, id"
+	queryToDeleteProductImg  = "DELETE FROM product_images WHERE id=$1 AND product_id=$2 RETURNING *"
+	queryToReorderProductImg = "UPDATE product_images pi SET position = v.position - 1 FROM unnest($1::int[]) WITH ORDINALITY AS v(id, position) WHERE pi.id = v.id AND pi.product_id=$2"
+	queryToSelectPrimaryImg  = "SELECT * FROM product_images WHERE product_id=$1 ORDER BY position, id LIMIT 1"
+	queryToHasProductImgs    = "SELECT EXISTS (SELECT 1 FROM product_images WHERE product_id=$1)"
+	queryToSetProductImage   = "UPDATE products SET image=$1, version=version+1, updated_at=NOW() WHERE id=$2 AND image <> $1 RETURNING *"
+)
+
+// Методы картинок держат products.image равным ссылке на главную (первую) картинку:
+// imagesPath + blob_key. Ссылка меняет товар, поэтому растет его version и пишется событие product.updated.
+
+// CreateProductImage добавляет картинку в конец списка картинок товара.
+// Товар блокируется, чтобы две параллельные загрузки не получили одну и ту же позицию.
+func (postgres *PostgresStorer) CreateProductImage(ctx context.Context, img *domain.ProductImage, imagesPath string) (*domain.ProductImage, error) {
+	op := "storer.CreateProductImage"
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockProduct(ctx, tx, op, img.ProductID); err != nil {
+			return err
+		}
+		err := tx.GetContext(ctx, img, queryToInsertProductImg,
+			img.ProductID, img.BlobKey, img.ThumbnailKey, img.ContentType, img.Size, img.Width, img.Height)
+		if err != nil {
+			return fmt.Errorf("error inserting image of product with id %d: %w", img.ProductID, err)
+		}
+		return syncPrimaryImage(ctx, tx, img.ProductID, imagesPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+func (postgres *PostgresStorer) GetProductImages(ctx context.Context, productID int64) ([]*domain.ProductImage, error) {
+	images := []*domain.ProductImage{}
+	if err := postgres.db.SelectContext(ctx, &images, queryToSelectProductImgs, productID); err != nil {
+		return nil, fmt.Errorf("error getting images of product with id %d: %w", productID, err)
+	}
+	return images, nil
+}
+
+// DeleteProductImage удаляет запись о картинке и возвращает ее, чтобы вызывающий код удалил файлы.
+// Последнюю картинку удалить нельзя: на ее файл указывает products.image, а товар без картинки не проходит проверку.
+func (postgres *PostgresStorer) DeleteProductImage(ctx context.Context, productID int64, id int64, imagesPath string) (*domain.ProductImage, error) {
+	op := "storer.DeleteProductImage"
+	img := domain.ProductImage{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockProduct(ctx, tx, op, productID); err != nil {
+			return err
+		}
+		err := tx.GetContext(ctx, &img, queryToDeleteProductImg, id, productID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "product image", id, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("error deleting product image with id %d: %w", id, err)
+		}
+
+		var hasImages bool
+		if err := tx.GetContext(ctx, &hasImages, queryToHasProductImgs, productID); err != nil {
+			return fmt.Errorf("error checking images of product with id %d: %w", productID, err)
+		}
+		if !hasImages {
+			return NewInvalidStateError(op, "product image", id, "the last image of the product")
+		}
+		return syncPrimaryImage(ctx, tx, productID, imagesPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
+
+// ReorderProductImages расставляет картинки в порядке ids. ids должен содержать все картинки товара.
+func (postgres *PostgresStorer) ReorderProductImages(ctx context.Context, productID int64, ids []int64, imagesPath string) ([]*domain.ProductImage, error) {
+	op := "storer.ReorderProductImages"
+	images := []*domain.ProductImage{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockProduct(ctx, tx, op, productID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, queryToReorderProductImg, pq.Array(ids), productID); err != nil {
+			return fmt.Errorf("error reordering images of product with id %d: %w", productID, err)
+		}
+		if err := syncPrimaryImage(ctx, tx, productID, imagesPath); err != nil {
+			return err
+		}
+		if err := tx.SelectContext(ctx, &images, queryToSelectProductImgs, productID); err != nil {
+			return fmt.Errorf("error getting images of product with id %d: %w", productID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func lockProduct(ctx context.Context, tx *sqlx.Tx, op string, productID int64) error {
+	var id int64
+	err := tx.GetContext(ctx, &id, queryToLockProduct, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewNotFoundError(op, "product", productID, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error locking product with id %d: %w", productID, err)
+	}
+	return nil
+}
+
+// syncPrimaryImage ставит в products.image ссылку на первую картинку товара.
+// Если картинок нет, ссылка не меняется.
+func syncPrimaryImage(ctx context.Context, tx *sqlx.Tx, productID int64, imagesPath string) error {
+	primary := domain.ProductImage{}
+	err := tx.GetContext(ctx, &primary, queryToSelectPrimaryImg, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting primary image of product with id %d: %w", productID, err)
+	}
+
+	product := domain.Product{}
+	err = tx.GetContext(ctx, &product, queryToSetProductImage, imagesPath+primary.BlobKey, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Главная картинка не поменялась
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error setting image of product with id %d: %w", productID, err)
+	}
+	return insertProductUpdatedEvent(ctx, tx, &product)
+}
@@ -0,0 +1,113 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+var imageColumns = []string{"id", "product_id", "position", "blob_key", "thumbnail_key", "content_type", "size", "width", "height", "created_at"}
+
+func TestProductPrimaryImage(t *testing.T) {
+	lockQuery := regexp.QuoteMeta("SELECT id FROM products WHERE id=$1 AND deleted_at IS NULL FOR UPDATE")
+	deleteQuery := regexp.QuoteMeta("DELETE FROM product_images WHERE id=$1 AND product_id=$2 RETURNING *")
+	primaryQuery := regexp.QuoteMeta("SELECT * FROM product_images WHERE product_id=$1 ORDER BY position, id LIMIT 1")
+	hasImagesQuery := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM product_images WHERE product_id=$1)")
+	setQuery := regexp.QuoteMeta("UPDATE products SET image=$1, version=version+1, updated_at=NOW() WHERE id=$2 AND image <> $1 RETURNING *")
+	productRow := func(image string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "image", "category_id", "price", "count_in_stock", "version"}).AddRow(1, "lamp", image, 1, 10, 5, 3)
+	}
+	imageRow := func(id int64, position int64, key string) *sqlmock.Rows {
+		return sqlmock.NewRows(imageColumns).AddRow(id, 1, position, key, key+"_thumb", "image/png", 100, 10, 10, time.Now())
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "deleting primary image promotes the next one",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(deleteQuery).WithArgs(7, 1).WillReturnRows(imageRow(7, 0, "products/1/a.png"))
+				mock.ExpectQuery(hasImagesQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectQuery(primaryQuery).WithArgs(1).WillReturnRows(imageRow(8, 1, "products/1/b.png"))
+				mock.ExpectQuery(setQuery).WithArgs("/images/products/1/b.png", 1).WillReturnRows(productRow("/images/products/1/b.png"))
+				expectOutboxEvent(mock, "product", 1, domain.EventProductUpdated)
+				mock.ExpectCommit()
+
+				img, err := postgresTest.DeleteProductImage(context.Background(), 1, 7, "/images/")
+				require.NoError(t, err)
+				require.Equal(t, "products/1/a.png", img.BlobKey)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "last image cannot be deleted",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(deleteQuery).WithArgs(7, 1).WillReturnRows(imageRow(7, 0, "products/1/a.png"))
+				mock.ExpectQuery(hasImagesQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.DeleteProductImage(context.Background(), 1, 7, "/images/")
+				var invalidStateErr *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "deleting missing image",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(deleteQuery).WithArgs(7, 1).WillReturnRows(sqlmock.NewRows(imageColumns))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.DeleteProductImage(context.Background(), 1, 7, "/images/")
+				var notFoundErr *NotFoundError
+				require.ErrorAs(t, err, &notFoundErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "reorder makes the first image primary",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE product_images pi SET position = v.position - 1")).
+					WithArgs(pq.Array([]int64{8, 7}), 1).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectQuery(primaryQuery).WithArgs(1).WillReturnRows(imageRow(8, 0, "products/1/b.png"))
+				mock.ExpectQuery(setQuery).WithArgs("/images/products/1/b.png", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product_images WHERE product_id=$1 ORDER BY position, id")).
+					WithArgs(1).
+					WillReturnRows(imageRow(8, 0, "products/1/b.png").AddRow(7, 1, 1, "products/1/a.png", "products/1/a.png_thumb", "image/png", 100, 10, 10, time.Now()))
+				mock.ExpectCommit()
+
+				images, err := postgresTest.ReorderProductImages(context.Background(), 1, []int64{8, 7}, "/images/")
+				require.NoError(t, err)
+				require.Len(t, images, 2)
+				require.Equal(t, int64(8), images[0].ID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
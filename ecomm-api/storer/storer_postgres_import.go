@@ -0,0 +1,142 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	queryToFindProductBySKU  = "SELECT id, deleted_at FROM products WHERE sku=$1 FOR UPDATE"
+	queryToFindProductByName = "SELECT id FROM products WHERE name=$1 AND deleted_at IS NULL FOR UPDATE"
+	queryToImportProduct     = "INSERT INTO products (sku, name, image, category_id, description, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *"
+	// Найденный по имени товар сохраняет свой артикул, если в строке импорта его нет
+	queryToReimportProduct = "UPDATE products SET sku=COALESCE($1, sku), name=$2, image=$3, category_id=$4, description=$5, price=$6, count_in_stock=$7, version=version+1, updated_at=NOW() WHERE id=$8 RETURNING *"
+)
+
+// ImportRow - товар из строки файла импорта, Line - номер строки для отчета.
+type ImportRow struct {
+	Line    int
+	Product *domain.Product
+}
+
+type ImportResult struct {
+	Line    int
+	ID      int64
+	Created bool
+	Err     error // Ошибка только этой строки, остальные строки пачки она не откатывает
+}
+
+var errDryRun = errors.New("dry run")
+
+// ImportProducts сохраняет пачку товаров в одной транзакции: товар с артикулом ищется по sku, без артикула - по имени.
+// Каждая строка выполняется в своей точке сохранения, поэтому ошибка строки откатывает только ее.
+// При dryRun вся транзакция откатывается, но ошибки базы (например, неизвестная категория) попадают в результаты.
+func (postgres *PostgresStorer) ImportProducts(ctx context.Context, rows []ImportRow, dryRun bool) ([]ImportResult, error) {
+	var results []ImportResult
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		results = make([]ImportResult, 0, len(rows))
+		for _, row := range rows {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT import_row"); err != nil {
+				return fmt.Errorf("error creating savepoint for line %d: %w", row.Line, err)
+			}
+			result, err := importProduct(ctx, tx, row)
+			if err != nil {
+				if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_row"); rbErr != nil {
+					return fmt.Errorf("error rolling back line %d: %w", row.Line, rbErr)
+				}
+				results = append(results, ImportResult{Line: row.Line, Err: err})
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT import_row"); err != nil {
+				return fmt.Errorf("error releasing savepoint for line %d: %w", row.Line, err)
+			}
+			results = append(results, result)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return results, nil
+}
+
+func importProduct(ctx context.Context, tx *sqlx.Tx, row ImportRow) (ImportResult, error) {
+	op := "storer.ImportProducts"
+	p := row.Product
+	result := ImportResult{Line: row.Line}
+
+	id, err := findImportedProduct(ctx, tx, op, p)
+	if err != nil {
+		return result, err
+	}
+
+	saved := domain.Product{}
+	eventType := domain.EventProductUpdated
+	if id == 0 {
+		err = tx.GetContext(ctx, &saved, queryToImportProduct,
+			p.SKU, p.Name, p.Image, p.CategoryID, p.Description, p.Price, p.CountInStock)
+		eventType = domain.EventProductCreated
+		result.Created = true
+	} else {
+		err = tx.GetContext(ctx, &saved, queryToReimportProduct,
+			p.SKU, p.Name, p.Image, p.CategoryID, p.Description, p.Price, p.CountInStock, id)
+	}
+	if categoryErr := missingCategoryError(op, p.CategoryID, err); categoryErr != nil {
+		return result, categoryErr
+	}
+	if skuErr := duplicateSKUError(op, p.SKU, err); skuErr != nil {
+		return result, skuErr
+	}
+	if err != nil {
+		return result, fmt.Errorf("error saving product from line %d: %w", row.Line, err)
+	}
+	// Событие пишется в точке сохранения строки и откатывается вместе с ней
+	if err := insertProductEvent(ctx, tx, eventType, &saved); err != nil {
+		return result, err
+	}
+	result.ID = saved.ID
+	return result, nil
+}
+
+// findImportedProduct возвращает id товара, который нужно обновить, или 0, если товар новый.
+func findImportedProduct(ctx context.Context, tx *sqlx.Tx, op string, p *domain.Product) (int64, error) {
+	if p.SKU != nil {
+		var found struct {
+			ID        int64      `db:"id"`
+			DeletedAt *time.Time `db:"deleted_at"`
+		}
+		err := tx.GetContext(ctx, &found, queryToFindProductBySKU, *p.SKU)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error finding product with sku %s: %w", *p.SKU, err)
+		}
+		// Удаленный товар не воскрешаем молча - для этого есть restore
+		if found.DeletedAt != nil {
+			return 0, NewInvalidStateError(op, "product", found.ID, "deleted")
+		}
+		return found.ID, nil
+	}
+
+	var ids []int64
+	if err := tx.SelectContext(ctx, &ids, queryToFindProductByName, p.Name); err != nil {
+		return 0, fmt.Errorf("error finding product named %s: %w", p.Name, err)
+	}
+	switch len(ids) {
+	case 0:
+		return 0, nil
+	case 1:
+		return ids[0], nil
+	}
+	return 0, NewAmbiguousMatchError(op, "products", fmt.Sprintf("name %q", p.Name), len(ids))
+}
@@ -0,0 +1,137 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportProducts(t *testing.T) {
+	sku := "LAMP-1"
+	lamp := &domain.Product{SKU: &sku, Name: "lamp", Image: "lamp.jpg", CategoryID: 1, Price: 10, CountInStock: 5}
+	chair := &domain.Product{Name: "chair", Image: "chair.jpg", CategoryID: 2, Price: 20, CountInStock: 1}
+
+	expectSavepoint := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT import_row")).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	expectRelease := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("RELEASE SAVEPOINT import_row")).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	expectRollbackToSavepoint := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("ROLLBACK TO SAVEPOINT import_row")).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	findBySKU := regexp.QuoteMeta("SELECT id, deleted_at FROM products WHERE sku=$1 FOR UPDATE")
+	findByName := regexp.QuoteMeta("SELECT id FROM products WHERE name=$1 AND deleted_at IS NULL FOR UPDATE")
+	insertQuery := regexp.QuoteMeta("INSERT INTO products (sku, name, image, category_id, description, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *")
+	updateQuery := regexp.QuoteMeta("UPDATE products SET sku=COALESCE($1, sku), name=$2")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "insert by sku and update by name",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectSavepoint(mock)
+				mock.ExpectQuery(findBySKU).WithArgs(sku).WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}))
+				mock.ExpectQuery(insertQuery).
+					WithArgs(&sku, "lamp", "lamp.jpg", int64(1), "", 10.0, int64(5)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				expectOutboxEvent(mock, "product", 7, domain.EventProductCreated)
+				expectRelease(mock)
+				expectSavepoint(mock)
+				mock.ExpectQuery(findByName).WithArgs("chair").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectQuery(updateQuery).
+					WithArgs(nil, "chair", "chair.jpg", int64(2), "", 20.0, int64(1), int64(3)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				expectOutboxEvent(mock, "product", 3, domain.EventProductUpdated)
+				expectRelease(mock)
+				mock.ExpectCommit()
+
+				results, err := postgresTest.ImportProducts(context.Background(), []ImportRow{{Line: 2, Product: lamp}, {Line: 3, Product: chair}}, false)
+				require.NoError(t, err)
+				require.Equal(t, []ImportResult{{Line: 2, ID: 7, Created: true}, {Line: 3, ID: 3}}, results)
+			},
+		},
+		{
+			name: "row error rolls back only the row",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectSavepoint(mock)
+				mock.ExpectQuery(findBySKU).WithArgs(sku).WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}))
+				mock.ExpectQuery(insertQuery).WillReturnError(&pq.Error{Code: foreignKeyViolationCode})
+				expectRollbackToSavepoint(mock)
+				expectSavepoint(mock)
+				mock.ExpectQuery(findByName).WithArgs("chair").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(insertQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+				expectOutboxEvent(mock, "product", 8, domain.EventProductCreated)
+				expectRelease(mock)
+				mock.ExpectCommit()
+
+				results, err := postgresTest.ImportProducts(context.Background(), []ImportRow{{Line: 2, Product: lamp}, {Line: 3, Product: chair}}, false)
+				require.NoError(t, err)
+				require.Len(t, results, 2)
+				var notFoundErr *NotFoundError
+				require.ErrorAs(t, results[0].Err, &notFoundErr)
+				require.Equal(t, "category", notFoundErr.Resource)
+				require.Equal(t, ImportResult{Line: 3, ID: 8, Created: true}, results[1])
+			},
+		},
+		{
+			name: "deleted sku and ambiguous name",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectSavepoint(mock)
+				mock.ExpectQuery(findBySKU).WithArgs(sku).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}).AddRow(7, time.Now()))
+				expectRollbackToSavepoint(mock)
+				expectSavepoint(mock)
+				mock.ExpectQuery(findByName).WithArgs("chair").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(4))
+				expectRollbackToSavepoint(mock)
+				mock.ExpectCommit()
+
+				results, err := postgresTest.ImportProducts(context.Background(), []ImportRow{{Line: 2, Product: lamp}, {Line: 3, Product: chair}}, false)
+				require.NoError(t, err)
+				var stateErr *InvalidStateError
+				require.ErrorAs(t, results[0].Err, &stateErr)
+				require.Equal(t, int64(7), stateErr.ID)
+				var ambiguousErr *AmbiguousMatchError
+				require.ErrorAs(t, results[1].Err, &ambiguousErr)
+				require.Equal(t, 2, ambiguousErr.Count)
+			},
+		},
+		{
+			name: "dry run rolls back",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectSavepoint(mock)
+				mock.ExpectQuery(findBySKU).WithArgs(sku).WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at"}))
+				mock.ExpectQuery(insertQuery).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				expectOutboxEvent(mock, "product", 7, domain.EventProductCreated)
+				expectRelease(mock)
+				mock.ExpectRollback()
+
+				results, err := postgresTest.ImportProducts(context.Background(), []ImportRow{{Line: 2, Product: lamp}}, true)
+				require.NoError(t, err)
+				require.Equal(t, []ImportResult{{Line: 2, ID: 7, Created: true}}, results)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	queryToInsertJob = "INSERT INTO jobs (type, payload, max_attempts, run_at, unique_key) VALUES ($1, $2, $3, COALESCE($4, NOW()), $5) " +
+		"ON CONFLICT (unique_key) DO NOTHING RETURNING *"
+	// Задача упавшего воркера остается running: после lease ее забирает другой воркер
+	queryToClaimJob = "UPDATE jobs SET status='running', attempts=attempts+1, locked_at=NOW(), updated_at=NOW() WHERE id = (" +
+		"SELECT id FROM jobs WHERE type = ANY($1) AND (" +
+		"(status = 'pending' AND run_at <= NOW()) OR (status = 'running' AND locked_at < NOW() - make_interval(secs => $2))) " +
+		"ORDER BY run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING *"
+	queryToCompleteJob = "UPDATE jobs SET status='succeeded', locked_at=NULL, last_error=NULL, finished_at=NOW(), updated_at=NOW() WHERE id=$1"
+	queryToFailJob     = "UPDATE jobs SET status=$2, last_error=$3, run_at=COALESCE($4, run_at), locked_at=NULL, " +
+		"finished_at=CASE WHEN $2 = 'dead' THEN NOW() END, updated_at=NOW() WHERE id=$1"
+	queryToRetryJob = "UPDATE jobs SET status='pending', attempts=0, run_at=NOW(), finished_at=NULL, updated_at=NOW() " +
+		"WHERE id=$1 AND status='dead' RETURNING *"
+	queryToDeleteFinishedJobs = "DELETE FROM jobs WHERE status='succeeded' AND finished_at < $1"
+)
+
+// EnqueueJob ставит задачу в очередь. Если задача с тем же UniqueKey уже есть, новая не создается
+// и возвращается false. Нулевой RunAt - выполнить сразу.
+func (postgres *PostgresStorer) EnqueueJob(ctx context.Context, job *domain.Job) (bool, error) {
+	payload := job.Payload
+	if payload == "" {
+		payload = "{}"
+	}
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+	err := postgres.db.GetContext(ctx, job, queryToInsertJob, job.Type, payload, job.MaxAttempts, runAt, job.UniqueKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error enqueuing job %s: %w", job.Type, err)
+	}
+	return true, nil
+}
+
+// ClaimJob забирает самую раннюю задачу одного из types, которой пора выполняться, и
+// увеличивает ее счетчик попыток. Задача в статусе running дольше lease считается брошенной.
+// Возвращает nil, если забирать нечего.
+func (postgres *PostgresStorer) ClaimJob(ctx context.Context, types []string, lease time.Duration) (*domain.Job, error) {
+	job := domain.Job{}
+	err := postgres.db.GetContext(ctx, &job, queryToClaimJob, pq.Array(types), lease.Seconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming job: %w", err)
+	}
+	return &job, nil
+}
+
+func (postgres *PostgresStorer) CompleteJob(ctx context.Context, id int64) error {
+	if _, err := postgres.db.ExecContext(ctx, queryToCompleteJob, id); err != nil {
+		return fmt.Errorf("error completing job with id %d: %w", id, err)
+	}
+	return nil
+}
+
+// FailJob сохраняет ошибку попытки. Задача повторится в retryAt, а без retryAt
+// уходит в dead и ждет ручного перезапуска.
+func (postgres *PostgresStorer) FailJob(ctx context.Context, id int64, message string, retryAt *time.Time) error {
+	status := domain.JobDead
+	if retryAt != nil {
+		status = domain.JobPending
+	}
+	if _, err := postgres.db.ExecContext(ctx, queryToFailJob, id, status, message, retryAt); err != nil {
+		return fmt.Errorf("error failing job with id %d: %w", id, err)
+	}
+	return nil
+}
+
+func (postgres *PostgresStorer) GetJob(ctx context.Context, id int64) (*domain.Job, error) {
+	op := "storer.GetJob"
+	job := domain.Job{}
+	err := postgres.db.GetContext(ctx, &job, "SELECT * FROM jobs WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "job", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting job with id %d: %w", id, err)
+	}
+	return &job, nil
+}
+
+// JobFilter - условия выборки задач, пустые Status и Type не ограничивают выборку.
+type JobFilter struct {
+	Status string
+	Type   string
+	Limit  int64
+}
+
+// GetJobs возвращает задачи, новые первыми.
+func (postgres *PostgresStorer) GetJobs(ctx context.Context, filter JobFilter) ([]*domain.Job, error) {
+	jobs := []*domain.Job{}
+	err := postgres.db.SelectContext(ctx, &jobs,
+		"SELECT * FROM jobs WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2) ORDER BY id DESC LIMIT $3",
+		filter.Status, filter.Type, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// RetryJob возвращает задачу из dead в очередь с полным набором попыток. Последняя ошибка
+// остается, пока ее не заменит новая попытка.
+func (postgres *PostgresStorer) RetryJob(ctx context.Context, id int64) (*domain.Job, error) {
+	op := "storer.RetryJob"
+	job := domain.Job{}
+	err := postgres.db.GetContext(ctx, &job, queryToRetryJob, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "dead job", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrying job with id %d: %w", id, err)
+	}
+	return &job, nil
+}
+
+// DeleteFinishedJobs удаляет успешно выполненные задачи, завершенные до before. Задачи
+// в dead остаются для разбора. Возвращает число удаленных.
+func (postgres *PostgresStorer) DeleteFinishedJobs(ctx context.Context, before time.Time) (int64, error) {
+	res, err := postgres.db.ExecContext(ctx, queryToDeleteFinishedJobs, before)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting finished jobs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("cannot get affected rows for finished jobs: %w", err)
+	}
+	return n, nil
+}
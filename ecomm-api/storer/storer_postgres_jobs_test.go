@@ -0,0 +1,145 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+var jobColumns = []string{"id", "type", "payload", "status", "attempts", "max_attempts", "run_at", "locked_at", "last_error",
+	"unique_key", "created_at", "updated_at", "finished_at"}
+
+func TestJobs(t *testing.T) {
+	key := "cron:ratings.recompute:30 3 * * *:1772335800"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "enqueue",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(queryToInsertJob)).
+					WithArgs("email.send", `{"order_id":7}`, 5, nil, nil).
+					WillReturnRows(sqlmock.NewRows(jobColumns).
+						AddRow(1, "email.send", []byte(`{"order_id":7}`), "pending", 0, 5, time.Now(), nil, nil, nil, time.Now(), nil, nil))
+
+				job := &domain.Job{Type: "email.send", Payload: `{"order_id":7}`, MaxAttempts: 5}
+				created, err := postgresTest.EnqueueJob(context.Background(), job)
+				require.NoError(t, err)
+				require.True(t, created)
+				require.Equal(t, int64(1), job.ID)
+				require.Equal(t, domain.JobPending, job.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "enqueue duplicate unique key",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				runAt := time.Date(2026, 3, 1, 3, 30, 0, 0, time.UTC)
+				mock.ExpectQuery(regexp.QuoteMeta(queryToInsertJob)).
+					WithArgs("ratings.recompute", "{}", 3, runAt, key).
+					WillReturnRows(sqlmock.NewRows(jobColumns))
+
+				created, err := postgresTest.EnqueueJob(context.Background(), &domain.Job{
+					Type: "ratings.recompute", MaxAttempts: 3, RunAt: runAt, UniqueKey: &key,
+				})
+				require.NoError(t, err)
+				require.False(t, created)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "claim skips locked jobs",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("ORDER BY run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING *")).
+					WithArgs(pq.Array([]string{"email.send", "ratings.recompute"}), 360.0).
+					WillReturnRows(sqlmock.NewRows(jobColumns).
+						AddRow(1, "email.send", []byte(`{"order_id":7}`), "running", 1, 5, time.Now(), time.Now(), nil, nil, time.Now(), nil, nil))
+
+				job, err := postgresTest.ClaimJob(context.Background(), []string{"email.send", "ratings.recompute"}, 6*time.Minute)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), job.Attempts)
+				require.Equal(t, `{"order_id":7}`, job.Payload)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "claim from empty queue",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(queryToClaimJob)).
+					WillReturnRows(sqlmock.NewRows(jobColumns))
+
+				job, err := postgresTest.ClaimJob(context.Background(), []string{"email.send"}, time.Minute)
+				require.NoError(t, err)
+				require.Nil(t, job)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "fail with retry",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				retryAt := time.Now().Add(time.Minute)
+				mock.ExpectExec(regexp.QuoteMeta(queryToFailJob)).
+					WithArgs(1, domain.JobPending, "smtp unavailable", retryAt).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				require.NoError(t, postgresTest.FailJob(context.Background(), 1, "smtp unavailable", &retryAt))
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "fail without retry moves job to dead letters",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(queryToFailJob)).
+					WithArgs(1, domain.JobDead, "invalid arguments", nil).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				require.NoError(t, postgresTest.FailJob(context.Background(), 1, "invalid arguments", nil))
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "retry job that is not dead",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(queryToRetryJob)).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(jobColumns))
+
+				_, err := postgresTest.RetryJob(context.Background(), 1)
+				var notFoundErr *NotFoundError
+				require.ErrorAs(t, err, &notFoundErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "delete finished jobs",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				before := time.Now().AddDate(0, 0, -7)
+				mock.ExpectExec(regexp.QuoteMeta(queryToDeleteFinishedJobs)).
+					WithArgs(before).
+					WillReturnResult(sqlmock.NewResult(0, 12))
+
+				n, err := postgresTest.DeleteFinishedJobs(context.Background(), before)
+				require.NoError(t, err)
+				require.Equal(t, int64(12), n)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
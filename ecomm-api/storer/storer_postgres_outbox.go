@@ -0,0 +1,239 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	queryToInsertOutboxEvent = "INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload) VALUES ($1, $2, $3, $4)"
+	queryToLockOutboxEvents  = "SELECT * FROM outbox_events WHERE published_at IS NULL AND dead_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE"
+	queryToMarkOutboxEvents  = "UPDATE outbox_events SET published_at=NOW(), attempts=attempts+1, last_error=NULL WHERE id = ANY($1)"
+	queryToFailOutboxEvent   = "UPDATE outbox_events SET attempts=attempts+1, last_error=$1 WHERE id=$2"
+	queryToBuryOutboxEvent   = "UPDATE outbox_events SET attempts=attempts+1, last_error=$1, dead_at=NOW() WHERE id=$2"
+	queryToSelectDeadEvents  = "SELECT * FROM outbox_events WHERE dead_at IS NOT NULL AND published_at IS NULL ORDER BY id LIMIT $1"
+	queryToRetryOutboxEvent  = "UPDATE outbox_events SET dead_at=NULL, attempts=0 WHERE id=$1 AND dead_at IS NOT NULL AND published_at IS NULL RETURNING *"
+)
+
+// Полезная нагрузка событий - их публичный формат для подписчиков, поэтому он не зависит от DTO REST.
+type orderEventPayload struct {
+	OrderID       int64                   `json:"order_id"`
+	UserID        int64                   `json:"user_id"`
+	Status        string                  `json:"status"`
+	PaymentMethod string                  `json:"payment_method"`
+	TotalPrice    float64                 `json:"total_price"`
+	Items         []orderItemEventPayload `json:"items"`
+	CreatedAt     time.Time               `json:"created_at"`
+}
+
+type orderItemEventPayload struct {
+	ProductID int64   `json:"product_id"`
+	VariantID *int64  `json:"variant_id,omitempty"`
+	Quantity  int64   `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+type orderCancelledEventPayload struct {
+	OrderID       int64      `json:"order_id"`
+	UserID        int64      `json:"user_id"`
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason"`
+	RefundedPrice float64    `json:"refunded_price"`
+	CancelledAt   *time.Time `json:"cancelled_at"`
+}
+
+type orderShippedEventPayload struct {
+	OrderID        int64      `json:"order_id"`
+	UserID         int64      `json:"user_id"`
+	Status         string     `json:"status"`
+	TrackingNumber *string    `json:"tracking_number"`
+	ShippedAt      *time.Time `json:"shipped_at"`
+}
+
+type productEventPayload struct {
+	ProductID    int64   `json:"product_id"`
+	SKU          *string `json:"sku"`
+	Name         string  `json:"name"`
+	CategoryID   int64   `json:"category_id"`
+	Price        float64 `json:"price"`
+	CountInStock int64   `json:"count_in_stock"`
+	Version      int64   `json:"version"`
+}
+
+// Для варианта count_in_stock и version - значения варианта
+type productStockChangedEventPayload struct {
+	ProductID    int64  `json:"product_id"`
+	VariantID    *int64 `json:"variant_id,omitempty"`
+	Delta        int64  `json:"delta"`
+	CountInStock int64  `json:"count_in_stock"`
+	Version      int64  `json:"version"`
+}
+
+type productDeletedEventPayload struct {
+	ProductID int64 `json:"product_id"`
+	Version   int64 `json:"version"`
+}
+
+// insertOutboxEvent пишет событие в транзакции tx: оно станет видно relay только вместе с изменением.
+// Строка агрегата к этому моменту должна быть заблокирована в tx, иначе события агрегата могут прийти не по порядку.
+func insertOutboxEvent(ctx context.Context, tx *sqlx.Tx, aggregateType string, aggregateID int64, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding %s event: %w", eventType, err)
+	}
+	if _, err := tx.ExecContext(ctx, queryToInsertOutboxEvent, aggregateType, aggregateID, eventType, string(data)); err != nil {
+		return fmt.Errorf("error inserting %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+func insertOrderCreatedEvent(ctx context.Context, tx *sqlx.Tx, order *domain.Order) error {
+	payload := orderEventPayload{
+		OrderID:       order.ID,
+		UserID:        order.UserID,
+		Status:        order.Status,
+		PaymentMethod: order.PaymentMethod,
+		TotalPrice:    order.TotalPrice,
+		Items:         make([]orderItemEventPayload, len(order.Items)),
+		CreatedAt:     order.CreatedAt,
+	}
+	for i, item := range order.Items {
+		payload.Items[i] = orderItemEventPayload{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		}
+	}
+	return insertOutboxEvent(ctx, tx, "order", order.ID, domain.EventOrderCreated, payload)
+}
+
+func insertOrderShippedEvent(ctx context.Context, tx *sqlx.Tx, order *domain.Order) error {
+	return insertOutboxEvent(ctx, tx, "order", order.ID, domain.EventOrderShipped, orderShippedEventPayload{
+		OrderID:        order.ID,
+		UserID:         order.UserID,
+		Status:         order.Status,
+		TrackingNumber: order.TrackingNumber,
+		ShippedAt:      order.ShippedAt,
+	})
+}
+
+func insertOrderCancelledEvent(ctx context.Context, tx *sqlx.Tx, order *domain.Order) error {
+	return insertOutboxEvent(ctx, tx, "order", order.ID, domain.EventOrderCancelled, orderCancelledEventPayload{
+		OrderID:       order.ID,
+		UserID:        order.UserID,
+		Status:        order.Status,
+		Reason:        order.CancellationReason,
+		RefundedPrice: order.RefundedPrice,
+		CancelledAt:   order.CancelledAt,
+	})
+}
+
+// insertProductEvent пишет событие о товаре p с его текущим состоянием: product.created, product.updated
+// или product.restored.
+func insertProductEvent(ctx context.Context, tx *sqlx.Tx, eventType string, p *domain.Product) error {
+	return insertOutboxEvent(ctx, tx, "product", p.ID, eventType, productEventPayload{
+		ProductID:    p.ID,
+		SKU:          p.SKU,
+		Name:         p.Name,
+		CategoryID:   p.CategoryID,
+		Price:        p.Price,
+		CountInStock: p.CountInStock,
+		Version:      p.Version,
+	})
+}
+
+func insertProductUpdatedEvent(ctx context.Context, tx *sqlx.Tx, p *domain.Product) error {
+	return insertProductEvent(ctx, tx, domain.EventProductUpdated, p)
+}
+
+// RelayOutboxEvents блокирует до limit неопубликованных событий в порядке id и передает их publish по одному.
+// Опубликованные отмечаются в той же транзакции. Если процесс упадет после publish, но до коммита,
+// событие уйдет повторно - доставка at-least-once.
+//
+// Порядок гарантируется только внутри агрегата (aggregate_type, aggregate_id). id выдается при вставке,
+// а видно событие становится при коммите, поэтому событие с меньшим id может появиться уже после
+// публикации большего. События одного агрегата пишутся под блокировкой его строки, и для них порядок id
+// совпадает с порядком коммитов. На первой ошибке relay останавливается, чтобы не нарушить этот порядок:
+// событие с ошибкой и все следующие будут отправлены в следующий раз.
+//
+// Событие, которое не опубликовалось за maxAttempts попыток, откладывается в dead letters (dead_at), и relay
+// идет дальше: иначе одно такое событие навсегда задержало бы все следующие. Порядок его агрегата при этом
+// нарушается - отложенное событие уходит, только когда его вернут в очередь через RetryOutboxEvent.
+// Возвращает число опубликованных событий и ошибку publish, на которой relay остановился.
+func (postgres *PostgresStorer) RelayOutboxEvents(ctx context.Context, limit int, maxAttempts int64, publish func(*domain.OutboxEvent) error) (int, error) {
+	var (
+		published  []int64
+		publishErr error
+	)
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		// FOR UPDATE без SKIP LOCKED: второй relay ждет первого, а не публикует события в обход очереди
+		events := []*domain.OutboxEvent{}
+		if err := tx.SelectContext(ctx, &events, queryToLockOutboxEvents, limit); err != nil {
+			return fmt.Errorf("error locking outbox events: %w", err)
+		}
+
+		for _, event := range events {
+			err := publish(event)
+			if err == nil {
+				published = append(published, event.ID)
+				continue
+			}
+			if event.Attempts+1 >= maxAttempts {
+				if _, err := tx.ExecContext(ctx, queryToBuryOutboxEvent, err.Error(), event.ID); err != nil {
+					return fmt.Errorf("error moving outbox event to dead letters: %w", err)
+				}
+				continue
+			}
+			publishErr = err
+			if _, err := tx.ExecContext(ctx, queryToFailOutboxEvent, publishErr.Error(), event.ID); err != nil {
+				return fmt.Errorf("error recording outbox event failure: %w", err)
+			}
+			break
+		}
+
+		if len(published) == 0 {
+			return nil
+		}
+		if _, err := tx.ExecContext(ctx, queryToMarkOutboxEvents, pq.Array(published)); err != nil {
+			return fmt.Errorf("error marking outbox events published: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(published), publishErr
+}
+
+// GetDeadOutboxEvents возвращает до limit отложенных событий в порядке id.
+func (postgres *PostgresStorer) GetDeadOutboxEvents(ctx context.Context, limit int64) ([]*domain.OutboxEvent, error) {
+	events := []*domain.OutboxEvent{}
+	if err := postgres.db.SelectContext(ctx, &events, queryToSelectDeadEvents, limit); err != nil {
+		return nil, fmt.Errorf("error getting dead outbox events: %w", err)
+	}
+	return events, nil
+}
+
+// RetryOutboxEvent возвращает отложенное событие в очередь relay с полным набором попыток.
+// Последняя ошибка остается, пока ее не заменит новая попытка.
+func (postgres *PostgresStorer) RetryOutboxEvent(ctx context.Context, id int64) (*domain.OutboxEvent, error) {
+	op := "storer.RetryOutboxEvent"
+	event := domain.OutboxEvent{}
+	err := postgres.db.GetContext(ctx, &event, queryToRetryOutboxEvent, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "dead outbox event", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error retrying outbox event with id %d: %w", id, err)
+	}
+	return &event, nil
+}
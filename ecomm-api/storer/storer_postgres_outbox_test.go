@@ -0,0 +1,249 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func expectOutboxEvent(mock sqlmock.Sqlmock, aggregateType string, aggregateID int64, eventType string) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload) VALUES ($1, $2, $3, $4)")).
+		WithArgs(aggregateType, aggregateID, eventType, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+func TestRelayOutboxEvents(t *testing.T) {
+	outboxColumns := []string{"id", "aggregate_type", "aggregate_id", "type", "payload", "attempts", "last_error", "created_at", "published_at"}
+	lockQuery := regexp.QuoteMeta("SELECT * FROM outbox_events WHERE published_at IS NULL AND dead_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE")
+	markQuery := regexp.QuoteMeta("UPDATE outbox_events SET published_at=NOW(), attempts=attempts+1, last_error=NULL WHERE id = ANY($1)")
+	failQuery := regexp.QuoteMeta("UPDATE outbox_events SET attempts=attempts+1, last_error=$1 WHERE id=$2")
+	buryQuery := regexp.QuoteMeta("UPDATE outbox_events SET attempts=attempts+1, last_error=$1, dead_at=NOW() WHERE id=$2")
+	eventRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(outboxColumns).
+			AddRow(1, "order", 10, domain.EventOrderCreated, `{"order_id":10}`, 0, nil, time.Now(), nil).
+			AddRow(2, "product", 3, domain.EventProductUpdated, `{"product_id":3}`, 0, nil, time.Now(), nil).
+			AddRow(3, "product", 3, domain.EventProductDeleted, `{"product_id":3}`, 0, nil, time.Now(), nil)
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "publishes events in order",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(100).WillReturnRows(eventRows())
+				mock.ExpectExec(markQuery).WithArgs(pq.Array([]int64{1, 2, 3})).WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectCommit()
+
+				var types []string
+				n, err := postgresTest.RelayOutboxEvents(context.Background(), 100, 10, func(event *domain.OutboxEvent) error {
+					types = append(types, event.Type)
+					return nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, 3, n)
+				require.Equal(t, []string{domain.EventOrderCreated, domain.EventProductUpdated, domain.EventProductDeleted}, types)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "stops on the first publish error",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(100).WillReturnRows(eventRows())
+				mock.ExpectExec(failQuery).WithArgs("broker is down", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(markQuery).WithArgs(pq.Array([]int64{1})).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				publishErr := errors.New("broker is down")
+				var ids []int64
+				n, err := postgresTest.RelayOutboxEvents(context.Background(), 100, 10, func(event *domain.OutboxEvent) error {
+					ids = append(ids, event.ID)
+					if event.ID == 2 {
+						return publishErr
+					}
+					return nil
+				})
+				require.ErrorIs(t, err, publishErr)
+				require.Equal(t, 1, n)
+				require.Equal(t, []int64{1, 2}, ids)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "event out of attempts is moved to dead letters and the rest are published",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(100).WillReturnRows(sqlmock.NewRows(outboxColumns).
+					AddRow(1, "order", 10, domain.EventOrderCreated, `{"order_id":10}`, 9, "broken payload", time.Now(), nil).
+					AddRow(2, "product", 3, domain.EventProductUpdated, `{"product_id":3}`, 0, nil, time.Now(), nil))
+				mock.ExpectExec(buryQuery).WithArgs("broken payload", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(markQuery).WithArgs(pq.Array([]int64{2})).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				n, err := postgresTest.RelayOutboxEvents(context.Background(), 100, 10, func(event *domain.OutboxEvent) error {
+					if event.ID == 1 {
+						return errors.New("broken payload")
+					}
+					return nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, 1, n)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "empty outbox",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(100).WillReturnRows(sqlmock.NewRows(outboxColumns))
+				mock.ExpectCommit()
+
+				n, err := postgresTest.RelayOutboxEvents(context.Background(), 100, 10, func(event *domain.OutboxEvent) error {
+					t.Fatal("nothing to publish")
+					return nil
+				})
+				require.NoError(t, err)
+				require.Zero(t, n)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestRetryOutboxEvent(t *testing.T) {
+	outboxColumns := []string{"id", "aggregate_type", "aggregate_id", "type", "payload", "attempts", "last_error", "created_at", "published_at", "dead_at"}
+	retryQuery := regexp.QuoteMeta("UPDATE outbox_events SET dead_at=NULL, attempts=0 WHERE id=$1 AND dead_at IS NOT NULL AND published_at IS NULL RETURNING *")
+
+	t.Run("dead event goes back to the queue", func(t *testing.T) {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(retryQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows(outboxColumns).
+				AddRow(1, "order", 10, domain.EventOrderCreated, `{"order_id":10}`, 0, "broken payload", time.Now(), nil, nil))
+
+			event, err := NewPostgresStorer(db).RetryOutboxEvent(context.Background(), 1)
+			require.NoError(t, err)
+			require.Zero(t, event.Attempts)
+			require.Nil(t, event.DeadAt)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("event is not dead", func(t *testing.T) {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(retryQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows(outboxColumns))
+
+			_, err := NewPostgresStorer(db).RetryOutboxEvent(context.Background(), 1)
+			var notFoundErr *NotFoundError
+			require.ErrorAs(t, err, &notFoundErr)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+}
+
+func TestProductEvents(t *testing.T) {
+	productColumns := []string{"id", "sku", "name", "image", "category_id", "description", "price", "count_in_stock", "version", "created_at"}
+	productRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(productColumns).AddRow(3, nil, "lamp", "lamp.jpg", 1, "", 10, 5, 2, time.Now())
+	}
+	expectEventPayload := func(mock sqlmock.Sqlmock, eventType string, payload string) {
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload) VALUES ($1, $2, $3, $4)")).
+			WithArgs("product", 3, eventType, payload).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	productPayload := `{"product_id":3,"sku":null,"name":"lamp","category_id":1,"price":10,"count_in_stock":5,"version":2}`
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "create writes product.created",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO products")).WillReturnRows(productRows())
+				expectEventPayload(mock, domain.EventProductCreated, productPayload)
+				mock.ExpectCommit()
+
+				_, err := postgresTest.CreateProduct(context.Background(), &domain.Product{Name: "lamp", Image: "lamp.jpg", CategoryID: 1, Price: 10, CountInStock: 5})
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "restore writes product.restored",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET deleted_at=NULL")).WithArgs(3).WillReturnRows(productRows())
+				expectEventPayload(mock, domain.EventProductRestored, productPayload)
+				mock.ExpectCommit()
+
+				_, err := postgresTest.RestoreProduct(context.Background(), 3)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "reimport writes product.updated",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("SAVEPOINT import_row")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE name=$1")).WithArgs("lamp").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET sku=COALESCE($1, sku)")).WillReturnRows(productRows())
+				expectEventPayload(mock, domain.EventProductUpdated, productPayload)
+				mock.ExpectExec(regexp.QuoteMeta("RELEASE SAVEPOINT import_row")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+
+				results, err := postgresTest.ImportProducts(context.Background(),
+					[]ImportRow{{Line: 2, Product: &domain.Product{Name: "lamp", Image: "lamp.jpg", CategoryID: 1, Price: 10, CountInStock: 5}}}, false)
+				require.NoError(t, err)
+				require.NoError(t, results[0].Err)
+			},
+		},
+		{
+			name: "received variant return writes product.stock_changed",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE returns SET status=$1")).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "order_item_id", "quantity", "status"}).AddRow(5, 1, 101, 2, "received"))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE id=$1")).WithArgs(101).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "quantity", "product_id", "variant_id", "order_id"}).AddRow(101, 2, 3, 9, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE id=$1 FOR UPDATE")).WithArgs(3).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE product_variants SET count_in_stock = count_in_stock + $1")).WithArgs(2, 9).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "count_in_stock", "version"}).AddRow(9, 3, 4, 6))
+				expectEventPayload(mock, domain.EventProductStockChanged,
+					`{"product_id":3,"variant_id":9,"delta":2,"count_in_stock":4,"version":6}`)
+				mock.ExpectCommit()
+
+				_, err := postgresTest.ReceiveReturn(context.Background(), 5, "")
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	queryToLockOrderItem        = "SELECT * FROM order_items WHERE id=$1 AND order_id=$2 FOR UPDATE"
+	queryToSumReturnedItems     = "SELECT COALESCE(SUM(quantity), 0) FROM returns WHERE order_item_id=$1 AND status <> 'rejected'"
+	queryToInsertReturn         = "INSERT INTO returns (order_id, order_item_id, quantity, reason, status) VALUES (:order_id, :order_item_id, :quantity, :reason, :status) RETURNING *"
+	queryToSelectReturn         = "SELECT * FROM returns WHERE id=$1"
+	queryToLockReturn           = "SELECT * FROM returns WHERE id=$1 FOR UPDATE"
+	queryToUpdateReturnState    = "UPDATE returns SET status=$1, admin_note=$2, updated_at=NOW() WHERE id=$3 AND status = ANY($4) RETURNING *"
+	queryToSelectOrderItem      = "SELECT * FROM order_items WHERE id=$1"
+	queryToRestockReturn        = "UPDATE products SET count_in_stock = count_in_stock + $1, version=version+1, updated_at=NOW() WHERE id=$2 RETURNING *"
+	queryToRestockReturnVariant = "UPDATE product_variants SET count_in_stock = count_in_stock + $1, version=version+1, updated_at=NOW() WHERE id=$2 RETURNING *"
+	// Удаленный товар тоже блокируется: возвращенный товар приходит на склад и в этом случае
+	queryToLockReturnedProduct = "SELECT id FROM products WHERE id=$1 FOR UPDATE"
+
+	queryToLockOrderPayment   = "SELECT * FROM payments WHERE order_id=$1 AND status = ANY($2) ORDER BY id DESC LIMIT 1 FOR UPDATE"
+	queryToInsertRefund       = "INSERT INTO refunds (order_id, payment_id, return_id, amount, reason) VALUES (:order_id, :payment_id, :return_id, :amount, :reason) RETURNING *"
+	queryToAddPaymentRefund   = "UPDATE payments SET refunded_amount = refunded_amount + $1, status = CASE WHEN refunded_amount + $1 >= captured_amount THEN 'refunded' ELSE 'partially_refunded' END, updated_at=NOW() WHERE id=$2"
+	queryToAddOrderRefund     = "UPDATE orders SET refunded_price = refunded_price + $1, status = CASE WHEN refunded_price + $1 >= total_price THEN 'refunded' ELSE status END, updated_at=NOW() WHERE id=$2"
+	queryToMarkReturnRefunded = "UPDATE returns SET status='refunded', updated_at=NOW() WHERE id=$1"
+	queryToHasReturnRefund    = "SELECT EXISTS (SELECT 1 FROM refunds WHERE return_id=$1 AND status <> 'failed')"
+
+	queryToSelectPendingRefunds = "SELECT * FROM refunds WHERE status='pending' ORDER BY id LIMIT $1"
+	queryToCompleteRefund       = "UPDATE refunds SET status='succeeded', provider_refund_id=$1, last_error=NULL, updated_at=NOW() WHERE id=$2 AND status='pending'"
+	queryToLockPendingRefund    = "SELECT * FROM refunds WHERE id=$1 AND status='pending' FOR UPDATE"
+	queryToFailRefund           = "UPDATE refunds SET status='failed', last_error=$1, updated_at=NOW() WHERE id=$2"
+	queryToRevertPaymentRefund  = "UPDATE payments SET refunded_amount = refunded_amount - $1, status = CASE WHEN refunded_amount - $1 > 0 THEN 'partially_refunded' ELSE 'captured' END, updated_at=NOW() WHERE id=$2"
+	queryToRevertOrderRefund    = "UPDATE orders SET refunded_price = refunded_price - $1, status = CASE WHEN status = 'refunded' THEN CASE WHEN shipped_at IS NULL THEN 'paid' ELSE 'shipped' END ELSE status END, updated_at=NOW() WHERE id=$2"
+)
+
+// CreateReturn блокирует позицию заказа, чтобы две параллельные заявки не вернули больше, чем было куплено.
+func (postgres *PostgresStorer) CreateReturn(ctx context.Context, ret *domain.Return) (*domain.Return, error) {
+	op := "storer.CreateReturn"
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		item := domain.OrderItem{}
+		err := tx.GetContext(ctx, &item, queryToLockOrderItem, ret.OrderItemID, ret.OrderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "order item", ret.OrderItemID, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting order item with id %d: %w", ret.OrderItemID, err)
+		}
+
+		var returned int64
+		if err := tx.GetContext(ctx, &returned, queryToSumReturnedItems, ret.OrderItemID); err != nil {
+			return fmt.Errorf("error counting returned items: %w", err)
+		}
+		if returned+ret.Quantity > item.Quantity {
+			return NewReturnQuantityError(op, ret.OrderItemID, ret.Quantity, item.Quantity-returned)
+		}
+
+		stmt, err := tx.PrepareNamedContext(ctx, queryToInsertReturn)
+		if err != nil {
+			return fmt.Errorf("Error creating statement: %w", err)
+		}
+		defer stmt.Close()
+
+		if err := stmt.GetContext(ctx, ret, ret); err != nil {
+			return fmt.Errorf("Error creating return: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (postgres *PostgresStorer) GetReturn(ctx context.Context, id int64) (*domain.Return, error) {
+	op := "storer.GetReturn"
+	ret := domain.Return{}
+	err := postgres.db.GetContext(ctx, &ret, queryToSelectReturn, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "return", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting return: %w", err)
+	}
+	return &ret, nil
+}
+
+func (postgres *PostgresStorer) GetReturnsByOrderID(ctx context.Context, orderID int64) ([]*domain.Return, error) {
+	returns := []*domain.Return{}
+	err := postgres.db.SelectContext(ctx, &returns, "SELECT * FROM returns WHERE order_id=$1 ORDER BY id", orderID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting returns: %w", err)
+	}
+	return returns, nil
+}
+
+// GetReturns возвращает заявки на возврат, пустой status - все заявки.
+func (postgres *PostgresStorer) GetReturns(ctx context.Context, status string) ([]*domain.Return, error) {
+	returns := []*domain.Return{}
+	err := postgres.db.SelectContext(ctx, &returns, "SELECT * FROM returns WHERE ($1 = '' OR status = $1) ORDER BY id", status)
+	if err != nil {
+		return nil, fmt.Errorf("error getting returns: %w", err)
+	}
+	return returns, nil
+}
+
+// UpdateReturnStatus переводит заявку в статус to, только если она сейчас в одном из статусов from.
+func (postgres *PostgresStorer) UpdateReturnStatus(ctx context.Context, id int64, from []string, to string, note string) (*domain.Return, error) {
+	ret := domain.Return{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		return updateReturnStatus(ctx, tx, &ret, id, from, to, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ReceiveReturn отмечает, что товар вернулся на склад, возвращает его в count_in_stock
+// и пишет событие product.stock_changed в той же транзакции.
+func (postgres *PostgresStorer) ReceiveReturn(ctx context.Context, id int64, note string) (*domain.Return, error) {
+	ret := domain.Return{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := updateReturnStatus(ctx, tx, &ret, id, []string{domain.ReturnStatusApproved}, domain.ReturnStatusReceived, note)
+		if err != nil {
+			return err
+		}
+
+		item := domain.OrderItem{}
+		if err := tx.GetContext(ctx, &item, queryToSelectOrderItem, ret.OrderItemID); err != nil {
+			return fmt.Errorf("error getting order item with id %d: %w", ret.OrderItemID, err)
+		}
+		return restockReturnedItem(ctx, tx, &item, ret.Quantity)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// restockReturnedItem возвращает quantity единиц позиции на склад товара или его варианта.
+// Для варианта товар блокируется заранее, как в adjustVariantStock: событие пишется от имени товара.
+func restockReturnedItem(ctx context.Context, tx *sqlx.Tx, item *domain.OrderItem, quantity int64) error {
+	if item.VariantID == nil {
+		product := domain.Product{}
+		if err := tx.GetContext(ctx, &product, queryToRestockReturn, quantity, item.ProductID); err != nil {
+			return fmt.Errorf("error restocking product with id %d: %w", item.ProductID, err)
+		}
+		return insertOutboxEvent(ctx, tx, "product", item.ProductID, domain.EventProductStockChanged, productStockChangedEventPayload{
+			ProductID:    item.ProductID,
+			Delta:        quantity,
+			CountInStock: product.CountInStock,
+			Version:      product.Version,
+		})
+	}
+
+	var productID int64
+	if err := tx.GetContext(ctx, &productID, queryToLockReturnedProduct, item.ProductID); err != nil {
+		return fmt.Errorf("error locking product with id %d: %w", item.ProductID, err)
+	}
+	variant := domain.ProductVariant{}
+	if err := tx.GetContext(ctx, &variant, queryToRestockReturnVariant, quantity, *item.VariantID); err != nil {
+		return fmt.Errorf("error restocking product variant with id %d: %w", *item.VariantID, err)
+	}
+	return insertOutboxEvent(ctx, tx, "product", item.ProductID, domain.EventProductStockChanged, productStockChangedEventPayload{
+		ProductID:    item.ProductID,
+		VariantID:    item.VariantID,
+		Delta:        quantity,
+		CountInStock: variant.CountInStock,
+		Version:      variant.Version,
+	})
+}
+
+func updateReturnStatus(ctx context.Context, tx *sqlx.Tx, ret *domain.Return, id int64, from []string, to string, note string) error {
+	op := "storer.UpdateReturnStatus"
+	err := tx.GetContext(ctx, ret, queryToUpdateReturnState, to, note, id, pq.Array(from))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error updating return with id %d: %w", id, err)
+	}
+
+	// Ничего не обновилось: либо заявки нет, либо она в неподходящем статусе
+	current := domain.Return{}
+	err = tx.GetContext(ctx, &current, queryToSelectReturn, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewNotFoundError(op, "return", id, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting return with id %d: %w", id, err)
+	}
+	return NewInvalidStateError(op, "return", id, current.Status)
+}
+
+// RefundFunc проверяет сумму возврата по заблокированному платежу и заполняет ее, если она не задана.
+type RefundFunc func(payment *domain.Payment, refund *domain.Refund) error
+
+// CreateRefund в одной транзакции пишет строку возврата в статусе pending и уменьшает
+// оплаченную сумму платежа и заказа. Если у refund указан ReturnID, заявка на возврат
+// должна быть одобрена или получена и переходит в refunded. Заявку в refunded можно вернуть
+// еще раз, только если все ее возвраты отклонены шлюзом.
+//
+// Через шлюз деньги возвращаются уже после коммита (CompleteRefund/FailRefund): если шлюз
+// вызывать в транзакции, а коммит не пройдет, деньги уйдут, а заказ останется как был.
+func (postgres *PostgresStorer) CreateRefund(ctx context.Context, refund *domain.Refund, refundFn RefundFunc) (*domain.Refund, error) {
+	op := "storer.CreateRefund"
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		if refund.ReturnID != nil {
+			ret := domain.Return{}
+			err := tx.GetContext(ctx, &ret, queryToLockReturn, *refund.ReturnID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return NewNotFoundError(op, "return", *refund.ReturnID, nil)
+			}
+			if err != nil {
+				return fmt.Errorf("error getting return with id %d: %w", *refund.ReturnID, err)
+			}
+			switch ret.Status {
+			case domain.ReturnStatusApproved, domain.ReturnStatusReceived:
+			case domain.ReturnStatusRefunded:
+				var refunded bool
+				if err := tx.GetContext(ctx, &refunded, queryToHasReturnRefund, ret.ID); err != nil {
+					return fmt.Errorf("error getting refunds of return with id %d: %w", ret.ID, err)
+				}
+				if refunded {
+					return NewInvalidStateError(op, "return", ret.ID, ret.Status)
+				}
+			default:
+				return NewInvalidStateError(op, "return", ret.ID, ret.Status)
+			}
+		}
+
+		payment, err := lockRefundablePayment(ctx, tx, refund.OrderID)
+		if err != nil {
+			return err
+		}
+		if payment == nil {
+			return NewNotFoundError(op, "refundable payment for order", refund.OrderID, nil)
+		}
+
+		return createRefund(ctx, tx, payment, refund, refundFn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+// lockRefundablePayment блокирует последний списанный платёж заказа; nil - возвращать нечего.
+func lockRefundablePayment(ctx context.Context, tx *sqlx.Tx, orderID int64) (*domain.Payment, error) {
+	payment := domain.Payment{}
+	refundable := []string{domain.PaymentStatusCaptured, domain.PaymentStatusPartiallyRefunded}
+	err := tx.GetContext(ctx, &payment, queryToLockOrderPayment, orderID, pq.Array(refundable))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting payment for order with id %d: %w", orderID, err)
+	}
+	return &payment, nil
+}
+
+func createRefund(ctx context.Context, tx *sqlx.Tx, payment *domain.Payment, refund *domain.Refund, refundFn RefundFunc) error {
+	if err := refundFn(payment, refund); err != nil {
+		return err
+	}
+	refund.PaymentID = payment.ID
+
+	stmt, err := tx.PrepareNamedContext(ctx, queryToInsertRefund)
+	if err != nil {
+		return fmt.Errorf("Error creating statement: %w", err)
+	}
+	defer stmt.Close()
+	if err := stmt.GetContext(ctx, refund, refund); err != nil {
+		return fmt.Errorf("Error creating refund: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, queryToAddPaymentRefund, refund.Amount, payment.ID); err != nil {
+		return fmt.Errorf("error updating payment with id %d: %w", payment.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, queryToAddOrderRefund, refund.Amount, refund.OrderID); err != nil {
+		return fmt.Errorf("error updating order with id %d: %w", refund.OrderID, err)
+	}
+	if refund.ReturnID != nil {
+		if _, err := tx.ExecContext(ctx, queryToMarkReturnRefunded, *refund.ReturnID); err != nil {
+			return fmt.Errorf("error updating return with id %d: %w", *refund.ReturnID, err)
+		}
+	}
+	return nil
+}
+
+// GetPendingRefunds - возвраты, которые еще не прошли через шлюз, от старых к новым.
+func (postgres *PostgresStorer) GetPendingRefunds(ctx context.Context, limit int) ([]domain.Refund, error) {
+	refunds := []domain.Refund{}
+	if err := postgres.db.SelectContext(ctx, &refunds, queryToSelectPendingRefunds, limit); err != nil {
+		return nil, fmt.Errorf("error getting pending refunds: %w", err)
+	}
+	return refunds, nil
+}
+
+// CompleteRefund отмечает, что шлюз вернул деньги. Уже завершенный возврат не меняется.
+func (postgres *PostgresStorer) CompleteRefund(ctx context.Context, id int64, providerRefundID string) error {
+	if _, err := postgres.db.ExecContext(ctx, queryToCompleteRefund, providerRefundID, id); err != nil {
+		return fmt.Errorf("error completing refund with id %d: %w", id, err)
+	}
+	return nil
+}
+
+// FailRefund отмечает, что шлюз отказал в возврате, и снова делает сумму доступной
+// для возврата. Заявка на возврат остается refunded, но без действующего возврата
+// CreateRefund примет ее снова.
+func (postgres *PostgresStorer) FailRefund(ctx context.Context, id int64, message string) error {
+	return postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		refund := domain.Refund{}
+		err := tx.GetContext(ctx, &refund, queryToLockPendingRefund, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error getting refund with id %d: %w", id, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, queryToFailRefund, message, id); err != nil {
+			return fmt.Errorf("error failing refund with id %d: %w", id, err)
+		}
+		if _, err := tx.ExecContext(ctx, queryToRevertPaymentRefund, refund.Amount, refund.PaymentID); err != nil {
+			return fmt.Errorf("error updating payment with id %d: %w", refund.PaymentID, err)
+		}
+		if _, err := tx.ExecContext(ctx, queryToRevertOrderRefund, refund.Amount, refund.OrderID); err != nil {
+			return fmt.Errorf("error updating order with id %d: %w", refund.OrderID, err)
+		}
+		return nil
+	})
+}
+
+func (postgres *PostgresStorer) GetRefundsByOrderID(ctx context.Context, orderID int64) ([]domain.Refund, error) {
+	refunds := []domain.Refund{}
+	err := postgres.db.SelectContext(ctx, &refunds, "SELECT * FROM refunds WHERE order_id=$1 ORDER BY id", orderID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting refunds: %w", err)
+	}
+	return refunds, nil
+}
@@ -0,0 +1,405 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	returnColumns  = []string{"id", "order_id", "order_item_id", "quantity", "reason", "status", "admin_note", "created_at", "updated_at"}
+	paymentColumns = []string{"id", "order_id", "provider", "method", "status", "amount", "captured_amount", "refunded_amount", "authorization_id", "created_at", "updated_at"}
+)
+
+func TestCreateReturn(t *testing.T) {
+	itemColumns := []string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}
+	newReturn := func(quantity int64) *domain.Return {
+		return &domain.Return{OrderID: 1, OrderItemID: 101, Quantity: quantity, Reason: "broken", Status: domain.ReturnStatusRequested}
+	}
+	expectLockItem := func(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE id=$1 AND order_id=$2 FOR UPDATE")).
+			WithArgs(101, 1).
+			WillReturnRows(rows)
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				ret := newReturn(2)
+				mock.ExpectBegin()
+				expectLockItem(mock, sqlmock.NewRows(itemColumns).AddRow(101, "item", 3, "test.jpg", 50, 1, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(SUM(quantity), 0) FROM returns WHERE order_item_id=$1 AND status <> 'rejected'")).
+					WithArgs(101).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(1))
+				mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO returns (order_id, order_item_id, quantity, reason, status) VALUES ($1, $2, $3, $4, $5) RETURNING *")).
+					ExpectQuery().
+					WithArgs(1, 101, 2, "broken", domain.ReturnStatusRequested).
+					WillReturnRows(sqlmock.NewRows(returnColumns).AddRow(5, 1, 101, 2, "broken", "requested", "", time.Now(), nil))
+				mock.ExpectCommit()
+
+				created, err := postgresTest.CreateReturn(context.Background(), ret)
+				require.NoError(t, err)
+				require.Equal(t, int64(5), created.ID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "more than left to return",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockItem(mock, sqlmock.NewRows(itemColumns).AddRow(101, "item", 3, "test.jpg", 50, 1, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(SUM(quantity), 0) FROM returns")).
+					WithArgs(101).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(2))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateReturn(context.Background(), newReturn(2))
+				var quantityError *ReturnQuantityError
+				require.ErrorAs(t, err, &quantityError)
+				require.Equal(t, int64(1), quantityError.Available)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "item does not belong to order",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockItem(mock, sqlmock.NewRows(itemColumns))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateReturn(context.Background(), newReturn(1))
+				var notFoundError *NotFoundError
+				require.ErrorAs(t, err, &notFoundError)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestReceiveReturn(t *testing.T) {
+	updateQuery := regexp.QuoteMeta("UPDATE returns SET status=$1, admin_note=$2, updated_at=NOW() WHERE id=$3 AND status = ANY($4) RETURNING *")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "restocks returned quantity",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(updateQuery).
+					WithArgs(domain.ReturnStatusReceived, "ok", 5, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(returnColumns).AddRow(5, 1, 101, 2, "broken", "received", "ok", time.Now(), time.Now()))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE id=$1")).
+					WithArgs(101).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "quantity", "product_id", "variant_id", "order_id"}).AddRow(101, 2, 3, nil, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET count_in_stock = count_in_stock + $1, version=version+1, updated_at=NOW() WHERE id=$2 RETURNING *")).
+					WithArgs(2, 3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "count_in_stock", "version"}).AddRow(3, 7, 5))
+				expectOutboxEvent(mock, "product", 3, domain.EventProductStockChanged)
+				mock.ExpectCommit()
+
+				ret, err := postgresTest.ReceiveReturn(context.Background(), 5, "ok")
+				require.NoError(t, err)
+				require.Equal(t, domain.ReturnStatusReceived, ret.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "return is not approved",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(updateQuery).
+					WithArgs(domain.ReturnStatusReceived, "", 5, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(returnColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM returns WHERE id=$1")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows(returnColumns).AddRow(5, 1, 101, 2, "broken", "requested", "", time.Now(), nil))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.ReceiveReturn(context.Background(), 5, "")
+				var invalidStateError *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateError)
+				require.Equal(t, domain.ReturnStatusRequested, invalidStateError.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestCreateRefund(t *testing.T) {
+	refundColumns := []string{"id", "order_id", "payment_id", "return_id", "amount", "reason", "provider_refund_id", "status", "created_at"}
+	expectLockPayment := func(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1 AND status = ANY($2) ORDER BY id DESC LIMIT 1 FOR UPDATE")).
+			WithArgs(1, sqlmock.AnyArg()).
+			WillReturnRows(rows)
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "partial refund for a return",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				returnID := int64(5)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM returns WHERE id=$1 FOR UPDATE")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows(returnColumns).AddRow(5, 1, 101, 1, "broken", "received", "", time.Now(), nil))
+				expectLockPayment(mock, sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, "fake", "card", "captured", 130, 130, 0, "fake_auth_000001", time.Now(), nil))
+				mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO refunds (order_id, payment_id, return_id, amount, reason) VALUES ($1, $2, $3, $4, $5) RETURNING *")).
+					ExpectQuery().
+					WithArgs(1, 7, &returnID, 55.0, "broken").
+					WillReturnRows(sqlmock.NewRows(refundColumns).AddRow(9, 1, 7, 5, 55.0, "broken", "", "pending", time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET refunded_amount = refunded_amount + $1")).
+					WithArgs(55.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price + $1")).
+					WithArgs(55.0, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE returns SET status='refunded', updated_at=NOW() WHERE id=$1")).
+					WithArgs(5).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				refund, err := postgresTest.CreateRefund(context.Background(),
+					&domain.Refund{OrderID: 1, ReturnID: &returnID, Amount: 55, Reason: "broken"},
+					func(payment *domain.Payment, refund *domain.Refund) error {
+						require.Equal(t, "fake_auth_000001", payment.AuthorizationID)
+						return nil
+					})
+				require.NoError(t, err)
+				require.Equal(t, int64(9), refund.ID)
+				require.Equal(t, int64(7), refund.PaymentID)
+				require.Equal(t, domain.RefundStatusPending, refund.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "declined refund of a return is retried",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				returnID := int64(5)
+				// Шлюз отказал: сумма снова доступна, заявка осталась refunded
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM refunds WHERE id=$1 AND status='pending' FOR UPDATE")).
+					WithArgs(9).
+					WillReturnRows(sqlmock.NewRows(refundColumns).AddRow(9, 1, 7, 5, 55.0, "broken", "", "pending", time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE refunds SET status='failed'")).
+					WithArgs("declined", 9).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET refunded_amount = refunded_amount - $1")).
+					WithArgs(55.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price - $1")).
+					WithArgs(55.0, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				require.NoError(t, postgresTest.FailRefund(context.Background(), 9, "declined"))
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM returns WHERE id=$1 FOR UPDATE")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows(returnColumns).AddRow(5, 1, 101, 1, "broken", "refunded", "", time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM refunds WHERE return_id=$1 AND status <> 'failed')")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				expectLockPayment(mock, sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, "fake", "card", "captured", 130, 130, 0, "fake_auth_000001", time.Now(), nil))
+				mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO refunds")).
+					ExpectQuery().
+					WithArgs(1, 7, &returnID, 55.0, "broken").
+					WillReturnRows(sqlmock.NewRows(refundColumns).AddRow(10, 1, 7, 5, 55.0, "broken", "", "pending", time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET refunded_amount = refunded_amount + $1")).
+					WithArgs(55.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price + $1")).
+					WithArgs(55.0, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE returns SET status='refunded', updated_at=NOW() WHERE id=$1")).
+					WithArgs(5).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				refund, err := postgresTest.CreateRefund(context.Background(),
+					&domain.Refund{OrderID: 1, ReturnID: &returnID, Amount: 55, Reason: "broken"},
+					func(payment *domain.Payment, refund *domain.Refund) error { return nil })
+				require.NoError(t, err)
+				require.Equal(t, int64(10), refund.ID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "return with an active refund is not refunded twice",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				returnID := int64(5)
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM returns WHERE id=$1 FOR UPDATE")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows(returnColumns).AddRow(5, 1, 101, 1, "broken", "refunded", "", time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM refunds WHERE return_id=$1 AND status <> 'failed')")).
+					WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateRefund(context.Background(),
+					&domain.Refund{OrderID: 1, ReturnID: &returnID, Amount: 55, Reason: "broken"},
+					func(payment *domain.Payment, refund *domain.Refund) error {
+						return fmt.Errorf("must not be called")
+					})
+				var invalidStateError *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateError)
+				require.Equal(t, domain.ReturnStatusRefunded, invalidStateError.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "invalid amount rolls back",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockPayment(mock, sqlmock.NewRows(paymentColumns).
+					AddRow(7, 1, "fake", "card", "captured", 130, 130, 0, "fake_auth_000001", time.Now(), nil))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateRefund(context.Background(),
+					&domain.Refund{OrderID: 1, Amount: 10},
+					func(payment *domain.Payment, refund *domain.Refund) error {
+						return errors.New("amount exceeds refundable amount")
+					})
+				require.ErrorContains(t, err, "amount exceeds refundable amount")
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "order has no refundable payment",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockPayment(mock, sqlmock.NewRows(paymentColumns))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateRefund(context.Background(), &domain.Refund{OrderID: 1, Amount: 10},
+					func(payment *domain.Payment, refund *domain.Refund) error {
+						return fmt.Errorf("must not be called")
+					})
+				var notFoundError *NotFoundError
+				require.ErrorAs(t, err, &notFoundError)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestSettleRefund(t *testing.T) {
+	refundColumns := []string{"id", "order_id", "payment_id", "return_id", "amount", "reason", "provider_refund_id", "status", "created_at"}
+	lockQuery := regexp.QuoteMeta("SELECT * FROM refunds WHERE id=$1 AND status='pending' FOR UPDATE")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "pending refunds",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM refunds WHERE status='pending' ORDER BY id LIMIT $1")).
+					WithArgs(100).
+					WillReturnRows(sqlmock.NewRows(refundColumns).AddRow(9, 1, 7, nil, 55.0, "broken", "", "pending", time.Now()))
+
+				refunds, err := postgresTest.GetPendingRefunds(context.Background(), 100)
+				require.NoError(t, err)
+				require.Len(t, refunds, 1)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "complete",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE refunds SET status='succeeded', provider_refund_id=$1, last_error=NULL, updated_at=NOW() WHERE id=$2 AND status='pending'")).
+					WithArgs("fake_ref_000003", 9).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				require.NoError(t, postgresTest.CompleteRefund(context.Background(), 9, "fake_ref_000003"))
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "fail returns the amount to payment and order",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs(9).
+					WillReturnRows(sqlmock.NewRows(refundColumns).AddRow(9, 1, 7, nil, 55.0, "broken", "", "pending", time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE refunds SET status='failed', last_error=$1, updated_at=NOW() WHERE id=$2")).
+					WithArgs("declined", 9).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET refunded_amount = refunded_amount - $1")).
+					WithArgs(55.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price - $1")).
+					WithArgs(55.0, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				require.NoError(t, postgresTest.FailRefund(context.Background(), 9, "declined"))
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "fail of already settled refund changes nothing",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs(9).
+					WillReturnRows(sqlmock.NewRows(refundColumns))
+				mock.ExpectCommit()
+
+				require.NoError(t, postgresTest.FailRefund(context.Background(), 9, "declined"))
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	queryToCheckProductPurchase = "SELECT EXISTS (SELECT 1 FROM order_items oi JOIN orders o ON o.id = oi.order_id WHERE o.user_id=$1 AND oi.product_id=$2 AND o.status = ANY($3))"
+	queryToInsertReview         = "INSERT INTO reviews (product_id, user_id, rating, comment, status) VALUES (:product_id, :user_id, :rating, :comment, :status) RETURNING *"
+	queryToLockReview           = "SELECT * FROM reviews WHERE id=$1 FOR UPDATE"
+	queryToUpdateReviewStatus   = "UPDATE reviews SET status=$1, updated_at=NOW() WHERE id=$2 RETURNING *"
+	queryToLockProductRating    = "SELECT id FROM products WHERE id=$1 AND deleted_at IS NULL FOR UPDATE"
+	// version не меняется: рейтинг не редактируется через API и не должен ломать If-Match у администратора
+	queryToRecomputeRating = "UPDATE products p SET rating = COALESCE(r.rating, 0), num_reviews = r.num_reviews, updated_at=NOW() FROM (SELECT ROUND(AVG(rating), 2) AS rating, COUNT(*) AS num_reviews FROM reviews WHERE product_id=$1 AND status='approved') r WHERE p.id=$1"
+	// Меняет только товары, у которых рейтинг разошелся с одобренными отзывами
+	queryToRecomputeAllRatings = "UPDATE products p SET rating = r.rating, num_reviews = r.num_reviews, updated_at=NOW() " +
+		"FROM (SELECT pr.id, COALESCE(ROUND(AVG(rv.rating), 2), 0) AS rating, COUNT(rv.id) AS num_reviews FROM products pr " +
+		"LEFT JOIN reviews rv ON rv.product_id = pr.id AND rv.status='approved' GROUP BY pr.id) r " +
+		"WHERE p.id = r.id AND (p.rating, p.num_reviews) IS DISTINCT FROM (r.rating, r.num_reviews)"
+)
+
+// HasPurchasedProduct проверяет, есть ли у пользователя заказ с товаром в одном из статусов statuses.
+func (postgres *PostgresStorer) HasPurchasedProduct(ctx context.Context, userID int64, productID int64, statuses []string) (bool, error) {
+	var purchased bool
+	err := postgres.db.GetContext(ctx, &purchased, queryToCheckProductPurchase, userID, productID, pq.Array(statuses))
+	if err != nil {
+		return false, fmt.Errorf("error checking purchase of product with id %d: %w", productID, err)
+	}
+	return purchased, nil
+}
+
+// CreateReview сохраняет отзыв. Второй отзыв того же пользователя на товар отклоняется уникальным индексом.
+func (postgres *PostgresStorer) CreateReview(ctx context.Context, review *domain.Review) (*domain.Review, error) {
+	op := "storer.CreateReview"
+	rows, err := postgres.db.NamedQueryContext(ctx, queryToInsertReview, review)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			return nil, NewAlreadyExistsError(op, "review", fmt.Sprintf("for product %d", review.ProductID), err)
+		}
+		return nil, fmt.Errorf("Error inserting review: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("review not created")
+	}
+	if err := rows.StructScan(review); err != nil {
+		return nil, fmt.Errorf("Error scanning rows: %w", err)
+	}
+	return review, nil
+}
+
+// ReviewFilter - условия выборки отзывов, нулевые значения не ограничивают выборку.
+type ReviewFilter struct {
+	ProductID int64
+	Status    string
+}
+
+func (postgres *PostgresStorer) GetReviews(ctx context.Context, filter ReviewFilter) ([]*domain.Review, error) {
+	reviews := []*domain.Review{}
+	err := postgres.db.SelectContext(ctx, &reviews,
+		"SELECT * FROM reviews WHERE ($1 = 0 OR product_id = $1) AND ($2 = '' OR status = $2) ORDER BY id",
+		filter.ProductID, filter.Status)
+	if err != nil {
+		return nil, fmt.Errorf("error getting reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+// GetReviewsByProductIDs возвращает отзывы со статусом status сразу для нескольких товаров одним запросом.
+func (postgres *PostgresStorer) GetReviewsByProductIDs(ctx context.Context, productIDs []int64, status string) ([]*domain.Review, error) {
+	reviews := []*domain.Review{}
+	if len(productIDs) == 0 {
+		return reviews, nil
+	}
+	err := postgres.db.SelectContext(ctx, &reviews,
+		"SELECT * FROM reviews WHERE product_id = ANY($1) AND status = $2 ORDER BY id", pq.Array(productIDs), status)
+	if err != nil {
+		return nil, fmt.Errorf("error getting reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+// UpdateReviewStatus переводит отзыв в статус to, только если он сейчас в одном из статусов from.
+// Если одобренных отзывов стало больше или меньше, rating и num_reviews товара пересчитываются в той же транзакции.
+func (postgres *PostgresStorer) UpdateReviewStatus(ctx context.Context, id int64, from []string, to string) (*domain.Review, error) {
+	op := "storer.UpdateReviewStatus"
+	review := domain.Review{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &review, queryToLockReview, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "review", id, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting review with id %d: %w", id, err)
+		}
+		if !slices.Contains(from, review.Status) {
+			return NewInvalidStateError(op, "review", id, review.Status)
+		}
+
+		wasApproved := review.Status == domain.ReviewStatusApproved
+		if err := tx.GetContext(ctx, &review, queryToUpdateReviewStatus, to, id); err != nil {
+			return fmt.Errorf("error updating review with id %d: %w", id, err)
+		}
+		if !wasApproved && to != domain.ReviewStatusApproved {
+			return nil
+		}
+		return recomputeProductRating(ctx, tx, review.ProductID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// recomputeProductRating сначала блокирует товар: UPDATE с подзапросом видит снимок на момент своего начала,
+// и без блокировки две параллельные модерации могли бы не увидеть отзывы друг друга.
+// Рейтинг удаленного товара не пересчитывается, его поправит ночной RecomputeProductRatings.
+func recomputeProductRating(ctx context.Context, tx *sqlx.Tx, productID int64) error {
+	var id int64
+	err := tx.GetContext(ctx, &id, queryToLockProductRating, productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error locking product with id %d: %w", productID, err)
+	}
+	if _, err := tx.ExecContext(ctx, queryToRecomputeRating, productID); err != nil {
+		return fmt.Errorf("error recomputing rating of product with id %d: %w", productID, err)
+	}
+	return nil
+}
+
+// RecomputeProductRatings пересчитывает рейтинги всех товаров по одобренным отзывам и возвращает
+// число исправленных. Нужен как страховка от расхождений, которые не поймал recomputeProductRating.
+func (postgres *PostgresStorer) RecomputeProductRatings(ctx context.Context) (int64, error) {
+	res, err := postgres.db.ExecContext(ctx, queryToRecomputeAllRatings)
+	if err != nil {
+		return 0, fmt.Errorf("error recomputing product ratings: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("cannot get affected rows for product ratings: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var reviewColumns = []string{"id", "product_id", "user_id", "rating", "comment", "status", "created_at", "updated_at"}
+
+func TestUpdateReviewStatus(t *testing.T) {
+	lockQuery := regexp.QuoteMeta("SELECT * FROM reviews WHERE id=$1 FOR UPDATE")
+	updateQuery := regexp.QuoteMeta("UPDATE reviews SET status=$1, updated_at=NOW() WHERE id=$2 RETURNING *")
+	expectRecompute := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE id=$1 AND deleted_at IS NULL FOR UPDATE")).
+			WithArgs(int64(5)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE products p SET rating = COALESCE(r.rating, 0), num_reviews = r.num_reviews, updated_at=NOW() FROM (SELECT ROUND(AVG(rating), 2) AS rating, COUNT(*) AS num_reviews FROM reviews WHERE product_id=$1 AND status='approved') r WHERE p.id=$1")).
+			WithArgs(int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	reviewRow := func(status string) *sqlmock.Rows {
+		return sqlmock.NewRows(reviewColumns).AddRow(1, 5, 3, 4, "good", status, time.Now(), nil)
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "approve recomputes rating",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(reviewRow(domain.ReviewStatusPending))
+				mock.ExpectQuery(updateQuery).WithArgs(domain.ReviewStatusApproved, 1).WillReturnRows(reviewRow(domain.ReviewStatusApproved))
+				expectRecompute(mock)
+				mock.ExpectCommit()
+
+				review, err := postgresTest.UpdateReviewStatus(context.Background(), 1,
+					[]string{domain.ReviewStatusPending}, domain.ReviewStatusApproved)
+				require.NoError(t, err)
+				require.Equal(t, domain.ReviewStatusApproved, review.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "rejecting approved review recomputes rating",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(reviewRow(domain.ReviewStatusApproved))
+				mock.ExpectQuery(updateQuery).WithArgs(domain.ReviewStatusRejected, 1).WillReturnRows(reviewRow(domain.ReviewStatusRejected))
+				expectRecompute(mock)
+				mock.ExpectCommit()
+
+				_, err := postgresTest.UpdateReviewStatus(context.Background(), 1,
+					[]string{domain.ReviewStatusPending, domain.ReviewStatusApproved}, domain.ReviewStatusRejected)
+				require.NoError(t, err)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "approving review of deleted product skips rating",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(reviewRow(domain.ReviewStatusPending))
+				mock.ExpectQuery(updateQuery).WithArgs(domain.ReviewStatusApproved, 1).WillReturnRows(reviewRow(domain.ReviewStatusApproved))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM products WHERE id=$1 AND deleted_at IS NULL FOR UPDATE")).
+					WithArgs(int64(5)).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectCommit()
+
+				_, err := postgresTest.UpdateReviewStatus(context.Background(), 1,
+					[]string{domain.ReviewStatusPending}, domain.ReviewStatusApproved)
+				require.NoError(t, err)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			// отзыв не был одобрен и не станет одобренным - рейтинг не меняется
+			name: "rejecting pending review keeps rating",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(reviewRow(domain.ReviewStatusPending))
+				mock.ExpectQuery(updateQuery).WithArgs(domain.ReviewStatusRejected, 1).WillReturnRows(reviewRow(domain.ReviewStatusRejected))
+				mock.ExpectCommit()
+
+				_, err := postgresTest.UpdateReviewStatus(context.Background(), 1,
+					[]string{domain.ReviewStatusPending, domain.ReviewStatusApproved}, domain.ReviewStatusRejected)
+				require.NoError(t, err)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "invalid state",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(reviewRow(domain.ReviewStatusApproved))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.UpdateReviewStatus(context.Background(), 1,
+					[]string{domain.ReviewStatusPending, domain.ReviewStatusRejected}, domain.ReviewStatusApproved)
+				var stateErr *InvalidStateError
+				require.ErrorAs(t, err, &stateErr)
+				require.Equal(t, domain.ReviewStatusApproved, stateErr.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "review not found",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows(reviewColumns))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.UpdateReviewStatus(context.Background(), 1,
+					[]string{domain.ReviewStatusPending}, domain.ReviewStatusApproved)
+				var notFoundErr *NotFoundError
+				require.ErrorAs(t, err, &notFoundErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestRecomputeProductRatings(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta(queryToRecomputeAllRatings)).WillReturnResult(sqlmock.NewResult(0, 2))
+
+		n, err := NewPostgresStorer(db).RecomputeProductRatings(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
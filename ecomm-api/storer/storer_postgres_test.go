@@ -2,6 +2,7 @@ package storer
 
 import (
 	"context"
+	"database/sql"
 	"ecomm/domain"
 	"fmt"
 	"regexp"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,7 +20,7 @@ func newSingleProductForUpdateTesting() domain.Product {
 		ID:           1,
 		Name:         "test product",
 		Image:        "test.jpg",
-		Category:     "test category",
+		CategoryID:   1,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
@@ -39,12 +41,13 @@ func TestCreateProduct(t *testing.T) {
 	p := &domain.Product{
 		Name:         "test product",
 		Image:        "test.jpg",
-		Category:     "test category",
+		CategoryID:   1,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
 		Price:        100.0,
 		CountInStock: 100,
+		Version:      2,
 	}
 
 	tcs := []struct {
@@ -56,14 +59,17 @@ func TestCreateProduct(t *testing.T) {
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
 				// Для именованных запросов sqlx сначала преобразует плейсхолдеры в '?'
 				// sqlmock перехватывает запрос уже в этом виде.
-				expectedQuery := regexp.QuoteMeta(`INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *`)
+				expectedQuery := regexp.QuoteMeta(`INSERT INTO products (sku, name, image, category_id, description, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *`)
 
-				rows := sqlmock.NewRows([]string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}).
-					AddRow(1, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, time.Now(), nil)
+				rows := sqlmock.NewRows([]string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}).
+					AddRow(1, p.Name, p.Image, p.CategoryID, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, time.Now(), nil)
 
+				mock.ExpectBegin()
 				mock.ExpectQuery(expectedQuery).
-					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock).
+					WithArgs(p.SKU, p.Name, p.Image, p.CategoryID, p.Description, p.Price, p.CountInStock).
 					WillReturnRows(rows)
+				expectOutboxEvent(mock, "product", 1, domain.EventProductCreated)
+				mock.ExpectCommit()
 
 				createdProduct, err := postgresTest.CreateProduct(context.Background(), p)
 				require.NoError(t, err)
@@ -78,10 +84,12 @@ func TestCreateProduct(t *testing.T) {
 		{
 			name: "failed inserting product",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta(`INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *`)
+				expectedQuery := regexp.QuoteMeta(`INSERT INTO products (sku, name, image, category_id, description, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *`)
+				mock.ExpectBegin()
 				mock.ExpectQuery(expectedQuery).
-					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock).
+					WithArgs(p.SKU, p.Name, p.Image, p.CategoryID, p.Description, p.Price, p.CountInStock).
 					WillReturnError(fmt.Errorf("Error inserting product"))
+				mock.ExpectRollback()
 				_, err := postgresTest.CreateProduct(context.Background(), p)
 				require.Error(t, err)
 				err = mock.ExpectationsWereMet()
@@ -91,12 +99,14 @@ func TestCreateProduct(t *testing.T) {
 		{
 			name: "failed to scan rows",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id", "name", "this_is_a_bad_column", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}).
-					AddRow(1, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, time.Now(), nil)
-				expectedQuery := regexp.QuoteMeta(`INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *`)
+				rows := sqlmock.NewRows([]string{"id", "name", "this_is_a_bad_column", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}).
+					AddRow(1, p.Name, p.Image, p.CategoryID, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, time.Now(), nil)
+				expectedQuery := regexp.QuoteMeta(`INSERT INTO products (sku, name, image, category_id, description, price, count_in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *`)
+				mock.ExpectBegin()
 				mock.ExpectQuery(expectedQuery).
-					WithArgs(p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock).
+					WithArgs(p.SKU, p.Name, p.Image, p.CategoryID, p.Description, p.Price, p.CountInStock).
 					WillReturnRows(rows)
+				mock.ExpectRollback()
 				_, err := postgresTest.CreateProduct(context.Background(), p)
 				require.Error(t, err)
 				require.ErrorContains(t, err, "Error scanning rows")
@@ -121,7 +131,7 @@ func TestGetProduct(t *testing.T) {
 		ID:           1,
 		Name:         "test product",
 		Image:        "test.jpg",
-		Category:     "test category",
+		CategoryID:   1,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
@@ -135,12 +145,12 @@ func TestGetProduct(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE id=$1`)
+				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL`)
 
 				rows := sqlmock.NewRows([]string{
-					"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at",
+					"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at",
 				}).
-					AddRow(p.ID, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, time.Now(), nil)
+					AddRow(p.ID, p.Name, p.Image, p.CategoryID, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, time.Now(), nil)
 
 				mock.ExpectQuery(expectedQuery).WithArgs(p.ID).WillReturnRows(rows)
 
@@ -158,7 +168,7 @@ func TestGetProduct(t *testing.T) {
 		{
 			name: "failed getting product",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE id=$1`)
+				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL`)
 				mock.ExpectQuery(expectedQuery).WithArgs(p.ID).WillReturnError(fmt.Errorf("Error getting product"))
 				_, err := postgresTest.GetProduct(context.Background(), p.ID)
 				require.Error(t, err)
@@ -169,9 +179,9 @@ func TestGetProduct(t *testing.T) {
 		{
 			name: "failed scanning rows",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE id=$1`)
-				rows := sqlmock.NewRows([]string{"id", "name", "this_is_a_bad_column", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}).
-					AddRow(1, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, time.Now(), nil)
+				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL`)
+				rows := sqlmock.NewRows([]string{"id", "name", "this_is_a_bad_column", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}).
+					AddRow(1, p.Name, p.Image, p.CategoryID, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, time.Now(), nil)
 
 				mock.ExpectQuery(expectedQuery).WithArgs(p.ID).WillReturnRows(rows)
 
@@ -184,14 +194,14 @@ func TestGetProduct(t *testing.T) {
 		{
 			name: "product not found",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE id=$1`)
-				columns := []string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
+				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL`)
+				columns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
 				rows := sqlmock.NewRows(columns)
 				mock.ExpectQuery(expectedQuery).WithArgs(p.ID).WillReturnRows(rows)
 
 				_, err := postgresTest.GetProduct(context.Background(), p.ID)
 				require.Error(t, err)
-				require.ErrorContains(t, err, fmt.Sprintf("Product with id %d not found", p.ID))
+				require.ErrorContains(t, err, fmt.Sprintf("operation storer.GetProduct: product with id %d not found", p.ID))
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
 			},
@@ -212,7 +222,7 @@ func TestGetProducts(t *testing.T) {
 		ID:           1,
 		Name:         "test product1",
 		Image:        "test.jpg",
-		Category:     "test category1",
+		CategoryID:   1,
 		Description:  "test description1",
 		Rating:       5,
 		NumReviews:   10,
@@ -223,7 +233,7 @@ func TestGetProducts(t *testing.T) {
 		ID:           1,
 		Name:         "test product1",
 		Image:        "test.jpg",
-		Category:     "test category1",
+		CategoryID:   1,
 		Description:  "test description1",
 		Rating:       5,
 		NumReviews:   10,
@@ -234,7 +244,7 @@ func TestGetProducts(t *testing.T) {
 		ID:           1,
 		Name:         "test product1",
 		Image:        "test.jpg",
-		Category:     "test category1",
+		CategoryID:   1,
 		Description:  "test description1",
 		Rating:       5,
 		NumReviews:   10,
@@ -250,12 +260,12 @@ func TestGetProducts(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products`)
-				columns := []string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
+				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE deleted_at IS NULL`)
+				columns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
 				rows := sqlmock.NewRows(columns).
-					AddRow(product1.ID, product1.Name, product1.Image, product1.Category, product1.Description, product1.Rating, product1.NumReviews, product1.Price, product1.CountInStock, product1.CreatedAt, nil).
-					AddRow(product2.ID, product2.Name, product2.Image, product2.Category, product2.Description, product2.Rating, product2.NumReviews, product2.Price, product2.CountInStock, product2.CreatedAt, nil).
-					AddRow(product3.ID, product3.Name, product3.Image, product3.Category, product3.Description, product3.Rating, product3.NumReviews, product3.Price, product3.CountInStock, product3.CreatedAt, nil)
+					AddRow(product1.ID, product1.Name, product1.Image, product1.CategoryID, product1.Description, product1.Rating, product1.NumReviews, product1.Price, product1.CountInStock, product1.CreatedAt, nil).
+					AddRow(product2.ID, product2.Name, product2.Image, product2.CategoryID, product2.Description, product2.Rating, product2.NumReviews, product2.Price, product2.CountInStock, product2.CreatedAt, nil).
+					AddRow(product3.ID, product3.Name, product3.Image, product3.CategoryID, product3.Description, product3.Rating, product3.NumReviews, product3.Price, product3.CountInStock, product3.CreatedAt, nil)
 				mock.ExpectQuery(expectedQuery).WithArgs().WillReturnRows(rows)
 
 				foundProducts, err := postgresTest.GetProducts(context.Background())
@@ -269,7 +279,7 @@ func TestGetProducts(t *testing.T) {
 		{
 			name: "error getting products",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products`)
+				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE deleted_at IS NULL`)
 				mock.ExpectQuery(expectedQuery).WillReturnError(fmt.Errorf("Error getting products"))
 				_, err := postgresTest.GetProducts(context.Background())
 				require.Error(t, err)
@@ -281,8 +291,8 @@ func TestGetProducts(t *testing.T) {
 		{
 			name: "products not found",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
-				columns := []string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
-				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products`)
+				columns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
+				expectedQuery := regexp.QuoteMeta(`SELECT * FROM products WHERE deleted_at IS NULL`)
 				rows := sqlmock.NewRows(columns)
 				mock.ExpectQuery(expectedQuery).WillReturnRows(rows)
 				foundProducts, err := postgresTest.GetProducts(context.Background())
@@ -315,11 +325,14 @@ func TestUpdateProduct(t *testing.T) {
 			name: "success",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
 				product := newSingleProductForUpdateTesting()
-				columns := []string{"name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
-				expectedQuery := regexp.QuoteMeta("UPDATE products SET name=$1, image=$2, category=$3, description=$4, rating=$5, num_reviews=$6, price=$7, count_in_stock=$8, updated_at=NOW() WHERE id=$9 RETURNING *")
+				columns := []string{"name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET sku=$1, name=$2, image=$3, category_id=$4, description=$5, price=$6, count_in_stock=$7, version=version+1, updated_at=NOW() WHERE id=$8 AND version=$9 AND deleted_at IS NULL RETURNING *")
 				rows := sqlmock.NewRows(columns).
-					AddRow("updated test product", "updated test.jpg", "updated test category", "updated test description", 1, 1, 10.0, 10, time.Now(), time.Now())
+					AddRow("updated test product", "updated test.jpg", 2, "updated test description", 1, 1, 10.0, 10, time.Now(), time.Now())
+				mock.ExpectBegin()
 				mock.ExpectQuery(expectedQuery).WillReturnRows(rows)
+				expectOutboxEvent(mock, "product", 1, domain.EventProductUpdated)
+				mock.ExpectCommit()
 
 				err := postgresTest.UpdateProduct(context.Background(), &product)
 
@@ -328,9 +341,9 @@ func TestUpdateProduct(t *testing.T) {
 				require.Equal(t, int64(1), product.ID)
 				require.Equal(t, "updated test product", product.Name)
 				require.Equal(t, "updated test.jpg", product.Image)
-				require.Equal(t, "updated test category", product.Category)
+				require.Equal(t, int64(2), product.CategoryID)
 				require.Equal(t, "updated test description", product.Description)
-				require.Equal(t, int64(1), product.Rating)
+				require.InDelta(t, 1.0, product.Rating, 0.001)
 				require.Equal(t, int64(1), product.NumReviews)
 				require.InDelta(t, 10.0, product.Price, 0.001)
 				require.Equal(t, int64(10), product.CountInStock)
@@ -343,8 +356,10 @@ func TestUpdateProduct(t *testing.T) {
 			name: "error updating product",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
 				product := newSingleProductForUpdateTesting()
-				expectedQuery := regexp.QuoteMeta("UPDATE products SET name=$1, image=$2, category=$3, description=$4, rating=$5, num_reviews=$6, price=$7, count_in_stock=$8, updated_at=NOW() WHERE id=$9 RETURNING *")
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET sku=$1, name=$2, image=$3, category_id=$4, description=$5, price=$6, count_in_stock=$7, version=version+1, updated_at=NOW() WHERE id=$8 AND version=$9 AND deleted_at IS NULL RETURNING *")
+				mock.ExpectBegin()
 				mock.ExpectQuery(expectedQuery).WillReturnError(fmt.Errorf("Error updating product with id 1"))
+				mock.ExpectRollback()
 
 				err := postgresTest.UpdateProduct(context.Background(), &product)
 				require.Error(t, err)
@@ -353,9 +368,9 @@ func TestUpdateProduct(t *testing.T) {
 				require.Equal(t, int64(1), product.ID)
 				require.Equal(t, "test product", product.Name)
 				require.Equal(t, "test.jpg", product.Image)
-				require.Equal(t, "test category", product.Category)
+				require.Equal(t, int64(1), product.CategoryID)
 				require.Equal(t, "test description", product.Description)
-				require.Equal(t, int64(5), product.Rating)
+				require.InDelta(t, 5.0, product.Rating, 0.001)
 				require.Equal(t, int64(10), product.NumReviews)
 				require.InDelta(t, 100.0, product.Price, 0.001)
 				require.Equal(t, int64(100), product.CountInStock)
@@ -369,13 +384,15 @@ func TestUpdateProduct(t *testing.T) {
 			name: "error scanning updated product",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
 				product := newSingleProductForUpdateTesting()
-				columns := []string{"name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
-				expectedQuery := regexp.QuoteMeta("UPDATE products SET name=$1, image=$2, category=$3, description=$4, rating=$5, num_reviews=$6, price=$7, count_in_stock=$8, updated_at=NOW() WHERE id=$9 RETURNING *")
+				columns := []string{"name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET sku=$1, name=$2, image=$3, category_id=$4, description=$5, price=$6, count_in_stock=$7, version=version+1, updated_at=NOW() WHERE id=$8 AND version=$9 AND deleted_at IS NULL RETURNING *")
 
 				rows := sqlmock.NewRows(columns).
 					AddRow("name", "image", "this_is_a_bad_column", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at")
 
+				mock.ExpectBegin()
 				mock.ExpectQuery(expectedQuery).WillReturnRows(rows)
+				mock.ExpectRollback()
 
 				err := postgresTest.UpdateProduct(context.Background(), &product)
 
@@ -390,20 +407,25 @@ func TestUpdateProduct(t *testing.T) {
 			name: "product for update not found",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
 				product := newSingleProductForUpdateTesting()
-				columns := []string{"name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
-				expectedQuery := regexp.QuoteMeta("UPDATE products SET name=$1, image=$2, category=$3, description=$4, rating=$5, num_reviews=$6, price=$7, count_in_stock=$8, updated_at=NOW() WHERE id=$9 RETURNING *")
+				columns := []string{"name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET sku=$1, name=$2, image=$3, category_id=$4, description=$5, price=$6, count_in_stock=$7, version=version+1, updated_at=NOW() WHERE id=$8 AND version=$9 AND deleted_at IS NULL RETURNING *")
 				rows := sqlmock.NewRows(columns)
+				mock.ExpectBegin()
 				mock.ExpectQuery(expectedQuery).WillReturnRows(rows)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(product.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mock.ExpectRollback()
 				err := postgresTest.UpdateProduct(context.Background(), &product)
 				require.Error(t, err)
-				require.ErrorContains(t, err, "Product with id 1 not found for update")
+				require.ErrorContains(t, err, "operation storer.UpdateProduct: product with id 1 not found")
 				require.NotNil(t, product)
 				require.Equal(t, int64(1), product.ID)
 				require.Equal(t, "test product", product.Name)
 				require.Equal(t, "test.jpg", product.Image)
-				require.Equal(t, "test category", product.Category)
+				require.Equal(t, int64(1), product.CategoryID)
 				require.Equal(t, "test description", product.Description)
-				require.Equal(t, int64(5), product.Rating)
+				require.InDelta(t, 5.0, product.Rating, 0.001)
 				require.Equal(t, int64(10), product.NumReviews)
 				require.InDelta(t, 100.0, product.Price, 0.001)
 				require.Equal(t, int64(100), product.CountInStock)
@@ -412,6 +434,29 @@ func TestUpdateProduct(t *testing.T) {
 				require.NoError(t, err)
 			},
 		},
+		{
+			name: "stale version",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				product := newSingleProductForUpdateTesting()
+				product.Version = 2
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET sku=$1, name=$2, image=$3, category_id=$4, description=$5, price=$6, count_in_stock=$7, version=version+1, updated_at=NOW() WHERE id=$8 AND version=$9 AND deleted_at IS NULL RETURNING *")
+				mock.ExpectBegin()
+				mock.ExpectQuery(expectedQuery).
+					WithArgs(product.SKU, product.Name, product.Image, product.CategoryID, product.Description, product.Price, product.CountInStock, product.ID, product.Version).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(product.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(5))
+				mock.ExpectRollback()
+
+				err := postgresTest.UpdateProduct(context.Background(), &product)
+				var versionErr *VersionMismatchError
+				require.ErrorAs(t, err, &versionErr)
+				require.Equal(t, int64(2), versionErr.Expected)
+				require.Equal(t, int64(5), versionErr.Current)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -429,12 +474,13 @@ func TestDeleteProduct(t *testing.T) {
 		ID:           1,
 		Name:         "test product",
 		Image:        "test.jpg",
-		Category:     "test category",
+		CategoryID:   1,
 		Description:  "test description",
 		Rating:       5,
 		NumReviews:   10,
 		Price:        100.0,
 		CountInStock: 100,
+		Version:      2,
 	}
 
 	tcs := []struct {
@@ -445,11 +491,14 @@ func TestDeleteProduct(t *testing.T) {
 			name: "success",
 			test: func(t *testing.T, postgres *PostgresStorer, mock sqlmock.Sqlmock) {
 
-				expectedQuery := regexp.QuoteMeta("DELETE FROM products WHERE id=$1")
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET deleted_at=NOW(), version=version+1, updated_at=NOW() WHERE id=$1 AND version=$2 AND deleted_at IS NULL")
 
-				mock.ExpectExec(expectedQuery).WithArgs(product.ID).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec(expectedQuery).WithArgs(product.ID, product.Version).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectOutboxEvent(mock, "product", product.ID, domain.EventProductDeleted)
+				mock.ExpectCommit()
 
-				err := postgres.DeleteProduct(context.Background(), product.ID)
+				err := postgres.DeleteProduct(context.Background(), product.ID, product.Version)
 				require.NoError(t, err)
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
@@ -458,9 +507,11 @@ func TestDeleteProduct(t *testing.T) {
 		{
 			name: "failed to delete product",
 			test: func(t *testing.T, postgres *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta("DELETE FROM products WHERE id=$1")
-				mock.ExpectExec(expectedQuery).WithArgs(product.ID).WillReturnError(fmt.Errorf("failed delete product with id 1"))
-				err := postgres.DeleteProduct(context.Background(), product.ID)
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET deleted_at=NOW(), version=version+1, updated_at=NOW() WHERE id=$1 AND version=$2 AND deleted_at IS NULL")
+				mock.ExpectBegin()
+				mock.ExpectExec(expectedQuery).WithArgs(product.ID, product.Version).WillReturnError(fmt.Errorf("failed delete product with id 1"))
+				mock.ExpectRollback()
+				err := postgres.DeleteProduct(context.Background(), product.ID, product.Version)
 				require.Error(t, err)
 				require.ErrorContains(t, err, "failed delete product with id 1")
 				err = mock.ExpectationsWereMet()
@@ -470,9 +521,11 @@ func TestDeleteProduct(t *testing.T) {
 		{
 			name: "failed to get affected rows",
 			test: func(t *testing.T, postgres *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta("DELETE FROM products WHERE id=$1")
-				mock.ExpectExec(expectedQuery).WithArgs(product.ID).WillReturnResult(sqlmock.NewErrorResult(fmt.Errorf("rows affected error")))
-				err := postgres.DeleteProduct(context.Background(), product.ID)
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET deleted_at=NOW(), version=version+1, updated_at=NOW() WHERE id=$1 AND version=$2 AND deleted_at IS NULL")
+				mock.ExpectBegin()
+				mock.ExpectExec(expectedQuery).WithArgs(product.ID, product.Version).WillReturnResult(sqlmock.NewErrorResult(fmt.Errorf("rows affected error")))
+				mock.ExpectRollback()
+				err := postgres.DeleteProduct(context.Background(), product.ID, product.Version)
 				require.Error(t, err)
 				require.ErrorContains(t, err, "cannot get affected rows for product with id 1")
 				err = mock.ExpectationsWereMet()
@@ -482,15 +535,38 @@ func TestDeleteProduct(t *testing.T) {
 		{
 			name: "product for delete not found",
 			test: func(t *testing.T, postgres *PostgresStorer, mock sqlmock.Sqlmock) {
-				expectedQuery := regexp.QuoteMeta("DELETE FROM products WHERE id=$1")
-				mock.ExpectExec(expectedQuery).WithArgs(product.ID).WillReturnResult(sqlmock.NewResult(1, 0))
-				err := postgres.DeleteProduct(context.Background(), product.ID)
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET deleted_at=NOW(), version=version+1, updated_at=NOW() WHERE id=$1 AND version=$2 AND deleted_at IS NULL")
+				mock.ExpectBegin()
+				mock.ExpectExec(expectedQuery).WithArgs(product.ID, product.Version).WillReturnResult(sqlmock.NewResult(1, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(product.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mock.ExpectRollback()
+				err := postgres.DeleteProduct(context.Background(), product.ID, product.Version)
 				require.Error(t, err)
 				require.ErrorContains(t, err, "product with id 1 not found")
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
 			},
 		},
+		{
+			name: "stale version",
+			test: func(t *testing.T, postgres *PostgresStorer, mock sqlmock.Sqlmock) {
+				expectedQuery := regexp.QuoteMeta("UPDATE products SET deleted_at=NOW(), version=version+1, updated_at=NOW() WHERE id=$1 AND version=$2 AND deleted_at IS NULL")
+				mock.ExpectBegin()
+				mock.ExpectExec(expectedQuery).WithArgs(product.ID, product.Version).WillReturnResult(sqlmock.NewResult(1, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(product.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+				mock.ExpectRollback()
+				err := postgres.DeleteProduct(context.Background(), product.ID, product.Version)
+				var versionErr *VersionMismatchError
+				require.ErrorAs(t, err, &versionErr)
+				require.Equal(t, int64(2), versionErr.Expected)
+				require.Equal(t, int64(3), versionErr.Current)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -504,15 +580,66 @@ func TestDeleteProduct(t *testing.T) {
 }
 
 func TestCreateOrder(t *testing.T) {
-	order := &domain.Order{
-		PaymentMethod: "CreditCard",
-		TaxPrice:      10,
-		ShippingPrice: 20,
-		TotalPrice:    130,
-		Items: []domain.OrderItem{
-			{Name: "item1", Quantity: 1, Image: "test.jpg", Price: 50, ProductID: 1},
-			{Name: "item2", Quantity: 2, Image: "test.jpg", Price: 25, ProductID: 2},
-		},
+	newOrder := func() *domain.Order {
+		return &domain.Order{
+			UserID:        3,
+			PaymentMethod: "CreditCard",
+			Status:        domain.OrderStatusPending,
+			TaxPrice:      10,
+			ShippingPrice: 20,
+			TotalPrice:    130,
+			Items: []domain.OrderItem{
+				{Name: "item1", Quantity: 1, Image: "test.jpg", Price: 50, ProductID: 1},
+				{Name: "item2", Quantity: 2, Image: "test.jpg", Price: 25, ProductID: 2},
+			},
+		}
+	}
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+	itemColumns := []string{"id", "name", "quantity", "image", "price", "product_id", "variant_id", "order_id"}
+	paymentColumns := []string{"id", "order_id", "provider", "method", "status", "amount", "captured_amount", "authorization_id", "created_at", "updated_at"}
+
+	expectOrderInsert := func(mock sqlmock.Sqlmock, order *domain.Order) {
+		prepareOrder := mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO orders (user_id, payment_method, status, tax_price, shipping_price, total_price) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *"))
+		orderRows := sqlmock.NewRows(orderColumns).
+			AddRow(1, order.UserID, order.PaymentMethod, order.Status, order.TaxPrice, order.ShippingPrice, order.TotalPrice, time.Now(), nil)
+		prepareOrder.ExpectQuery().
+			WithArgs(order.UserID, order.PaymentMethod, order.Status, order.TaxPrice, order.ShippingPrice, order.TotalPrice).
+			WillReturnRows(orderRows)
+	}
+	// Postgres не обещает порядок строк в RETURNING, поэтому отдаем их в обратном порядке
+	expectItemsInsert := func(mock sqlmock.Sqlmock, items []domain.OrderItem, ids []int64) {
+		var (
+			names, images          []string
+			quantities, productIDs []int64
+			prices                 []float64
+			variantIDs             []sql.NullInt64
+		)
+		rows := sqlmock.NewRows(append(itemColumns, "ordinal"))
+		for i := len(items) - 1; i >= 0; i-- {
+			rows.AddRow(ids[i], items[i].Name, items[i].Quantity, items[i].Image, items[i].Price, items[i].ProductID, items[i].VariantID, 1, i+1)
+		}
+		for _, item := range items {
+			names, images = append(names, item.Name), append(images, item.Image)
+			quantities, productIDs = append(quantities, item.Quantity), append(productIDs, item.ProductID)
+			prices = append(prices, item.Price)
+			variantID := sql.NullInt64{}
+			if item.VariantID != nil {
+				variantID = sql.NullInt64{Int64: *item.VariantID, Valid: true}
+			}
+			variantIDs = append(variantIDs, variantID)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(queryToInsertOrderItems)).
+			WithArgs(pq.Array(names), pq.Array(quantities), pq.Array(images), pq.Array(prices), pq.Array(productIDs), pq.Array(variantIDs), 1).
+			WillReturnRows(rows)
+	}
+	expectStockDecrease := func(mock sqlmock.Sqlmock, productIDs []int64, quantities []int64, updated ...int64) {
+		rows := sqlmock.NewRows([]string{"id"})
+		for _, id := range updated {
+			rows.AddRow(id)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE products p SET count_in_stock = p.count_in_stock - v.quantity, version=p.version+1, updated_at=NOW() FROM unnest($1::int[], $2::int[]) AS v(id, quantity) WHERE p.id = v.id AND p.count_in_stock >= v.quantity AND p.deleted_at IS NULL RETURNING p.id")).
+			WithArgs(pq.Array(productIDs), pq.Array(quantities)).
+			WillReturnRows(rows)
 	}
 
 	tcs := []struct {
@@ -522,38 +649,619 @@ func TestCreateOrder(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				expectItemsInsert(mock, order.Items, []int64{101, 102})
+				expectStockDecrease(mock, []int64{1, 2}, []int64{1, 2}, 2, 1)
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderCreated)
+				mock.ExpectCommit()
+
+				createdOrder, err := postgresTest.CreateOrder(context.Background(), order, nil)
+				require.NoError(t, err)
+				require.Equal(t, int64(101), createdOrder.Items[0].ID)
+				require.Equal(t, "item1", createdOrder.Items[0].Name)
+				require.Equal(t, int64(102), createdOrder.Items[1].ID)
+				require.Equal(t, "item2", createdOrder.Items[1].Name)
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+
+			},
+		},
+		{
+			name: "items are matched by ordinal and stock is locked in id order",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				order.Items[0].ProductID, order.Items[1].ProductID = 2, 1
+				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				// id не обязаны расти вместе с позицией в корзине
+				expectItemsInsert(mock, order.Items, []int64{105, 101})
+				expectStockDecrease(mock, []int64{1, 2}, []int64{2, 1}, 1, 2)
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderCreated)
+				mock.ExpectCommit()
+
+				createdOrder, err := postgresTest.CreateOrder(context.Background(), order, nil)
+				require.NoError(t, err)
+				require.Equal(t, int64(105), createdOrder.Items[0].ID)
+				require.Equal(t, "item1", createdOrder.Items[0].Name)
+				require.Equal(t, int64(101), createdOrder.Items[1].ID)
+				require.Equal(t, "item2", createdOrder.Items[1].Name)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "variant item decreases variant stock",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				variantID := int64(7)
+				order.Items[1].VariantID = &variantID
 				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				expectItemsInsert(mock, order.Items, []int64{101, 102})
+				expectStockDecrease(mock, []int64{1}, []int64{1}, 1)
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE product_variants pv SET count_in_stock = pv.count_in_stock - v.quantity, version=pv.version+1, updated_at=NOW() FROM unnest($1::int[], $2::int[]) AS v(id, quantity) WHERE pv.id = v.id AND pv.count_in_stock >= v.quantity RETURNING pv.id")).
+					WithArgs(pq.Array([]int64{7}), pq.Array([]int64{2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderCreated)
+				mock.ExpectCommit()
 
-				prepareOrder := mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES ($1, $2, $3, $4) RETURNING *"))
-				orderColumns := []string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
-				orderRows := sqlmock.NewRows(orderColumns).
-					AddRow(1, order.PaymentMethod, order.TaxPrice, order.ShippingPrice, order.TotalPrice, time.Now(), nil)
-				prepareOrder.ExpectQuery().
-					WithArgs(order.PaymentMethod, order.TaxPrice, order.ShippingPrice, order.TotalPrice).
-					WillReturnRows(orderRows)
-				itemColumns := []string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}
-				prepItem1 := mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING * "))
-				item1 := order.Items[0]
-				item1Rows := sqlmock.NewRows(itemColumns).
-					AddRow(101, item1.Name, item1.Quantity, item1.Image, item1.Price, item1.ProductID, 1)
-				prepItem1.ExpectQuery().
-					WithArgs(item1.Name, item1.Quantity, item1.Image, item1.Price, item1.ProductID, 1).
-					WillReturnRows(item1Rows)
-
-				prepItem2 := mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING * "))
-				item2 := order.Items[1]
-				item2Rows := sqlmock.NewRows(itemColumns).
-					AddRow(102, item2.Name, item2.Quantity, item2.Image, item2.Price, item2.ProductID, 1)
-				prepItem2.ExpectQuery().
-					WithArgs(item2.Name, item2.Quantity, item2.Image, item2.Price, item2.ProductID, 1).
-					WillReturnRows(item2Rows)
+				createdOrder, err := postgresTest.CreateOrder(context.Background(), order, nil)
+				require.NoError(t, err)
+				require.Nil(t, createdOrder.Items[0].VariantID)
+				require.Equal(t, variantID, *createdOrder.Items[1].VariantID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "not enough variant stock",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				variantID := int64(7)
+				order.Items[1].VariantID = &variantID
+				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				expectItemsInsert(mock, order.Items, []int64{101, 102})
+				expectStockDecrease(mock, []int64{1}, []int64{1}, 1)
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE product_variants pv SET count_in_stock")).
+					WithArgs(pq.Array([]int64{7}), pq.Array([]int64{2})).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count_in_stock FROM product_variants WHERE id=$1")).
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}).AddRow(1))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateOrder(context.Background(), order, nil)
+				var stockErr *InsufficientStockError
+				require.ErrorAs(t, err, &stockErr)
+				require.Equal(t, variantID, *stockErr.VariantID)
+				require.Equal(t, int64(1), stockErr.Available)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "captured payment marks order paid",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				expectItemsInsert(mock, order.Items, []int64{101, 102})
+				expectStockDecrease(mock, []int64{1, 2}, []int64{1, 2}, 2, 1)
+
+				preparePayment := mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO payments (order_id, provider, method, status, amount, captured_amount, authorization_id) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *"))
+				preparePayment.ExpectQuery().
+					WithArgs(1, "seed", order.PaymentMethod, domain.PaymentStatusCaptured, order.TotalPrice, order.TotalPrice, "seed_auth_1").
+					WillReturnRows(sqlmock.NewRows(paymentColumns).
+						AddRow(7, 1, "seed", order.PaymentMethod, domain.PaymentStatusCaptured, order.TotalPrice, order.TotalPrice, "seed_auth_1", time.Now(), nil))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET status=$1, updated_at=NOW() WHERE id=$2")).
+					WithArgs(domain.OrderStatusPaid, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderCreated)
+				mock.ExpectCommit()
+
+				createdOrder, err := postgresTest.CreateOrder(context.Background(), order, &domain.Payment{
+					Provider:        "seed",
+					Method:          order.PaymentMethod,
+					Status:          domain.PaymentStatusCaptured,
+					Amount:          order.TotalPrice,
+					CapturedAmount:  order.TotalPrice,
+					AuthorizationID: "seed_auth_1",
+				})
+				require.NoError(t, err)
+				require.Equal(t, domain.OrderStatusPaid, createdOrder.Status)
+				require.Equal(t, int64(7), createdOrder.Payment.ID)
+				require.Equal(t, int64(1), createdOrder.Payment.OrderID)
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "pending payment leaves order.created for later",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				expectItemsInsert(mock, order.Items, []int64{101, 102})
+				expectStockDecrease(mock, []int64{1, 2}, []int64{1, 2}, 2, 1)
+				mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO payments")).
+					ExpectQuery().
+					WithArgs(1, "fake", order.PaymentMethod, domain.PaymentStatusPending, order.TotalPrice, 0.0, "").
+					WillReturnRows(sqlmock.NewRows(paymentColumns).
+						AddRow(7, 1, "fake", order.PaymentMethod, domain.PaymentStatusPending, order.TotalPrice, 0, "", time.Now(), nil))
 				mock.ExpectCommit()
 
-				_, err := postgresTest.CreateOrder(context.Background(), order)
+				createdOrder, err := postgresTest.CreateOrder(context.Background(), order, &domain.Payment{
+					Provider: "fake",
+					Method:   order.PaymentMethod,
+					Status:   domain.PaymentStatusPending,
+					Amount:   order.TotalPrice,
+				})
 				require.NoError(t, err)
+				require.Equal(t, domain.OrderStatusPending, createdOrder.Status)
+				require.Equal(t, domain.PaymentStatusPending, createdOrder.Payment.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "not enough stock",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				expectItemsInsert(mock, order.Items, []int64{101, 102})
+				expectStockDecrease(mock, []int64{1, 2}, []int64{1, 2}, 2)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count_in_stock FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(order.Items[0].ProductID).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}).AddRow(0))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateOrder(context.Background(), order, nil)
+				var stockErr *InsufficientStockError
+				require.ErrorAs(t, err, &stockErr)
+				require.Equal(t, int64(1), stockErr.ProductID)
+				require.Equal(t, int64(0), stockErr.Available)
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
+			},
+		},
+		{
+			name: "deleted product",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				expectItemsInsert(mock, order.Items, []int64{101, 102})
+				expectStockDecrease(mock, []int64{1, 2}, []int64{1, 2}, 2)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count_in_stock FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(order.Items[0].ProductID).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateOrder(context.Background(), order, nil)
+				var notFoundErr *NotFoundError
+				require.ErrorAs(t, err, &notFoundErr)
+				require.Equal(t, "product", notFoundErr.Resource)
+				require.Equal(t, int64(1), notFoundErr.ID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "same product in several items is decreased once",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				order.Items[1].ProductID = 1
+				mock.ExpectBegin()
+				expectOrderInsert(mock, order)
+				expectItemsInsert(mock, order.Items, []int64{101, 102})
+				expectStockDecrease(mock, []int64{1}, []int64{3})
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT count_in_stock FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"count_in_stock"}).AddRow(2))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.CreateOrder(context.Background(), order, nil)
+				var stockErr *InsufficientStockError
+				require.ErrorAs(t, err, &stockErr)
+				require.Equal(t, int64(3), stockErr.Requested)
+				require.Equal(t, int64(2), stockErr.Available)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				postgresTest := NewPostgresStorer(db)
+				tc.test(t, postgresTest, mock)
+			})
+		})
+	}
+}
+
+func TestCompleteOrderPayment(t *testing.T) {
+	paymentColumns := []string{"id", "order_id", "provider", "method", "status", "amount", "captured_amount", "authorization_id", "created_at", "updated_at"}
+	captureQuery := regexp.QuoteMeta("UPDATE payments SET status=$1, captured_amount=$2, authorization_id=$3, updated_at=NOW() WHERE id=$4 AND status='pending' RETURNING *")
+	newOrder := func() *domain.Order {
+		return &domain.Order{ID: 1, UserID: 3, Status: domain.OrderStatusPending, TotalPrice: 130,
+			Payment: &domain.Payment{ID: 7, OrderID: 1, Status: domain.PaymentStatusPending, Amount: 130}}
+	}
+	expectLockOrder := func(mock sqlmock.Sqlmock, status string) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(1, 3, status))
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "captures payment and writes order.created",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				mock.ExpectBegin()
+				expectLockOrder(mock, domain.OrderStatusPending)
+				mock.ExpectQuery(captureQuery).
+					WithArgs(domain.PaymentStatusCaptured, 130.0, "fake_auth_000001", 7).
+					WillReturnRows(sqlmock.NewRows(paymentColumns).
+						AddRow(7, 1, "fake", "card", domain.PaymentStatusCaptured, 130, 130, "fake_auth_000001", time.Now(), time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET status=$1, updated_at=NOW() WHERE id=$2")).
+					WithArgs(domain.OrderStatusPaid, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderCreated)
+				mock.ExpectCommit()
+
+				require.NoError(t, postgresTest.CompleteOrderPayment(context.Background(), order, "fake_auth_000001", 130))
+				require.Equal(t, domain.OrderStatusPaid, order.Status)
+				require.Equal(t, domain.PaymentStatusCaptured, order.Payment.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "payment is no longer pending",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, domain.OrderStatusPending)
+				mock.ExpectQuery(captureQuery).WillReturnRows(sqlmock.NewRows(paymentColumns))
+				mock.ExpectRollback()
+
+				err := postgresTest.CompleteOrderPayment(context.Background(), newOrder(), "fake_auth_000001", 130)
+				var invalidStateError *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateError)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "order cancelled while the charge was in flight",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, domain.OrderStatusCancelled)
+				mock.ExpectRollback()
+
+				err := postgresTest.CompleteOrderPayment(context.Background(), newOrder(), "fake_auth_000001", 130)
+				var invalidStateError *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateError)
+				require.Equal(t, "order", invalidStateError.Resource)
+				require.Equal(t, domain.OrderStatusCancelled, invalidStateError.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestFailOrderPayment(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "cancellation_reason", "cancelled_at", "created_at", "updated_at"}
+	failQuery := regexp.QuoteMeta("UPDATE payments SET status=$1, updated_at=NOW() WHERE id=$2 AND status='pending'")
+	newOrder := func() *domain.Order {
+		return &domain.Order{ID: 1, UserID: 3, Status: domain.OrderStatusPending, TotalPrice: 130,
+			Payment: &domain.Payment{ID: 7, OrderID: 1, Status: domain.PaymentStatusPending, Amount: 130}}
+	}
+	expectLockOrder := func(mock sqlmock.Sqlmock, status string) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status"}).AddRow(1, 3, status))
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "restores stock and cancels order",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				order := newOrder()
+				mock.ExpectBegin()
+				expectLockOrder(mock, domain.OrderStatusPending)
+				mock.ExpectExec(failQuery).WithArgs(domain.PaymentStatusFailed, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta(queryToRestoreOrderStock)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta(queryToRestoreVariantStock)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(queryToMarkOrderCancelled)).
+					WithArgs(domain.OrderStatusCancelled, "payment failed", 1).
+					WillReturnRows(sqlmock.NewRows(orderColumns).
+						AddRow(1, 3, "card", "cancelled", 10, 20, 130, "payment failed", time.Now(), time.Now(), time.Now()))
+				mock.ExpectCommit()
+
+				require.NoError(t, postgresTest.FailOrderPayment(context.Background(), order, "payment failed"))
+				require.Equal(t, domain.OrderStatusCancelled, order.Status)
+				require.Equal(t, domain.PaymentStatusFailed, order.Payment.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "payment is no longer pending",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, domain.OrderStatusPending)
+				mock.ExpectExec(failQuery).WithArgs(domain.PaymentStatusFailed, 7).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := postgresTest.FailOrderPayment(context.Background(), newOrder(), "payment failed")
+				var invalidStateError *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateError)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "cancelled order keeps its stock untouched",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, domain.OrderStatusCancelled)
+				mock.ExpectRollback()
+
+				err := postgresTest.FailOrderPayment(context.Background(), newOrder(), "payment failed")
+				var invalidStateError *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateError)
+				require.Equal(t, domain.OrderStatusCancelled, invalidStateError.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "refunded_price", "cancellation_reason", "cancelled_at", "created_at", "updated_at"}
+	cancellable := []string{domain.OrderStatusPending, domain.OrderStatusPaid}
+
+	expectLockOrder := func(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+			WithArgs(1).
+			WillReturnRows(rows)
+	}
+	expectNoOpenReturns := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM returns WHERE order_id=$1 AND status <> 'rejected'")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	}
+	expectRestoreStock := func(mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE products p SET count_in_stock = p.count_in_stock + oi.quantity, version=p.version+1, updated_at=NOW() FROM (SELECT product_id, SUM(quantity) AS quantity FROM order_items WHERE order_id=$1 AND variant_id IS NULL GROUP BY product_id) oi WHERE p.id = oi.product_id")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE product_variants pv SET count_in_stock = pv.count_in_stock + oi.quantity, version=pv.version+1, updated_at=NOW() FROM (SELECT variant_id, SUM(quantity) AS quantity FROM order_items WHERE order_id=$1 AND variant_id IS NOT NULL GROUP BY variant_id) oi WHERE pv.id = oi.variant_id")).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, updated_at=NOW() WHERE order_id=$2 AND status='pending'")).
+			WithArgs(domain.PaymentStatusFailed, 1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	expectMarkCancelled := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET status=$1, cancellation_reason=$2, cancelled_at=NOW(), updated_at=NOW() WHERE id=$3 RETURNING *")).
+			WithArgs(domain.OrderStatusCancelled, "changed my mind", 1).
+			WillReturnRows(sqlmock.NewRows(orderColumns).
+				AddRow(1, 3, "card", "cancelled", 10, 20, 130, 130, "changed my mind", time.Now(), time.Now(), time.Now()))
+	}
+	refundNotCalled := func(payment *domain.Payment, refund *domain.Refund) error {
+		return fmt.Errorf("refund must not be called")
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "unpaid order restores stock",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, sqlmock.NewRows(orderColumns).
+					AddRow(1, 3, "card", "pending", 10, 20, 130, 0, "", nil, time.Now(), nil))
+				expectNoOpenReturns(mock)
+				expectRestoreStock(mock)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1 AND status = ANY($2) ORDER BY id DESC LIMIT 1 FOR UPDATE")).
+					WithArgs(1, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(paymentColumns))
+				expectMarkCancelled(mock)
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderCancelled)
+				mock.ExpectCommit()
+
+				order, refund, err := postgresTest.CancelOrder(context.Background(), 1, cancellable, "changed my mind", refundNotCalled)
+				require.NoError(t, err)
+				require.Nil(t, refund)
+				require.Equal(t, domain.OrderStatusCancelled, order.Status)
+				require.Equal(t, "changed my mind", order.CancellationReason)
+				require.NotNil(t, order.CancelledAt)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "paid order records a pending refund in the same transaction",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, sqlmock.NewRows(orderColumns).
+					AddRow(1, 3, "card", "paid", 10, 20, 130, 0, "", nil, time.Now(), nil))
+				expectNoOpenReturns(mock)
+				expectRestoreStock(mock)
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1 AND status = ANY($2) ORDER BY id DESC LIMIT 1 FOR UPDATE")).
+					WithArgs(1, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(paymentColumns).
+						AddRow(7, 1, "fake", "card", "captured", 130, 130, 0, "fake_auth_000001", time.Now(), nil))
+				mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO refunds")).
+					ExpectQuery().
+					WithArgs(1, 7, nil, 130.0, "order cancelled: changed my mind").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "payment_id", "return_id", "amount", "reason", "provider_refund_id", "status", "created_at"}).
+						AddRow(9, 1, 7, nil, 130.0, "order cancelled: changed my mind", "", "pending", time.Now()))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET refunded_amount = refunded_amount + $1")).
+					WithArgs(130.0, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE orders SET refunded_price = refunded_price + $1")).
+					WithArgs(130.0, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectMarkCancelled(mock)
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderCancelled)
+				mock.ExpectCommit()
+
+				_, refund, err := postgresTest.CancelOrder(context.Background(), 1, cancellable, "changed my mind", func(payment *domain.Payment, refund *domain.Refund) error {
+					refund.Amount = payment.CapturedAmount - payment.RefundedAmount
+					return nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, int64(9), refund.ID)
+				require.Equal(t, domain.RefundStatusPending, refund.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "order awaiting payment fails its pending payment",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, sqlmock.NewRows(orderColumns).
+					AddRow(1, 3, "card", "pending", 10, 20, 130, 0, "", nil, time.Now(), nil))
+				expectNoOpenReturns(mock)
+				mock.ExpectExec(regexp.QuoteMeta(queryToRestoreOrderStock)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(regexp.QuoteMeta(queryToRestoreVariantStock)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				// Шлюз еще списывает деньги: CompleteOrderPayment потом увидит отмененный заказ
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE payments SET status=$1, updated_at=NOW() WHERE order_id=$2 AND status='pending'")).
+					WithArgs(domain.PaymentStatusFailed, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM payments WHERE order_id=$1 AND status = ANY($2) ORDER BY id DESC LIMIT 1 FOR UPDATE")).
+					WithArgs(1, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(paymentColumns))
+				expectMarkCancelled(mock)
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderCancelled)
+				mock.ExpectCommit()
+
+				_, refund, err := postgresTest.CancelOrder(context.Background(), 1, cancellable, "changed my mind", refundNotCalled)
+				require.NoError(t, err)
+				require.Nil(t, refund)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "shipped order cannot be cancelled",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, sqlmock.NewRows(orderColumns).
+					AddRow(1, 3, "card", "shipped", 10, 20, 130, 0, "", nil, time.Now(), nil))
+				mock.ExpectRollback()
+
+				_, _, err := postgresTest.CancelOrder(context.Background(), 1, cancellable, "changed my mind", refundNotCalled)
+				var invalidStateError *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateError)
+				require.Equal(t, domain.OrderStatusShipped, invalidStateError.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "order not found",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, sqlmock.NewRows(orderColumns))
+				mock.ExpectRollback()
+
+				_, _, err := postgresTest.CancelOrder(context.Background(), 1, cancellable, "changed my mind", refundNotCalled)
+				var notFoundError *NotFoundError
+				require.ErrorAs(t, err, &notFoundError)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				postgresTest := NewPostgresStorer(db)
+				tc.test(t, postgresTest, mock)
+			})
+		})
+	}
+}
+
+func TestShipOrder(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "tracking_number", "shipped_at", "created_at", "updated_at"}
+	tracking := "TRACK-1"
+
+	expectLockOrder := func(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE id=$1 FOR UPDATE")).
+			WithArgs(1).
+			WillReturnRows(rows)
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "paid order is shipped",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, sqlmock.NewRows(orderColumns).
+					AddRow(1, 3, "card", "paid", 10, 20, 130, nil, nil, time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE orders SET status=$1, tracking_number=$2, shipped_at=NOW(), updated_at=NOW() WHERE id=$3 RETURNING *")).
+					WithArgs(domain.OrderStatusShipped, &tracking, 1).
+					WillReturnRows(sqlmock.NewRows(orderColumns).
+						AddRow(1, 3, "card", "shipped", 10, 20, 130, tracking, time.Now(), time.Now(), time.Now()))
+				expectOutboxEvent(mock, "order", 1, domain.EventOrderShipped)
+				mock.ExpectCommit()
+
+				order, err := postgresTest.ShipOrder(context.Background(), 1, &tracking)
+				require.NoError(t, err)
+				require.Equal(t, domain.OrderStatusShipped, order.Status)
+				require.Equal(t, tracking, *order.TrackingNumber)
+				require.NotNil(t, order.ShippedAt)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "pending order cannot be shipped",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, sqlmock.NewRows(orderColumns).
+					AddRow(1, 3, "card", "pending", 10, 20, 130, nil, nil, time.Now(), nil))
+				mock.ExpectRollback()
 
+				_, err := postgresTest.ShipOrder(context.Background(), 1, nil)
+				var invalidStateError *InvalidStateError
+				require.ErrorAs(t, err, &invalidStateError)
+				require.Equal(t, domain.OrderStatusPending, invalidStateError.Status)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "order not found",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectLockOrder(mock, sqlmock.NewRows(orderColumns))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.ShipOrder(context.Background(), 1, nil)
+				var notFoundError *NotFoundError
+				require.ErrorAs(t, err, &notFoundError)
+				require.NoError(t, mock.ExpectationsWereMet())
 			},
 		},
 	}
@@ -567,3 +1275,306 @@ func TestCreateOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOrders(t *testing.T) {
+	orderColumns := []string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}
+	itemColumns := []string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	minTotal := 100.0
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "filters and paginates",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders WHERE user_id = $1 AND status = $2 AND created_at >= $3 AND total_price >= $4 ORDER BY created_at DESC, id DESC LIMIT $5 OFFSET $6")).
+					WithArgs(3, "paid", from, minTotal, 10, 20).
+					WillReturnRows(sqlmock.NewRows(orderColumns).
+						AddRow(1, 3, "card", "paid", 10, 20, 130, time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY order_id, id")).
+					WithArgs(pq.Array([]int64{1})).
+					WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(101, "item1", 1, "test.jpg", 100, 1, 1))
+
+				orders, err := postgresTest.GetOrders(context.Background(), OrderFilter{
+					UserID: 3, Status: "paid", From: &from, MinTotal: &minTotal, Limit: 10, Offset: 20,
+				})
+				require.NoError(t, err)
+				require.Len(t, orders, 1)
+				require.Equal(t, int64(3), orders[0].UserID)
+				require.Len(t, orders[0].Items, 1)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "items for the whole page in one query",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2")).
+					WithArgs(3, 0).
+					WillReturnRows(sqlmock.NewRows(orderColumns).
+						AddRow(3, 1, "card", "paid", 10, 20, 130, time.Now(), nil).
+						AddRow(2, 1, "card", "paid", 10, 20, 130, time.Now(), nil).
+						AddRow(1, 2, "card", "paid", 10, 20, 130, time.Now(), nil))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY order_id, id")).
+					WithArgs(pq.Array([]int64{3, 2, 1})).
+					WillReturnRows(sqlmock.NewRows(itemColumns).
+						AddRow(101, "item1", 1, "test.jpg", 100, 1, 1).
+						AddRow(102, "item2", 2, "test.jpg", 100, 2, 1).
+						AddRow(301, "item3", 1, "test.jpg", 100, 3, 3))
+
+				orders, err := postgresTest.GetOrders(context.Background(), OrderFilter{Limit: 3})
+				require.NoError(t, err)
+				require.Len(t, orders, 3)
+				require.Equal(t, []int64{301}, itemIDs(orders[0].Items))
+				require.Empty(t, orders[1].Items)
+				require.Equal(t, []int64{101, 102}, itemIDs(orders[2].Items))
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "no filters",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders ORDER BY created_at DESC, id DESC")).
+					WillReturnRows(sqlmock.NewRows(orderColumns))
+
+				orders, err := postgresTest.GetOrders(context.Background(), OrderFilter{})
+				require.NoError(t, err)
+				require.Empty(t, orders)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "count uses the same filter",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status = $2")).
+					WithArgs(3, "paid").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+
+				count, err := postgresTest.CountOrders(context.Background(), OrderFilter{UserID: 3, Status: "paid", Limit: 10})
+				require.NoError(t, err)
+				require.Equal(t, int64(42), count)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+// Число запросов не зависит от размера страницы: sqlmock падает на любом неожиданном запросе.
+func TestGetOrdersQueryCount(t *testing.T) {
+	for _, pageSize := range []int{1, 10, 100} {
+		t.Run(fmt.Sprintf("page size %d", pageSize), func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				expectOrdersPage(mock, pageSize)
+
+				orders, err := NewPostgresStorer(db).GetOrders(context.Background(), OrderFilter{Limit: int64(pageSize)})
+				require.NoError(t, err)
+				require.Len(t, orders, pageSize)
+				for _, order := range orders {
+					require.Len(t, order.Items, 2)
+				}
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func BenchmarkGetOrders(b *testing.B) {
+	for _, pageSize := range []int{10, 100} {
+		b.Run(fmt.Sprintf("page size %d", pageSize), func(b *testing.B) {
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(b, err)
+			defer mockDB.Close()
+			postgresTest := NewPostgresStorer(sqlx.NewDb(mockDB, "postgres"))
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				expectOrdersPage(mock, pageSize)
+				b.StartTimer()
+
+				if _, err := postgresTest.GetOrders(context.Background(), OrderFilter{Limit: int64(pageSize)}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// expectOrdersPage ожидает ровно два запроса: страницу заказов и все их позиции, по две на заказ.
+func expectOrdersPage(mock sqlmock.Sqlmock, pageSize int) {
+	orderRows := sqlmock.NewRows([]string{"id", "user_id", "payment_method", "status", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"})
+	itemRows := sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id"})
+	ids := make([]int64, pageSize)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+		orderRows.AddRow(ids[i], 1, "card", "paid", 10, 20, 130, time.Now(), nil)
+		itemRows.AddRow(ids[i]*10, "item1", 1, "test.jpg", 100, 1, ids[i])
+		itemRows.AddRow(ids[i]*10+1, "item2", 1, "test.jpg", 100, 2, ids[i])
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM orders ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2")).
+		WithArgs(pageSize, 0).
+		WillReturnRows(orderRows)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY order_id, id")).
+		WithArgs(pq.Array(ids)).
+		WillReturnRows(itemRows)
+}
+
+func itemIDs(items []domain.OrderItem) []int64 {
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func TestPatchProduct(t *testing.T) {
+	productColumns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "updates only supplied columns",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET count_in_stock=$1, price=$2, version=version+1, updated_at=NOW() WHERE id=$3 AND version=$4 AND deleted_at IS NULL RETURNING *")).
+					WithArgs(int64(7), 12.5, 1, 2).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "test product", "test.jpg", 1, "", 5, 10, 12.5, 7, 3, time.Now(), time.Now()))
+				expectOutboxEvent(mock, "product", 1, domain.EventProductUpdated)
+				mock.ExpectCommit()
+
+				product, err := postgresTest.PatchProduct(context.Background(), 1, 2, map[string]interface{}{
+					"price":          12.5,
+					"count_in_stock": int64(7),
+				})
+				require.NoError(t, err)
+				require.Equal(t, int64(3), product.Version)
+				require.Equal(t, "test product", product.Name)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "unknown column",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				_, err := postgresTest.PatchProduct(context.Background(), 1, 2, map[string]interface{}{
+					"version": 100,
+				})
+				require.ErrorContains(t, err, `column "version" cannot be patched`)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "stale version",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE products SET name=$1, version=version+1, updated_at=NOW() WHERE id=$2 AND version=$3 AND deleted_at IS NULL RETURNING *")).
+					WithArgs("new name", 1, 2).
+					WillReturnRows(sqlmock.NewRows(productColumns))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM products WHERE id=$1 AND deleted_at IS NULL")).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.PatchProduct(context.Background(), 1, 2, map[string]interface{}{"name": "new name"})
+				var versionErr *VersionMismatchError
+				require.ErrorAs(t, err, &versionErr)
+				require.Equal(t, int64(3), versionErr.Current)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestRestoreProduct(t *testing.T) {
+	productColumns := []string{"id", "name", "image", "category_id", "description", "rating", "num_reviews", "price", "count_in_stock", "version", "created_at", "updated_at", "deleted_at"}
+	restoreQuery := regexp.QuoteMeta("UPDATE products SET deleted_at=NULL, version=version+1, updated_at=NOW() WHERE id=$1 AND deleted_at IS NOT NULL RETURNING *")
+	existsQuery := regexp.QuoteMeta("SELECT EXISTS(SELECT 1 FROM products WHERE id=$1)")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(restoreQuery).
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(productColumns).
+						AddRow(1, "test product", "test.jpg", 1, "", 5, 10, 100, 3, 4, time.Now(), time.Now(), nil))
+				expectOutboxEvent(mock, "product", 1, domain.EventProductRestored)
+				mock.ExpectCommit()
+
+				product, err := postgresTest.RestoreProduct(context.Background(), 1)
+				require.NoError(t, err)
+				require.Nil(t, product.DeletedAt)
+				require.Equal(t, int64(4), product.Version)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "product is not deleted",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(restoreQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows(productColumns))
+				mock.ExpectRollback()
+				mock.ExpectQuery(existsQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+				_, err := postgresTest.RestoreProduct(context.Background(), 1)
+				var stateErr *InvalidStateError
+				require.ErrorAs(t, err, &stateErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "product not found",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(restoreQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows(productColumns))
+				mock.ExpectRollback()
+				mock.ExpectQuery(existsQuery).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+				_, err := postgresTest.RestoreProduct(context.Background(), 1)
+				var notFoundErr *NotFoundError
+				require.ErrorAs(t, err, &notFoundErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestTruncateAll(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec(regexp.QuoteMeta(queryToTruncateAll)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		require.NoError(t, NewPostgresStorer(db).TruncateAll(context.Background()))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
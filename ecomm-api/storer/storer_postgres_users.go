@@ -0,0 +1,127 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	queryToInsertUser      = "INSERT INTO users (name, email, password, is_admin) VALUES (:name, :email, :password, :is_admin) RETURNING *"
+	queryToSelectUserEmail = "SELECT * FROM users WHERE email=$1"
+	queryToSelectUser      = "SELECT * FROM users WHERE id=$1"
+	queryToSetUserAdmin    = "UPDATE users SET is_admin=$1 WHERE email=$2 RETURNING *"
+
+	queryToInsertPasswordResetToken = "INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING *"
+	queryToLockPasswordResetToken   = "SELECT * FROM password_reset_tokens WHERE token_hash=$1 AND used_at IS NULL AND expires_at > NOW() FOR UPDATE"
+	queryToSetUserPassword          = "UPDATE users SET password=$1 WHERE id=$2 RETURNING *"
+	// Новый пароль делает недействительными и остальные выданные пользователю токены
+	queryToUsePasswordResetTokens = "UPDATE password_reset_tokens SET used_at=NOW() WHERE user_id=$1 AND used_at IS NULL"
+
+	uniqueViolationCode = "23505"
+)
+
+func (postgres *PostgresStorer) CreateUser(ctx context.Context, u *domain.User) (*domain.User, error) {
+	op := "storer.CreateUser"
+	rows, err := postgres.db.NamedQueryContext(ctx, queryToInsertUser, u)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			return nil, NewAlreadyExistsError(op, "user", u.Email, err)
+		}
+		return nil, fmt.Errorf("Error inserting user: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("user not created")
+	}
+	if err := rows.StructScan(u); err != nil {
+		return nil, fmt.Errorf("Error scanning rows: %w", err)
+	}
+
+	return u, nil
+}
+
+func (postgres *PostgresStorer) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	op := "storer.GetUserByEmail"
+	user := domain.User{}
+	err := postgres.db.GetContext(ctx, &user, queryToSelectUserEmail, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "user", email, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting user: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (postgres *PostgresStorer) GetUser(ctx context.Context, id int64) (*domain.User, error) {
+	op := "storer.GetUser"
+	user := domain.User{}
+	err := postgres.db.GetContext(ctx, &user, queryToSelectUser, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "user", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error getting user: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (postgres *PostgresStorer) SetUserAdmin(ctx context.Context, email string, isAdmin bool) (*domain.User, error) {
+	op := "storer.SetUserAdmin"
+	user := domain.User{}
+	err := postgres.db.GetContext(ctx, &user, queryToSetUserAdmin, isAdmin, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "user", email, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error updating user: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (postgres *PostgresStorer) CreatePasswordResetToken(ctx context.Context, t *domain.PasswordResetToken) error {
+	if err := postgres.db.GetContext(ctx, t, queryToInsertPasswordResetToken, t.UserID, t.TokenHash, t.ExpiresAt); err != nil {
+		return fmt.Errorf("error inserting password reset token for user with id %d: %w", t.UserID, err)
+	}
+	return nil
+}
+
+// ResetPassword меняет пароль по действующему токену и гасит все токены пользователя.
+// Неизвестный, использованный и просроченный токены неразличимы - это NotFoundError.
+func (postgres *PostgresStorer) ResetPassword(ctx context.Context, tokenHash string, passwordHash string) (*domain.User, error) {
+	op := "storer.ResetPassword"
+	user := domain.User{}
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		t := domain.PasswordResetToken{}
+		err := tx.GetContext(ctx, &t, queryToLockPasswordResetToken, tokenHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "password reset token", "", nil)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting password reset token: %w", err)
+		}
+
+		if err := tx.GetContext(ctx, &user, queryToSetUserPassword, passwordHash, t.UserID); err != nil {
+			return fmt.Errorf("error updating password of user with id %d: %w", t.UserID, err)
+		}
+		if _, err := tx.ExecContext(ctx, queryToUsePasswordResetTokens, t.UserID); err != nil {
+			return fmt.Errorf("error using password reset tokens of user with id %d: %w", t.UserID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
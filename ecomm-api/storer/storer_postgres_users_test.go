@@ -0,0 +1,84 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordResetTokens(t *testing.T) {
+	tokenColumns := []string{"id", "user_id", "token_hash", "expires_at", "used_at", "created_at"}
+	lockQuery := regexp.QuoteMeta("SELECT * FROM password_reset_tokens WHERE token_hash=$1 AND used_at IS NULL AND expires_at > NOW() FOR UPDATE")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "create token",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				expiresAt := time.Now().Add(time.Hour)
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING *")).
+					WithArgs(3, "hash", expiresAt).
+					WillReturnRows(sqlmock.NewRows(tokenColumns).AddRow(1, 3, "hash", expiresAt, nil, time.Now()))
+
+				token := &domain.PasswordResetToken{UserID: 3, TokenHash: "hash", ExpiresAt: expiresAt}
+				require.NoError(t, postgresTest.CreatePasswordResetToken(context.Background(), token))
+				require.Equal(t, int64(1), token.ID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "reset password uses all tokens of the user",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(tokenColumns).AddRow(1, 3, "hash", time.Now().Add(time.Hour), nil, time.Now()))
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE users SET password=$1 WHERE id=$2 RETURNING *")).
+					WithArgs("new-password-hash", 3).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "password", "is_admin"}).
+						AddRow(3, "Anna", "anna@example.com", "new-password-hash", false))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE password_reset_tokens SET used_at=NOW() WHERE user_id=$1 AND used_at IS NULL")).
+					WithArgs(3).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				user, err := postgresTest.ResetPassword(context.Background(), "hash", "new-password-hash")
+				require.NoError(t, err)
+				require.Equal(t, int64(3), user.ID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "unknown, used or expired token",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lockQuery).
+					WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(tokenColumns))
+				mock.ExpectRollback()
+
+				_, err := postgresTest.ResetPassword(context.Background(), "hash", "new-password-hash")
+				var notFoundError *NotFoundError
+				require.ErrorAs(t, err, &notFoundError)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				postgresTest := NewPostgresStorer(db)
+				tc.test(t, postgresTest, mock)
+			})
+		})
+	}
+}
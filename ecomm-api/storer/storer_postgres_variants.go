@@ -0,0 +1,80 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+const (
+	queryToInsertProductOption  = "INSERT INTO product_options (product_id, name, values) VALUES (:product_id, :name, :values) RETURNING *"
+	queryToInsertProductVariant = "INSERT INTO product_variants (product_id, sku, options, price, count_in_stock, image) VALUES (:product_id, :sku, :options, :price, :count_in_stock, :image) RETURNING *"
+)
+
+func (postgres *PostgresStorer) CreateProductOption(ctx context.Context, option *domain.ProductOption) (*domain.ProductOption, error) {
+	op := "storer.CreateProductOption"
+	rows, err := postgres.db.NamedQueryContext(ctx, queryToInsertProductOption, option)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			return nil, NewAlreadyExistsError(op, "product option", option.Name, err)
+		}
+		return nil, fmt.Errorf("Error inserting product option: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("product option not created")
+	}
+	if err := rows.StructScan(option); err != nil {
+		return nil, fmt.Errorf("Error scanning rows: %w", err)
+	}
+	return option, nil
+}
+
+func (postgres *PostgresStorer) GetProductOptions(ctx context.Context, productID int64) ([]*domain.ProductOption, error) {
+	options := []*domain.ProductOption{}
+	err := postgres.db.SelectContext(ctx, &options, "SELECT * FROM product_options WHERE product_id=$1 ORDER BY id", productID)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting product options: %w", err)
+	}
+	return options, nil
+}
+
+// CreateProductVariant добавляет вариант. SKU уникален глобально, набор опций - в пределах товара.
+func (postgres *PostgresStorer) CreateProductVariant(ctx context.Context, variant *domain.ProductVariant) (*domain.ProductVariant, error) {
+	op := "storer.CreateProductVariant"
+	rows, err := postgres.db.NamedQueryContext(ctx, queryToInsertProductVariant, variant)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+			return nil, NewAlreadyExistsError(op, "product variant", variant.SKU, err)
+		}
+		return nil, fmt.Errorf("Error inserting product variant: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("product variant not created")
+	}
+	if err := rows.StructScan(variant); err != nil {
+		return nil, fmt.Errorf("Error scanning rows: %w", err)
+	}
+	return variant, nil
+}
+
+// GetProductVariants возвращает варианты всех переданных товаров.
+func (postgres *PostgresStorer) GetProductVariants(ctx context.Context, productIDs []int64) ([]*domain.ProductVariant, error) {
+	variants := []*domain.ProductVariant{}
+	if len(productIDs) == 0 {
+		return variants, nil
+	}
+	err := postgres.db.SelectContext(ctx, &variants, "SELECT * FROM product_variants WHERE product_id = ANY($1) ORDER BY id", pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("Error getting product variants: %w", err)
+	}
+	return variants, nil
+}
@@ -0,0 +1,110 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+var variantColumns = []string{"id", "product_id", "sku", "options", "price", "count_in_stock", "image", "version", "created_at", "updated_at"}
+
+func TestCreateProductVariant(t *testing.T) {
+	insertQuery := regexp.QuoteMeta("INSERT INTO product_variants (product_id, sku, options, price, count_in_stock, image) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(insertQuery).
+					WithArgs(int64(1), "TS-M-RED", `{"color":"red","size":"M"}`, 15.0, int64(4), "").
+					WillReturnRows(sqlmock.NewRows(variantColumns).
+						AddRow(3, 1, "TS-M-RED", []byte(`{"color":"red","size":"M"}`), 15.0, 4, "", 1, time.Now(), nil))
+
+				variant, err := postgresTest.CreateProductVariant(context.Background(), &domain.ProductVariant{
+					ProductID:    1,
+					SKU:          "TS-M-RED",
+					Options:      domain.VariantOptions{"size": "M", "color": "red"},
+					Price:        15,
+					CountInStock: 4,
+				})
+				require.NoError(t, err)
+				require.Equal(t, int64(3), variant.ID)
+				require.Equal(t, "M", variant.Options["size"])
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "duplicate sku",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(insertQuery).
+					WillReturnError(&pq.Error{Code: uniqueViolationCode})
+
+				_, err := postgresTest.CreateProductVariant(context.Background(), &domain.ProductVariant{ProductID: 1, SKU: "TS-M-RED"})
+				var existsErr *AlreadyExistsError
+				require.ErrorAs(t, err, &existsErr)
+				require.Equal(t, "TS-M-RED", existsErr.Key)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestGetProductVariants(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM product_variants WHERE product_id = ANY($1) ORDER BY id")).
+					WithArgs(pq.Array([]int64{1, 2})).
+					WillReturnRows(sqlmock.NewRows(variantColumns).
+						AddRow(3, 1, "TS-M", `{"size":"M"}`, 15.0, 4, "", 1, time.Now(), nil).
+						AddRow(4, 2, "MUG", `{}`, 5.0, 10, "", 1, time.Now(), nil))
+
+				variants, err := postgresTest.GetProductVariants(context.Background(), []int64{1, 2})
+				require.NoError(t, err)
+				require.Len(t, variants, 2)
+				require.Equal(t, "M", variants[0].Options["size"])
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			// без товаров запрос в базу не нужен
+			name: "no products",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				variants, err := postgresTest.GetProductVariants(context.Background(), nil)
+				require.NoError(t, err)
+				require.Empty(t, variants)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"ecomm/domain"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	queryToInsertWebhookSubscription = "INSERT INTO webhook_subscriptions (url, event_types, secret, enabled) VALUES (:url, :event_types, :secret, :enabled) RETURNING *"
+	// Включение подписки сбрасывает счетчик неудач, иначе первая же ошибка снова ее отключит
+	queryToUpdateWebhookSubscription = "UPDATE webhook_subscriptions SET url=:url, event_types=:event_types, secret=:secret, enabled=:enabled, " +
+		"consecutive_failures=CASE WHEN :enabled THEN 0 ELSE consecutive_failures END, " +
+		"disabled_at=CASE WHEN :enabled THEN NULL ELSE COALESCE(disabled_at, NOW()) END, updated_at=NOW() WHERE id=:id RETURNING *"
+
+	queryToEnqueueWebhookDeliveries = "INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, body) " +
+		"SELECT id, $1, $2, $3 FROM webhook_subscriptions WHERE enabled AND event_types @> jsonb_build_array($2::text) " +
+		"ON CONFLICT (subscription_id, event_id) DO NOTHING"
+	// Доставка захватывается на время lease: если отправитель упадет, ее заберет следующий
+	queryToClaimWebhookDeliveries = "UPDATE webhook_deliveries SET next_attempt_at = NOW() + make_interval(secs => $2) WHERE id IN (" +
+		"SELECT d.id FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id = d.subscription_id " +
+		"WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND s.enabled " +
+		"ORDER BY d.next_attempt_at, d.id LIMIT $1 FOR UPDATE OF d SKIP LOCKED) RETURNING *"
+	queryToRecordWebhookAttempt = "UPDATE webhook_deliveries SET status=$1, attempts=attempts+1, response_code=$2, response_body=$3, last_error=$4, " +
+		"next_attempt_at=COALESCE($5, next_attempt_at), delivered_at=CASE WHEN $1 = 'succeeded' THEN NOW() ELSE delivered_at END, updated_at=NOW() " +
+		"WHERE id=$6 RETURNING subscription_id"
+	queryToResetWebhookFailures = "UPDATE webhook_subscriptions SET consecutive_failures=0 WHERE id=$1 AND consecutive_failures > 0"
+	// В SET справа старые значения колонок, поэтому все три выражения видят счетчик до увеличения
+	queryToCountWebhookFailure = "UPDATE webhook_subscriptions SET consecutive_failures=consecutive_failures+1, " +
+		"enabled = enabled AND consecutive_failures+1 < $2, " +
+		"disabled_at = CASE WHEN enabled AND consecutive_failures+1 >= $2 THEN NOW() ELSE disabled_at END " +
+		"WHERE id=$1 RETURNING enabled"
+	queryToRedeliverWebhook = "UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=NOW(), updated_at=NOW() " +
+		"WHERE id=$1 AND subscription_id=$2 RETURNING *"
+)
+
+func (postgres *PostgresStorer) CreateWebhookSubscription(ctx context.Context, s *domain.WebhookSubscription) (*domain.WebhookSubscription, error) {
+	rows, err := postgres.db.NamedQueryContext(ctx, queryToInsertWebhookSubscription, s)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting webhook subscription: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("webhook subscription not created")
+	}
+	if err := rows.StructScan(s); err != nil {
+		return nil, fmt.Errorf("error scanning webhook subscription: %w", err)
+	}
+	return s, nil
+}
+
+func (postgres *PostgresStorer) GetWebhookSubscription(ctx context.Context, id int64) (*domain.WebhookSubscription, error) {
+	op := "storer.GetWebhookSubscription"
+	s := domain.WebhookSubscription{}
+	err := postgres.db.GetContext(ctx, &s, "SELECT * FROM webhook_subscriptions WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "webhook subscription", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting webhook subscription with id %d: %w", id, err)
+	}
+	return &s, nil
+}
+
+func (postgres *PostgresStorer) GetWebhookSubscriptions(ctx context.Context) ([]*domain.WebhookSubscription, error) {
+	subscriptions := []*domain.WebhookSubscription{}
+	if err := postgres.db.SelectContext(ctx, &subscriptions, "SELECT * FROM webhook_subscriptions ORDER BY id"); err != nil {
+		return nil, fmt.Errorf("error getting webhook subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+func (postgres *PostgresStorer) UpdateWebhookSubscription(ctx context.Context, s *domain.WebhookSubscription) error {
+	op := "storer.UpdateWebhookSubscription"
+	rows, err := postgres.db.NamedQueryContext(ctx, queryToUpdateWebhookSubscription, s)
+	if err != nil {
+		return fmt.Errorf("error updating webhook subscription with id %d: %w", s.ID, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return NewNotFoundError(op, "webhook subscription", s.ID, rows.Err())
+	}
+	if err := rows.StructScan(s); err != nil {
+		return fmt.Errorf("error scanning webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhookSubscription удаляет подписку вместе с журналом ее доставок.
+func (postgres *PostgresStorer) DeleteWebhookSubscription(ctx context.Context, id int64) error {
+	op := "storer.DeleteWebhookSubscription"
+	res, err := postgres.db.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id=$1", id)
+	if err != nil {
+		return fmt.Errorf("failed delete webhook subscription with id %d: %w", id, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("cannot get affected rows for webhook subscription with id %d: %w", id, err)
+	}
+	if rowsAffected == 0 {
+		return NewNotFoundError(op, "webhook subscription", id, nil)
+	}
+	return nil
+}
+
+// EnqueueWebhookDeliveries создает доставку события для каждой включенной подписки на его тип.
+// Повторный вызов для того же события ничего не добавляет. Возвращает число новых доставок.
+func (postgres *PostgresStorer) EnqueueWebhookDeliveries(ctx context.Context, eventID int64, eventType string, body string) (int64, error) {
+	res, err := postgres.db.ExecContext(ctx, queryToEnqueueWebhookDeliveries, eventID, eventType, body)
+	if err != nil {
+		return 0, fmt.Errorf("error enqueuing webhook deliveries for event %d: %w", eventID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("cannot get affected rows for event %d: %w", eventID, err)
+	}
+	return n, nil
+}
+
+// ClaimWebhookDeliveries забирает до limit доставок, которым пора отправляться, и откладывает
+// их следующую попытку на lease. Несколько отправителей не получат одну доставку дважды.
+func (postgres *PostgresStorer) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error) {
+	deliveries := []*domain.WebhookDelivery{}
+	if err := postgres.db.SelectContext(ctx, &deliveries, queryToClaimWebhookDeliveries, limit, lease.Seconds()); err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RecordWebhookAttempt сохраняет результат попытки и ведет счетчик неудач подписки подряд:
+// успех его сбрасывает, а на disableAfter неудаче подписка отключается. Возвращает true,
+// если подписку отключила именно эта попытка.
+func (postgres *PostgresStorer) RecordWebhookAttempt(ctx context.Context, attempt *domain.WebhookAttempt, disableAfter int64) (bool, error) {
+	op := "storer.RecordWebhookAttempt"
+	status := domain.WebhookDeliveryFailed
+	switch {
+	case attempt.Succeeded:
+		status = domain.WebhookDeliverySucceeded
+	case attempt.NextAttemptAt != nil:
+		status = domain.WebhookDeliveryPending
+	}
+
+	disabled := false
+	err := postgres.execTx(ctx, func(tx *sqlx.Tx) error {
+		var subscriptionID int64
+		err := tx.GetContext(ctx, &subscriptionID, queryToRecordWebhookAttempt,
+			status, attempt.ResponseCode, attempt.ResponseBody, attempt.Error, attempt.NextAttemptAt, attempt.DeliveryID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NewNotFoundError(op, "webhook delivery", attempt.DeliveryID, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("error recording attempt of webhook delivery with id %d: %w", attempt.DeliveryID, err)
+		}
+
+		if attempt.Succeeded {
+			if _, err := tx.ExecContext(ctx, queryToResetWebhookFailures, subscriptionID); err != nil {
+				return fmt.Errorf("error resetting failures of webhook subscription with id %d: %w", subscriptionID, err)
+			}
+			return nil
+		}
+
+		var enabled bool
+		if err := tx.GetContext(ctx, &enabled, queryToCountWebhookFailure, subscriptionID, disableAfter); err != nil {
+			return fmt.Errorf("error counting failure of webhook subscription with id %d: %w", subscriptionID, err)
+		}
+		disabled = !enabled
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return disabled, nil
+}
+
+// WebhookDeliveryFilter - условия выборки журнала доставок, пустой Status не ограничивает выборку.
+type WebhookDeliveryFilter struct {
+	SubscriptionID int64
+	Status         string
+	Limit          int64
+}
+
+// GetWebhookDeliveries возвращает доставки подписки, новые первыми.
+func (postgres *PostgresStorer) GetWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter) ([]*domain.WebhookDelivery, error) {
+	deliveries := []*domain.WebhookDelivery{}
+	err := postgres.db.SelectContext(ctx, &deliveries,
+		"SELECT * FROM webhook_deliveries WHERE subscription_id = $1 AND ($2 = '' OR status = $2) ORDER BY id DESC LIMIT $3",
+		filter.SubscriptionID, filter.Status, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting deliveries of webhook subscription with id %d: %w", filter.SubscriptionID, err)
+	}
+	return deliveries, nil
+}
+
+// RedeliverWebhook ставит доставку в очередь заново с полным набором попыток, в каком бы статусе она ни была.
+func (postgres *PostgresStorer) RedeliverWebhook(ctx context.Context, subscriptionID int64, id int64) (*domain.WebhookDelivery, error) {
+	op := "storer.RedeliverWebhook"
+	delivery := domain.WebhookDelivery{}
+	err := postgres.db.GetContext(ctx, &delivery, queryToRedeliverWebhook, id, subscriptionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, NewNotFoundError(op, "webhook delivery", id, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error redelivering webhook delivery with id %d: %w", id, err)
+	}
+	return &delivery, nil
+}
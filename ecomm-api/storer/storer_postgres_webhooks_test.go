@@ -0,0 +1,184 @@
+package storer
+
+import (
+	"context"
+	"ecomm/domain"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var webhookDeliveryColumns = []string{"id", "subscription_id", "event_id", "event_type", "body", "status", "attempts", "next_attempt_at",
+	"response_code", "response_body", "last_error", "created_at", "updated_at", "delivered_at"}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	subscriptionColumns := []string{"id", "url", "event_types", "secret", "enabled", "consecutive_failures", "disabled_at", "created_at", "updated_at"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "create",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhook_subscriptions (url, event_types, secret, enabled) VALUES ($1, $2, $3, $4) RETURNING *")).
+					WithArgs("https://partner.example/hooks", `["order.created"]`, "whsec_secret_value", true).
+					WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+						AddRow(1, "https://partner.example/hooks", []byte(`["order.created"]`), "whsec_secret_value", true, 0, nil, time.Now(), nil))
+
+				s, err := postgresTest.CreateWebhookSubscription(context.Background(), &domain.WebhookSubscription{
+					URL:        "https://partner.example/hooks",
+					EventTypes: domain.WebhookEventTypes{domain.EventOrderCreated},
+					Secret:     "whsec_secret_value",
+					Enabled:    true,
+				})
+				require.NoError(t, err)
+				require.Equal(t, int64(1), s.ID)
+				require.Equal(t, domain.WebhookEventTypes{domain.EventOrderCreated}, s.EventTypes)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "update missing subscription",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhook_subscriptions SET url=$1, event_types=$2, secret=$3, enabled=$4, "+
+					"consecutive_failures=CASE WHEN $5 THEN 0 ELSE consecutive_failures END, "+
+					"disabled_at=CASE WHEN $6 THEN NULL ELSE COALESCE(disabled_at, NOW()) END, updated_at=NOW() WHERE id=$7 RETURNING *")).
+					WithArgs("https://partner.example/hooks", `["order.created"]`, "whsec_secret_value", true, true, true, 5).
+					WillReturnRows(sqlmock.NewRows(subscriptionColumns))
+
+				err := postgresTest.UpdateWebhookSubscription(context.Background(), &domain.WebhookSubscription{
+					ID:         5,
+					URL:        "https://partner.example/hooks",
+					EventTypes: domain.WebhookEventTypes{domain.EventOrderCreated},
+					Secret:     "whsec_secret_value",
+					Enabled:    true,
+				})
+				var notFoundErr *NotFoundError
+				require.ErrorAs(t, err, &notFoundErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	recordQuery := regexp.QuoteMeta("UPDATE webhook_deliveries SET status=$1, attempts=attempts+1, response_code=$2, response_body=$3, last_error=$4, " +
+		"next_attempt_at=COALESCE($5, next_attempt_at), delivered_at=CASE WHEN $1 = 'succeeded' THEN NOW() ELSE delivered_at END, updated_at=NOW() " +
+		"WHERE id=$6 RETURNING subscription_id")
+	failureQuery := regexp.QuoteMeta("UPDATE webhook_subscriptions SET consecutive_failures=consecutive_failures+1, " +
+		"enabled = enabled AND consecutive_failures+1 < $2, " +
+		"disabled_at = CASE WHEN enabled AND consecutive_failures+1 >= $2 THEN NOW() ELSE disabled_at END " +
+		"WHERE id=$1 RETURNING enabled")
+	code := func(c int64) *int64 { return &c }
+	text := func(s string) *string { return &s }
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *PostgresStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "enqueue for matching subscriptions",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, body) "+
+					"SELECT id, $1, $2, $3 FROM webhook_subscriptions WHERE enabled AND event_types @> jsonb_build_array($2::text) "+
+					"ON CONFLICT (subscription_id, event_id) DO NOTHING")).
+					WithArgs(42, domain.EventOrderCreated, `{"id":42}`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+
+				n, err := postgresTest.EnqueueWebhookDeliveries(context.Background(), 42, domain.EventOrderCreated, `{"id":42}`)
+				require.NoError(t, err)
+				require.Equal(t, int64(2), n)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "claim skips locked deliveries",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FOR UPDATE OF d SKIP LOCKED) RETURNING *")).
+					WithArgs(20, 60.0).
+					WillReturnRows(sqlmock.NewRows(webhookDeliveryColumns).
+						AddRow(7, 1, 42, domain.EventOrderCreated, `{"id":42}`, "pending", 0, time.Now(), nil, nil, nil, time.Now(), nil, nil))
+
+				deliveries, err := postgresTest.ClaimWebhookDeliveries(context.Background(), 20, time.Minute)
+				require.NoError(t, err)
+				require.Len(t, deliveries, 1)
+				require.Equal(t, int64(42), deliveries[0].EventID)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "success resets failures",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(recordQuery).
+					WithArgs(domain.WebhookDeliverySucceeded, 200, "ok", nil, nil, 7).
+					WillReturnRows(sqlmock.NewRows([]string{"subscription_id"}).AddRow(1))
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_subscriptions SET consecutive_failures=0 WHERE id=$1 AND consecutive_failures > 0")).
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				disabled, err := postgresTest.RecordWebhookAttempt(context.Background(), &domain.WebhookAttempt{
+					DeliveryID: 7, Succeeded: true, ResponseCode: code(200), ResponseBody: text("ok"),
+				}, 50)
+				require.NoError(t, err)
+				require.False(t, disabled)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "last failure disables the subscription",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(recordQuery).
+					WithArgs(domain.WebhookDeliveryFailed, 500, nil, "unexpected status 500", nil, 7).
+					WillReturnRows(sqlmock.NewRows([]string{"subscription_id"}).AddRow(1))
+				mock.ExpectQuery(failureQuery).
+					WithArgs(1, 50).
+					WillReturnRows(sqlmock.NewRows([]string{"enabled"}).AddRow(false))
+				mock.ExpectCommit()
+
+				disabled, err := postgresTest.RecordWebhookAttempt(context.Background(), &domain.WebhookAttempt{
+					DeliveryID: 7, ResponseCode: code(500), Error: text("unexpected status 500"),
+				}, 50)
+				require.NoError(t, err)
+				require.True(t, disabled)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+		{
+			name: "redeliver delivery of another subscription",
+			test: func(t *testing.T, postgresTest *PostgresStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=NOW(), updated_at=NOW() WHERE id=$1 AND subscription_id=$2 RETURNING *")).
+					WithArgs(7, 2).
+					WillReturnRows(sqlmock.NewRows(webhookDeliveryColumns))
+
+				_, err := postgresTest.RedeliverWebhook(context.Background(), 2, 7)
+				var notFoundErr *NotFoundError
+				require.ErrorAs(t, err, &notFoundErr)
+				require.NoError(t, mock.ExpectationsWereMet())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				tc.test(t, NewPostgresStorer(db), mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+)
+
+// ErrForbiddenAddress - адрес получателя во внутренней сети. Вебхук, направленный туда,
+// позволил бы любому администратору подписок ходить запросами во внутренние сервисы.
+var ErrForbiddenAddress = errors.New("webhook address is not public")
+
+// Общий адресный диапазон провайдеров (RFC 6598), netip не считает его частным
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsPublicAddress сообщает, можно ли отправлять вебхуки на адрес addr.
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// newClient - клиент по умолчанию. Адрес проверяется при соединении, уже после DNS, поэтому
+// имя, которое резолвится во внутреннюю сеть, не обходит проверку. Редиректы не выполняются:
+// ответ 3xx считается неудачей, иначе получатель мог бы перенаправить запрос куда угодно.
+// control == nil отключает проверку адреса (тесты с httptest на loopback).
+func newClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Через прокси соединение шло бы к прокси, и проверять было бы нечего
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicAddressesOnly - net.Dialer.Control, который не дает соединиться с внутренним адресом.
+func publicAddressesOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	if !IsPublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"ecomm/domain"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Store - часть storer, которая нужна отправителю вебхуков.
+type Store interface {
+	EnqueueWebhookDeliveries(ctx context.Context, eventID int64, eventType string, body string) (int64, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error)
+	GetWebhookSubscription(ctx context.Context, id int64) (*domain.WebhookSubscription, error)
+	RecordWebhookAttempt(ctx context.Context, attempt *domain.WebhookAttempt, disableAfter int64) (bool, error)
+}
+
+// Policy задает повторы и отключение подписок.
+type Policy struct {
+	MaxAttempts  int64         // После стольких неудач доставка получает статус failed
+	BaseDelay    time.Duration // Пауза после первой неудачи, дальше она удваивается
+	MaxDelay     time.Duration
+	DisableAfter int64 // Столько неудачных попыток подряд по подписке - и она отключается
+}
+
+// DefaultPolicy растягивает попытки одной доставки примерно на сутки.
+var DefaultPolicy = Policy{
+	MaxAttempts:  10,
+	BaseDelay:    30 * time.Second,
+	MaxDelay:     6 * time.Hour,
+	DisableAfter: 50,
+}
+
+// Backoff возвращает паузу перед следующей попыткой после attempts неудачных.
+func (p Policy) Backoff(attempts int64) time.Duration {
+	delay := p.BaseDelay
+	for i := int64(1); i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+const (
+	DefaultBatchSize    = 20
+	DefaultPollInterval = 2 * time.Second
+	requestTimeout      = 10 * time.Second
+	// Доставка захватывается с запасом на все запросы пачки
+	claimLease = DefaultBatchSize*requestTimeout + time.Minute
+	// Сколько тела неудачного ответа сохранить в журнале для разбора ошибки
+	maxResponseBody = 256
+)
+
+// envelope - тело запроса к получателю.
+type envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Dispatcher раскладывает события из outbox по подпискам и отправляет их получателям.
+type Dispatcher struct {
+	store        Store
+	client       *http.Client
+	policy       Policy
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+// NewDispatcher создает отправителя. client == nil - клиент, который не ходит во внутреннюю сеть
+// и не следует редиректам; свой client должен обеспечивать то же самое.
+func NewDispatcher(store Store, client *http.Client, policy Policy) *Dispatcher {
+	if client == nil {
+		client = newClient(publicAddressesOnly)
+	}
+	return &Dispatcher{
+		store:        store,
+		client:       client,
+		policy:       policy,
+		pollInterval: DefaultPollInterval,
+		now:          time.Now,
+	}
+}
+
+// Enqueue создает доставки события для подходящих подписок. Подходит как обработчик
+// outbox.InProcessPublisher: сами запросы отправляет Run, чтобы медленный получатель
+// не задерживал публикацию остальных событий.
+func (d *Dispatcher) Enqueue(ctx context.Context, event *domain.OutboxEvent) error {
+	body, err := json.Marshal(envelope{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding webhook body for event %d: %w", event.ID, err)
+	}
+	_, err = d.store.EnqueueWebhookDeliveries(ctx, event.ID, event.Type, string(body))
+	return err
+}
+
+// DeliverDue отправляет пачку доставок, которым пора, и возвращает их число.
+// Ошибка базы по одной доставке не останавливает остальные: такая доставка пропускается
+// и будет захвачена снова, когда истечет аренда. Ошибки возвращаются вместе.
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, DefaultBatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	subscriptions := map[int64]*domain.WebhookSubscription{}
+	for _, delivery := range deliveries {
+		subscription, ok := subscriptions[delivery.SubscriptionID]
+		if !ok {
+			// nil запоминается, чтобы не спрашивать базу заново для каждой доставки подписки
+			subscription, err = d.store.GetWebhookSubscription(ctx, delivery.SubscriptionID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error getting webhook subscription %d: %w", delivery.SubscriptionID, err))
+			}
+			subscriptions[delivery.SubscriptionID] = subscription
+		}
+		// Подписку могла отключить неудача предыдущей доставки из этой же пачки
+		if subscription == nil || !subscription.Enabled {
+			continue
+		}
+
+		attempt := d.send(ctx, subscription, delivery)
+		disabled, err := d.store.RecordWebhookAttempt(ctx, attempt, d.policy.DisableAfter)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error recording webhook delivery %d: %w", delivery.ID, err))
+			continue
+		}
+		if disabled {
+			subscription.Enabled = false
+			log.Printf("webhooks: subscription %d (%s) disabled after %d failed deliveries in a row",
+				subscription.ID, subscription.URL, d.policy.DisableAfter)
+		}
+	}
+	return len(deliveries), errors.Join(errs...)
+}
+
+// send выполняет один запрос. Успех - любой ответ 2xx, тело сохраняется только у неудачного ответа.
+func (d *Dispatcher) send(ctx context.Context, subscription *domain.WebhookSubscription, delivery *domain.WebhookDelivery) *domain.WebhookAttempt {
+	attempt := &domain.WebhookAttempt{DeliveryID: delivery.ID}
+	fail := func(message string) *domain.WebhookAttempt {
+		attempt.Error = &message
+		if delivery.Attempts+1 < d.policy.MaxAttempts {
+			next := d.now().Add(d.policy.Backoff(delivery.Attempts + 1))
+			attempt.NextAttemptAt = &next
+		}
+		return attempt
+	}
+
+	body := []byte(delivery.Body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return fail(fmt.Sprintf("invalid request: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ecomm-webhooks/1.0")
+	req.Header.Set(EventIDHeader, fmt.Sprint(delivery.EventID))
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, d.now(), body))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return fail(err.Error())
+	}
+	defer res.Body.Close()
+
+	code := int64(res.StatusCode)
+	attempt.ResponseCode = &code
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		attempt.Succeeded = true
+		return attempt
+	}
+	if data, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBody)); err == nil && len(data) > 0 {
+		responseBody := string(data)
+		attempt.ResponseBody = &responseBody
+	}
+	return fail(fmt.Sprintf("unexpected status %d", res.StatusCode))
+}
+
+// Run отправляет доставки до отмены ctx. Полная пачка значит, что очередь, скорее всего,
+// не пуста, поэтому следующая забирается сразу.
+func (d *Dispatcher) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		wait := d.pollInterval
+		n, err := d.DeliverDue(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("webhooks: error delivering: %v", err)
+		} else if n == DefaultBatchSize {
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
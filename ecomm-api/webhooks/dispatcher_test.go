@@ -0,0 +1,371 @@
+package webhooks
+
+import (
+	"context"
+	"ecomm/domain"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore повторяет поведение storer для одного отправителя.
+type memoryStore struct {
+	now              time.Time
+	subscriptions    map[int64]*domain.WebhookSubscription
+	deliveries       []*domain.WebhookDelivery
+	subscriptionErrs map[int64]error
+}
+
+func (s *memoryStore) EnqueueWebhookDeliveries(ctx context.Context, eventID int64, eventType string, body string) (int64, error) {
+	var n int64
+	for id := int64(1); id <= int64(len(s.subscriptions)); id++ {
+		subscription := s.subscriptions[id]
+		if !subscription.Enabled || !slices.Contains(subscription.EventTypes, eventType) {
+			continue
+		}
+		s.deliveries = append(s.deliveries, &domain.WebhookDelivery{
+			ID:             int64(len(s.deliveries) + 1),
+			SubscriptionID: id,
+			EventID:        eventID,
+			EventType:      eventType,
+			Body:           body,
+			Status:         domain.WebhookDeliveryPending,
+			NextAttemptAt:  s.now,
+		})
+		n++
+	}
+	return n, nil
+}
+
+func (s *memoryStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*domain.WebhookDelivery, error) {
+	var claimed []*domain.WebhookDelivery
+	for _, d := range s.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if d.Status == domain.WebhookDeliveryPending && !d.NextAttemptAt.After(s.now) && s.subscriptions[d.SubscriptionID].Enabled {
+			d.NextAttemptAt = s.now.Add(lease)
+			copied := *d
+			claimed = append(claimed, &copied)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memoryStore) GetWebhookSubscription(ctx context.Context, id int64) (*domain.WebhookSubscription, error) {
+	if err := s.subscriptionErrs[id]; err != nil {
+		return nil, err
+	}
+	copied := *s.subscriptions[id]
+	return &copied, nil
+}
+
+func (s *memoryStore) RecordWebhookAttempt(ctx context.Context, attempt *domain.WebhookAttempt, disableAfter int64) (bool, error) {
+	d := s.deliveries[attempt.DeliveryID-1]
+	d.Attempts++
+	d.ResponseCode = attempt.ResponseCode
+	d.ResponseBody = attempt.ResponseBody
+	d.LastError = attempt.Error
+	subscription := s.subscriptions[d.SubscriptionID]
+	switch {
+	case attempt.Succeeded:
+		d.Status = domain.WebhookDeliverySucceeded
+		subscription.ConsecutiveFailures = 0
+		return false, nil
+	case attempt.NextAttemptAt != nil:
+		d.NextAttemptAt = *attempt.NextAttemptAt
+	default:
+		d.Status = domain.WebhookDeliveryFailed
+	}
+	subscription.ConsecutiveFailures++
+	if subscription.Enabled && subscription.ConsecutiveFailures >= disableAfter {
+		subscription.Enabled = false
+		return true, nil
+	}
+	return false, nil
+}
+
+// receiver - httptest-сервер партнера, который отвечает кодами из statuses по очереди.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rec := &receiver{statuses: statuses}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.requests = append(rec.requests, r)
+		rec.bodies = append(rec.bodies, body)
+		status := http.StatusOK
+		if len(rec.statuses) > 0 {
+			status, rec.statuses = rec.statuses[0], rec.statuses[1:]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("ack"))
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+func TestDispatcher(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, DisableAfter: 4}
+	event := &domain.OutboxEvent{ID: 42, Type: domain.EventOrderCreated, Payload: `{"order_id":7}`, CreatedAt: now}
+
+	setup := func(t *testing.T, urls ...string) (*memoryStore, *Dispatcher) {
+		store := &memoryStore{now: now, subscriptions: map[int64]*domain.WebhookSubscription{}}
+		for i, url := range urls {
+			store.subscriptions[int64(i+1)] = &domain.WebhookSubscription{
+				ID:         int64(i + 1),
+				URL:        url,
+				EventTypes: domain.WebhookEventTypes{domain.EventOrderCreated},
+				Secret:     "whsec_test_secret",
+				Enabled:    true,
+			}
+		}
+		// Получатели слушают loopback, поэтому проверка адреса отключена, см. "internal address is refused"
+		d := NewDispatcher(store, newClient(nil), policy)
+		d.now = func() time.Time { return store.now }
+		return store, d
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{
+			name: "signed delivery",
+			test: func(t *testing.T) {
+				rec := newReceiver(t)
+				store, d := setup(t, rec.URL)
+				require.NoError(t, d.Enqueue(context.Background(), event))
+				require.NoError(t, d.Enqueue(context.Background(), &domain.OutboxEvent{ID: 43, Type: domain.EventProductDeleted, Payload: `{}`}))
+
+				n, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, 1, n)
+
+				require.Len(t, rec.requests, 1)
+				req := rec.requests[0]
+				require.Equal(t, "42", req.Header.Get(EventIDHeader))
+				require.Equal(t, domain.EventOrderCreated, req.Header.Get(EventTypeHeader))
+				require.Equal(t, Sign("whsec_test_secret", now, rec.bodies[0]), req.Header.Get(SignatureHeader))
+
+				body := map[string]interface{}{}
+				require.NoError(t, json.Unmarshal(rec.bodies[0], &body))
+				require.Equal(t, float64(42), body["id"])
+				require.Equal(t, map[string]interface{}{"order_id": float64(7)}, body["data"])
+
+				require.Equal(t, domain.WebhookDeliverySucceeded, store.deliveries[0].Status)
+				require.Equal(t, int64(200), *store.deliveries[0].ResponseCode)
+			},
+		},
+		{
+			name: "failed delivery is retried with exponential backoff",
+			test: func(t *testing.T) {
+				rec := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+				store, d := setup(t, rec.URL)
+				require.NoError(t, d.Enqueue(context.Background(), event))
+				delivery := store.deliveries[0]
+
+				_, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, domain.WebhookDeliveryPending, delivery.Status)
+				require.Equal(t, now.Add(time.Minute), delivery.NextAttemptAt)
+				require.Equal(t, "unexpected status 500", *delivery.LastError)
+
+				// До следующей попытки доставка не отправляется
+				n, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Zero(t, n)
+
+				store.now = delivery.NextAttemptAt
+				_, err = d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, store.now.Add(2*time.Minute), delivery.NextAttemptAt)
+
+				// Третья неудача исчерпывает попытки
+				store.now = delivery.NextAttemptAt
+				_, err = d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Equal(t, domain.WebhookDeliveryFailed, delivery.Status)
+				require.Equal(t, int64(503), *delivery.ResponseCode)
+				require.Len(t, rec.requests, 3)
+			},
+		},
+		{
+			name: "unreachable endpoint",
+			test: func(t *testing.T) {
+				rec := newReceiver(t)
+				rec.Close()
+				store, d := setup(t, rec.URL)
+				require.NoError(t, d.Enqueue(context.Background(), event))
+
+				_, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Nil(t, store.deliveries[0].ResponseCode)
+				require.NotNil(t, store.deliveries[0].LastError)
+				require.Equal(t, domain.WebhookDeliveryPending, store.deliveries[0].Status)
+			},
+		},
+		{
+			name: "endpoint that keeps failing is disabled, others still get events",
+			test: func(t *testing.T) {
+				failing := newReceiver(t, 500, 500, 500, 500, 500)
+				healthy := newReceiver(t)
+				store, d := setup(t, failing.URL, healthy.URL)
+				for id := int64(1); id <= 5; id++ {
+					require.NoError(t, d.Enqueue(context.Background(), &domain.OutboxEvent{ID: id, Type: domain.EventOrderCreated, Payload: `{}`}))
+				}
+
+				_, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.False(t, store.subscriptions[1].Enabled)
+				require.Len(t, failing.requests, 4)
+				require.Len(t, healthy.requests, 5)
+
+				// Отключенной подписке больше ничего не отправляется
+				store.now = store.now.Add(time.Hour)
+				_, err = d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Len(t, failing.requests, 4)
+			},
+		},
+		{
+			name: "success resets the failure counter",
+			test: func(t *testing.T) {
+				rec := newReceiver(t, 500, 500, 200)
+				store, d := setup(t, rec.URL)
+				for id := int64(1); id <= 3; id++ {
+					require.NoError(t, d.Enqueue(context.Background(), &domain.OutboxEvent{ID: id, Type: domain.EventOrderCreated, Payload: `{}`}))
+				}
+
+				_, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.True(t, store.subscriptions[1].Enabled)
+				require.Zero(t, store.subscriptions[1].ConsecutiveFailures)
+			},
+		},
+		{
+			name: "internal address is refused",
+			test: func(t *testing.T) {
+				rec := newReceiver(t)
+				store, _ := setup(t, rec.URL)
+				d := NewDispatcher(store, nil, policy)
+				d.now = func() time.Time { return store.now }
+				require.NoError(t, d.Enqueue(context.Background(), event))
+
+				_, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Empty(t, rec.requests)
+				require.Contains(t, *store.deliveries[0].LastError, ErrForbiddenAddress.Error())
+			},
+		},
+		{
+			name: "redirect is not followed",
+			test: func(t *testing.T) {
+				target := newReceiver(t)
+				redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+				t.Cleanup(redirect.Close)
+				store, d := setup(t, redirect.URL)
+				require.NoError(t, d.Enqueue(context.Background(), event))
+
+				_, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Empty(t, target.requests)
+				require.Equal(t, int64(http.StatusFound), *store.deliveries[0].ResponseCode)
+				require.Equal(t, "unexpected status 302", *store.deliveries[0].LastError)
+			},
+		},
+		{
+			name: "only failed responses keep a truncated body",
+			test: func(t *testing.T) {
+				long := strings.Repeat("x", 2*maxResponseBody)
+				rec := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Header.Get(EventIDHeader) == "1" {
+						w.WriteHeader(http.StatusBadRequest)
+					}
+					w.Write([]byte(long))
+				}))
+				t.Cleanup(rec.Close)
+				store, d := setup(t, rec.URL)
+				for id := int64(1); id <= 2; id++ {
+					require.NoError(t, d.Enqueue(context.Background(), &domain.OutboxEvent{ID: id, Type: domain.EventOrderCreated, Payload: `{}`}))
+				}
+
+				_, err := d.DeliverDue(context.Background())
+				require.NoError(t, err)
+				require.Len(t, *store.deliveries[0].ResponseBody, maxResponseBody)
+				require.Nil(t, store.deliveries[1].ResponseBody)
+			},
+		},
+		{
+			name: "subscription lookup error skips only its deliveries",
+			test: func(t *testing.T) {
+				broken := newReceiver(t)
+				healthy := newReceiver(t)
+				store, d := setup(t, broken.URL, healthy.URL)
+				store.subscriptionErrs = map[int64]error{1: errors.New("connection reset")}
+				require.NoError(t, d.Enqueue(context.Background(), event))
+
+				n, err := d.DeliverDue(context.Background())
+				require.ErrorContains(t, err, "error getting webhook subscription 1: connection reset")
+				require.Equal(t, 2, n)
+				require.Empty(t, broken.requests)
+				require.Len(t, healthy.requests, 1)
+				// Доставка не тронута и будет захвачена снова после аренды
+				require.Equal(t, domain.WebhookDeliveryPending, store.deliveries[0].Status)
+				require.Zero(t, store.deliveries[0].Attempts)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, tc.test)
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:2800::1":    true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		require.Equal(t, public, IsPublicAddress(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{BaseDelay: 30 * time.Second, MaxDelay: 10 * time.Minute}
+	require.Equal(t, 30*time.Second, policy.Backoff(1))
+	require.Equal(t, time.Minute, policy.Backoff(2))
+	require.Equal(t, 8*time.Minute, policy.Backoff(5))
+	require.Equal(t, 10*time.Minute, policy.Backoff(6))
+	require.Equal(t, 10*time.Minute, policy.Backoff(60))
+}
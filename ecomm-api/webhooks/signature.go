@@ -0,0 +1,28 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Заголовки исходящего запроса. SignatureHeader устроен так же, как у платежного шлюза:
+// "t=<unix time>,v1=<hex hmac-sha256>", подпись считается от строки "<t>.<тело запроса>".
+const (
+	SignatureHeader = "Webhook-Signature"
+	EventIDHeader   = "Webhook-Event-Id" // Одинаковый у повторов одного события - по нему получатель отсекает дубликаты
+	EventTypeHeader = "Webhook-Event-Type"
+)
+
+// Sign формирует значение заголовка SignatureHeader.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
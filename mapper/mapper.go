@@ -2,20 +2,33 @@ package mapper
 
 import (
 	"ecomm/domain"
+	categoryDto "ecomm/ecomm-api/handler/dto/category"
+	jobDto "ecomm/ecomm-api/handler/dto/job"
 	orderDto "ecomm/ecomm-api/handler/dto/order"
+	outboxDto "ecomm/ecomm-api/handler/dto/outbox"
 	productDto "ecomm/ecomm-api/handler/dto/product"
+	returnDto "ecomm/ecomm-api/handler/dto/returns"
+	reviewDto "ecomm/ecomm-api/handler/dto/review"
+	userDto "ecomm/ecomm-api/handler/dto/user"
+	webhookDto "ecomm/ecomm-api/handler/dto/webhook"
+	"encoding/json"
+	"fmt"
+	"strings"
 )
 
 func MapToProductRes(product *domain.Product) productDto.ProductRes {
 	return productDto.ProductRes{
 		ID:           product.ID,
+		SKU:          product.SKU,
 		Name:         product.Name,
 		Image:        product.Image,
-		Category:     product.Category,
+		CategoryID:   product.CategoryID,
 		Description:  product.Description,
 		Rating:       product.Rating,
+		NumReviews:   product.NumReviews,
 		Price:        product.Price,
 		CountInStock: product.CountInStock,
+		Version:      product.Version,
 		CreatedAt:    product.CreatedAt,
 		UpdatedAt:    product.UpdatedAt,
 	}
@@ -23,12 +36,11 @@ func MapToProductRes(product *domain.Product) productDto.ProductRes {
 
 func MapToProductFromCreateProductReq(productReq *productDto.CreateProductReq) *domain.Product {
 	return &domain.Product{
+		SKU:          MapToSKU(productReq.SKU),
 		Name:         productReq.Name,
 		Image:        productReq.Image,
-		Category:     productReq.Category,
+		CategoryID:   productReq.CategoryID,
 		Description:  productReq.Description,
-		Rating:       productReq.Rating,
-		NumReviews:   productReq.NumReviews,
 		Price:        productReq.Price,
 		CountInStock: productReq.CountInStock,
 	}
@@ -36,17 +48,89 @@ func MapToProductFromCreateProductReq(productReq *productDto.CreateProductReq) *
 
 func MapToProductFromUpdateProductReq(productReq *productDto.UpdateProductReq) *domain.Product {
 	return &domain.Product{
+		SKU:          MapToSKU(productReq.SKU),
 		Name:         productReq.Name,
 		Image:        productReq.Image,
-		Category:     productReq.Category,
+		CategoryID:   productReq.CategoryID,
 		Description:  productReq.Description,
-		Rating:       productReq.Rating,
-		NumReviews:   productReq.NumReviews,
 		Price:        productReq.Price,
 		CountInStock: productReq.CountInStock,
 	}
 }
 
+// ApplyPatchProductReq переносит в product только присланные поля патча.
+func ApplyPatchProductReq(product *domain.Product, patch *productDto.PatchProductReq) {
+	if patch.SKU != nil {
+		product.SKU = MapToSKU(*patch.SKU)
+	}
+	if patch.Name != nil {
+		product.Name = *patch.Name
+	}
+	if patch.Image != nil {
+		product.Image = *patch.Image
+	}
+	if patch.CategoryID != nil {
+		product.CategoryID = *patch.CategoryID
+	}
+	if patch.Description != nil {
+		product.Description = *patch.Description
+	}
+	if patch.Price != nil {
+		product.Price = *patch.Price
+	}
+	if patch.CountInStock != nil {
+		product.CountInStock = *patch.CountInStock
+	}
+}
+
+// MapToProductChangesFromPatchProductReq возвращает присланные поля патча по именам колонок.
+func MapToProductChangesFromPatchProductReq(patch *productDto.PatchProductReq) map[string]interface{} {
+	changes := map[string]interface{}{}
+	if patch.SKU != nil {
+		changes["sku"] = MapToSKU(*patch.SKU)
+	}
+	if patch.Name != nil {
+		changes["name"] = *patch.Name
+	}
+	if patch.Image != nil {
+		changes["image"] = *patch.Image
+	}
+	if patch.CategoryID != nil {
+		changes["category_id"] = *patch.CategoryID
+	}
+	if patch.Description != nil {
+		changes["description"] = *patch.Description
+	}
+	if patch.Price != nil {
+		changes["price"] = *patch.Price
+	}
+	if patch.CountInStock != nil {
+		changes["count_in_stock"] = *patch.CountInStock
+	}
+	return changes
+}
+
+func MapToProductFromImportProductRow(row *productDto.ImportProductRow, categoryID int64) *domain.Product {
+	return &domain.Product{
+		SKU:          MapToSKU(row.SKU),
+		Name:         strings.TrimSpace(row.Name),
+		Image:        strings.TrimSpace(row.Image),
+		CategoryID:   categoryID,
+		Description:  row.Description,
+		Price:        row.Price,
+		CountInStock: row.CountInStock,
+	}
+}
+
+// MapToSKU - артикул без пробелов по краям, пустой артикул хранится как NULL.
+func MapToSKU(sku string) *string {
+	sku = strings.TrimSpace(sku)
+	if sku == "" {
+		return nil
+	}
+	return &sku
+}
+
 func MapToProductResList(products []*domain.Product) []productDto.ProductRes {
 	productResList := make([]productDto.ProductRes, 0)
 
@@ -75,10 +159,29 @@ func MapToOrderFromCreateOrderReq(orderReq *orderDto.CreateOrderReq) *domain.Ord
 func mapToOrderItemFromOrderItemReq(orderItemReq orderDto.CreateOrderItemReq) domain.OrderItem {
 	return domain.OrderItem{
 		ProductID: orderItemReq.ProductID,
+		VariantID: orderItemReq.VariantID,
 		Quantity:  orderItemReq.Quantity,
 	}
 }
 
+// MapToOrderItemFromProductVariant - позиция заказа по варианту: цена и остаток берутся у варианта,
+// а в названии к имени товара добавляется SKU, чтобы в истории заказа было видно, что купили.
+func MapToOrderItemFromProductVariant(product *domain.Product, variant *domain.ProductVariant, quantity int64) domain.OrderItem {
+	image := variant.Image
+	if image == "" {
+		image = product.Image
+	}
+	variantID := variant.ID
+	return domain.OrderItem{
+		Name:      fmt.Sprintf("%s (%s)", product.Name, variant.SKU),
+		Quantity:  quantity,
+		Image:     image,
+		Price:     variant.Price,
+		ProductID: product.ID,
+		VariantID: &variantID,
+	}
+}
+
 func mapToOrderItemResFromOrderItem(orderItem domain.OrderItem) orderDto.OrderItemRes {
 	return orderDto.OrderItemRes{
 		ID:        orderItem.ID,
@@ -87,10 +190,54 @@ func mapToOrderItemResFromOrderItem(orderItem domain.OrderItem) orderDto.OrderIt
 		Image:     orderItem.Image,
 		Price:     orderItem.Price,
 		ProductID: orderItem.ProductID,
+		VariantID: orderItem.VariantID,
 		OrderID:   orderItem.OrderID,
 	}
 }
 
+func mapToPaymentRes(payment *domain.Payment) *orderDto.PaymentRes {
+	if payment == nil {
+		return nil
+	}
+
+	return &orderDto.PaymentRes{
+		ID:              payment.ID,
+		Provider:        payment.Provider,
+		Method:          payment.Method,
+		Status:          payment.Status,
+		Amount:          payment.Amount,
+		CapturedAmount:  payment.CapturedAmount,
+		RefundedAmount:  payment.RefundedAmount,
+		AuthorizationID: payment.AuthorizationID,
+		CreatedAt:       payment.CreatedAt,
+		UpdatedAt:       payment.UpdatedAt,
+	}
+}
+
+func MapToOrderResList(orders []*domain.Order) []orderDto.OrderRes {
+	orderResList := make([]orderDto.OrderRes, 0, len(orders))
+
+	for _, order := range orders {
+		orderResList = append(orderResList, MapToOrderRes(order))
+	}
+
+	return orderResList
+}
+
+func MapToRefundRes(refund *domain.Refund) orderDto.RefundRes {
+	return orderDto.RefundRes{
+		ID:               refund.ID,
+		OrderID:          refund.OrderID,
+		PaymentID:        refund.PaymentID,
+		ReturnID:         refund.ReturnID,
+		Amount:           refund.Amount,
+		Reason:           refund.Reason,
+		ProviderRefundID: refund.ProviderRefundID,
+		Status:           refund.Status,
+		CreatedAt:        refund.CreatedAt,
+	}
+}
+
 func MapToOrderRes(order *domain.Order) orderDto.OrderRes {
 	var orderItemsRes []orderDto.OrderItemRes
 
@@ -99,14 +246,276 @@ func MapToOrderRes(order *domain.Order) orderDto.OrderRes {
 		orderItemsRes = append(orderItemsRes, orderItemRes)
 	}
 
+	var refundsRes []orderDto.RefundRes
+
+	for i := range order.Refunds {
+		refundsRes = append(refundsRes, MapToRefundRes(&order.Refunds[i]))
+	}
+
 	return orderDto.OrderRes{
-		ID:            order.ID,
-		PaymentMethod: order.PaymentMethod,
-		TaxPrice:      order.TaxPrice,
-		ShippingPrice: order.ShippingPrice,
-		TotalPrice:    order.TotalPrice,
-		Items:         orderItemsRes,
-		CreatedAt:     order.CreatedAt,
-		UpdatedAt:     order.UpdatedAt,
+		ID:                 order.ID,
+		UserID:             order.UserID,
+		PaymentMethod:      order.PaymentMethod,
+		Status:             order.Status,
+		TaxPrice:           order.TaxPrice,
+		ShippingPrice:      order.ShippingPrice,
+		TotalPrice:         order.TotalPrice,
+		RefundedPrice:      order.RefundedPrice,
+		Items:              orderItemsRes,
+		Payment:            mapToPaymentRes(order.Payment),
+		Refunds:            refundsRes,
+		CancellationReason: order.CancellationReason,
+		CancelledAt:        order.CancelledAt,
+		TrackingNumber:     order.TrackingNumber,
+		ShippedAt:          order.ShippedAt,
+		CreatedAt:          order.CreatedAt,
+		UpdatedAt:          order.UpdatedAt,
+	}
+}
+
+func MapToUserRes(user *domain.User) userDto.UserRes {
+	return userDto.UserRes{
+		ID:      user.ID,
+		Name:    user.Name,
+		Email:   user.Email,
+		IsAdmin: user.IsAdmin,
+	}
+}
+
+func MapToReturnRes(ret *domain.Return) returnDto.ReturnRes {
+	return returnDto.ReturnRes{
+		ID:          ret.ID,
+		OrderID:     ret.OrderID,
+		OrderItemID: ret.OrderItemID,
+		Quantity:    ret.Quantity,
+		Reason:      ret.Reason,
+		Status:      ret.Status,
+		AdminNote:   ret.AdminNote,
+		CreatedAt:   ret.CreatedAt,
+		UpdatedAt:   ret.UpdatedAt,
+	}
+}
+
+func MapToReturnResList(returns []*domain.Return) []returnDto.ReturnRes {
+	returnResList := make([]returnDto.ReturnRes, 0, len(returns))
+
+	for _, ret := range returns {
+		returnResList = append(returnResList, MapToReturnRes(ret))
+	}
+
+	return returnResList
+}
+
+func MapToCategoryRes(category *domain.Category) categoryDto.CategoryRes {
+	return categoryDto.CategoryRes{
+		ID:        category.ID,
+		ParentID:  category.ParentID,
+		Name:      category.Name,
+		Slug:      category.Slug,
+		CreatedAt: category.CreatedAt,
+		UpdatedAt: category.UpdatedAt,
+	}
+}
+
+func MapToCategoryResList(categories []*domain.Category) []categoryDto.CategoryRes {
+	categoryResList := make([]categoryDto.CategoryRes, 0, len(categories))
+	for _, category := range categories {
+		categoryResList = append(categoryResList, MapToCategoryRes(category))
+	}
+	return categoryResList
+}
+
+func MapToProductOptionRes(option *domain.ProductOption) productDto.ProductOptionRes {
+	return productDto.ProductOptionRes{
+		ID:        option.ID,
+		ProductID: option.ProductID,
+		Name:      option.Name,
+		Values:    option.Values,
+		CreatedAt: option.CreatedAt,
+	}
+}
+
+func MapToProductOptionResList(options []*domain.ProductOption) []productDto.ProductOptionRes {
+	optionResList := make([]productDto.ProductOptionRes, 0, len(options))
+	for _, option := range options {
+		optionResList = append(optionResList, MapToProductOptionRes(option))
+	}
+	return optionResList
+}
+
+func MapToProductVariantFromCreateProductVariantReq(productID int64, variantReq *productDto.CreateProductVariantReq) *domain.ProductVariant {
+	return &domain.ProductVariant{
+		ProductID:    productID,
+		SKU:          variantReq.SKU,
+		Options:      variantReq.Options,
+		Price:        variantReq.Price,
+		CountInStock: variantReq.CountInStock,
+		Image:        variantReq.Image,
+	}
+}
+
+func MapToProductVariantRes(variant *domain.ProductVariant) productDto.ProductVariantRes {
+	return productDto.ProductVariantRes{
+		ID:           variant.ID,
+		ProductID:    variant.ProductID,
+		SKU:          variant.SKU,
+		Options:      variant.Options,
+		Price:        variant.Price,
+		CountInStock: variant.CountInStock,
+		Image:        variant.Image,
+		CreatedAt:    variant.CreatedAt,
+		UpdatedAt:    variant.UpdatedAt,
+	}
+}
+
+func MapToProductVariantResList(variants []*domain.ProductVariant) []productDto.ProductVariantRes {
+	variantResList := make([]productDto.ProductVariantRes, 0, len(variants))
+	for _, variant := range variants {
+		variantResList = append(variantResList, MapToProductVariantRes(variant))
+	}
+	return variantResList
+}
+
+func MapToReviewRes(review *domain.Review) reviewDto.ReviewRes {
+	return reviewDto.ReviewRes{
+		ID:        review.ID,
+		ProductID: review.ProductID,
+		UserID:    review.UserID,
+		Rating:    review.Rating,
+		Comment:   review.Comment,
+		Status:    review.Status,
+		CreatedAt: review.CreatedAt,
+		UpdatedAt: review.UpdatedAt,
+	}
+}
+
+func MapToReviewResList(reviews []*domain.Review) []reviewDto.ReviewRes {
+	reviewResList := make([]reviewDto.ReviewRes, 0, len(reviews))
+	for _, review := range reviews {
+		reviewResList = append(reviewResList, MapToReviewRes(review))
+	}
+	return reviewResList
+}
+
+// MapToWebhookSubscriptionRes не переносит секрет: его показывают только при создании.
+func MapToWebhookSubscriptionRes(s *domain.WebhookSubscription) webhookDto.WebhookSubscriptionRes {
+	return webhookDto.WebhookSubscriptionRes{
+		ID:                  s.ID,
+		URL:                 s.URL,
+		EventTypes:          s.EventTypes,
+		Enabled:             s.Enabled,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		DisabledAt:          s.DisabledAt,
+		CreatedAt:           s.CreatedAt,
+		UpdatedAt:           s.UpdatedAt,
+	}
+}
+
+func MapToWebhookSubscriptionResList(subscriptions []*domain.WebhookSubscription) []webhookDto.WebhookSubscriptionRes {
+	subscriptionResList := make([]webhookDto.WebhookSubscriptionRes, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		subscriptionResList = append(subscriptionResList, MapToWebhookSubscriptionRes(s))
+	}
+	return subscriptionResList
+}
+
+func MapToWebhookDeliveryRes(d *domain.WebhookDelivery) webhookDto.WebhookDeliveryRes {
+	res := webhookDto.WebhookDeliveryRes{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		ResponseCode:   d.ResponseCode,
+		ResponseBody:   d.ResponseBody,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt,
+		DeliveredAt:    d.DeliveredAt,
+	}
+	if d.Status == domain.WebhookDeliveryPending {
+		next := d.NextAttemptAt
+		res.NextAttemptAt = &next
+	}
+	return res
+}
+
+func MapToWebhookDeliveryResList(deliveries []*domain.WebhookDelivery) []webhookDto.WebhookDeliveryRes {
+	deliveryResList := make([]webhookDto.WebhookDeliveryRes, 0, len(deliveries))
+	for _, d := range deliveries {
+		deliveryResList = append(deliveryResList, MapToWebhookDeliveryRes(d))
+	}
+	return deliveryResList
+}
+
+func MapToJobRes(job *domain.Job) jobDto.JobRes {
+	return jobDto.JobRes{
+		ID:          job.ID,
+		Type:        job.Type,
+		Payload:     json.RawMessage(job.Payload),
+		Status:      job.Status,
+		Attempts:    job.Attempts,
+		MaxAttempts: job.MaxAttempts,
+		RunAt:       job.RunAt,
+		LastError:   job.LastError,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+		FinishedAt:  job.FinishedAt,
+	}
+}
+
+func MapToJobResList(jobs []*domain.Job) []jobDto.JobRes {
+	jobResList := make([]jobDto.JobRes, 0, len(jobs))
+	for _, job := range jobs {
+		jobResList = append(jobResList, MapToJobRes(job))
+	}
+	return jobResList
+}
+
+func MapToOutboxEventRes(event *domain.OutboxEvent) outboxDto.OutboxEventRes {
+	return outboxDto.OutboxEventRes{
+		ID:            event.ID,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		Type:          event.Type,
+		Payload:       json.RawMessage(event.Payload),
+		Attempts:      event.Attempts,
+		LastError:     event.LastError,
+		CreatedAt:     event.CreatedAt,
+		DeadAt:        event.DeadAt,
+	}
+}
+
+func MapToOutboxEventResList(events []*domain.OutboxEvent) []outboxDto.OutboxEventRes {
+	eventResList := make([]outboxDto.OutboxEventRes, 0, len(events))
+	for _, event := range events {
+		eventResList = append(eventResList, MapToOutboxEventRes(event))
+	}
+	return eventResList
+}
+
+// ImagesPath - префикс, по которому API отдает файлы из BlobStore.
+const ImagesPath = "/images/"
+
+func MapToProductImageRes(img *domain.ProductImage) productDto.ProductImageRes {
+	return productDto.ProductImageRes{
+		ID:           img.ID,
+		ProductID:    img.ProductID,
+		Position:     img.Position,
+		URL:          ImagesPath + img.BlobKey,
+		ThumbnailURL: ImagesPath + img.ThumbnailKey,
+		ContentType:  img.ContentType,
+		Size:         img.Size,
+		Width:        img.Width,
+		Height:       img.Height,
+		CreatedAt:    img.CreatedAt,
+	}
+}
+
+func MapToProductImageResList(images []*domain.ProductImage) []productDto.ProductImageRes {
+	imageResList := make([]productDto.ProductImageRes, 0, len(images))
+	for _, img := range images {
+		imageResList = append(imageResList, MapToProductImageRes(img))
 	}
+	return imageResList
 }